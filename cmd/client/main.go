@@ -7,6 +7,10 @@
 // Run command:
 //
 //	go run main.go
+//
+// Serve the ssh keys of the vault over the ssh-agent protocol:
+//
+//	go run main.go [-socket path] agent
 package main
 
 import (
@@ -16,7 +20,6 @@ import (
 	"github.com/EgorKo25/GophKeeper/internal/client"
 	"github.com/EgorKo25/GophKeeper/internal/config"
 	"github.com/EgorKo25/GophKeeper/internal/dialog"
-	"github.com/EgorKo25/GophKeeper/pkg/mycrypto"
 )
 
 var (
@@ -34,14 +37,19 @@ func main() {
 		log.Fatal(err)
 	}
 
-	enc, err := mycrypto.NewCrypto(cfg.Secret)
+	device, err := client.DeviceID()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	c := client.NewClient(cfg.AddrServ)
+	c := client.NewClient(cfg.AddrServ, device)
 
-	dial := dialog.NewManager(c, enc)
+	dial := dialog.NewManager(c, cfg.Secret)
+
+	if cfg.Command == "agent" {
+		log.Println(dial.ServeAgent(cfg.SSHSocket))
+		return
+	}
 
 	log.Println(dial.Run())
 
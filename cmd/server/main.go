@@ -7,15 +7,23 @@
 // Run command:
 //
 //	go run main.go
+//
+// Migrate command, the flags go before the command:
+//
+//	go run . [flags] migrate [up [version] | down [steps] | status]
 package main
 
 import (
+	"context"
+	"flag"
 	"log"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/EgorKo25/GophKeeper/pkg/auth"
 
+	"github.com/EgorKo25/GophKeeper/internal/blob"
 	"github.com/EgorKo25/GophKeeper/internal/config"
 	"github.com/EgorKo25/GophKeeper/internal/database"
 	"github.com/EgorKo25/GophKeeper/internal/server/handlers"
@@ -38,18 +46,51 @@ func main() {
 		log.Fatalf("config create error: %s", err)
 	}
 
-	db, err := database.NewManagerDB(cfg.DB)
+	if flag.Arg(0) == "migrate" {
+		os.Exit(migrate(cfg.DB, flag.Args()[1:]))
+	}
+
+	db, err := database.NewManagerDB(cfg.DB, cfg.AutoMigrate)
 	if err != nil {
 		log.Fatalf("database constructor error: %s", err)
 	}
 
-	authentication := auth.NewAuth(cfg.RefreshToken)
+	if cfg.AccessToken == cfg.RefreshToken {
+		log.Fatal("access and refresh token secrets must differ")
+	}
+
+	authentication := auth.NewAuth(cfg.AccessToken, cfg.RefreshToken)
+
+	middle := mymiddleware.NewMyMiddleware(authentication)
+
+	var blobs blob.BlobStore
+
+	switch cfg.BlobStore {
+	case "s3":
+		blobs, err = blob.NewS3Store(cfg.S3Endpoint, cfg.S3Bucket, cfg.S3Region, cfg.S3AccessKey, cfg.S3SecretKey)
+	case "fs":
+		blobs, err = blob.NewFileStore(cfg.BlobDir)
+	default:
+		log.Fatalf("unknown blob store: %s", cfg.BlobStore)
+	}
+	if err != nil {
+		log.Fatalf("blob store constructor error: %s", err)
+	}
+
+	// the files stored in the database before the blob store are readable only from it
+	moved, err := db.MoveInlineFiles(context.Background(), blobs)
+	if err != nil {
+		log.Fatalf("moving files into the blob store error: %s", err)
+	}
+	if moved > 0 {
+		log.Printf("files moved into the blob store: %d", moved)
+	}
 
-	middle := mymiddleware.NewMyMiddleware(authentication, db)
+	go blob.NewCollector(blobs, db, cfg.UploadTTL).Run(context.Background(), cfg.GCInterval)
 
-	handler := handlers.NewHandler(db, authentication)
+	handler := handlers.NewHandler(db, authentication, blobs, cfg.MaxBlobSize, cfg.MaxChunkSize)
 
-	router := myrouter.NewRouter(handler, middle)
+	router := myrouter.NewRouter(handler, middle, cfg.MaxBodySize)
 
 	log.Println(http.ListenAndServe(cfg.Addr, router))
 }
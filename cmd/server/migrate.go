@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/EgorKo25/GophKeeper/internal/database"
+)
+
+// migrate runs the migrate command: up [version], down [steps] or status.
+// It returns the exit code
+func migrate(address string, args []string) int {
+
+	ctx := context.Background()
+
+	command, n := "up", 0
+	if len(args) > 0 {
+		command = args[0]
+	}
+	if command == "down" {
+		n = 1
+	}
+	if len(args) > 1 {
+		var err error
+		n, err = strconv.Atoi(args[1])
+		if err != nil || n < 0 {
+			log.Printf("invalid number: %s", args[1])
+			return 2
+		}
+	}
+	if len(args) > 2 {
+		log.Print("usage: migrate [up [version] | down [steps] | status]")
+		return 2
+	}
+
+	db, err := database.Connect(address)
+	if err != nil {
+		log.Printf("database connection error: %s", err)
+		return 1
+	}
+	defer db.Close()
+
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		log.Printf("migrations load error: %s", err)
+		return 1
+	}
+
+	switch command {
+	case "up":
+		applied, err := migrator.Up(ctx, n)
+		for _, m := range applied {
+			fmt.Printf("applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Printf("migrate up error: %s", err)
+			return 1
+		}
+	case "down":
+		rolledBack, err := migrator.Down(ctx, n)
+		for _, m := range rolledBack {
+			fmt.Printf("rolled back %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Printf("migrate down error: %s", err)
+			return 1
+		}
+	case "status":
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			log.Printf("migrate status error: %s", err)
+			return 1
+		}
+		for _, m := range status {
+			applied := "pending"
+			if m.Applied {
+				applied = m.AppliedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Printf("%04d_%-20s %s\n", m.Version, m.Name, applied)
+		}
+	default:
+		log.Print("usage: migrate [up [version] | down [steps] | status]")
+		return 2
+	}
+
+	return 0
+}
@@ -0,0 +1,201 @@
+// Package blob is a package for storing the chunks of large files outside the database
+package blob
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+)
+
+var (
+	ErrInvalidKey = errors.New("invalid blob key")
+	ErrNotFound   = errors.New("chunk not found")
+)
+
+// keyPattern limits the keys to the ids the database generates,
+// so a key never leaves the store directory
+var keyPattern = regexp.MustCompile(`^[0-9A-Za-z-]{1,64}$`)
+
+// BlobStore is an interface for storing the chunks of files.
+// A blob is addressed by its key, its chunks by their numbers
+type BlobStore interface {
+	Put(key string, n int, r io.Reader) (int64, error)
+	Get(key string, n int) (io.ReadCloser, int64, error)
+	Chunks(key string) (map[int]int64, error)
+	Remove(key string) error
+	RemoveChunk(key string, n int) error
+	Keys() ([]string, error)
+}
+
+// ChunkRef addresses the n-th chunk of the blob
+type ChunkRef struct {
+	Key string `db:"blob_key"`
+	N   int    `db:"blob_n"`
+}
+
+// FileStore keeps the chunks of every blob in its own directory
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore is a constructor, the directory is created if it doesn't exist
+func NewFileStore(dir string) (*FileStore, error) {
+
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileStore{dir: dir}, nil
+}
+
+// Put stores the n-th chunk of the blob and returns its size.
+// The chunk is replaced atomically, so a repeated upload of a chunk is safe
+func (s *FileStore) Put(key string, n int, r io.Reader) (int64, error) {
+
+	dir, err := s.blobDir(key)
+	if err != nil {
+		return 0, err
+	}
+
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return 0, err
+	}
+
+	tmp, err := os.CreateTemp(dir, "chunk-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		return 0, err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	return size, os.Rename(tmp.Name(), filepath.Join(dir, strconv.Itoa(n)))
+}
+
+// Get opens the n-th chunk of the blob
+func (s *FileStore) Get(key string, n int) (io.ReadCloser, int64, error) {
+
+	dir, err := s.blobDir(key)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	f, err := os.Open(filepath.Join(dir, strconv.Itoa(n)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, 0, ErrNotFound
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+
+	return f, info.Size(), nil
+}
+
+// Chunks returns the sizes of the stored chunks of the blob by their numbers
+func (s *FileStore) Chunks(key string) (map[int]int64, error) {
+
+	dir, err := s.blobDir(key)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[int]int64{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	chunks := make(map[int]int64, len(entries))
+	for _, entry := range entries {
+		n, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			// an unfinished write
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+
+		chunks[n] = info.Size()
+	}
+
+	return chunks, nil
+}
+
+// Remove deletes all chunks of the blob
+func (s *FileStore) Remove(key string) error {
+
+	dir, err := s.blobDir(key)
+	if err != nil {
+		return err
+	}
+
+	return os.RemoveAll(dir)
+}
+
+// RemoveChunk deletes the n-th chunk of the blob, a missing chunk is not an error
+func (s *FileStore) RemoveChunk(key string, n int) error {
+
+	dir, err := s.blobDir(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(filepath.Join(dir, strconv.Itoa(n)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+// Keys returns the keys of all stored blobs
+func (s *FileStore) Keys() ([]string, error) {
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() && keyPattern.MatchString(entry.Name()) {
+			keys = append(keys, entry.Name())
+		}
+	}
+
+	return keys, nil
+}
+
+// blobDir returns the directory of the blob chunks
+func (s *FileStore) blobDir(key string) (string, error) {
+	if !keyPattern.MatchString(key) {
+		return "", ErrInvalidKey
+	}
+
+	return filepath.Join(s.dir, key), nil
+}
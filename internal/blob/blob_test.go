@@ -0,0 +1,66 @@
+package blob
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStore(t *testing.T) {
+	s, err := NewFileStore(t.TempDir())
+	require.NoError(t, err)
+
+	const key = "0b7e5a44-6f6d-4c1e-9d55-1f1f0c3a8e21"
+
+	chunks, err := s.Chunks(key)
+	require.NoError(t, err)
+	assert.Empty(t, chunks)
+
+	size, err := s.Put(key, 1, strings.NewReader("second"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), size)
+
+	_, err = s.Put(key, 0, strings.NewReader("first, sent twice"))
+	require.NoError(t, err)
+
+	_, err = s.Put(key, 0, strings.NewReader("first"))
+	require.NoError(t, err)
+
+	chunks, err = s.Chunks(key)
+	require.NoError(t, err)
+	assert.Equal(t, map[int]int64{0: 5, 1: 6}, chunks)
+
+	keys, err := s.Keys()
+	require.NoError(t, err)
+	assert.Equal(t, []string{key}, keys)
+
+	r, size, err := s.Get(key, 0)
+	require.NoError(t, err)
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	assert.Equal(t, "first", string(data))
+	assert.Equal(t, int64(5), size)
+
+	_, _, err = s.Get(key, 2)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, s.RemoveChunk(key, 1))
+	require.NoError(t, s.RemoveChunk(key, 1), "a missing chunk")
+
+	chunks, err = s.Chunks(key)
+	require.NoError(t, err)
+	assert.Equal(t, map[int]int64{0: 5}, chunks)
+
+	require.NoError(t, s.Remove(key))
+
+	chunks, err = s.Chunks(key)
+	require.NoError(t, err)
+	assert.Empty(t, chunks)
+
+	_, err = s.Put("../escape", 0, strings.NewReader("data"))
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
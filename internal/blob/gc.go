@@ -0,0 +1,119 @@
+package blob
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// References is an interface for the database of the blob keys in use
+type References interface {
+	// BlobKeys returns the keys of the blobs of the stored files and of the unfinished uploads
+	BlobKeys(ctx context.Context) ([]string, error)
+	// ExpireUploads deletes the uploads started before the time and returns their keys
+	ExpireUploads(ctx context.Context, before time.Time) ([]string, error)
+	// ReleaseChunks deletes the chunks no file refers to and returns where they are kept
+	ReleaseChunks(ctx context.Context) ([]ChunkRef, error)
+}
+
+// Collector removes the blobs nothing refers to: the chunks of abandoned uploads,
+// the chunks of deleted files and the blobs left behind by a failed removal
+type Collector struct {
+	store     BlobStore
+	refs      References
+	uploadTTL time.Duration
+}
+
+// NewCollector is a constructor, an upload is abandoned when it isn't completed within uploadTTL
+func NewCollector(store BlobStore, refs References, uploadTTL time.Duration) *Collector {
+	return &Collector{
+		store:     store,
+		refs:      refs,
+		uploadTTL: uploadTTL,
+	}
+}
+
+// Collect removes the released chunks, expires the abandoned uploads and removes the orphaned blobs,
+// it returns the number of removed chunks and blobs.
+// The stored keys are listed before the references are read: a blob is always created after its reference,
+// so a listed blob without a reference is never in use
+func (c *Collector) Collect(ctx context.Context) (int, error) {
+
+	released, err := c.refs.ReleaseChunks(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, chunk := range released {
+		err = c.store.RemoveChunk(chunk.Key, chunk.N)
+		if err != nil {
+			return removed, err
+		}
+		removed++
+	}
+
+	expired, err := c.refs.ExpireUploads(ctx, time.Now().Add(-c.uploadTTL))
+	if err != nil {
+		return removed, err
+	}
+
+	for _, key := range expired {
+		err = c.store.Remove(key)
+		if err != nil {
+			return removed, err
+		}
+		removed++
+	}
+
+	keys, err := c.store.Keys()
+	if err != nil {
+		return removed, err
+	}
+
+	refs, err := c.refs.BlobKeys(ctx)
+	if err != nil {
+		return removed, err
+	}
+
+	used := make(map[string]bool, len(refs))
+	for _, key := range refs {
+		used[key] = true
+	}
+
+	for _, key := range keys {
+		if used[key] {
+			continue
+		}
+
+		err = c.store.Remove(key)
+		if err != nil {
+			return removed, err
+		}
+		removed++
+	}
+
+	return removed, nil
+}
+
+// Run collects the garbage every interval until the context is done
+func (c *Collector) Run(ctx context.Context, interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		removed, err := c.Collect(ctx)
+		if err != nil {
+			log.Printf("blob gc error: %s", err)
+		} else if removed > 0 {
+			log.Printf("blob gc: %d blobs removed", removed)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
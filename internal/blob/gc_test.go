@@ -0,0 +1,84 @@
+package blob
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRefs is a database of the blob keys
+type fakeRefs struct {
+	files    []string
+	uploads  map[string]time.Time
+	released []ChunkRef
+}
+
+func (f *fakeRefs) BlobKeys(_ context.Context) ([]string, error) {
+	keys := append([]string{}, f.files...)
+	for key := range f.uploads {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (f *fakeRefs) ExpireUploads(_ context.Context, before time.Time) ([]string, error) {
+	var expired []string
+	for key, created := range f.uploads {
+		if created.Before(before) {
+			expired = append(expired, key)
+			delete(f.uploads, key)
+		}
+	}
+	return expired, nil
+}
+
+func (f *fakeRefs) ReleaseChunks(_ context.Context) ([]ChunkRef, error) {
+	released := f.released
+	f.released = nil
+	return released, nil
+}
+
+func TestCollector_Collect(t *testing.T) {
+	s, err := NewFileStore(t.TempDir())
+	require.NoError(t, err)
+
+	const (
+		file      = "0b7e5a44-6f6d-4c1e-9d55-1f1f0c3a8e21"
+		upload    = "9c1d3f5e-2a4b-4c6d-8e0f-1a2b3c4d5e6f"
+		abandoned = "1a2b3c4d-5e6f-4a1b-8c2d-3e4f5a6b7c8d"
+		orphan    = "7f6e5d4c-3b2a-4f1e-9d8c-7b6a5f4e3d2c"
+	)
+
+	for _, key := range []string{file, upload, abandoned, orphan} {
+		_, err = s.Put(key, 0, strings.NewReader("chunk"))
+		require.NoError(t, err)
+	}
+
+	_, err = s.Put(file, 1, strings.NewReader("released"))
+	require.NoError(t, err)
+
+	refs := &fakeRefs{
+		files: []string{file},
+		uploads: map[string]time.Time{
+			upload:    time.Now(),
+			abandoned: time.Now().Add(-48 * time.Hour),
+		},
+		released: []ChunkRef{{Key: file, N: 1}},
+	}
+
+	removed, err := NewCollector(s, refs, 24*time.Hour).Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 3, removed)
+
+	keys, err := s.Keys()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{file, upload}, keys)
+
+	chunks, err := s.Chunks(file)
+	require.NoError(t, err)
+	assert.Equal(t, map[int]int64{0: 5}, chunks)
+}
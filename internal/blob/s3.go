@@ -0,0 +1,387 @@
+package blob
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// s3Timeout limits a request to the bucket
+const s3Timeout = 30 * time.Second
+
+// S3Store keeps the chunks as objects of a bucket of an S3-compatible storage,
+// the n-th chunk of a blob is the object "key/n". The bucket is addressed in the path
+type S3Store struct {
+	endpoint *url.URL
+	bucket   string
+	signer   signer
+	client   *http.Client
+}
+
+// NewS3Store is a constructor, the bucket must exist
+func NewS3Store(endpoint, bucket, region, accessKey, secretKey string) (*S3Store, error) {
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme == "" || u.Host == "" || bucket == "" {
+		return nil, errors.New("s3 endpoint and bucket are required")
+	}
+
+	return &S3Store{
+		endpoint: u,
+		bucket:   bucket,
+		signer: signer{
+			accessKey: accessKey,
+			secretKey: secretKey,
+			region:    region,
+			service:   "s3",
+		},
+		client: &http.Client{Timeout: s3Timeout},
+	}, nil
+}
+
+// Put stores the n-th chunk of the blob and returns its size.
+// The chunk is read into memory, the storage requires its length and hash before the upload
+func (s *S3Store) Put(key string, n int, r io.Reader) (int64, error) {
+
+	if !keyPattern.MatchString(key) {
+		return 0, ErrInvalidKey
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := s.do(http.MethodPut, chunkObject(key, n), nil, data)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, responseError(resp)
+	}
+
+	return int64(len(data)), nil
+}
+
+// Get opens the n-th chunk of the blob
+func (s *S3Store) Get(key string, n int) (io.ReadCloser, int64, error) {
+
+	if !keyPattern.MatchString(key) {
+		return nil, 0, ErrInvalidKey
+	}
+
+	resp, err := s.do(http.MethodGet, chunkObject(key, n), nil, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, resp.ContentLength, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, 0, ErrNotFound
+	}
+
+	defer resp.Body.Close()
+	return nil, 0, responseError(resp)
+}
+
+// Chunks returns the sizes of the stored chunks of the blob by their numbers
+func (s *S3Store) Chunks(key string) (map[int]int64, error) {
+
+	if !keyPattern.MatchString(key) {
+		return nil, ErrInvalidKey
+	}
+
+	chunks := map[int]int64{}
+
+	err := s.list(key+"/", "", func(page *listResult) {
+		for _, object := range page.Contents {
+			n, err := strconv.Atoi(strings.TrimPrefix(object.Key, key+"/"))
+			if err == nil {
+				chunks[n] = object.Size
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return chunks, nil
+}
+
+// Remove deletes all chunks of the blob
+func (s *S3Store) Remove(key string) error {
+
+	chunks, err := s.Chunks(key)
+	if err != nil {
+		return err
+	}
+
+	for n := range chunks {
+		err = s.RemoveChunk(key, n)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RemoveChunk deletes the n-th chunk of the blob, a missing chunk is not an error
+func (s *S3Store) RemoveChunk(key string, n int) error {
+
+	if !keyPattern.MatchString(key) {
+		return ErrInvalidKey
+	}
+
+	resp, err := s.do(http.MethodDelete, chunkObject(key, n), nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+
+	return nil
+}
+
+// Keys returns the keys of all stored blobs
+func (s *S3Store) Keys() ([]string, error) {
+
+	keys := []string{}
+
+	err := s.list("", "/", func(page *listResult) {
+		for _, prefix := range page.CommonPrefixes {
+			key := strings.TrimSuffix(prefix.Prefix, "/")
+			if keyPattern.MatchString(key) {
+				keys = append(keys, key)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// listResult is a page of the objects of the bucket
+type listResult struct {
+	Contents []struct {
+		Key  string `xml:"Key"`
+		Size int64  `xml:"Size"`
+	} `xml:"Contents"`
+	CommonPrefixes []struct {
+		Prefix string `xml:"Prefix"`
+	} `xml:"CommonPrefixes"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// list passes every page of the objects with the prefix to fn,
+// with a delimiter the objects are grouped into the common prefixes
+func (s *S3Store) list(prefix, delimiter string, fn func(page *listResult)) error {
+
+	query := url.Values{}
+	query.Set("list-type", "2")
+	query.Set("prefix", prefix)
+	if delimiter != "" {
+		query.Set("delimiter", delimiter)
+	}
+
+	for {
+		resp, err := s.do(http.MethodGet, "", query, nil)
+		if err != nil {
+			return err
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			err = responseError(resp)
+			resp.Body.Close()
+			return err
+		}
+
+		var page listResult
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		fn(&page)
+
+		if !page.IsTruncated {
+			return nil
+		}
+
+		query.Set("continuation-token", page.NextContinuationToken)
+	}
+}
+
+// do sends the signed request for the object of the bucket, an empty object addresses the bucket itself
+func (s *S3Store) do(method, object string, query url.Values, body []byte) (*http.Response, error) {
+
+	u := *s.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.bucket
+	if object != "" {
+		u.Path += "/" + object
+	}
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(sum[:])
+
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	s.signer.sign(req, payloadHash, time.Now())
+
+	return s.client.Do(req)
+}
+
+// chunkObject returns the name of the object of the n-th chunk of the blob
+func chunkObject(key string, n int) string {
+	return key + "/" + strconv.Itoa(n)
+}
+
+// responseError returns the error of the storage response
+func responseError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("s3 %s: %s", resp.Status, body)
+}
+
+// signer signs the requests with AWS Signature Version 4
+type signer struct {
+	accessKey string
+	secretKey string
+	region    string
+	service   string
+}
+
+// sign sets the date and the authorization of the request.
+// The host and the x-amz-* headers set before are signed
+func (s signer) sign(req *http.Request, payloadHash string, now time.Time) {
+
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	if req.Host != "" {
+		headers["host"] = req.Host
+	}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.EscapedPath(), false),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + s.region + "/" + s.service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), day)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, s.service)
+	key = hmacSHA256(key, "aws4_request")
+
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// canonicalQuery returns the query parameters sorted by name with the values encoded
+func canonicalQuery(query url.Values) string {
+
+	params := make([]string, 0, len(query))
+	for name, values := range query {
+		for _, value := range values {
+			params = append(params, uriEncode(name, true)+"="+uriEncode(value, true))
+		}
+	}
+	sort.Strings(params)
+
+	return strings.Join(params, "&")
+}
+
+// uriEncode encodes every byte except the unreserved characters.
+// The path is already escaped, its escapes are kept and the slashes are left as is
+func uriEncode(s string, encodeSlash bool) string {
+
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		case c == '%' && !encodeSlash && i+2 < len(s):
+			b.WriteString(s[i : i+3])
+			i += 2
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
+
+// hmacSHA256 returns the HMAC of the data
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,205 @@
+package blob
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSigner_Sign(t *testing.T) {
+	// the get-vanilla case of the AWS Signature Version 4 test suite
+	req, err := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	require.NoError(t, err)
+
+	s := signer{
+		accessKey: "AKIDEXAMPLE",
+		secretKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		region:    "us-east-1",
+		service:   "service",
+	}
+
+	sum := sha256.Sum256(nil)
+	s.sign(req, hex.EncodeToString(sum[:]), time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	assert.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+		"SignedHeaders=host;x-amz-date, "+
+		"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		req.Header.Get("Authorization"))
+}
+
+// fakeS3 is a stand-in for an S3-compatible storage with one bucket.
+// It checks the signatures and returns the lists in pages of two entries
+type fakeS3 struct {
+	t      *testing.T
+	signer signer
+
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	body, err := io.ReadAll(r.Body)
+	require.NoError(f.t, err)
+
+	signed := r.Clone(r.Context())
+	signed.Header = http.Header{"X-Amz-Content-Sha256": r.Header.Values("X-Amz-Content-Sha256")}
+	date, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+	require.NoError(f.t, err)
+	f.signer.sign(signed, r.Header.Get("X-Amz-Content-Sha256"), date)
+
+	sum := sha256.Sum256(body)
+	if signed.Header.Get("Authorization") != r.Header.Get("Authorization") ||
+		hex.EncodeToString(sum[:]) != r.Header.Get("X-Amz-Content-Sha256") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	bucket, object, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != "bucket" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case object == "" && r.Method == http.MethodGet:
+		f.list(w, r)
+	case r.Method == http.MethodPut:
+		f.objects[object] = body
+	case r.Method == http.MethodGet:
+		data, ok := f.objects[object]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		_, _ = w.Write(data)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, object)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// list writes a page of the objects, the continuation token is the number of the skipped entries
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	prefix, delimiter := query.Get("prefix"), query.Get("delimiter")
+
+	var entries []string
+	seen := map[string]bool{}
+	for name := range f.objects {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if delimiter != "" {
+			if i := strings.Index(name[len(prefix):], delimiter); i >= 0 {
+				name = name[:len(prefix)+i+1]
+			}
+		}
+		if !seen[name] {
+			seen[name] = true
+			entries = append(entries, name)
+		}
+	}
+	sort.Strings(entries)
+
+	skip, _ := strconv.Atoi(query.Get("continuation-token"))
+
+	var page listResult
+	for i := skip; i < len(entries) && i < skip+2; i++ {
+		if strings.HasSuffix(entries[i], "/") {
+			page.CommonPrefixes = append(page.CommonPrefixes, struct {
+				Prefix string `xml:"Prefix"`
+			}{Prefix: entries[i]})
+			continue
+		}
+		page.Contents = append(page.Contents, struct {
+			Key  string `xml:"Key"`
+			Size int64  `xml:"Size"`
+		}{Key: entries[i], Size: int64(len(f.objects[entries[i]]))})
+	}
+	if skip+2 < len(entries) {
+		page.IsTruncated = true
+		page.NextContinuationToken = strconv.Itoa(skip + 2)
+	}
+
+	require.NoError(f.t, xml.NewEncoder(w).Encode(&page))
+}
+
+func TestS3Store(t *testing.T) {
+	fake := &fakeS3{
+		t:       t,
+		signer:  signer{accessKey: "access", secretKey: "secret", region: "us-east-1", service: "s3"},
+		objects: map[string][]byte{},
+	}
+
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	s, err := NewS3Store(server.URL, "bucket", "us-east-1", "access", "secret")
+	require.NoError(t, err)
+
+	const key = "0b7e5a44-6f6d-4c1e-9d55-1f1f0c3a8e21"
+	const other = "9c1d3f5e-2a4b-4c6d-8e0f-1a2b3c4d5e6f"
+
+	for n, chunk := range []string{"first", "second", "third"} {
+		size, err := s.Put(key, n, strings.NewReader(chunk))
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(chunk)), size)
+	}
+
+	_, err = s.Put(other, 0, strings.NewReader("other"))
+	require.NoError(t, err)
+
+	chunks, err := s.Chunks(key)
+	require.NoError(t, err)
+	assert.Equal(t, map[int]int64{0: 5, 1: 6, 2: 5}, chunks)
+
+	keys, err := s.Keys()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{key, other}, keys)
+
+	r, size, err := s.Get(key, 1)
+	require.NoError(t, err)
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	assert.Equal(t, "second", string(data))
+	assert.Equal(t, int64(6), size)
+
+	_, _, err = s.Get(key, 3)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, s.RemoveChunk(key, 2))
+
+	chunks, err = s.Chunks(key)
+	require.NoError(t, err)
+	assert.Equal(t, map[int]int64{0: 5, 1: 6}, chunks)
+
+	require.NoError(t, s.Remove(key))
+
+	keys, err = s.Keys()
+	require.NoError(t, err)
+	assert.Equal(t, []string{other}, keys)
+
+	wrong, err := NewS3Store(server.URL, "bucket", "us-east-1", "access", "wrong")
+	require.NoError(t, err)
+
+	_, err = wrong.Put(key, 0, strings.NewReader("data"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,490 @@
+package client
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/EgorKo25/GophKeeper/internal/storage"
+	"github.com/EgorKo25/GophKeeper/pkg/mycrypto"
+)
+
+var (
+	ErrCacheLocked = errors.New("cache is locked")
+	ErrNoChange    = errors.New("no such rejected change")
+)
+
+// Pending is a change made while the server was unreachable,
+// it is sent to the server when the connection is back
+type Pending struct {
+	Path     string          `json:"path"`
+	DataType string          `json:"data_type"`
+	Version  string          `json:"version,omitempty"`
+	Body     json.RawMessage `json:"body"`
+	// Local is the id the added item has in the local copy until the server assigns its own
+	Local string `json:"local,omitempty"`
+}
+
+// Rejected is a pending change the server has refused on replay, e.g. an update of a stale version.
+// It is kept until the user resolves it
+type Rejected struct {
+	Pending
+	Code int `json:"code"`
+}
+
+// cacheFile is the content of the cache file.
+// The key metadata is needed to derive the key and is stored as is,
+// everything else is encrypted with the vault key.
+// The number of the unsent changes is known before Unlock, so they are never dropped unseen
+type cacheFile struct {
+	KeyMeta *storage.KeyMeta `json:"key_meta"`
+	State   string           `json:"state"`
+	Unsent  int              `json:"unsent,omitempty"`
+}
+
+// cacheState is the encrypted part of the cache file
+type cacheState struct {
+	Cursor   int64             `json:"cursor"`
+	Vault    *storage.UserDate `json:"vault"`
+	Pending  []Pending         `json:"pending"`
+	Rejected []Rejected        `json:"rejected,omitempty"`
+}
+
+// Cache is a Store kept in an encrypted file.
+// It holds the last synchronized vault and the changes waiting to be sent to the server
+type Cache struct {
+	*MemoryStore
+
+	mu       sync.Mutex
+	path     string
+	meta     *storage.KeyMeta
+	state    string
+	unsent   int
+	pending  []Pending
+	rejected []Rejected
+	e        *mycrypto.Crypto
+}
+
+// CachePath returns the path of the cache file of the user of the server
+// in the configuration directory of the current user
+func CachePath(server, login string) (string, error) {
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256([]byte(server + "\x00" + login))
+
+	return filepath.Join(dir, "gophkeeper", hex.EncodeToString(sum[:16])+".cache"), nil
+}
+
+// OpenCache reads the cache file, a missing file gives an empty cache.
+// The vault stays encrypted until Unlock
+func OpenCache(path string) (*Cache, error) {
+
+	cache := &Cache{
+		MemoryStore: NewMemoryStore(),
+		path:        path,
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var file cacheFile
+
+	err = json.Unmarshal(data, &file)
+	if err != nil {
+		return nil, err
+	}
+
+	cache.meta = file.KeyMeta
+	cache.state = file.State
+	cache.unsent = file.Unsent
+
+	return cache, nil
+}
+
+// Path returns the path of the cache file
+func (c *Cache) Path() string {
+	return c.path
+}
+
+// KeyMeta returns the cached key metadata, it is nil when the vault has never been cached
+func (c *Cache) KeyMeta() *storage.KeyMeta {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.meta
+}
+
+// SetKeyMeta replaces the cached key metadata with the one read from the server
+func (c *Cache) SetKeyMeta(meta *storage.KeyMeta) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.meta = meta
+}
+
+// Unlock decrypts the cached vault with the vault key.
+// The cache can't be decrypted when the key has been changed on another device,
+// Reset drops it then
+func (c *Cache) Unlock(e *mycrypto.Crypto) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.state != "" {
+		plain, err := e.Decrypt(c.state)
+		if err != nil {
+			return err
+		}
+
+		var state cacheState
+
+		err = json.Unmarshal([]byte(plain), &state)
+		if err != nil {
+			return err
+		}
+
+		c.MemoryStore.load(state.Cursor, state.Vault)
+		c.pending = state.Pending
+		c.rejected = state.Rejected
+		c.state = ""
+	}
+
+	c.e = e
+
+	return nil
+}
+
+// Reset drops the cached vault and the unsent changes
+func (c *Cache) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.MemoryStore.load(0, nil)
+	c.pending = nil
+	c.rejected = nil
+	c.state = ""
+	c.unsent = 0
+}
+
+// Rekey saves the cache encrypted with a new vault key
+func (c *Cache) Rekey(e *mycrypto.Crypto, meta *storage.KeyMeta) error {
+	c.mu.Lock()
+	c.e = e
+	c.meta = meta
+	c.mu.Unlock()
+
+	return c.Save()
+}
+
+// Apply applies the changes pulled from the server and saves the cache
+func (c *Cache) Apply(delta *storage.SyncDelta) error {
+
+	err := c.MemoryStore.Apply(delta)
+	if err != nil {
+		return err
+	}
+
+	return c.Save()
+}
+
+// Enqueue adds a change to be sent to the server, applies it to the local copy and saves the cache.
+// The changes of an item added offline are merged into its addition,
+// an update takes the version the queued changes will make on the server
+func (c *Cache) Enqueue(p Pending) error {
+
+	kind, ok := storage.KindOf(p.DataType)
+	if !ok {
+		return fmt.Errorf("unknown item type %q", p.DataType)
+	}
+
+	item := kind.New()
+
+	err := json.Unmarshal(p.Body, item)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	err = c.queue(p, item)
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return c.Save()
+}
+
+// queue applies the change of the item to the local copy and adds it to the pending ones
+func (c *Cache) queue(p Pending, item storage.Item) error {
+
+	h := item.Header()
+
+	added := -1
+	for i, queued := range c.pending {
+		if queued.Local != "" && queued.Local == *h.Id {
+			added = i
+		}
+	}
+
+	switch {
+	case p.Path == "/user/add":
+		id, err := localID()
+		if err != nil {
+			return err
+		}
+
+		*h.Id = id
+		p.Local = id
+		c.MemoryStore.store(item)
+	case added >= 0 && p.Path == "/user/delete":
+		c.pending = append(c.pending[:added:added], c.pending[added+1:]...)
+		c.MemoryStore.remove(item)
+		return nil
+	case added >= 0:
+		// the item is sent only by its addition, the move changes the folder of the added one
+		if p.Path == "/user/move" {
+			stored, ok := c.MemoryStore.read(item)
+			if !ok {
+				return ErrNoChange
+			}
+
+			*stored.Header().Folder = *h.Folder
+			item = stored
+		}
+
+		body, err := addBody(item)
+		if err != nil {
+			return err
+		}
+
+		c.pending[added].Body = body
+		c.MemoryStore.store(item)
+		return nil
+	case p.Path == "/user/update":
+		*h.Version++
+		c.MemoryStore.store(item)
+	case p.Path == "/user/delete":
+		c.MemoryStore.remove(item)
+	case p.Path == "/user/move":
+		stored, ok := c.MemoryStore.read(item)
+		if ok {
+			*stored.Header().Folder = *h.Folder
+			c.MemoryStore.store(stored)
+		}
+	}
+
+	c.pending = append(c.pending, p)
+
+	return nil
+}
+
+// addBody returns the body adding the item, the local id is not sent
+func addBody(item storage.Item) (json.RawMessage, error) {
+
+	added := clone(item)
+	*added.Header().Id = ""
+
+	return json.Marshal(added)
+}
+
+// localID returns a random id of an item added offline
+func localID() (string, error) {
+
+	id := make([]byte, 16)
+
+	_, err := rand.Read(id)
+	if err != nil {
+		return "", err
+	}
+
+	return "local-" + hex.EncodeToString(id), nil
+}
+
+// replayed drops the placeholder of the sent item and makes the next pull read the whole vault,
+// so the changes applied in advance are replaced by the ones the server has stored
+func (c *Cache) replayed(p Pending) {
+
+	if p.Local != "" {
+		if kind, ok := storage.KindOf(p.DataType); ok {
+			item := kind.New()
+			*item.Header().Id = p.Local
+			c.MemoryStore.remove(item)
+		}
+	}
+
+	c.MemoryStore.rewind()
+}
+
+// Pending returns the changes waiting to be sent to the server
+func (c *Cache) Pending() []Pending {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]Pending(nil), c.pending...)
+}
+
+// Unsent returns the number of the pending and rejected changes,
+// it is known before Unlock from the cache file
+func (c *Cache) Unsent() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.state != "" {
+		return c.unsent
+	}
+
+	return len(c.pending) + len(c.rejected)
+}
+
+// dequeue removes the first pending change after it has been sent
+func (c *Cache) dequeue() error {
+	c.mu.Lock()
+	if len(c.pending) > 0 {
+		c.replayed(c.pending[0])
+		c.pending = c.pending[1:]
+	}
+	c.mu.Unlock()
+
+	return c.Save()
+}
+
+// reject moves the first pending change the server has refused with the code to the rejected ones
+func (c *Cache) reject(code int) error {
+	c.mu.Lock()
+	if len(c.pending) > 0 {
+		c.replayed(c.pending[0])
+		c.rejected = append(c.rejected, Rejected{Pending: c.pending[0], Code: code})
+		c.pending = c.pending[1:]
+	}
+	c.mu.Unlock()
+
+	return c.Save()
+}
+
+// Rejected returns the changes the server has refused
+func (c *Cache) Rejected() []Rejected {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]Rejected(nil), c.rejected...)
+}
+
+// Retry queues the rejected change again guarded by the version, an empty version overwrites the item
+func (c *Cache) Retry(i int, version string) error {
+	c.mu.Lock()
+	if i < 0 || i >= len(c.rejected) {
+		c.mu.Unlock()
+		return ErrNoChange
+	}
+
+	p := c.rejected[i].Pending
+	p.Version = version
+
+	c.rejected = append(c.rejected[:i:i], c.rejected[i+1:]...)
+	c.pending = append(c.pending, p)
+	c.mu.Unlock()
+
+	return c.Save()
+}
+
+// Discard drops the rejected change
+func (c *Cache) Discard(i int) error {
+	c.mu.Lock()
+	if i < 0 || i >= len(c.rejected) {
+		c.mu.Unlock()
+		return ErrNoChange
+	}
+
+	c.rejected = append(c.rejected[:i:i], c.rejected[i+1:]...)
+	c.mu.Unlock()
+
+	return c.Save()
+}
+
+// Save writes the cache file, the file is replaced atomically
+func (c *Cache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.e == nil {
+		return ErrCacheLocked
+	}
+
+	plain, err := json.Marshal(cacheState{
+		Cursor:   c.MemoryStore.Cursor(),
+		Vault:    c.MemoryStore.Vault(),
+		Pending:  c.pending,
+		Rejected: c.rejected,
+	})
+	if err != nil {
+		return err
+	}
+
+	state, err := c.e.Encrypt(string(plain))
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(cacheFile{
+		KeyMeta: c.meta,
+		State:   state,
+		Unsent:  len(c.pending) + len(c.rejected),
+	})
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(c.path)
+
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(c.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), c.path)
+}
+
+// Remove deletes the cache file, e.g. when the account is deleted
+func (c *Cache) Remove() error {
+
+	c.Reset()
+	c.SetKeyMeta(nil)
+
+	err := os.Remove(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,393 @@
+package client
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/EgorKo25/GophKeeper/internal/storage"
+	"github.com/EgorKo25/GophKeeper/pkg/mycrypto"
+)
+
+// newTestCrypto derives a vault key from the secret
+func newTestCrypto(t *testing.T, secret string) (*mycrypto.Crypto, *storage.KeyMeta) {
+	params, err := mycrypto.NewKeyParams()
+	require.NoError(t, err)
+
+	e, err := mycrypto.NewCrypto(secret, params)
+	require.NoError(t, err)
+
+	meta := &storage.KeyMeta{Salt: params.Salt, Time: params.Time, Memory: params.Memory, Threads: params.Threads}
+	meta.Check, err = e.Verifier()
+	require.NoError(t, err)
+
+	return e, meta
+}
+
+func TestCache_SaveAndUnlock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault.cache")
+	e, meta := newTestCrypto(t, "master")
+
+	cache, err := OpenCache(path)
+	require.NoError(t, err)
+	assert.Nil(t, cache.KeyMeta())
+
+	assert.ErrorIs(t, cache.Save(), ErrCacheLocked)
+
+	cache.SetKeyMeta(meta)
+	require.NoError(t, cache.Unlock(e))
+	require.NoError(t, cache.Apply(&storage.SyncDelta{
+		Cursor: 7,
+		Items:  storage.Items{"password": {&storage.Password{Id: "p1", Service: "yandex", Version: 3}}},
+	}))
+	require.NoError(t, cache.Enqueue(Pending{Path: "/user/add", DataType: "card", Body: json.RawMessage(`{}`)}))
+
+	reopened, err := OpenCache(path)
+	require.NoError(t, err)
+	assert.Equal(t, meta, reopened.KeyMeta())
+	assert.Empty(t, reopened.Vault().Items["password"])
+	assert.Equal(t, 1, reopened.Unsent(), "known before unlock")
+
+	other, _ := newTestCrypto(t, "other")
+	assert.Error(t, reopened.Unlock(other))
+
+	require.NoError(t, reopened.Unlock(e))
+	assert.Equal(t, int64(7), reopened.Cursor())
+	assert.Equal(t, cache.Vault(), reopened.Vault())
+	assert.Len(t, reopened.Pending(), 1)
+
+	require.NoError(t, reopened.Remove())
+	assert.NoFileExists(t, path)
+}
+
+func TestClient_Offline(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	vault := &fakeVault{}
+	vault.put(change{password: &storage.Password{Id: "p1", Service: "yandex", Version: 1}})
+	vault.put(change{password: &storage.Password{Id: "p2", Service: "google", Version: 1}})
+
+	var updates []string
+
+	mux := http.NewServeMux()
+	mux.Handle("/user/sync", vault)
+	mux.HandleFunc("/user/update", func(w http.ResponseWriter, r *http.Request) {
+		var pass storage.Password
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&pass))
+
+		updates = append(updates, r.Header.Get("If-Match"))
+		assert.Equal(t, "laptop", r.Header.Get(deviceHeader))
+
+		pass.Version++
+		vault.put(change{password: &pass})
+		w.WriteHeader(http.StatusOK)
+	})
+
+	server := httptest.NewServer(mux)
+	addr := server.Listener.Addr().String()
+
+	c := NewClient(server.URL, "laptop")
+
+	cache, err := c.UseCache("testuser")
+	require.NoError(t, err)
+
+	e, meta := newTestCrypto(t, "master")
+	cache.SetKeyMeta(meta)
+	require.NoError(t, cache.Unlock(e))
+
+	code, _, _, err := NewSyncer(c, cache).Pull(nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, code)
+	assert.True(t, c.Status().Online)
+
+	server.Close()
+
+	code, _, _, err = NewSyncer(c, cache).Pull(nil)
+	assert.ErrorIs(t, err, ErrOffline)
+	assert.Zero(t, code)
+	assert.False(t, c.Status().Online)
+
+	code, res, _, err := c.Send(&storage.KeyMeta{}, "keymeta", nil, "/user/read")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, *meta, res)
+
+	code, _, _, err = c.Send(&storage.Password{Service: "yandex"}, "password", nil, "/user/search")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, res, _, err = c.Send(&storage.Password{}, "password", nil, "/user/search")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, code)
+	found := res.([]storage.Item)
+	require.Len(t, found, 2)
+	p1 := found[0].(*storage.Password)
+	assert.Equal(t, "p1", p1.Id)
+
+	code, res, _, err = c.Get(nil, "/user/items?offset=0")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 2, res.(storage.ItemList).Total)
+
+	code, _, _, err = c.Send(&storage.Password{Id: "p3"}, "password", nil, "/user/read")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	_, _, _, err = c.Send(&storage.User{Login: "testuser"}, "user", nil, "/user/login")
+	assert.ErrorIs(t, err, ErrOffline)
+
+	p1.Login = "new login"
+	code, _, _, err = c.Send(p1, "password", nil, "/user/update")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusAccepted, code)
+	assert.Equal(t, 1, c.Status().Pending)
+
+	// the queue survives a restart of the client
+	reopened, err := OpenCache(cache.path)
+	require.NoError(t, err)
+	require.NoError(t, reopened.Unlock(e))
+	assert.Len(t, reopened.Pending(), 1)
+
+	listener, err := net.Listen("tcp", addr)
+	require.NoError(t, err)
+
+	server = &httptest.Server{Listener: listener, Config: &http.Server{Handler: mux}}
+	server.Start()
+	defer server.Close()
+
+	code, _, _, err = NewSyncer(c, cache).Pull(nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, code)
+
+	assert.Equal(t, []string{`"1"`}, updates)
+	assert.Equal(t, Status{Online: true}, c.Status())
+
+	stored, ok := cache.read(&storage.Password{Id: "p1"})
+	require.True(t, ok)
+	assert.Equal(t, &storage.Password{Id: "p1", Service: "yandex", Login: "new login", Version: 2}, stored)
+}
+
+func TestClient_Rejected(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	var updates []string
+
+	mux := http.NewServeMux()
+	mux.Handle("/user/sync", &fakeVault{})
+	mux.HandleFunc("/user/update", func(w http.ResponseWriter, r *http.Request) {
+		updates = append(updates, r.Header.Get("If-Match"))
+		if r.Header.Get("If-Match") != `"5"` {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := NewClient(server.URL, "laptop")
+
+	cache, err := c.UseCache("testuser")
+	require.NoError(t, err)
+
+	e, meta := newTestCrypto(t, "master")
+	cache.SetKeyMeta(meta)
+	require.NoError(t, cache.Unlock(e))
+
+	body := json.RawMessage(`{"id":"p1","service":"yandex","version":1}`)
+	require.NoError(t, cache.Enqueue(Pending{Path: "/user/update", DataType: "password", Version: `"1"`, Body: body}))
+	require.NoError(t, cache.Enqueue(Pending{Path: "/user/update", DataType: "password", Version: `"2"`, Body: body}))
+
+	code, _, _, err := NewSyncer(c, cache).Pull(nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, code)
+
+	// the refused changes are kept for the user
+	assert.Equal(t, Status{Online: true, Rejected: 2}, c.Status())
+	rejected := cache.Rejected()
+	require.Len(t, rejected, 2)
+	assert.Equal(t, http.StatusConflict, rejected[0].Code)
+	assert.Equal(t, body, rejected[0].Body)
+
+	reopened, err := OpenCache(cache.path)
+	require.NoError(t, err)
+	assert.Equal(t, 2, reopened.Unsent())
+	require.NoError(t, reopened.Unlock(e))
+	assert.Equal(t, rejected, reopened.Rejected())
+
+	require.NoError(t, cache.Discard(1))
+	require.NoError(t, cache.Retry(0, `"5"`))
+	assert.ErrorIs(t, cache.Retry(0, ""), ErrNoChange)
+	assert.Equal(t, 1, c.Status().Pending)
+
+	_, _, _, err = NewSyncer(c, cache).Pull(nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{`"1"`, `"2"`, `"5"`}, updates)
+	assert.Equal(t, Status{Online: true}, c.Status())
+	assert.Zero(t, cache.Unsent())
+}
+
+func TestClient_OfflineChanges(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	vault := &fakeVault{}
+	vault.put(change{password: &storage.Password{Id: "p1", Service: "yandex", Version: 1}})
+	vault.put(change{password: &storage.Password{Id: "p2", Service: "google", Version: 1}})
+
+	var requests []string
+	var added []storage.Password
+
+	mux := http.NewServeMux()
+	mux.Handle("/user/sync", vault)
+	mux.HandleFunc("/user/update", func(w http.ResponseWriter, r *http.Request) {
+		var pass storage.Password
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&pass))
+
+		requests = append(requests, "update "+pass.Id+" "+r.Header.Get("If-Match"))
+
+		// the version the client has read must be the stored one
+		var stored *storage.Password
+		for _, c := range vault.changes {
+			if c.password != nil && c.password.Id == pass.Id {
+				stored = c.password
+			}
+		}
+		if stored == nil || r.Header.Get("If-Match") != strconv.Quote(strconv.FormatInt(stored.Version, 10)) {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+
+		pass.Version = stored.Version + 1
+		vault.put(change{password: &pass})
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/user/add", func(w http.ResponseWriter, r *http.Request) {
+		var pass storage.Password
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&pass))
+
+		requests = append(requests, "add "+pass.Service)
+		added = append(added, pass)
+
+		pass.Id, pass.Version = "p3", 1
+		vault.put(change{password: &pass})
+		w.WriteHeader(http.StatusOK)
+	})
+
+	server := httptest.NewServer(mux)
+	addr := server.Listener.Addr().String()
+
+	c := NewClient(server.URL, "laptop")
+
+	cache, err := c.UseCache("testuser")
+	require.NoError(t, err)
+
+	e, meta := newTestCrypto(t, "master")
+	cache.SetKeyMeta(meta)
+	require.NoError(t, cache.Unlock(e))
+
+	_, _, _, err = NewSyncer(c, cache).Pull(nil)
+	require.NoError(t, err)
+
+	server.Close()
+
+	read := func(id string) *storage.Password {
+		code, res, _, err := c.Send(&storage.Password{Id: id}, "password", nil, "/user/read")
+		require.NoError(t, err)
+		if code != http.StatusOK {
+			return nil
+		}
+		return res.(*storage.Password)
+	}
+
+	send := func(item storage.Item, path string) {
+		code, _, _, err := c.Send(item, "password", nil, path)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusAccepted, code)
+	}
+
+	// two updates of one item are chained by the versions they make
+	p1 := read("p1")
+	p1.Login = "first"
+	send(p1, "/user/update")
+
+	p1 = read("p1")
+	assert.Equal(t, "first", p1.Login, "the change is seen offline")
+	assert.Equal(t, int64(2), p1.Version)
+	p1.Login = "second"
+	send(p1, "/user/update")
+
+	// a deleted item is not seen
+	send(read("p2"), "/user/delete")
+	assert.Nil(t, read("p2"))
+
+	// an added item is seen and its changes are sent with the addition
+	send(&storage.Password{Service: "github", Login: "me"}, "/user/add")
+
+	code, res, _, err := c.Get(nil, "/user/items?offset=0")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, code)
+
+	var local string
+	for _, item := range res.(storage.ItemList).Items {
+		if item.Name == "github" {
+			local = item.Id
+		}
+	}
+	require.NotEmpty(t, local)
+
+	p3 := read(local)
+	require.NotNil(t, p3)
+	p3.Login = "edited"
+	send(p3, "/user/update")
+
+	temp := &storage.Password{Service: "temp"}
+	send(temp, "/user/add")
+	for _, item := range cache.Vault().Items["password"] {
+		if item.(*storage.Password).Service == "temp" {
+			send(item, "/user/delete")
+		}
+	}
+
+	assert.Len(t, cache.Pending(), 4)
+
+	listener, err := net.Listen("tcp", addr)
+	require.NoError(t, err)
+
+	mux.HandleFunc("/user/delete", func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, "delete "+r.Header.Get("If-Match"))
+		vault.put(change{deleted: &storage.Tombstone{Id: "p2", Type: "password"}})
+		w.WriteHeader(http.StatusOK)
+	})
+
+	server = &httptest.Server{Listener: listener, Config: &http.Server{Handler: mux}}
+	server.Start()
+	defer server.Close()
+
+	code, _, _, err = NewSyncer(c, cache).Pull(nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, code)
+
+	assert.Equal(t, []string{`update p1 "1"`, `update p1 "2"`, `delete "1"`, "add github"}, requests)
+	assert.Equal(t, Status{Online: true}, c.Status())
+
+	require.Len(t, added, 1)
+	assert.Empty(t, added[0].Id, "the local id is not sent")
+	assert.Equal(t, "edited", added[0].Login)
+
+	vaultItems := cache.Vault().Items["password"]
+	require.Len(t, vaultItems, 2)
+	assert.Equal(t, &storage.Password{Id: "p1", Service: "yandex", Login: "second", Version: 3}, vaultItems[0])
+	assert.Equal(t, "p3", *vaultItems[1].Header().Id)
+}
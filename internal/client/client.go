@@ -5,86 +5,236 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/EgorKo25/GophKeeper/internal/storage"
 )
 
-// Client is a struct for manage client
+const (
+	// requestTimeout limits a request, the server is considered unreachable after it
+	requestTimeout = 10 * time.Second
+
+	// deviceHeader is a header with the id of the device, the server stores it as the author of the changes
+	deviceHeader = "Device-Id"
+)
+
+// Client is a struct for manage client.
+// With a cache it serves the vault from it while the server is unreachable
 type Client struct {
 	urlServer string
+	device    string
+	client    *http.Client
+
+	mu     sync.Mutex
+	cache  *Cache
+	online bool
 }
 
-// NewClient is a constructor
-func NewClient(urlServer string) *Client {
+// NewClient is a constructor, the changes are sent on behalf of the device
+func NewClient(urlServer, device string) *Client {
 
 	return &Client{
 		urlServer: urlServer,
+		device:    device,
+		client:    &http.Client{Timeout: requestTimeout},
 	}
 }
 
-// Send is a function for sending any data to server
+// Send is a function for sending any data to server.
+// It returns the cookies updated with the ones the server has set.
+// An expired access token is refreshed once and the request is repeated
 func (c *Client) Send(src any, dataType string, cookie []*http.Cookie, path string) (int, any, []*http.Cookie, error) {
+	return c.send(http.MethodPost, src, dataType, cookie, path)
+}
+
+// Get is a function for getting data from server, the path may contain query parameters
+func (c *Client) Get(cookie []*http.Cookie, path string) (int, any, []*http.Cookie, error) {
+	return c.send(http.MethodGet, nil, "", cookie, path)
+}
+
+// send sends the pending changes and the request.
+// The request is served from the cache when the server is unreachable
+func (c *Client) send(method string, src any, dataType string, cookie []*http.Cookie, path string) (int, any, []*http.Cookie, error) {
 
 	var data []byte
 	var err error
 
-	client := &http.Client{}
-
 	data, err = c.anyTypeMarshal(src)
 	if err != nil {
 		return 0, nil, nil, err
 	}
 
-	req, err := http.NewRequest("POST", c.urlServer+path, bytes.NewBuffer(data))
+	version := ifMatch(src)
+
+	var resp *http.Response
+	var body []byte
+
+	cache := c.vaultCache(path)
+	if cache != nil {
+		cookie, err = c.flush(cache, cookie)
+	}
+	if err == nil {
+		resp, body, cookie, err = c.exchange(method, data, dataType, version, cookie, path)
+	}
+
+	c.setOnline(!errors.Is(err, ErrOffline))
+
+	if errors.Is(err, ErrOffline) && cache != nil {
+		code, res, err := c.serveOffline(cache, src, data, dataType, version, path)
+		return code, res, cookie, err
+	}
+	if err != nil {
+		return 0, nil, nil, err
+	}
+
+	res, err := c.anyTypeUnmarshal(resp.Header.Get("Data-Type"), body)
 	if err != nil {
 		return 0, nil, nil, err
 	}
 
+	return resp.StatusCode, res, cookie, nil
+}
+
+// exchange sends the request and refreshes an expired access token
+func (c *Client) exchange(method string, data []byte, dataType, version string, cookie []*http.Cookie, path string) (*http.Response, []byte, []*http.Cookie, error) {
+
+	resp, body, err := c.do(method, data, dataType, version, cookie, path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	cookie = mergeCookies(cookie, resp.Cookies())
+
+	if resp.StatusCode == http.StatusUnauthorized && path != "/user/refresh" {
+		refresh, _, err := c.do(http.MethodPost, nil, "", "", cookie, "/user/refresh")
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		if refresh.StatusCode == http.StatusOK {
+			cookie = mergeCookies(cookie, refresh.Cookies())
+
+			resp, body, err = c.do(method, data, dataType, version, cookie, path)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+
+			cookie = mergeCookies(cookie, resp.Cookies())
+		}
+	}
+
+	return resp, body, cookie, nil
+}
+
+// do sends one request to the server and reads the response body.
+// A non-empty version is sent as the If-Match precondition
+func (c *Client) do(method string, data []byte, dataType, version string, cookie []*http.Cookie, path string) (*http.Response, []byte, error) {
+
+	req, err := http.NewRequest(method, c.urlServer+path, bytes.NewBuffer(data))
+	if err != nil {
+		return nil, nil, err
+	}
+
 	for _, cook := range cookie {
 		req.AddCookie(cook)
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Data-Type", dataType)
+	if version != "" {
+		req.Header.Set("If-Match", version)
+	}
+	if c.device != "" {
+		req.Header.Set(deviceHeader, c.device)
+	}
 
-	resp, err := client.Do(req)
+	resp, err := c.client.Do(req)
 	if err != nil {
-		return 0, nil, nil, err
+		return nil, nil, fmt.Errorf("%w: %v", ErrOffline, err)
 	}
+	defer resp.Body.Close()
 
-	body, _ := io.ReadAll(resp.Body)
-
-	res, err := c.anyTypeUnmarshal(resp.Header.Get("Data-Type"), body)
+	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return 0, nil, nil, err
+		return nil, nil, err
+	}
+
+	return resp, body, nil
+}
+
+// ifMatch returns the precondition for a vault item of the version the client has read
+func ifMatch(src any) string {
+
+	item, ok := src.(storage.Item)
+	if !ok || *item.Header().Version == 0 {
+		return ""
 	}
 
-	return resp.StatusCode, res, resp.Cookies(), nil
+	return strconv.Quote(strconv.FormatInt(*item.Header().Version, 10))
+}
+
+// mergeCookies replaces the cookies by name with the received ones
+func mergeCookies(cookie, received []*http.Cookie) []*http.Cookie {
+
+	res := make([]*http.Cookie, 0, len(cookie)+len(received))
+
+	for _, cook := range cookie {
+		replaced := false
+		for _, recv := range received {
+			if recv.Name == cook.Name {
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			res = append(res, cook)
+		}
+	}
+
+	for _, recv := range received {
+		if recv.MaxAge >= 0 {
+			res = append(res, recv)
+		}
+	}
+
+	return res
 }
 
 // anyTypeMarshal is a Marshaller for my custom type
 func (c *Client) anyTypeMarshal(body any) ([]byte, error) {
 	switch t := body.(type) {
-	case *storage.Card:
+	case nil:
+		return nil, nil
+	case storage.Item:
 		res, err := json.Marshal(t)
 		if err != nil {
 			return nil, err
 		}
 		return res, nil
-	case *storage.Password:
+	case *storage.User:
 		res, err := json.Marshal(t)
 		if err != nil {
 			return nil, err
 		}
 		return res, nil
-	case *storage.BinaryData:
+	case *storage.KeyMeta:
 		res, err := json.Marshal(t)
 		if err != nil {
 			return nil, err
 		}
 		return res, nil
-	case *storage.User:
+	case *storage.UserDate:
+		res, err := json.Marshal(t)
+		if err != nil {
+			return nil, err
+		}
+		return res, nil
+	case *storage.Upload:
 		res, err := json.Marshal(t)
 		if err != nil {
 			return nil, err
@@ -95,30 +245,101 @@ func (c *Client) anyTypeMarshal(body any) ([]byte, error) {
 	return nil, errors.New("unknown type")
 }
 
-// anyTypeUnmarshal is an Unmarshaler for my custom type
+// anyTypeUnmarshal is an Unmarshaler for my custom type.
+// A vault item is returned as storage.Item and a list of them as []storage.Item
 func (c *Client) anyTypeUnmarshal(t string, body []byte) (any, error) {
 
 	if len(body) == 0 {
 		return nil, nil
 	}
 
+	if kind, ok := storage.KindOf(t); ok {
+		res := kind.New()
+		err := json.Unmarshal(body, res)
+		if err != nil {
+			return nil, err
+		}
+		return res, nil
+	}
+
+	if kind, ok := storage.KindOf(strings.TrimSuffix(t, "-list")); ok {
+		var raw []json.RawMessage
+		err := json.Unmarshal(body, &raw)
+		if err != nil {
+			return nil, err
+		}
+
+		res := make([]storage.Item, 0, len(raw))
+		for _, r := range raw {
+			item := kind.New()
+			err = json.Unmarshal(r, item)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, item)
+		}
+		return res, nil
+	}
+
 	switch t {
-	case "card":
-		res := storage.Card{}
+	case "keymeta":
+		res := storage.KeyMeta{}
+		err := json.Unmarshal(body, &res)
+		if err != nil {
+			return nil, err
+		}
+		return res, nil
+	case "vault":
+		res := storage.UserDate{}
+		err := json.Unmarshal(body, &res)
+		if err != nil {
+			return nil, err
+		}
+		return res, nil
+	case "sync":
+		res := storage.SyncDelta{}
+		err := json.Unmarshal(body, &res)
+		if err != nil {
+			return nil, err
+		}
+		return res, nil
+	case "items":
+		res := storage.ItemList{}
+		err := json.Unmarshal(body, &res)
+		if err != nil {
+			return nil, err
+		}
+		return res, nil
+	case "upload":
+		res := storage.Upload{}
+		err := json.Unmarshal(body, &res)
+		if err != nil {
+			return nil, err
+		}
+		return res, nil
+	case "uploads":
+		res := []storage.Upload{}
+		err := json.Unmarshal(body, &res)
+		if err != nil {
+			return nil, err
+		}
+		return res, nil
+	case "chunk-ids":
+		res := []string{}
 		err := json.Unmarshal(body, &res)
 		if err != nil {
 			return nil, err
 		}
 		return res, nil
-	case "password":
-		res := storage.Password{}
+	case "usage":
+		res := storage.Usage{}
 		err := json.Unmarshal(body, &res)
 		if err != nil {
 			return nil, err
 		}
 		return res, nil
-	case "bin":
-		res := storage.BinaryData{}
+	case "conflict":
+		res := storage.Conflict{}
 		err := json.Unmarshal(body, &res)
 		if err != nil {
 			return nil, err
@@ -0,0 +1,57 @@
+package client
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// deviceUnsafe matches the characters not allowed in a device id
+var deviceUnsafe = regexp.MustCompile(`[^0-9A-Za-z._-]+`)
+
+// DeviceID returns the id of this device, it is created on the first run
+// from the host name and a random suffix and kept in the configuration directory
+func DeviceID() (string, error) {
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, "gophkeeper", "device")
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		return strings.TrimSpace(string(data)), nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	host, _ := os.Hostname()
+	host = strings.Trim(deviceUnsafe.ReplaceAllString(host, "-"), "-")
+	if len(host) > 48 {
+		host = host[:48]
+	}
+	if host == "" {
+		host = "device"
+	}
+
+	suffix := make([]byte, 4)
+	if _, err = rand.Read(suffix); err != nil {
+		return "", err
+	}
+
+	device := host + "-" + hex.EncodeToString(suffix)
+
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return "", err
+	}
+
+	return device, os.WriteFile(path, []byte(device+"\n"), 0600)
+}
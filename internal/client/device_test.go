@@ -0,0 +1,21 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeviceID(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	device, err := DeviceID()
+	require.NoError(t, err)
+	assert.Regexp(t, `^[0-9A-Za-z._-]{1,64}$`, device)
+
+	again, err := DeviceID()
+	require.NoError(t, err)
+	assert.Equal(t, device, again)
+}
@@ -0,0 +1,292 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/EgorKo25/GophKeeper/internal/storage"
+	"github.com/EgorKo25/GophKeeper/pkg/blindindex"
+)
+
+var (
+	ErrOffline = errors.New("server is unreachable")
+)
+
+// defaultFindLimit is the number of the found items when the query has no limit, the server has the same default
+const defaultFindLimit = 50
+
+// Status describes the connection to the server
+type Status struct {
+	// Online is false when the last request could not reach the server
+	Online bool
+	// Pending is the number of changes waiting to be sent
+	Pending int
+	// Rejected is the number of the changes the server refused on replay, they wait for the user
+	Rejected int
+}
+
+// UseCache opens the cache of the user and makes the client fall back to it
+// when the server is unreachable
+func (c *Client) UseCache(login string) (*Cache, error) {
+
+	path, err := CachePath(c.urlServer, login)
+	if err != nil {
+		return nil, err
+	}
+
+	cache, err := OpenCache(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.cache = cache
+	c.mu.Unlock()
+
+	return cache, nil
+}
+
+// Status returns the state of the connection and of the pending changes
+func (c *Client) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	status := Status{
+		Online: c.online,
+	}
+
+	if c.cache != nil {
+		status.Pending = len(c.cache.Pending())
+		status.Rejected = len(c.cache.Rejected())
+	}
+
+	return status
+}
+
+// vaultCache returns the cache if the request to the path works with the vault
+func (c *Client) vaultCache(path string) *Cache {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch path {
+	case "/user/register", "/user/login", "/user/refresh":
+		return nil
+	}
+
+	return c.cache
+}
+
+// setOnline remembers whether the server has been reached
+func (c *Client) setOnline(online bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.online = online
+}
+
+// flush sends the pending changes in order.
+// A change refused by the server is kept as rejected until the user resolves it,
+// the replay stops when the server is unreachable or the session has expired
+func (c *Client) flush(cache *Cache, cookie []*http.Cookie) ([]*http.Cookie, error) {
+
+	for _, p := range cache.Pending() {
+		resp, _, received, err := c.exchange(http.MethodPost, p.Body, p.DataType, p.Version, cookie, p.Path)
+		if err != nil {
+			return cookie, err
+		}
+
+		cookie = received
+
+		if resp.StatusCode == http.StatusUnauthorized {
+			return cookie, nil
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			err = cache.reject(resp.StatusCode)
+		} else {
+			err = cache.dequeue()
+		}
+		if err != nil {
+			return cookie, err
+		}
+	}
+
+	return cookie, nil
+}
+
+// serveOffline answers the request from the cache.
+// Reads are served from the local copy, the changes of the items are queued and applied to it in advance,
+// the status of a queued change is 202 Accepted
+func (c *Client) serveOffline(cache *Cache, src any, data []byte, dataType, version, path string) (int, any, error) {
+
+	switch {
+	case path == "/user/read" && dataType == "keymeta":
+		meta := cache.KeyMeta()
+		if meta == nil {
+			return 0, nil, ErrOffline
+		}
+		return http.StatusOK, *meta, nil
+	case path == "/user/read":
+		item, ok := cache.read(src)
+		if !ok {
+			return http.StatusNotFound, nil, nil
+		}
+		return http.StatusOK, item, nil
+	case path == "/user/search":
+		found := cache.search(src)
+		if found == nil {
+			return http.StatusBadRequest, nil, nil
+		}
+		return http.StatusOK, found, nil
+	case strings.HasPrefix(path, "/user/items"):
+		return http.StatusOK, cache.items(), nil
+	case strings.HasPrefix(path, "/user/find"):
+		found := cache.find(path)
+		if found == nil {
+			return http.StatusBadRequest, nil, nil
+		}
+		return http.StatusOK, *found, nil
+	case path == "/user/add" || path == "/user/update" || path == "/user/delete" || path == "/user/move":
+		if _, ok := storage.KindOf(dataType); !ok {
+			return 0, nil, ErrOffline
+		}
+
+		err := cache.Enqueue(Pending{
+			Path:     path,
+			DataType: dataType,
+			Version:  version,
+			Body:     data,
+		})
+		if err != nil {
+			return 0, nil, err
+		}
+		return http.StatusAccepted, nil, nil
+	}
+
+	return 0, nil, ErrOffline
+}
+
+// read returns the stored item with the id of src
+func (s *MemoryStore) read(src any) (storage.Item, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, ok := src.(storage.Item)
+	if !ok {
+		return nil, false
+	}
+
+	item, ok := s.byKind[t.Kind().Name][*t.Header().Id]
+	if !ok {
+		return nil, false
+	}
+
+	return clone(item), true
+}
+
+// search returns all stored items of the kind of the filter like the server does,
+// nil is returned for a filter by the name
+func (s *MemoryStore) search(filter any) []storage.Item {
+
+	t, ok := filter.(storage.Item)
+	if !ok || t.Kind().Search().Value(t) != "" {
+		return nil
+	}
+
+	found := []storage.Item{}
+	found = append(found, s.Vault().Items[t.Kind().Name]...)
+
+	return found
+}
+
+// items returns the metadata of all stored items in one page.
+// The store doesn't keep the timestamps, they are left zero
+func (s *MemoryStore) items() storage.ItemList {
+
+	vault := s.Vault()
+
+	list := storage.ItemList{Items: []storage.ItemMeta{}}
+
+	for _, kind := range storage.Kinds() {
+		for _, item := range vault.Items[kind.Name] {
+			list.Items = append(list.Items, itemMeta(item))
+		}
+	}
+
+	list.Total = len(list.Items)
+
+	return list
+}
+
+// itemMeta returns the metadata of the stored item
+func itemMeta(item storage.Item) storage.ItemMeta {
+	return storage.ItemMeta{
+		Id:         *item.Header().Id,
+		Type:       item.Kind().Name,
+		Name:       item.Kind().Search().Value(item),
+		Tags:       *item.Header().Tags,
+		SecretTags: *item.Header().SecretTags,
+		FolderId:   *item.Header().Folder,
+	}
+}
+
+// find ranks the stored items by the blinded tokens of the query in the path like the server does,
+// nil is returned for a malformed query
+func (s *MemoryStore) find(path string) *storage.ItemList {
+
+	u, err := url.Parse(path)
+	if err != nil {
+		return nil
+	}
+
+	tokens := u.Query()["token"]
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	limit := defaultFindLimit
+	if v := u.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return nil
+		}
+	}
+
+	vault := s.Vault()
+
+	list := storage.ItemList{Items: []storage.ItemMeta{}}
+
+	for _, kind := range storage.Kinds() {
+		for _, item := range vault.Items[kind.Name] {
+			index := make(map[string]bool)
+			for _, token := range strings.Fields(*item.Header().Index) {
+				index[token] = true
+			}
+
+			score := blindindex.Score(index, tokens)
+			if score < blindindex.MinScore(len(tokens)) {
+				continue
+			}
+
+			meta := itemMeta(item)
+			meta.Score = score
+			list.Items = append(list.Items, meta)
+		}
+	}
+
+	sort.SliceStable(list.Items, func(i, j int) bool {
+		return list.Items[i].Score > list.Items[j].Score
+	})
+
+	if len(list.Items) > limit {
+		list.Items = list.Items[:limit]
+	}
+
+	list.Total = len(list.Items)
+
+	return &list
+}
@@ -0,0 +1,194 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/EgorKo25/GophKeeper/internal/storage"
+)
+
+// Store is a local copy of the vault the changes pulled from the server are applied to
+type Store interface {
+	// Cursor returns the revision the store is synchronized to
+	Cursor() int64
+	// Apply applies the changes and moves the cursor
+	Apply(delta *storage.SyncDelta) error
+}
+
+// MemoryStore is a Store keeping the vault in memory,
+// the items are kept by kind name and id
+type MemoryStore struct {
+	mu     sync.RWMutex
+	cursor int64
+	byKind map[string]map[string]storage.Item
+}
+
+// NewMemoryStore is a constructor of an empty store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		byKind: newItemMaps(),
+	}
+}
+
+// newItemMaps returns an empty map of the items of every kind
+func newItemMaps() map[string]map[string]storage.Item {
+
+	items := make(map[string]map[string]storage.Item)
+	for _, kind := range storage.Kinds() {
+		items[kind.Name] = make(map[string]storage.Item)
+	}
+
+	return items
+}
+
+// put stores a copy of the item
+func (s *MemoryStore) put(item storage.Item) {
+	s.byKind[item.Kind().Name][*item.Header().Id] = clone(item)
+}
+
+// clone returns a copy of the item, so the stored items are not changed by the callers
+func clone(item storage.Item) storage.Item {
+
+	v := reflect.New(reflect.TypeOf(item).Elem())
+	v.Elem().Set(reflect.ValueOf(item).Elem())
+
+	return v.Interface().(storage.Item)
+}
+
+// Cursor returns the revision the store is synchronized to
+func (s *MemoryStore) Cursor() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.cursor
+}
+
+// Apply replaces the changed items, removes the deleted ones and moves the cursor
+func (s *MemoryStore) Apply(delta *storage.SyncDelta) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, items := range delta.Items {
+		for _, item := range items {
+			s.put(item)
+		}
+	}
+
+	for _, t := range delta.Deleted {
+		if _, ok := storage.KindOf(t.Type); !ok {
+			return errors.New("unknown deleted type " + t.Type)
+		}
+		delete(s.byKind[t.Type], t.Id)
+	}
+
+	if delta.Cursor > s.cursor {
+		s.cursor = delta.Cursor
+	}
+
+	return nil
+}
+
+// Vault returns a copy of the stored items ordered by id
+func (s *MemoryStore) Vault() *storage.UserDate {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	vault := storage.UserDate{
+		Items: make(storage.Items),
+	}
+
+	for _, kind := range storage.Kinds() {
+		items := make([]storage.Item, 0, len(s.byKind[kind.Name]))
+		for _, item := range s.byKind[kind.Name] {
+			items = append(items, clone(item))
+		}
+
+		sort.Slice(items, func(i, j int) bool { return *items[i].Header().Id < *items[j].Header().Id })
+		vault.Items[kind.Name] = items
+	}
+
+	return &vault
+}
+
+// Syncer pulls the vault changes from the server into a local store
+type Syncer struct {
+	c     *Client
+	store Store
+}
+
+// NewSyncer is a constructor
+func NewSyncer(c *Client, store Store) *Syncer {
+	return &Syncer{
+		c:     c,
+		store: store,
+	}
+}
+
+// Pull fetches the changes since the cursor of the store and applies them.
+// It returns the applied changes and the updated cookies
+func (s *Syncer) Pull(cookie []*http.Cookie) (int, *storage.SyncDelta, []*http.Cookie, error) {
+
+	code, tmp, cookie, err := s.c.Get(cookie, fmt.Sprintf("/user/sync?since=%d", s.store.Cursor()))
+	if code != http.StatusOK {
+		return code, nil, cookie, err
+	}
+
+	delta, ok := tmp.(storage.SyncDelta)
+	if !ok {
+		return code, nil, cookie, errors.New("unexpected sync response")
+	}
+
+	err = s.store.Apply(&delta)
+	if err != nil {
+		return code, nil, cookie, err
+	}
+
+	return code, &delta, cookie, nil
+}
+
+// store stores a copy of the item
+func (s *MemoryStore) store(item storage.Item) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.put(item)
+}
+
+// remove removes the item with the id of the item
+func (s *MemoryStore) remove(item storage.Item) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.byKind[item.Kind().Name], *item.Header().Id)
+}
+
+// rewind moves the cursor to the beginning, the next pull reads the whole vault
+func (s *MemoryStore) rewind() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cursor = 0
+}
+
+// load replaces the stored items and the cursor
+func (s *MemoryStore) load(cursor int64, vault *storage.UserDate) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cursor = cursor
+	s.byKind = newItemMaps()
+
+	if vault == nil {
+		return
+	}
+
+	for _, items := range vault.Items {
+		for _, item := range items {
+			s.put(item)
+		}
+	}
+}
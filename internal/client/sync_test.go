@@ -0,0 +1,183 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/EgorKo25/GophKeeper/internal/storage"
+)
+
+// fakeVault is a server vault recording the revision of every change
+type fakeVault struct {
+	mu       sync.Mutex
+	revision int64
+	changes  []change
+}
+
+// change is an item stored or deleted at the revision
+type change struct {
+	revision int64
+	password *storage.Password
+	card     *storage.Card
+	deleted  *storage.Tombstone
+}
+
+func (v *fakeVault) put(c change) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.revision++
+	c.revision = v.revision
+	v.changes = append(v.changes, c)
+}
+
+// ServeHTTP returns the latest state of the items changed since the cursor
+func (v *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	since, err := strconv.ParseInt(r.URL.Query().Get("since"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	latest := make(map[string]change)
+	for _, c := range v.changes {
+		switch {
+		case c.password != nil:
+			latest[c.password.Id] = c
+		case c.card != nil:
+			latest[c.card.Id] = c
+		case c.deleted != nil:
+			latest[c.deleted.Id] = c
+		}
+	}
+
+	delta := storage.SyncDelta{Cursor: v.revision, Items: make(storage.Items)}
+	for _, c := range latest {
+		if c.revision <= since {
+			continue
+		}
+		switch {
+		case c.password != nil:
+			delta.Items.Add(c.password)
+		case c.card != nil:
+			delta.Items.Add(c.card)
+		case c.deleted != nil:
+			delta.Deleted = append(delta.Deleted, *c.deleted)
+		}
+	}
+
+	w.Header().Set("Data-Type", "sync")
+	_ = json.NewEncoder(w).Encode(delta)
+}
+
+func TestSyncer_Pull(t *testing.T) {
+	vault := &fakeVault{}
+
+	server := httptest.NewServer(vault)
+	defer server.Close()
+
+	c := NewClient(server.URL, "laptop")
+
+	laptop := NewMemoryStore()
+	workstation := NewMemoryStore()
+
+	pull := func(store *MemoryStore) *storage.SyncDelta {
+		code, delta, _, err := NewSyncer(c, store).Pull(nil)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, code)
+		return delta
+	}
+
+	vault.put(change{password: &storage.Password{Id: "p1", Service: "yandex", Version: 1}})
+	vault.put(change{card: &storage.Card{Id: "c1", Bank: "tinkoff", Version: 1}})
+
+	delta := pull(laptop)
+	assert.Len(t, delta.Items["password"], 1)
+	assert.Len(t, delta.Items["card"], 1)
+	assert.Equal(t, int64(2), laptop.Cursor())
+
+	vault.put(change{password: &storage.Password{Id: "p1", Service: "yandex", Version: 2}})
+	vault.put(change{deleted: &storage.Tombstone{Id: "c1", Type: "card"}})
+	vault.put(change{password: &storage.Password{Id: "p2", Service: "google", Version: 1}})
+
+	delta = pull(laptop)
+	assert.Len(t, delta.Items["password"], 2)
+	assert.Empty(t, delta.Items["card"])
+	assert.Len(t, delta.Deleted, 1)
+
+	pull(workstation)
+
+	assert.Equal(t, laptop.Vault(), workstation.Vault())
+	assert.Equal(t, laptop.Cursor(), workstation.Cursor())
+
+	assert.Equal(t, []storage.Item{
+		&storage.Password{Id: "p1", Service: "yandex", Version: 2},
+		&storage.Password{Id: "p2", Service: "google", Version: 1},
+	}, laptop.Vault().Items["password"])
+	assert.Empty(t, laptop.Vault().Items["card"])
+
+	delta = pull(laptop)
+	assert.Empty(t, delta.Items["password"])
+	assert.Empty(t, delta.Deleted)
+}
+
+func TestMemoryStore_Apply(t *testing.T) {
+	store := NewMemoryStore()
+
+	require.NoError(t, store.Apply(&storage.SyncDelta{
+		Cursor: 5,
+		Items:  storage.Items{"bin": {&storage.BinaryData{Id: "b1", Title: "notes"}}},
+	}))
+
+	err := store.Apply(&storage.SyncDelta{
+		Cursor:  6,
+		Deleted: []storage.Tombstone{{Id: "b1", Type: "unknown"}},
+	})
+	assert.Error(t, err)
+
+	require.NoError(t, store.Apply(&storage.SyncDelta{
+		Cursor:  3,
+		Deleted: []storage.Tombstone{{Id: "b1", Type: "bin"}},
+	}))
+
+	assert.Empty(t, store.Vault().Items["bin"])
+	assert.Equal(t, int64(5), store.Cursor())
+}
+
+func TestMemoryStore_Find(t *testing.T) {
+	store := NewMemoryStore()
+
+	require.NoError(t, store.Apply(&storage.SyncDelta{
+		Cursor: 3,
+		Items: storage.Items{
+			"password": {
+				&storage.Password{Id: "p1", Service: "yandex", Index: "a b c d"},
+				&storage.Password{Id: "p2", Service: "google", Index: "a e"},
+			},
+			"folder": {&storage.Folder{Id: "f1", Name: "work", FolderId: "f0", Index: "b c"}},
+		},
+	}))
+
+	found := store.find("/user/find?token=b&token=c&token=d")
+	require.NotNil(t, found)
+	require.Equal(t, 2, found.Total)
+	assert.Equal(t, storage.ItemMeta{Id: "p1", Type: "password", Name: "yandex", Score: 3}, found.Items[0])
+	assert.Equal(t, storage.ItemMeta{Id: "f1", Type: "folder", Name: "work", FolderId: "f0", Score: 2}, found.Items[1])
+
+	found = store.find("/user/find?limit=1&token=a")
+	require.NotNil(t, found)
+	assert.Equal(t, 1, found.Total)
+
+	assert.Nil(t, store.find("/user/find"))
+	assert.Nil(t, store.find("/user/find?limit=x&token=a"))
+}
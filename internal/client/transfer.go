@@ -0,0 +1,60 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/EgorKo25/GophKeeper/internal/storage"
+)
+
+// ChunkSize is the size of a plain chunk of an uploaded file
+const ChunkSize = 1 << 20
+
+// PutChunk uploads the encrypted n-th chunk of the upload
+func (c *Client) PutChunk(cookie []*http.Cookie, upload string, n int, chunk []byte) (int, []*http.Cookie, error) {
+
+	resp, _, cookie, err := c.exchange(http.MethodPut, chunk, "", "", cookie,
+		"/user/upload/"+upload+"/"+strconv.Itoa(n))
+
+	c.setOnline(!errors.Is(err, ErrOffline))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return resp.StatusCode, cookie, nil
+}
+
+// CompleteUpload stores the uploaded file on the server, it returns the stored file item.
+// The upload replacing a file is guarded by the version of the file the client has read
+func (c *Client) CompleteUpload(cookie []*http.Cookie, upload string, version int64) (int, any, []*http.Cookie, error) {
+
+	resp, body, cookie, err := c.exchange(http.MethodPost, nil, "", ifMatch(&storage.BinaryData{Version: version}),
+		cookie, "/user/upload/"+upload+"/complete")
+
+	c.setOnline(!errors.Is(err, ErrOffline))
+	if err != nil {
+		return 0, nil, nil, err
+	}
+
+	res, err := c.anyTypeUnmarshal(resp.Header.Get("Data-Type"), body)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+
+	return resp.StatusCode, res, cookie, nil
+}
+
+// GetChunk downloads the encrypted n-th chunk of the file
+func (c *Client) GetChunk(cookie []*http.Cookie, file string, n int) (int, []byte, []*http.Cookie, error) {
+
+	resp, body, cookie, err := c.exchange(http.MethodGet, nil, "", "", cookie,
+		"/user/download/"+file+"/"+strconv.Itoa(n))
+
+	c.setOnline(!errors.Is(err, ErrOffline))
+	if err != nil {
+		return 0, nil, nil, err
+	}
+
+	return resp.StatusCode, body, cookie, nil
+}
@@ -0,0 +1,59 @@
+package client
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/EgorKo25/GophKeeper/internal/storage"
+)
+
+func TestClient_Transfer(t *testing.T) {
+	chunks := map[string][]byte{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/user/upload/u1/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/user/upload/u1/complete" {
+			assert.Equal(t, http.MethodPost, r.Method)
+			assert.Equal(t, `"3"`, r.Header.Get("If-Match"))
+
+			w.Header().Set("Data-Type", "bin")
+			_, _ = w.Write([]byte(`{"id":"f1","chunks":1,"version":4}`))
+			return
+		}
+
+		assert.Equal(t, http.MethodPut, r.Method)
+
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		chunks[r.URL.Path[len("/user/upload/u1/"):]] = body
+	})
+	mux.HandleFunc("/user/download/f1/0", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		_, _ = w.Write(chunks["0"])
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := NewClient(server.URL, "laptop")
+
+	code, _, err := c.PutChunk(nil, "u1", 0, []byte("sealed chunk"))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, code)
+
+	code, res, _, err := c.CompleteUpload(nil, "u1", 3)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, &storage.BinaryData{Id: "f1", Chunks: 1, Version: 4}, res)
+
+	code, chunk, _, err := c.GetChunk(nil, "f1", 0)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "sealed chunk", string(chunk))
+	assert.True(t, c.Status().Online)
+}
@@ -0,0 +1,206 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/EgorKo25/GophKeeper/internal/blob"
+	"github.com/EgorKo25/GophKeeper/internal/storage"
+)
+
+// chunkColumns is the column list of the chunks of the files
+const chunkColumns = `c.id, c.blob_key, c.blob_n, c.size, c.refs`
+
+// StoredChunks returns which of the chunk ids the user has stored
+func (m *ManagerDB) StoredChunks(ctx context.Context, ids []string, login string) (map[string]bool, error) {
+	childCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	stored := map[string]bool{}
+	if len(ids) == 0 {
+		return stored, nil
+	}
+
+	query, args, err := sqlx.In(`SELECT id FROM chunks WHERE owner_id = user_id(?) AND id IN (?);`, login, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	found := []string{}
+
+	err = m.Db.SelectContext(childCtx, &found, m.Db.Rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range found {
+		stored[id] = true
+	}
+
+	return stored, nil
+}
+
+// FileChunks returns the chunks of the file in order
+func (m *ManagerDB) FileChunks(ctx context.Context, bin *storage.BinaryData, login string) ([]storage.Chunk, error) {
+	childCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	chunks := []storage.Chunk{}
+
+	err := m.Db.SelectContext(childCtx, &chunks, `SELECT `+chunkColumns+` FROM file_chunks f
+		JOIN chunks c ON c.owner_id = f.owner_id AND c.id = f.chunk_id
+		WHERE f.file_id = $1 AND f.owner_id = user_id($2) ORDER BY f.n;`, bin.Id, login)
+	if err != nil {
+		return nil, err
+	}
+
+	return chunks, nil
+}
+
+// ReadChunk reads the n-th chunk of the file
+func (m *ManagerDB) ReadChunk(ctx context.Context, bin *storage.BinaryData, n int, login string) (*storage.Chunk, error) {
+	childCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	var chunk storage.Chunk
+
+	err := m.Db.GetContext(childCtx, &chunk, `SELECT `+chunkColumns+` FROM file_chunks f
+		JOIN chunks c ON c.owner_id = f.owner_id AND c.id = f.chunk_id
+		WHERE f.file_id = $1 AND f.owner_id = user_id($2) AND f.n = $3;`, bin.Id, login, n)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &chunk, nil
+}
+
+// Usage returns the storage used by the files of the user.
+// The files stored before the chunks were shared count as they are in both sizes
+func (m *ManagerDB) Usage(ctx context.Context, login string) (*storage.Usage, error) {
+	childCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	var usage storage.Usage
+
+	err := m.Db.GetContext(childCtx, &usage, `SELECT
+		(SELECT COUNT(*) FROM binary_data WHERE owner_id = user_id($1)) AS files,
+		(SELECT COUNT(*) FROM chunks WHERE owner_id = user_id($1) AND refs > 0) AS chunks,
+		(SELECT COALESCE(SUM(size), 0)::BIGINT FROM binary_data WHERE owner_id = user_id($1)) AS logical,
+		(SELECT COALESCE(SUM(size), 0)::BIGINT FROM chunks WHERE owner_id = user_id($1) AND refs > 0) +
+		(SELECT COALESCE(SUM(size), 0)::BIGINT FROM binary_data
+			WHERE owner_id = user_id($1) AND manifest = '') AS physical;`, login)
+	if err != nil {
+		return nil, err
+	}
+
+	return &usage, nil
+}
+
+// ReleaseChunks deletes the chunks of all users no file refers to and returns where they are kept.
+// The chunks a file is taking at the moment are skipped
+func (m *ManagerDB) ReleaseChunks(ctx context.Context) ([]blob.ChunkRef, error) {
+	childCtx, cancel := context.WithTimeout(ctx, vaultTimeout)
+	defer cancel()
+
+	released := []blob.ChunkRef{}
+
+	err := m.Db.SelectContext(childCtx, &released, `DELETE FROM chunks WHERE (owner_id, id) IN
+		(SELECT owner_id, id FROM chunks WHERE refs = 0 FOR UPDATE SKIP LOCKED)
+		RETURNING blob_key, blob_n;`)
+	if err != nil {
+		return nil, err
+	}
+
+	return released, nil
+}
+
+// acquireChunks counts the places of the chunks in the uploaded file and returns the size of the file.
+// A received chunk with a new id is kept at its place in the blob of the upload, the numbers
+// of the other received chunks are returned. A chunk neither stored nor received fails with ErrMissingChunk
+func acquireChunks(ctx context.Context, tx *sqlx.Tx, upload *storage.Upload,
+	received map[int]int64, login string) (int64, []int, error) {
+
+	uses := map[string]int{}
+	first := map[string]int{}
+	unused := []int{}
+
+	for n, id := range upload.ChunkIds {
+		uses[id]++
+
+		if _, ok := received[n]; !ok {
+			continue
+		}
+		if _, ok := first[id]; ok {
+			unused = append(unused, n)
+			continue
+		}
+		first[id] = n
+	}
+
+	sizes := make(map[string]int64, len(uses))
+
+	for id, count := range uses {
+		var chunk storage.Chunk
+
+		n, ok := first[id]
+		if !ok {
+			err := tx.QueryRowxContext(ctx, `UPDATE chunks SET refs = refs + $3
+				WHERE owner_id = user_id($1) AND id = $2 RETURNING size;`, login, id, count).Scan(&chunk.Size)
+			if errors.Is(err, sql.ErrNoRows) {
+				return 0, nil, ErrMissingChunk
+			}
+			if err != nil {
+				return 0, nil, err
+			}
+
+			sizes[id] = chunk.Size
+			continue
+		}
+
+		err := tx.QueryRowxContext(ctx, `INSERT INTO chunks (owner_id, id, blob_key, blob_n, size, refs)
+			VALUES (user_id($1), $2, $3, $4, $5, $6)
+			ON CONFLICT (owner_id, id) DO UPDATE SET refs = chunks.refs + EXCLUDED.refs
+			RETURNING blob_key, blob_n, size;`, login, id, upload.Id, n, received[n], count).StructScan(&chunk)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		if chunk.BlobKey != upload.Id || chunk.BlobN != n {
+			unused = append(unused, n)
+		}
+		sizes[id] = chunk.Size
+	}
+
+	var size int64
+	for _, id := range upload.ChunkIds {
+		size += sizes[id]
+	}
+
+	sort.Ints(unused)
+
+	return size, unused, nil
+}
+
+// releaseChunks removes the places of the chunks in the file, the chunks no file refers to
+// are deleted by the garbage collector
+func releaseChunks(ctx context.Context, db execer, bin *storage.BinaryData) error {
+
+	query := `WITH released AS (
+			DELETE FROM file_chunks WHERE file_id = :id AND owner_id = user_id(:login_owner) RETURNING chunk_id
+		)
+		UPDATE chunks SET refs = chunks.refs - r.uses
+		FROM (SELECT chunk_id, COUNT(*) AS uses FROM released GROUP BY chunk_id) AS r
+		WHERE chunks.owner_id = user_id(:login_owner) AND chunks.id = r.chunk_id;`
+
+	_, err := db.NamedExecContext(ctx, query, bin)
+
+	return err
+}
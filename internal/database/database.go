@@ -2,12 +2,14 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jmoiron/sqlx"
 
 	_ "github.com/jackc/pgx"
@@ -20,90 +22,105 @@ type Database interface {
 	Add(ctx context.Context, src any, login string) error
 	Update(ctx context.Context, src any, login string) error
 	Delete(ctx context.Context, src any, login string) error
+	Move(ctx context.Context, src any, login string) error
 	Read(ctx context.Context, src any, login string) ([]byte, error)
+	Search(ctx context.Context, src any, login string) ([]byte, error)
+	List(ctx context.Context, itemType string, limit, offset int, login string) ([]byte, error)
+	Find(ctx context.Context, tokens []string, minScore, limit int, login string) ([]byte, error)
+	Sync(ctx context.Context, since int64, login string) ([]byte, error)
+	AddUpload(ctx context.Context, upload *storage.Upload, login string) error
+	ReadUpload(ctx context.Context, upload *storage.Upload, login string) error
+	Uploads(ctx context.Context, login string) ([]storage.Upload, error)
+	CompleteUpload(ctx context.Context, upload *storage.Upload, bin *storage.BinaryData,
+		received map[int]int64, login string) ([]int, error)
+	ReadFile(ctx context.Context, bin *storage.BinaryData, login string) error
+	StoredChunks(ctx context.Context, ids []string, login string) (map[string]bool, error)
+	FileChunks(ctx context.Context, bin *storage.BinaryData, login string) ([]storage.Chunk, error)
+	ReadChunk(ctx context.Context, bin *storage.BinaryData, n int, login string) (*storage.Chunk, error)
+	Usage(ctx context.Context, login string) (*storage.Usage, error)
 	CheckUser(ctx context.Context, user *storage.User) (bool, error)
+	UpgradeUser(ctx context.Context, legacy string, user *storage.User) error
+	AddSession(ctx context.Context, session *storage.Session) error
+	RotateSession(ctx context.Context, tokenHash string, next *storage.Session) error
+	RevokeSessions(ctx context.Context, login, family string) error
 }
 
 var (
-	ErrRace = errors.New("the resource is busy")
+	ErrConflict = errors.New("the resource has been changed by another request")
+	ErrNotFound = errors.New("not found")
+	// ErrMissingChunk is returned when a file refers to a chunk that is neither stored nor uploaded
+	ErrMissingChunk = errors.New("chunk is missing")
+	// ErrUserExists is returned when the username or email is already registered
+	ErrUserExists = errors.New("user already exists")
+	// ErrFolderCycle is returned when a folder is moved into itself or into one of its subfolders
+	ErrFolderCycle = errors.New("folder can't be moved into itself")
 )
 
+// uniqueViolation is the SQLSTATE of a duplicate key
+const uniqueViolation = "23505"
+
+// vaultTimeout is a timeout for operations over the whole user vault
+const vaultTimeout = 30 * time.Second
+
+// execer is implemented by both *sqlx.DB and *sqlx.Tx
+type execer interface {
+	NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error)
+	BindNamed(query string, arg interface{}) (string, []interface{}, error)
+	QueryRowxContext(ctx context.Context, query string, args ...interface{}) *sqlx.Row
+}
+
+// ownerColumn selects the login of the owner, the rows reference the user by id
+const ownerColumn = `(SELECT username FROM users WHERE users.id = owner_id) AS login_owner`
+
 // ManagerDB structure for managing database
 type ManagerDB struct {
 	Db *sqlx.DB
 }
 
-// NewManagerDB constructor
-func NewManagerDB(address string) (*ManagerDB, error) {
+// NewManagerDB constructor, the pending migrations are applied when autoMigrate is set,
+// otherwise the schema must be up to date
+func NewManagerDB(address string, autoMigrate bool) (*ManagerDB, error) {
 
 	ctx := context.Background()
 
-	db, err := sqlx.Open("pgx", address)
+	db, err := Connect(address)
 	if err != nil {
 		return nil, err
 	}
 
-	err = createTable(ctx, db)
+	migrator, err := NewMigrator(db)
 	if err != nil {
 		return nil, err
 	}
 
-	return &ManagerDB{
-		Db: db,
-	}, nil
-}
-
-// createTable creates tables for the database operation
-func createTable(ctx context.Context, db *sqlx.DB) error {
-
-	childCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
-	defer cancel()
+	if autoMigrate {
+		applied, err := migrator.Up(ctx, 0)
+		if err != nil {
+			return nil, err
+		}
 
-	queries := []string{
-		`CREATE TABLE IF NOT EXISTS 
-    users (
-    id SERIAL PRIMARY KEY,
-    username VARCHAR(255) NOT NULL,
-    password VARCHAR(255) NOT NULL,
-    email VARCHAR(255) NOT NULL,
-    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
-    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
-    status BOOLEAN);`,
-
-		`CREATE TABLE IF NOT EXISTS
-	passwords (
-	id SERIAL PRIMARY KEY, 
-	service VARCHAR(255),
-	login_owner VARCHAR(255) NOT NULL,
-	login VARCHAR(255) NOT NULL,
-	password VARCHAR(64) NOT NULL);`,
-
-		`CREATE TABLE IF NOT EXISTS
-	cards (
-	id SERIAL PRIMARY KEY, 
-    bank VARCHAR(255),
-	login_owner VARCHAR(255) NOT NULL,
-	number VARCHAR(50) NOT NULL,
-	date_end VARCHAR(50) NOT NULL,
-	secret_code VARCHAR(50) NOT NULL,
-	owner VARCHAR(50) NOT NULL);`,
-
-		`CREATE TABLE IF NOT EXISTS
-	binary_data (
-	id SERIAL PRIMARY KEY,
-	title VARCHAR(255), 
-	login_owner VARCHAR(255) NOT NULL,
-	data bytea NOT NULL);`,
-	}
-
-	for _, query := range queries {
-		_, err := db.ExecContext(childCtx, query)
+		for _, m := range applied {
+			log.Printf("migration %d_%s applied", m.Version, m.Name)
+		}
+	} else {
+		pending, err := migrator.Pending(ctx)
 		if err != nil {
-			return err
+			return nil, err
+		}
+
+		if len(pending) > 0 {
+			return nil, fmt.Errorf("%w: %d pending", ErrSchemaOutdated, len(pending))
 		}
 	}
 
-	return nil
+	return &ManagerDB{
+		Db: db,
+	}, nil
+}
+
+// Connect opens the database without touching the schema
+func Connect(address string) (*sqlx.DB, error) {
+	return sqlx.Open("pgx", address)
 }
 
 // Ping testing connection to database
@@ -122,12 +139,21 @@ func (m *ManagerDB) CheckUser(ctx context.Context, user *storage.User) (bool, er
 
 	check.Login = user.Login
 
+	// an unknown user is compared against the dummy hash, so the response time is the same
 	err := m.readUser(childCtx, &check)
-	if err != nil {
+	if err != nil && !errors.Is(err, ErrNotFound) {
 		return false, err
 	}
 
-	return check.Password == user.Password, nil
+	ok, rehash := verifyPassword(check.Password, user.Password)
+	if rehash {
+		err = m.updateUserPassword(ctx, user.Login, user.Password)
+		if err != nil {
+			log.Printf("rehash password error: %s", err)
+		}
+	}
+
+	return ok, nil
 
 }
 
@@ -139,45 +165,38 @@ func (m *ManagerDB) Add(ctx context.Context, src any, login string) error {
 	switch data := src.(type) {
 	case *storage.User:
 		return m.addUser(childCtx, data)
-	case *storage.Password:
-		data.LoginOwner = login
-		return m.addPassword(childCtx, data)
-	case *storage.BinaryData:
+	case storage.Item:
+		*data.Header().LoginOwner = login
+		return m.withVaultLock(childCtx, login, true, func(tx *sqlx.Tx) error {
+			return m.addItem(childCtx, tx, data)
+		})
+	case *storage.KeyMeta:
 		data.LoginOwner = login
-		return m.addBinData(childCtx, data)
-	case *storage.Card:
-		data.LoginOwner = login
-		return m.addCard(childCtx, data)
+		return m.addKeyMeta(childCtx, data)
 	default:
 		return errors.New("unknown adding type " + fmt.Sprintf("%T", data))
 	}
 
 }
 
-// addPassword adds new password
-func (m *ManagerDB) addPassword(ctx context.Context, password *storage.Password) error {
-
-	childCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
-	defer cancel()
-
-	query := `INSERT INTO passwords (service, login_owner, login, password)
-							VALUES  (:service, :login_owner, :login, :password);`
+// queryReturning runs the insert or update and scans the columns it returns
+func queryReturning(ctx context.Context, db execer, query string, arg any, dest ...any) error {
 
-	_, err := m.Db.NamedExecContext(childCtx, query, password)
+	query, args, err := db.BindNamed(query, arg)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return db.QueryRowxContext(ctx, query, args...).Scan(dest...)
 }
 
-// addCard adds new card
-func (m *ManagerDB) addCard(childCtx context.Context, card *storage.Card) error {
+// addKeyMeta adds the key derivation parameters of the user
+func (m *ManagerDB) addKeyMeta(childCtx context.Context, meta *storage.KeyMeta) error {
 
-	query := `INSERT INTO cards (bank, login_owner, number, date_end, secret_code, owner)
-							VALUES  (:bank, :login_owner, :number, :date_end, :secret_code, :owner);`
+	query := `INSERT INTO key_metadata (owner_id, salt, time, memory, threads, key_check, content_key)
+							VALUES  (user_id(:login_owner), :salt, :time, :memory, :threads, :key_check, :content_key);`
 
-	_, err := m.Db.NamedExecContext(childCtx, query, card)
+	_, err := m.Db.NamedExecContext(childCtx, query, meta)
 	if err != nil {
 		return err
 	}
@@ -185,26 +204,25 @@ func (m *ManagerDB) addCard(childCtx context.Context, card *storage.Card) error
 	return nil
 }
 
-// addBinData adds new binary data
-func (m *ManagerDB) addBinData(childCtx context.Context, data *storage.BinaryData) error {
-
-	query := `INSERT INTO binary_data (title, login_owner, data)
-							VALUES  (:title, :login_owner, :data);`
+// addUser adds new user to the database, the password is stored hashed
+func (m *ManagerDB) addUser(childCtx context.Context, user *storage.User) error {
 
-	_, err := m.Db.NamedExecContext(childCtx, query, data)
+	hash, err := hashPassword(user.Password)
 	if err != nil {
 		return err
 	}
 
-	return nil
-}
-
-// addUser adds new user to the database
-func (m *ManagerDB) addUser(childCtx context.Context, user *storage.User) error {
+	stored := *user
+	stored.Password = hash
 
 	query := `INSERT INTO users (username, password, email, created_at, updated_at) 
 							VALUES  (:username, :password, :email, :created_at, :updated_at)`
-	_, err := m.Db.NamedExecContext(childCtx, query, user)
+	_, err = m.Db.NamedExecContext(childCtx, query, &stored)
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return ErrUserExists
+	}
 	if err != nil {
 		return err
 	}
@@ -224,44 +242,40 @@ func (m *ManagerDB) Read(ctx context.Context, src any, login string) ([]byte, er
 			return []byte(""), err
 		}
 
-		if data.Status {
-			return []byte(""), err
-		}
-
 		res, err := json.Marshal(&data)
 		if err != nil {
 			return []byte(""), err
 		}
 
 		return res, nil
-	case *storage.Password:
-		data.LoginOwner = login
-
-		err := m.readPassword(childCtx, data)
+	case storage.Item:
+		*data.Header().LoginOwner = login
+		err := m.readItem(childCtx, data)
 		if err != nil {
 			return []byte(""), err
 		}
 
-		res, err := json.Marshal(&data)
+		res, err := json.Marshal(data)
 		if err != nil {
 			return []byte(""), err
 		}
 
 		return res, nil
-	case *storage.BinaryData:
+	case *storage.KeyMeta:
 		data.LoginOwner = login
-		err := m.readBinary(childCtx, data)
+		err := m.readKeyMeta(childCtx, data)
 		if err != nil {
 			return []byte(""), err
 		}
-		res, err := json.Marshal(&data)
+
+		res, err := json.Marshal(data)
 		if err != nil {
 			return []byte(""), err
 		}
+
 		return res, nil
-	case *storage.Card:
-		data.LoginOwner = login
-		err := m.readCard(childCtx, data)
+	case *storage.UserDate:
+		err := m.readVault(ctx, data, login)
 		if err != nil {
 			return []byte(""), err
 		}
@@ -277,80 +291,65 @@ func (m *ManagerDB) Read(ctx context.Context, src any, login string) ([]byte, er
 	return nil, errors.New("unknown type: " + fmt.Sprintf("%T", src))
 }
 
-// readPassword read password
-func (m *ManagerDB) readPassword(childCtx context.Context, password *storage.Password) error {
+// readKeyMeta read the key derivation parameters of the user
+func (m *ManagerDB) readKeyMeta(childCtx context.Context, meta *storage.KeyMeta) error {
 
-	query := `SELECT * FROM passwords  WHERE service = :service AND login_owner = :login_owner;`
+	query := `SELECT id, ` + ownerColumn + `, salt, time, memory, threads, key_check, content_key
+		FROM key_metadata WHERE owner_id = user_id(:login_owner);`
 
-	rows, err := m.Db.NamedQueryContext(childCtx, query, password)
+	rows, err := m.Db.NamedQueryContext(childCtx, query, meta)
 	if err != nil {
 		return err
 	}
+	defer rows.Close()
 
-	rows.Next()
-	err = rows.StructScan(password)
-
-	if err != nil {
-		return err
+	if !rows.Next() {
+		return ErrNotFound
 	}
 
-	return nil
+	return rows.StructScan(meta)
 }
 
-// readCard read card data
-func (m *ManagerDB) readCard(childCtx context.Context, card *storage.Card) error {
-
-	query := `SELECT * FROM cards  WHERE login_owner = :login_owner AND bank = :bank;`
-
-	rows, err := m.Db.NamedQueryContext(childCtx, query, card)
-	if err != nil {
-		return err
-	}
-
-	rows.Next()
-	err = rows.StructScan(card)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
+// readVault read all items of the user together with the key metadata
+func (m *ManagerDB) readVault(ctx context.Context, vault *storage.UserDate, login string) error {
 
-// readBinary read binary data
-func (m *ManagerDB) readBinary(childCtx context.Context, binary *storage.BinaryData) error {
+	childCtx, cancel := context.WithTimeout(ctx, vaultTimeout)
+	defer cancel()
 
-	query := `SELECT * FROM binary_data WHERE title = :title AND login_owner = :login_owner;`
+	vault.Items = make(storage.Items)
 
-	log.Println(binary)
-	rows, err := m.Db.NamedQueryContext(childCtx, query, binary)
-	if err != nil {
-		return err
+	for _, kind := range storage.Kinds() {
+		err := selectItems(childCtx, m.Db, vault.Items, kind,
+			`SELECT `+itemColumns(kind)+` FROM `+kind.Table+` WHERE owner_id = user_id($1) ORDER BY id;`, login)
+		if err != nil {
+			return err
+		}
 	}
 
-	rows.Next()
-	err = rows.StructScan(binary)
-	if err != nil {
-		return err
-	}
+	vault.KeyMeta = &storage.KeyMeta{LoginOwner: login}
 
-	return nil
+	return m.readKeyMeta(childCtx, vault.KeyMeta)
 }
 
-// readUser read user data
+// readUser read user data, ErrNotFound is returned for an unknown username
 func (m *ManagerDB) readUser(childCtx context.Context, user *storage.User) error {
 
-	query := `SELECT * FROM users WHERE username = :username;`
+	query := `SELECT id, username, password, email, created_at, updated_at FROM users WHERE username = :username;`
 
 	rows, err := m.Db.NamedQueryContext(childCtx, query, user)
 	if err != nil {
 		return err
 	}
+	defer rows.Close()
 
-	rows.Next()
-	_ = rows.StructScan(user)
-
-	return nil
+	if !rows.Next() {
+		if err = rows.Err(); err != nil {
+			return err
+		}
+		return ErrNotFound
+	}
 
+	return rows.StructScan(user)
 }
 
 // Update updates data from database
@@ -361,28 +360,56 @@ func (m *ManagerDB) Update(ctx context.Context, src any, login string) error {
 	switch data := src.(type) {
 	case *storage.User:
 		return m.updateUser(childCtx, data)
-	case *storage.Password:
-		data.LoginOwner = login
-		return m.updatePassword(childCtx, data)
 	case *storage.BinaryData:
+		// the chunks of the file are released, the changes of their counters are serialized
 		data.LoginOwner = login
-		return m.updateBinData(childCtx, data)
-	case *storage.Card:
+		return m.withVaultLock(childCtx, login, false, func(tx *sqlx.Tx) error {
+			return m.updateBinData(childCtx, tx, data)
+		})
+	case storage.Item:
+		*data.Header().LoginOwner = login
+		return m.withVaultLock(childCtx, login, true, func(tx *sqlx.Tx) error {
+			return m.updateItem(childCtx, tx, data)
+		})
+	case *storage.KeyMeta:
+		// the content key may be set, it must not race the replacement of the vault
 		data.LoginOwner = login
-		return m.updateCard(childCtx, data)
+		return m.withVaultLock(childCtx, login, true, func(tx *sqlx.Tx) error {
+			return m.updateKeyMeta(childCtx, tx, data)
+		})
+	case *storage.UserDate:
+		return m.replaceVault(ctx, data, login)
 	default:
 		return errors.New("unknown updating type " + fmt.Sprintf("%T", data))
 	}
 
 }
 
-// updatePassword update user password
-func (m *ManagerDB) updatePassword(childCtx context.Context, password *storage.Password) error {
+// updateBinData update user binary data by id of the version the client has read,
+// an update changes only the title, the tags, the custom fields and the search index of the file,
+// its content is replaced through an upload
+func (m *ManagerDB) updateBinData(childCtx context.Context, db execer, binary *storage.BinaryData) error {
+
+	return updateReturning(childCtx, db, `UPDATE binary_data
+                 SET title = :title, tags = :tags, secret_tags = :secret_tags, custom = :custom, search_index = :search_index,
+                 modified_by = :modified_by, version = version + 1, updated_at = NOW(),
+                 revision = nextval('vault_revision_seq')
+                 WHERE id = :id AND owner_id = user_id(:login_owner) AND version = :version
+                 RETURNING version, revision;`,
+		`SELECT id FROM binary_data WHERE id = :id AND owner_id = user_id(:login_owner);`, binary,
+		&binary.Version, &binary.Revision)
+}
 
-	query := `UPDATE passwords SET service = :service, login = :login, password = :password 
-                 WHERE login_owner = :login_owner AND service = :service;`
+// updateKeyMeta update the key derivation parameters of the user.
+// The content key is set only once: the first device to create it wins and the others read it back
+func (m *ManagerDB) updateKeyMeta(childCtx context.Context, db execer, meta *storage.KeyMeta) error {
 
-	_, err := m.Db.NamedExecContext(childCtx, query, password)
+	query := `UPDATE key_metadata SET salt = :salt, time = :time, memory = :memory,
+                 threads = :threads, key_check = :key_check,
+                 content_key = CASE WHEN content_key = '' THEN :content_key ELSE content_key END
+                 WHERE owner_id = user_id(:login_owner);`
+
+	_, err := db.NamedExecContext(childCtx, query, meta)
 	if err != nil {
 		return err
 	}
@@ -390,38 +417,85 @@ func (m *ManagerDB) updatePassword(childCtx context.Context, password *storage.P
 	return nil
 }
 
-// updateCard update user card
-func (m *ManagerDB) updateCard(childCtx context.Context, card *storage.Card) error {
+// replaceVault replaces the content of all items of the user and the key metadata in one transaction,
+// so a re-encrypted vault is either stored completely or not at all.
+// Items are matched by id and version, a vault changed since it was read is rejected with ErrConflict
+func (m *ManagerDB) replaceVault(ctx context.Context, vault *storage.UserDate, login string) error {
 
-	query := `UPDATE cards SET bank = :bank, number = :number, date_end = :date_end,
-                 secret_code = :secret_code, owner = :owner
-                 WHERE login_owner = :login_owner AND bank = :bank;`
+	childCtx, cancel := context.WithTimeout(ctx, vaultTimeout)
+	defer cancel()
 
-	_, err := m.Db.NamedExecContext(childCtx, query, card)
+	if vault.KeyMeta == nil {
+		return errors.New("vault without key metadata")
+	}
+
+	tx, err := m.Db.BeginTxx(childCtx, nil)
 	if err != nil {
 		return err
 	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
 
-	return nil
-}
+	err = lockVault(childCtx, tx, login, false)
+	if err != nil {
+		return err
+	}
+
+	for _, kind := range storage.Kinds() {
+		var count int
+
+		err = tx.GetContext(childCtx, &count,
+			`SELECT COUNT(*) FROM `+kind.Table+` WHERE owner_id = user_id($1);`, login)
+		if err != nil {
+			return err
+		}
+
+		if count != len(vault.Items[kind.Name]) {
+			return ErrConflict
+		}
 
-// updateBinDAta update user binary data
-func (m *ManagerDB) updateBinData(childCtx context.Context, binary *storage.BinaryData) error {
+		for _, item := range vault.Items[kind.Name] {
+			*item.Header().LoginOwner = login
+			err = replaceVaultItem(childCtx, tx, item)
+			if err != nil {
+				return err
+			}
+		}
+	}
 
-	query := `UPDATE binary_data SET data = :data WHERE login_owner = :login_owner AND title = :title;`
+	vault.KeyMeta.LoginOwner = login
+	err = m.updateKeyMeta(childCtx, tx, vault.KeyMeta)
+	if err != nil {
+		return err
+	}
+
+	// the content key is encrypted with the new vault key,
+	// a key created since the vault was read would be lost otherwise
+	var contentKey string
 
-	_, err := m.Db.NamedExecContext(childCtx, query, binary)
+	err = tx.GetContext(childCtx, &contentKey, `SELECT content_key FROM key_metadata WHERE owner_id = user_id($1);`, login)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	if contentKey != "" && vault.KeyMeta.ContentKey == "" {
+		return ErrConflict
+	}
+
+	_, err = tx.NamedExecContext(childCtx,
+		`UPDATE key_metadata SET content_key = :content_key WHERE owner_id = user_id(:login_owner);`, vault.KeyMeta)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 // updateUser update user
 func (m *ManagerDB) updateUser(childCtx context.Context, user *storage.User) error {
 
-	query := `UPDATE users SET username = :username, status = :status
+	query := `UPDATE users SET email = :email, updated_at = NOW()
                  WHERE username = :username;`
 
 	_, err := m.Db.NamedExecContext(childCtx, query, user)
@@ -439,67 +513,55 @@ func (m *ManagerDB) Delete(ctx context.Context, src any, login string) error {
 
 	switch data := src.(type) {
 	case *storage.User:
+		data.Login = login
 		return m.deleteUser(childCtx, data)
-	case *storage.Password:
-		data.LoginOwner = login
-		return m.deletePassword(childCtx, data)
 	case *storage.BinaryData:
+		// the chunks of the file are released, the changes of their counters are serialized
 		data.LoginOwner = login
-		return m.deleteBinData(childCtx, data)
-	case *storage.Card:
+		return m.withVaultLock(childCtx, login, false, func(tx *sqlx.Tx) error {
+			err := m.deleteItem(childCtx, tx, data)
+			if err != nil {
+				return err
+			}
+
+			return releaseChunks(childCtx, tx, data)
+		})
+	case *storage.Folder:
+		// the content of the folder is moved, the tree must not change meanwhile
 		data.LoginOwner = login
-		return m.deleteCard(childCtx, data)
+		return m.withVaultLock(childCtx, login, false, func(tx *sqlx.Tx) error {
+			return m.deleteFolder(childCtx, tx, data)
+		})
+	case storage.Item:
+		*data.Header().LoginOwner = login
+		return m.withVaultLock(childCtx, login, true, func(tx *sqlx.Tx) error {
+			return m.deleteItem(childCtx, tx, data)
+		})
 	default:
 	}
 
-	return errors.New("unknown updating type")
+	return errors.New("unknown deleting type")
 }
 
-// deletePassword delete pair login:password:service from db
-func (m *ManagerDB) deletePassword(childCtx context.Context, password *storage.Password) error {
+// deleteUser delete user profile, the vault, sessions and uploads of the user are deleted along.
+// The blobs of the files are left to the garbage collector
+func (m *ManagerDB) deleteUser(childCtx context.Context, user *storage.User) error {
 
-	query := `DELETE FROM passwords WHERE login_owner = :login_owner AND service = :service;`
+	query := `DELETE FROM users WHERE username = :username;`
 
-	_, err := m.Db.NamedExecContext(childCtx, query, password)
+	res, err := m.Db.NamedExecContext(childCtx, query, user)
 	if err != nil {
 		return err
 	}
 
-	return nil
-}
-
-// deleteCard delete user card
-func (m *ManagerDB) deleteCard(childCtx context.Context, card *storage.Card) error {
-
-	query := `DELETE FROM cards WHERE login_owner = :login_owner AND bank = :bank;`
-
-	_, err := m.Db.NamedExecContext(childCtx, query, card)
+	n, err := res.RowsAffected()
 	if err != nil {
 		return err
 	}
-	return nil
-}
 
-// deleteBinData delete user card
-func (m *ManagerDB) deleteBinData(childCtx context.Context, data *storage.BinaryData) error {
-
-	query := `DELETE FROM binary_data WHERE login_owner = :login_owner AND title = :title;`
-
-	_, err := m.Db.NamedExecContext(childCtx, query, data)
-	if err != nil {
-		return err
+	if n == 0 {
+		return ErrNotFound
 	}
-	return nil
-}
-
-// deleteUser delete user profile
-func (m *ManagerDB) deleteUser(childCtx context.Context, user *storage.User) error {
-
-	query := `DELETE FROM users WHERE login = :login;`
 
-	_, err := m.Db.NamedExecContext(childCtx, query, user)
-	if err != nil {
-		return err
-	}
 	return nil
 }
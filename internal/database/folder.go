@@ -0,0 +1,110 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/EgorKo25/GophKeeper/internal/storage"
+)
+
+// folderAncestors selects the folder of the folder_id parameter and all folders it is in
+const folderAncestors = `WITH RECURSIVE ancestors AS (
+		SELECT id, folder_id FROM folders WHERE id::text = :folder_id AND owner_id = user_id(:login_owner)
+		UNION ALL
+		SELECT folders.id, folders.folder_id FROM folders JOIN ancestors ON folders.id = ancestors.folder_id
+	) SELECT id FROM ancestors;`
+
+// Move moves the item or the folder into the folder of its folder id, an empty one moves it to the top level.
+// The version of the item is kept, so the move doesn't conflict with the changes of its fields
+func (m *ManagerDB) Move(ctx context.Context, src any, login string) error {
+	childCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	data, ok := src.(storage.Item)
+	if !ok {
+		return errors.New("unknown moving type " + fmt.Sprintf("%T", src))
+	}
+
+	*data.Header().LoginOwner = login
+
+	// the moves of the folders are serialized, two of them must not make a cycle together
+	shared := data.Kind() != storage.FolderKind
+
+	return m.withVaultLock(childCtx, login, shared, func(tx *sqlx.Tx) error {
+		return m.moveItem(childCtx, tx, data)
+	})
+}
+
+// moveItem sets the folder of the item, a folder is never moved into itself or into its subfolders
+func (m *ManagerDB) moveItem(ctx context.Context, tx *sqlx.Tx, item storage.Item) error {
+
+	kind := item.Kind()
+	h := item.Header()
+
+	if *h.Folder != "" {
+		query, args, err := tx.BindNamed(folderAncestors, item)
+		if err != nil {
+			return err
+		}
+
+		var ancestors []string
+		err = tx.SelectContext(ctx, &ancestors, query, args...)
+		if err != nil {
+			return err
+		}
+
+		if len(ancestors) == 0 {
+			return ErrNotFound
+		}
+
+		for _, id := range ancestors {
+			if kind == storage.FolderKind && id == *h.Id {
+				return ErrFolderCycle
+			}
+		}
+	}
+
+	query := `UPDATE ` + kind.Table + ` SET folder_id = ` + ownFolder + `,
+                 modified_by = :modified_by, updated_at = NOW(), revision = nextval('vault_revision_seq')
+                 WHERE ` + ownItem + `
+                 RETURNING revision;`
+
+	err := queryReturning(ctx, tx, query, item, h.Revision)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+
+	return err
+}
+
+// deleteFolder deletes the folder of the version the client has read,
+// its items and subfolders are moved to the folder it is in
+func (m *ManagerDB) deleteFolder(ctx context.Context, tx *sqlx.Tx, folder *storage.Folder) error {
+
+	var parent sql.NullString
+
+	err := tx.GetContext(ctx, &parent,
+		`SELECT folder_id FROM folders WHERE id = $1 AND owner_id = user_id($2);`, folder.Id, folder.LoginOwner)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, kind := range storage.Kinds() {
+		_, err = tx.ExecContext(ctx, `UPDATE `+kind.Table+` SET folder_id = $1,
+                 updated_at = NOW(), revision = nextval('vault_revision_seq')
+                 WHERE folder_id = $2 AND owner_id = user_id($3);`, parent, folder.Id, folder.LoginOwner)
+		if err != nil {
+			return err
+		}
+	}
+
+	return m.deleteItem(ctx, tx, folder)
+}
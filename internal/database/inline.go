@@ -0,0 +1,86 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/EgorKo25/GophKeeper/internal/blob"
+)
+
+// MoveInlineFiles moves the content of the files stored in the database before the blob store
+// into the blob store and returns the number of moved files.
+// The content is moved as it is, encrypted with the vault key, as the only chunk of the blob of the file,
+// the clients upload it again in chunks encrypted with a file key
+func (m *ManagerDB) MoveInlineFiles(ctx context.Context, blobs blob.BlobStore) (int, error) {
+
+	childCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	ids := []string{}
+	err := m.Db.SelectContext(childCtx, &ids, `SELECT id FROM binary_data WHERE length(data) > 0;`)
+	cancel()
+	if err != nil {
+		return 0, err
+	}
+
+	moved := 0
+	for _, id := range ids {
+		ok, err := m.moveInlineFile(ctx, blobs, id)
+		if err != nil {
+			return moved, err
+		}
+		if ok {
+			moved++
+		}
+	}
+
+	return moved, nil
+}
+
+// moveInlineFile moves the content of the file into the blob store, false is returned for a file
+// whose content is gone meanwhile. The blob key is stored before the blob is put, so the collector
+// never takes the blob for an orphan, and the content is cleared only after the blob is put.
+// A move interrupted between them puts the blob again under the same key
+func (m *ManagerDB) moveInlineFile(ctx context.Context, blobs blob.BlobStore, id string) (bool, error) {
+
+	childCtx, cancel := context.WithTimeout(ctx, vaultTimeout)
+	defer cancel()
+
+	var file struct {
+		BlobKey string `db:"blob_key"`
+		Data    []byte `db:"data"`
+	}
+
+	err := m.Db.GetContext(childCtx, &file, `UPDATE binary_data
+		SET blob_key = CASE WHEN blob_key = '' THEN gen_random_uuid()::text ELSE blob_key END
+		WHERE id = $1 AND length(data) > 0
+		RETURNING blob_key, data;`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	_, err = blobs.Put(file.BlobKey, 0, bytes.NewReader(file.Data))
+	if err != nil {
+		return false, err
+	}
+
+	// the file replaced by an upload meanwhile has another blob key, the put blob is left to the collector
+	res, err := m.Db.ExecContext(childCtx, `UPDATE binary_data
+		SET data = '', size = length(data), chunks = 1, manifest = '', file_key = '',
+		revision = nextval('vault_revision_seq')
+		WHERE id = $1 AND blob_key = $2 AND length(data) > 0;`, id, file.BlobKey)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
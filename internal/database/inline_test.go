@@ -0,0 +1,62 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/EgorKo25/GophKeeper/internal/blob"
+	"github.com/EgorKo25/GophKeeper/internal/storage"
+)
+
+func TestMoveInlineFiles(t *testing.T) {
+	m := testDB(t)
+	ctx := context.Background()
+
+	login := fmt.Sprintf("inline-%d", time.Now().UnixNano())
+	require.NoError(t, m.Add(ctx, &storage.User{Login: login, Password: "secret", Email: login + "@example.com",
+		CreatedAt: time.Now(), UpdatedAt: time.Now()}, login))
+	t.Cleanup(func() {
+		_ = m.Delete(context.Background(), &storage.User{}, login)
+	})
+
+	var id string
+	require.NoError(t, m.Db.GetContext(ctx, &id, `INSERT INTO binary_data (title, owner_id, data)
+		VALUES ('title', user_id($1), 'sealed') RETURNING id;`, login))
+
+	blobs, err := blob.NewFileStore(t.TempDir())
+	require.NoError(t, err)
+
+	moved, err := m.MoveInlineFiles(ctx, blobs)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, moved, 1)
+
+	bin := &storage.BinaryData{Id: id}
+	require.NoError(t, m.ReadFile(ctx, bin, login))
+	assert.Equal(t, 1, bin.Chunks)
+	assert.Equal(t, int64(len("sealed")), bin.Size)
+	assert.Empty(t, bin.Manifest)
+	assert.Empty(t, bin.Key)
+
+	r, _, err := blobs.Get(bin.BlobKey, 0)
+	require.NoError(t, err)
+	defer r.Close()
+
+	content, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "sealed", string(content))
+
+	var left int
+	require.NoError(t, m.Db.GetContext(ctx, &left, `SELECT length(data) FROM binary_data WHERE id = $1;`, id))
+	assert.Zero(t, left)
+
+	// the moved file isn't moved again
+	moved, err = m.MoveInlineFiles(ctx, blobs)
+	require.NoError(t, err)
+	assert.Zero(t, moved)
+}
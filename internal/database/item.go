@@ -0,0 +1,186 @@
+package database
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/EgorKo25/GophKeeper/internal/storage"
+)
+
+// folderColumn selects the folder of the item, it is empty for the items at the top level
+const folderColumn = `COALESCE(folder_id::text, '') AS folder_id`
+
+// ownFolder is the folder of the folder_id parameter if the user owns it and NULL otherwise,
+// so an item is never put into a folder of another user
+const ownFolder = `(SELECT folders.id FROM folders
+		WHERE folders.id::text = :folder_id AND folders.owner_id = user_id(:login_owner))`
+
+// itemColumns returns the column list of the items of the kind,
+// the tables may contain columns unknown to the item types
+func itemColumns(kind *storage.Kind) string {
+
+	columns := kind.Columns()
+	for i, column := range columns {
+		switch column {
+		case "login_owner":
+			columns[i] = ownerColumn
+		case "folder_id":
+			columns[i] = folderColumn
+		}
+	}
+
+	return strings.Join(columns, ", ")
+}
+
+// commonColumns are the columns the items of every kind have besides the fields of the kind
+var commonColumns = []string{"tags", "secret_tags", "custom", "search_index"}
+
+// fieldColumns returns the columns of the fields of the kind and the common columns with their named parameters
+func fieldColumns(kind *storage.Kind) (columns, params []string) {
+
+	for _, f := range kind.Fields {
+		columns = append(columns, f.Name)
+	}
+	columns = append(columns, commonColumns...)
+
+	for _, column := range columns {
+		params = append(params, ":"+column)
+	}
+
+	return columns, params
+}
+
+// setFields returns the assignments of the fields of the kind and of the common columns
+func setFields(kind *storage.Kind) string {
+
+	columns, params := fieldColumns(kind)
+
+	set := make([]string, 0, len(columns))
+	for i, column := range columns {
+		set = append(set, column+" = "+params[i])
+	}
+
+	return strings.Join(set, ", ")
+}
+
+// ownItem is the condition matching the item by id and owner
+const ownItem = `id = :id AND owner_id = user_id(:login_owner)`
+
+// addItem adds new item into its folder, an unknown folder puts the item at the top level.
+// The folder of a stored item is changed only by moving it
+func (m *ManagerDB) addItem(ctx context.Context, db execer, item storage.Item) error {
+
+	kind := item.Kind()
+	columns, params := fieldColumns(kind)
+
+	query := `INSERT INTO ` + kind.Table + ` (` + strings.Join(columns, ", ") + `, folder_id, owner_id, modified_by)
+							VALUES  (` + strings.Join(params, ", ") + `, ` + ownFolder + `, user_id(:login_owner), :modified_by)
+							RETURNING id, version, revision;`
+
+	h := item.Header()
+
+	return queryReturning(ctx, db, query, item, h.Id, h.Version, h.Revision)
+}
+
+// readItem read item by id
+func (m *ManagerDB) readItem(ctx context.Context, item storage.Item) error {
+
+	kind := item.Kind()
+
+	query := `SELECT ` + itemColumns(kind) + ` FROM ` + kind.Table + ` WHERE ` + ownItem + `;`
+
+	rows, err := m.Db.NamedQueryContext(ctx, query, item)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return ErrNotFound
+	}
+
+	return rows.StructScan(item)
+}
+
+// updateItem update item by id of the version the client has read
+func (m *ManagerDB) updateItem(ctx context.Context, db execer, item storage.Item) error {
+
+	kind := item.Kind()
+
+	query := `UPDATE ` + kind.Table + ` SET ` + setFields(kind) + `,
+                 modified_by = :modified_by, version = version + 1, updated_at = NOW(),
+                 revision = nextval('vault_revision_seq')
+                 WHERE ` + ownItem + ` AND version = :version
+                 RETURNING version, revision;`
+
+	h := item.Header()
+
+	return updateReturning(ctx, db, query,
+		`SELECT id FROM `+kind.Table+` WHERE `+ownItem+`;`, item, h.Version, h.Revision)
+}
+
+// deleteItem delete item by id of the version the client has read,
+// the deletion is recorded for the other devices of the user
+func (m *ManagerDB) deleteItem(ctx context.Context, db execer, item storage.Item) error {
+
+	kind := item.Kind()
+
+	query := `DELETE FROM ` + kind.Table + ` WHERE ` + ownItem + ` AND version = :version;`
+
+	res, err := db.NamedExecContext(ctx, query, item)
+	if err != nil {
+		return err
+	}
+
+	err = checkVersion(ctx, db, res, `SELECT id FROM `+kind.Table+` WHERE `+ownItem+`;`, item)
+	if err != nil {
+		return err
+	}
+
+	h := item.Header()
+
+	return addTombstone(ctx, db, *h.Id, kind.Name, *h.LoginOwner)
+}
+
+// replaceVaultItem replaces the fields of the item of the version the vault was read at
+func replaceVaultItem(ctx context.Context, db execer, item storage.Item) error {
+
+	kind := item.Kind()
+
+	err := replaceItem(ctx, db, `UPDATE `+kind.Table+`
+			SET `+setFields(kind)+`, modified_by = :modified_by,
+			version = version + 1, updated_at = NOW(),
+			revision = nextval('vault_revision_seq')
+			WHERE `+ownItem+` AND version = :version;`, item)
+	if err != nil {
+		return err
+	}
+
+	*item.Header().Version++
+
+	return nil
+}
+
+// selectItems adds the items of the kind selected by the query
+func selectItems(ctx context.Context, db sqlx.QueryerContext, items storage.Items, kind *storage.Kind,
+	query string, args ...any) error {
+
+	rows, err := db.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := kind.New()
+		err = rows.StructScan(item)
+		if err != nil {
+			return err
+		}
+		items.Add(item)
+	}
+
+	return rows.Err()
+}
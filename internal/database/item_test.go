@@ -0,0 +1,85 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/EgorKo25/GophKeeper/internal/storage"
+)
+
+func TestItemQueries(t *testing.T) {
+	assert.Equal(t, `id, service, `+ownerColumn+`, login, password, `+folderColumn+`, tags, secret_tags, custom, search_index, version, revision, modified_by`,
+		itemColumns(storage.PasswordKind))
+
+	assert.Equal(t, `bank = :bank, number = :number, date_end = :date_end, secret_code = :secret_code, owner = :owner, `+
+		`tags = :tags, secret_tags = :secret_tags, custom = :custom, search_index = :search_index`,
+		setFields(storage.CardKind))
+
+	// the columns of the blob store are read but never set from the request
+	assert.Contains(t, itemColumns(storage.FileKind), "blob_key")
+	assert.NotContains(t, setFields(storage.FileKind), "blob_key")
+
+	// the folder is changed only by moving the item
+	assert.NotContains(t, setFields(storage.FolderKind), "folder_id")
+
+	for _, kind := range storage.Kinds() {
+		assert.Contains(t, itemsQuery(), `'`+kind.Name+`' AS type`)
+		assert.Contains(t, findQuery(), `FROM `+kind.Table+` WHERE`)
+	}
+}
+
+func TestConcurrentUpdate(t *testing.T) {
+	m := testDB(t)
+	ctx := context.Background()
+
+	login := fmt.Sprintf("race-%d", time.Now().UnixNano())
+	require.NoError(t, m.Add(ctx, &storage.User{Login: login, Password: "secret", Email: login + "@example.com",
+		CreatedAt: time.Now(), UpdatedAt: time.Now()}, login))
+	t.Cleanup(func() {
+		_ = m.Delete(context.Background(), &storage.User{}, login)
+	})
+
+	item := &storage.Password{Service: "service", Login: "me", Password: "old"}
+	require.NoError(t, m.Add(ctx, item, login))
+
+	for round := 0; round < 10; round++ {
+		errs := make([]error, 2)
+
+		var wg sync.WaitGroup
+		for i := range errs {
+			change := *item
+			change.Password = fmt.Sprintf("new-%d-%d", round, i)
+
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs[i] = m.Update(ctx, &change, login)
+				if errs[i] == nil {
+					*item = change
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		// exactly one of the changes of the same version wins, the other one is stale
+		if errs[0] == nil {
+			errs[0], errs[1] = errs[1], errs[0]
+		}
+		require.NoError(t, errs[1], "round %d", round)
+		require.ErrorIs(t, errs[0], ErrConflict, "round %d", round)
+	}
+
+	stale := *item
+	stale.Version--
+	assert.ErrorIs(t, m.Delete(ctx, &stale, login), ErrConflict)
+
+	require.NoError(t, m.Delete(ctx, item, login))
+	assert.ErrorIs(t, m.Update(ctx, item, login), ErrNotFound)
+	assert.ErrorIs(t, m.Delete(ctx, item, login), ErrNotFound)
+}
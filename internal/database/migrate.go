@@ -0,0 +1,374 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	// ErrChecksumMismatch is returned when an applied migration has been changed afterwards
+	ErrChecksumMismatch = errors.New("applied migration has been changed")
+	// ErrIrreversible is returned when a migration to roll back has no down script
+	ErrIrreversible = errors.New("migration can't be rolled back")
+	// ErrUnknownMigration is returned when the database has a migration this build doesn't know,
+	// the database has been migrated by a newer server
+	ErrUnknownMigration = errors.New("unknown migration applied")
+	// ErrSchemaOutdated is returned at startup when there are pending migrations and auto-migration is off
+	ErrSchemaOutdated = errors.New("database schema is outdated, run the migrate command")
+)
+
+// migrationLockSpace is the first key of the advisory lock held while migrating,
+// so the replicas starting at the same time apply the migrations once
+const migrationLockSpace = 2
+
+// migrationTimeout is a timeout for applying or rolling back the migrations
+const migrationTimeout = 10 * time.Minute
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationName matches the files of the migrations: 0001_initial.up.sql and 0001_initial.down.sql
+var migrationName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is a versioned change of the schema
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	// Down is empty for the migrations which can't be rolled back
+	Down string
+	// Checksum is the SHA-256 of the up script, an applied migration must not change
+	Checksum string
+}
+
+// MigrationStatus is a migration and the time it was applied at
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// appliedMigration is a row of the schema_migrations table
+type appliedMigration struct {
+	Version   int       `db:"version"`
+	Name      string    `db:"name"`
+	Checksum  string    `db:"checksum"`
+	AppliedAt time.Time `db:"applied_at"`
+}
+
+// LoadMigrations reads the migrations from the directory of the file system ordered by version
+func LoadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := migrationName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			return nil, fmt.Errorf("unexpected migration file %s", entry.Name())
+		}
+
+		version, err := strconv.Atoi(match[1])
+		if err != nil || version == 0 {
+			return nil, fmt.Errorf("invalid migration version %s", entry.Name())
+		}
+
+		script, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(script)
+			sum := sha256.Sum256(script)
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(script)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d has no up script", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Migrator applies and rolls back the embedded migrations
+type Migrator struct {
+	db         *sqlx.DB
+	migrations []Migration
+}
+
+// NewMigrator is a constructor
+func NewMigrator(db *sqlx.DB) (*Migrator, error) {
+
+	migrations, err := LoadMigrations(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		db:         db,
+		migrations: migrations,
+	}, nil
+}
+
+// Up applies the pending migrations up to the target version, zero is the latest version.
+// The applied migrations are returned
+func (m *Migrator) Up(ctx context.Context, target int) ([]Migration, error) {
+
+	var done []Migration
+
+	err := m.locked(ctx, func(conn *sqlx.Conn, applied map[int]appliedMigration) error {
+
+		pending, err := planUp(m.migrations, applied, target)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range pending {
+			err = runMigration(ctx, conn, migration.Up,
+				`INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3);`,
+				migration.Version, migration.Name, migration.Checksum)
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			done = append(done, migration)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+// Down rolls back the given number of the latest applied migrations.
+// The rolled back migrations are returned
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+
+	var done []Migration
+
+	err := m.locked(ctx, func(conn *sqlx.Conn, applied map[int]appliedMigration) error {
+
+		rollback, err := planDown(m.migrations, applied, steps)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range rollback {
+			err = runMigration(ctx, conn, migration.Down,
+				`DELETE FROM schema_migrations WHERE version = $1;`, migration.Version)
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			done = append(done, migration)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+// Status returns all known migrations and whether they are applied
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+
+	var status []MigrationStatus
+
+	err := m.locked(ctx, func(conn *sqlx.Conn, applied map[int]appliedMigration) error {
+
+		_, err := planUp(m.migrations, applied, 0)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			row, ok := applied[migration.Version]
+			status = append(status, MigrationStatus{
+				Migration: migration,
+				Applied:   ok,
+				AppliedAt: row.AppliedAt,
+			})
+		}
+
+		return nil
+	})
+
+	return status, err
+}
+
+// Pending returns the migrations which are not applied yet
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+
+	var pending []Migration
+
+	err := m.locked(ctx, func(conn *sqlx.Conn, applied map[int]appliedMigration) (err error) {
+		pending, err = planUp(m.migrations, applied, 0)
+		return err
+	})
+
+	return pending, err
+}
+
+// locked calls fn holding the migration lock on a dedicated connection,
+// fn gets the migrations applied to the database
+func (m *Migrator) locked(ctx context.Context,
+	fn func(conn *sqlx.Conn, applied map[int]appliedMigration) error) error {
+
+	childCtx, cancel := context.WithTimeout(ctx, migrationTimeout)
+	defer cancel()
+
+	// a session lock belongs to the connection, so the whole migration uses one connection
+	conn, err := m.db.Connx(childCtx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(childCtx, `SELECT pg_advisory_lock($1, 0);`, migrationLockSpace)
+	if err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1, 0);`, migrationLockSpace)
+
+	_, err = conn.ExecContext(childCtx, `CREATE TABLE IF NOT EXISTS
+	schema_migrations (
+	version INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	checksum VARCHAR(64) NOT NULL,
+	applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW());`)
+	if err != nil {
+		return err
+	}
+
+	var rows []appliedMigration
+
+	err = conn.SelectContext(childCtx, &rows,
+		`SELECT version, name, checksum, applied_at FROM schema_migrations ORDER BY version;`)
+	if err != nil {
+		return err
+	}
+
+	applied := make(map[int]appliedMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+
+	return fn(conn, applied)
+}
+
+// runMigration runs the script and records it in one transaction
+func runMigration(ctx context.Context, conn *sqlx.Conn, script, record string, args ...any) error {
+
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// a query without arguments is sent as is, so the script may have several statements
+	_, err = tx.ExecContext(ctx, script)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, record, args...)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// planUp returns the migrations to apply up to the target version, zero is the latest version.
+// The applied migrations must be known and unchanged
+func planUp(migrations []Migration, applied map[int]appliedMigration, target int) ([]Migration, error) {
+
+	known := make(map[int]bool, len(migrations))
+	for _, migration := range migrations {
+		known[migration.Version] = true
+	}
+
+	for version := range applied {
+		if !known[version] {
+			return nil, fmt.Errorf("%w: version %d", ErrUnknownMigration, version)
+		}
+	}
+
+	if target != 0 && !known[target] {
+		return nil, fmt.Errorf("%w: version %d", ErrNotFound, target)
+	}
+
+	var pending []Migration
+	for _, migration := range migrations {
+		row, ok := applied[migration.Version]
+		if ok && row.Checksum != migration.Checksum {
+			return nil, fmt.Errorf("%w: %d_%s", ErrChecksumMismatch, migration.Version, migration.Name)
+		}
+
+		if !ok && (target == 0 || migration.Version <= target) {
+			pending = append(pending, migration)
+		}
+	}
+
+	return pending, nil
+}
+
+// planDown returns the latest applied migrations to roll back, the latest goes first
+func planDown(migrations []Migration, applied map[int]appliedMigration, steps int) ([]Migration, error) {
+
+	_, err := planUp(migrations, applied, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var rollback []Migration
+	for i := len(migrations) - 1; i >= 0 && len(rollback) < steps; i-- {
+		if _, ok := applied[migrations[i].Version]; !ok {
+			continue
+		}
+
+		if migrations[i].Down == "" {
+			return nil, fmt.Errorf("%w: %d_%s", ErrIrreversible, migrations[i].Version, migrations[i].Name)
+		}
+
+		rollback = append(rollback, migrations[i])
+	}
+
+	return rollback, nil
+}
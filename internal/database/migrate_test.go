@@ -0,0 +1,173 @@
+package database
+
+import (
+	"context"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDSN is the variable with the address of the database for the tests against PostgreSQL,
+// they are skipped when it is not set. The database must be disposable
+const testDSN = "GOPHKEEPER_TEST_DSN"
+
+// testDB opens the test database with all migrations applied
+func testDB(t *testing.T) *ManagerDB {
+	t.Helper()
+
+	dsn := os.Getenv(testDSN)
+	if dsn == "" {
+		t.Skipf("%s is not set", testDSN)
+	}
+
+	m, err := NewManagerDB(dsn, true)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = m.Db.Close()
+	})
+
+	return m
+}
+
+func TestLoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"m/0002_second.up.sql":    {Data: []byte("CREATE TABLE b ();")},
+		"m/0001_first.up.sql":     {Data: []byte("CREATE TABLE a ();")},
+		"m/0001_first.down.sql":   {Data: []byte("DROP TABLE a;")},
+		"m/0010_tenth.up.sql":     {Data: []byte("CREATE TABLE c ();")},
+		"m/0010_tenth.down.sql":   {Data: []byte("DROP TABLE c;")},
+		"other/0001_x.up.sql":     {Data: []byte("SELECT 1;")},
+		"other/0001_y.down.sql":   {Data: []byte("SELECT 1;")},
+		"missing/0001_a.down.sql": {Data: []byte("SELECT 1;")},
+		"junk/readme.md":          {Data: []byte("notes")},
+	}
+
+	migrations, err := LoadMigrations(fsys, "m")
+	require.NoError(t, err)
+	require.Len(t, migrations, 3)
+
+	assert.Equal(t, []int{1, 2, 10},
+		[]int{migrations[0].Version, migrations[1].Version, migrations[2].Version})
+	assert.Equal(t, "first", migrations[0].Name)
+	assert.Equal(t, "DROP TABLE a;", migrations[0].Down)
+	assert.Empty(t, migrations[1].Down, "irreversible")
+	assert.Len(t, migrations[0].Checksum, 64)
+	assert.NotEqual(t, migrations[0].Checksum, migrations[1].Checksum)
+
+	for _, dir := range []string{"other", "missing", "junk"} {
+		_, err = LoadMigrations(fsys, dir)
+		assert.Error(t, err, dir)
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := LoadMigrations(migrationFiles, "migrations")
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.Version, "versions have no gaps")
+		assert.NotEmpty(t, m.Up)
+	}
+}
+
+func TestPlanMigrations(t *testing.T) {
+	migrations := []Migration{
+		{Version: 1, Name: "first", Up: "1", Down: "-1", Checksum: "c1"},
+		{Version: 2, Name: "second", Up: "2", Checksum: "c2"},
+		{Version: 3, Name: "third", Up: "3", Down: "-3", Checksum: "c3"},
+		{Version: 4, Name: "fourth", Up: "4", Down: "-4", Checksum: "c4"},
+	}
+
+	applied := map[int]appliedMigration{
+		1: {Version: 1, Checksum: "c1"},
+		2: {Version: 2, Checksum: "c2"},
+	}
+
+	versions := func(ms []Migration) []int {
+		out := []int{}
+		for _, m := range ms {
+			out = append(out, m.Version)
+		}
+		return out
+	}
+
+	pending, err := planUp(migrations, applied, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []int{3, 4}, versions(pending))
+
+	pending, err = planUp(migrations, applied, 3)
+	require.NoError(t, err)
+	assert.Equal(t, []int{3}, versions(pending))
+
+	_, err = planUp(migrations, applied, 7)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, err = planUp(migrations, map[int]appliedMigration{1: {Version: 1, Checksum: "changed"}}, 0)
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+
+	_, err = planUp(migrations, map[int]appliedMigration{5: {Version: 5}}, 0)
+	assert.ErrorIs(t, err, ErrUnknownMigration)
+
+	applied[3] = appliedMigration{Version: 3, Checksum: "c3"}
+
+	rollback, err := planDown(migrations, applied, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []int{3}, versions(rollback))
+
+	_, err = planDown(migrations, applied, 2)
+	assert.ErrorIs(t, err, ErrIrreversible)
+}
+
+func TestMigrator(t *testing.T) {
+	m := testDB(t)
+	ctx := context.Background()
+
+	migrator, err := NewMigrator(m.Db)
+	require.NoError(t, err)
+
+	pending, err := migrator.Pending(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+
+	status, err := migrator.Status(ctx)
+	require.NoError(t, err)
+	for _, s := range status {
+		assert.True(t, s.Applied, s.Migration.Name)
+	}
+
+	last := status[len(status)-1].Migration
+	if last.Down == "" {
+		t.Skipf("migration %d_%s is irreversible", last.Version, last.Name)
+	}
+
+	rollback, err := migrator.Down(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, rollback, 1)
+	assert.Equal(t, last.Version, rollback[0].Version)
+
+	applied, err := migrator.Up(ctx, 0)
+	require.NoError(t, err)
+	require.Len(t, applied, 1)
+	assert.Equal(t, last.Version, applied[0].Version)
+}
+
+func TestQuarantine(t *testing.T) {
+	m := testDB(t)
+	ctx := context.Background()
+
+	var id int64
+	require.NoError(t, m.Db.GetContext(ctx, &id, `INSERT INTO quarantine (source, reason, data)
+		VALUES ('binary_data', 'unknown user', '{"blob_key": "quarantined-blob"}') RETURNING id;`))
+	t.Cleanup(func() {
+		_, _ = m.Db.ExecContext(context.Background(), `DELETE FROM quarantine WHERE id = $1;`, id)
+	})
+
+	// the collector keeps the blobs of the rows put aside
+	keys, err := m.BlobKeys(ctx)
+	require.NoError(t, err)
+	assert.Contains(t, keys, "quarantined-blob")
+}
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS binary_data;
+DROP TABLE IF EXISTS cards;
+DROP TABLE IF EXISTS passwords;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,48 @@
+CREATE TABLE IF NOT EXISTS users (
+    id SERIAL PRIMARY KEY,
+    username VARCHAR(255) NOT NULL,
+    password VARCHAR(255) NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS passwords (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    service TEXT,
+    login_owner VARCHAR(255) NOT NULL,
+    login TEXT NOT NULL,
+    password TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS cards (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    bank TEXT,
+    login_owner VARCHAR(255) NOT NULL,
+    number TEXT NOT NULL,
+    date_end TEXT NOT NULL,
+    secret_code TEXT NOT NULL,
+    owner TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS binary_data (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    title TEXT,
+    login_owner VARCHAR(255) NOT NULL,
+    data bytea NOT NULL
+);
+
+-- encrypted envelopes are longer than the legacy DES hex strings
+ALTER TABLE passwords
+    ALTER COLUMN service TYPE TEXT,
+    ALTER COLUMN login TYPE TEXT,
+    ALTER COLUMN password TYPE TEXT;
+
+ALTER TABLE cards
+    ALTER COLUMN bank TYPE TEXT,
+    ALTER COLUMN number TYPE TEXT,
+    ALTER COLUMN date_end TYPE TEXT,
+    ALTER COLUMN secret_code TYPE TEXT,
+    ALTER COLUMN owner TYPE TEXT;
+
+ALTER TABLE binary_data ALTER COLUMN title TYPE TEXT;
@@ -0,0 +1,3 @@
+ALTER TABLE binary_data DROP COLUMN IF EXISTS version;
+ALTER TABLE cards DROP COLUMN IF EXISTS version;
+ALTER TABLE passwords DROP COLUMN IF EXISTS version;
@@ -0,0 +1,6 @@
+-- concurrent changes are detected by the item version instead of the user status flag
+ALTER TABLE users DROP COLUMN IF EXISTS status;
+
+ALTER TABLE passwords ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE cards ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE binary_data ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
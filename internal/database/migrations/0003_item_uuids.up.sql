@@ -0,0 +1,34 @@
+-- items are addressed by server generated ids, several items may share a name.
+-- The serial ids are replaced once, the old ids are lost, so there is no down migration
+DO $$
+BEGIN
+    IF (SELECT data_type FROM information_schema.columns
+        WHERE table_name = 'passwords' AND column_name = 'id') = 'integer' THEN
+        ALTER TABLE passwords ALTER COLUMN id DROP DEFAULT;
+        ALTER TABLE passwords ALTER COLUMN id TYPE UUID USING gen_random_uuid();
+        ALTER TABLE passwords ALTER COLUMN id SET DEFAULT gen_random_uuid();
+        DROP SEQUENCE IF EXISTS passwords_id_seq;
+    END IF;
+END $$;
+
+DO $$
+BEGIN
+    IF (SELECT data_type FROM information_schema.columns
+        WHERE table_name = 'cards' AND column_name = 'id') = 'integer' THEN
+        ALTER TABLE cards ALTER COLUMN id DROP DEFAULT;
+        ALTER TABLE cards ALTER COLUMN id TYPE UUID USING gen_random_uuid();
+        ALTER TABLE cards ALTER COLUMN id SET DEFAULT gen_random_uuid();
+        DROP SEQUENCE IF EXISTS cards_id_seq;
+    END IF;
+END $$;
+
+DO $$
+BEGIN
+    IF (SELECT data_type FROM information_schema.columns
+        WHERE table_name = 'binary_data' AND column_name = 'id') = 'integer' THEN
+        ALTER TABLE binary_data ALTER COLUMN id DROP DEFAULT;
+        ALTER TABLE binary_data ALTER COLUMN id TYPE UUID USING gen_random_uuid();
+        ALTER TABLE binary_data ALTER COLUMN id SET DEFAULT gen_random_uuid();
+        DROP SEQUENCE IF EXISTS binary_data_id_seq;
+    END IF;
+END $$;
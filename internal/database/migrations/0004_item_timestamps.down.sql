@@ -0,0 +1,3 @@
+ALTER TABLE binary_data DROP COLUMN IF EXISTS created_at, DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE cards DROP COLUMN IF EXISTS created_at, DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE passwords DROP COLUMN IF EXISTS created_at, DROP COLUMN IF EXISTS updated_at;
@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS tombstones;
+
+DROP INDEX IF EXISTS binary_data_login_owner_revision_idx;
+DROP INDEX IF EXISTS cards_login_owner_revision_idx;
+DROP INDEX IF EXISTS passwords_login_owner_revision_idx;
+
+ALTER TABLE binary_data DROP COLUMN IF EXISTS revision;
+ALTER TABLE cards DROP COLUMN IF EXISTS revision;
+ALTER TABLE passwords DROP COLUMN IF EXISTS revision;
+
+DROP SEQUENCE IF EXISTS vault_revision_seq;
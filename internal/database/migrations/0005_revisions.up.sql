@@ -0,0 +1,19 @@
+-- every change of an item takes the next revision, clients pull the changes since a revision
+CREATE SEQUENCE IF NOT EXISTS vault_revision_seq;
+
+ALTER TABLE passwords ADD COLUMN IF NOT EXISTS revision BIGINT NOT NULL DEFAULT nextval('vault_revision_seq');
+ALTER TABLE cards ADD COLUMN IF NOT EXISTS revision BIGINT NOT NULL DEFAULT nextval('vault_revision_seq');
+ALTER TABLE binary_data ADD COLUMN IF NOT EXISTS revision BIGINT NOT NULL DEFAULT nextval('vault_revision_seq');
+
+CREATE TABLE IF NOT EXISTS tombstones (
+    id UUID PRIMARY KEY,
+    type VARCHAR(16) NOT NULL,
+    login_owner VARCHAR(255) NOT NULL,
+    revision BIGINT NOT NULL DEFAULT nextval('vault_revision_seq'),
+    deleted_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS passwords_login_owner_revision_idx ON passwords (login_owner, revision);
+CREATE INDEX IF NOT EXISTS cards_login_owner_revision_idx ON cards (login_owner, revision);
+CREATE INDEX IF NOT EXISTS binary_data_login_owner_revision_idx ON binary_data (login_owner, revision);
+CREATE INDEX IF NOT EXISTS tombstones_login_owner_revision_idx ON tombstones (login_owner, revision);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS binary_data_login_owner_title_idx;
+DROP INDEX IF EXISTS cards_login_owner_bank_idx;
+DROP INDEX IF EXISTS passwords_login_owner_service_idx;
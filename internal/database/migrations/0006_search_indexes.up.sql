@@ -0,0 +1,3 @@
+CREATE INDEX IF NOT EXISTS passwords_login_owner_service_idx ON passwords (login_owner, service);
+CREATE INDEX IF NOT EXISTS cards_login_owner_bank_idx ON cards (login_owner, bank);
+CREATE INDEX IF NOT EXISTS binary_data_login_owner_title_idx ON binary_data (login_owner, title);
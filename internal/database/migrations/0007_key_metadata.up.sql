@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS key_metadata (
+    id SERIAL PRIMARY KEY,
+    login_owner VARCHAR(255) NOT NULL UNIQUE,
+    salt bytea NOT NULL,
+    time INTEGER NOT NULL,
+    memory INTEGER NOT NULL,
+    threads SMALLINT NOT NULL,
+    key_check TEXT NOT NULL
+);
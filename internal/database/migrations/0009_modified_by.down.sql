@@ -0,0 +1,3 @@
+ALTER TABLE binary_data DROP COLUMN IF EXISTS modified_by;
+ALTER TABLE cards DROP COLUMN IF EXISTS modified_by;
+ALTER TABLE passwords DROP COLUMN IF EXISTS modified_by;
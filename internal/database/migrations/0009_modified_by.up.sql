@@ -0,0 +1,4 @@
+-- the device of the last change is shown to the user resolving a conflict
+ALTER TABLE passwords ADD COLUMN IF NOT EXISTS modified_by VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE cards ADD COLUMN IF NOT EXISTS modified_by VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE binary_data ADD COLUMN IF NOT EXISTS modified_by VARCHAR(64) NOT NULL DEFAULT '';
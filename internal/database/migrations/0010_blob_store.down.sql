@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS uploads;
+
+ALTER TABLE binary_data
+    DROP COLUMN IF EXISTS size,
+    DROP COLUMN IF EXISTS chunks,
+    DROP COLUMN IF EXISTS file_key,
+    DROP COLUMN IF EXISTS blob_key,
+    DROP COLUMN IF EXISTS content_hash;
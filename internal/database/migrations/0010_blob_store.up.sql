@@ -0,0 +1,21 @@
+-- large files are stored in chunks outside the database
+ALTER TABLE binary_data
+    ADD COLUMN IF NOT EXISTS size BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS chunks INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS file_key TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS blob_key VARCHAR(64) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS content_hash VARCHAR(64) NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS uploads (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    login_owner VARCHAR(255) NOT NULL,
+    item_id VARCHAR(36) NOT NULL DEFAULT '',
+    title TEXT NOT NULL,
+    fingerprint TEXT NOT NULL,
+    file_key TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    chunks INTEGER NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS uploads_login_owner_idx ON uploads (login_owner);
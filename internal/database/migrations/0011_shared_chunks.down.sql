@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS file_chunks;
+DROP TABLE IF EXISTS chunks;
+
+ALTER TABLE uploads DROP COLUMN IF EXISTS manifest, DROP COLUMN IF EXISTS chunk_ids;
+ALTER TABLE binary_data DROP COLUMN IF EXISTS manifest;
+ALTER TABLE key_metadata DROP COLUMN IF EXISTS content_key;
@@ -0,0 +1,29 @@
+-- the chunks of the files are stored once per user and shared by the files with the same content
+ALTER TABLE key_metadata ADD COLUMN IF NOT EXISTS content_key TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE binary_data ADD COLUMN IF NOT EXISTS manifest TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE uploads
+    ADD COLUMN IF NOT EXISTS manifest TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS chunk_ids TEXT NOT NULL DEFAULT '',
+    ALTER COLUMN file_key SET DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS chunks (
+    login_owner VARCHAR(255) NOT NULL,
+    id VARCHAR(64) NOT NULL,
+    blob_key VARCHAR(64) NOT NULL,
+    blob_n INTEGER NOT NULL,
+    size BIGINT NOT NULL,
+    refs INTEGER NOT NULL,
+    PRIMARY KEY (login_owner, id)
+);
+
+CREATE INDEX IF NOT EXISTS chunks_released_idx ON chunks (login_owner, id) WHERE refs = 0;
+
+CREATE TABLE IF NOT EXISTS file_chunks (
+    file_id UUID NOT NULL,
+    n INTEGER NOT NULL,
+    login_owner VARCHAR(255) NOT NULL,
+    chunk_id VARCHAR(64) NOT NULL,
+    PRIMARY KEY (file_id, n)
+);
@@ -0,0 +1,35 @@
+DO $$
+DECLARE
+    t TEXT;
+BEGIN
+    FOREACH t IN ARRAY ARRAY['passwords', 'cards', 'binary_data', 'tombstones', 'key_metadata',
+        'sessions', 'uploads', 'chunks', 'file_chunks'] LOOP
+        EXECUTE format('ALTER TABLE %I ADD COLUMN login_owner VARCHAR(255)', t);
+        EXECUTE format('UPDATE %I SET login_owner = users.username FROM users WHERE users.id = %I.owner_id', t, t);
+        EXECUTE format('ALTER TABLE %I ALTER COLUMN login_owner SET NOT NULL, DROP COLUMN owner_id', t);
+    END LOOP;
+END $$;
+
+ALTER TABLE key_metadata ADD CONSTRAINT key_metadata_login_owner_key UNIQUE (login_owner);
+ALTER TABLE chunks ADD PRIMARY KEY (login_owner, id);
+
+CREATE INDEX chunks_released_idx ON chunks (login_owner, id) WHERE refs = 0;
+CREATE INDEX uploads_login_owner_idx ON uploads (login_owner);
+CREATE INDEX sessions_login_owner_idx ON sessions (login_owner);
+
+CREATE INDEX passwords_login_owner_revision_idx ON passwords (login_owner, revision);
+CREATE INDEX cards_login_owner_revision_idx ON cards (login_owner, revision);
+CREATE INDEX binary_data_login_owner_revision_idx ON binary_data (login_owner, revision);
+CREATE INDEX tombstones_login_owner_revision_idx ON tombstones (login_owner, revision);
+
+CREATE INDEX passwords_login_owner_service_idx ON passwords (login_owner, service);
+CREATE INDEX cards_login_owner_bank_idx ON cards (login_owner, bank);
+CREATE INDEX binary_data_login_owner_title_idx ON binary_data (login_owner, title);
+
+DROP FUNCTION IF EXISTS user_id(TEXT);
+
+ALTER TABLE users
+    DROP CONSTRAINT IF EXISTS users_username_key,
+    DROP CONSTRAINT IF EXISTS users_email_key;
+
+-- the quarantined rows are kept, the accounts and the rows put aside aren't restored
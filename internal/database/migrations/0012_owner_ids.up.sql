@@ -0,0 +1,86 @@
+-- the data of the users is referenced by the user id, so a deleted user takes all of it along.
+-- The rows the migration can't keep are put aside in the quarantine for the administrator
+CREATE TABLE IF NOT EXISTS quarantine (
+    id BIGSERIAL PRIMARY KEY,
+    source TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    data JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- a username registered twice keeps the account registered first: the vault rows refer to the username,
+-- so the vaults of the accounts are merged into it and the other accounts are put aside
+WITH dropped AS (
+    DELETE FROM users u USING users kept
+        WHERE kept.username = u.username AND kept.id < u.id
+        RETURNING u.*
+)
+INSERT INTO quarantine (source, reason, data)
+    SELECT 'users', 'duplicate username', to_jsonb(dropped) FROM dropped;
+
+-- the sessions of a shared username can't be told apart, their users log in again
+DELETE FROM sessions WHERE login_owner IN
+    (SELECT data->>'username' FROM quarantine WHERE source = 'users' AND reason = 'duplicate username');
+
+-- an email registered twice stays with the account registered first, the others get a placeholder
+-- and their emails are kept in the quarantine
+WITH changed AS (
+    SELECT u.* FROM users u
+        WHERE EXISTS (SELECT 1 FROM users kept WHERE kept.email = u.email AND kept.id < u.id)
+), quarantined AS (
+    INSERT INTO quarantine (source, reason, data)
+        SELECT 'users', 'duplicate email', to_jsonb(changed) FROM changed
+)
+UPDATE users SET email = 'duplicate-' || users.id || '@invalid', updated_at = NOW()
+    FROM changed WHERE users.id = changed.id;
+
+ALTER TABLE users
+    ADD CONSTRAINT users_username_key UNIQUE (username),
+    ADD CONSTRAINT users_email_key UNIQUE (email);
+
+-- user_id resolves the login of a request to the id of the user, NULL for an unknown login
+CREATE OR REPLACE FUNCTION user_id(login TEXT) RETURNS INTEGER
+    AS $$ SELECT id FROM users WHERE username = login $$ LANGUAGE SQL STABLE;
+
+-- the rows of unknown users are moved into the quarantine, nobody can reach them
+-- and a user registering the name later would take them over
+DO $$
+DECLARE
+    t TEXT;
+    n BIGINT;
+BEGIN
+    FOREACH t IN ARRAY ARRAY['passwords', 'cards', 'binary_data', 'tombstones', 'key_metadata',
+        'sessions', 'uploads', 'chunks', 'file_chunks'] LOOP
+        EXECUTE format('ALTER TABLE %I ADD COLUMN owner_id INTEGER', t);
+        EXECUTE format('UPDATE %I SET owner_id = users.id FROM users WHERE users.username = %I.login_owner', t, t);
+        EXECUTE format('INSERT INTO quarantine (source, reason, data)
+            SELECT %L, ''unknown user'', to_jsonb(r) FROM %I r WHERE owner_id IS NULL', t, t);
+        GET DIAGNOSTICS n = ROW_COUNT;
+        IF n > 0 THEN
+            RAISE NOTICE '% rows of unknown users in % are moved into the quarantine', n, t;
+        END IF;
+        EXECUTE format('DELETE FROM %I WHERE owner_id IS NULL', t);
+        EXECUTE format('ALTER TABLE %I
+            ALTER COLUMN owner_id SET NOT NULL,
+            ADD FOREIGN KEY (owner_id) REFERENCES users (id) ON DELETE CASCADE,
+            DROP COLUMN login_owner', t);
+    END LOOP;
+END $$;
+
+-- the constraints and indexes on login_owner are dropped along with the column
+ALTER TABLE key_metadata ADD CONSTRAINT key_metadata_owner_id_key UNIQUE (owner_id);
+ALTER TABLE chunks ADD PRIMARY KEY (owner_id, id);
+
+CREATE INDEX chunks_released_idx ON chunks (owner_id, id) WHERE refs = 0;
+CREATE INDEX file_chunks_owner_id_idx ON file_chunks (owner_id);
+CREATE INDEX uploads_owner_id_idx ON uploads (owner_id);
+CREATE INDEX sessions_owner_id_idx ON sessions (owner_id);
+
+CREATE INDEX passwords_owner_id_revision_idx ON passwords (owner_id, revision);
+CREATE INDEX cards_owner_id_revision_idx ON cards (owner_id, revision);
+CREATE INDEX binary_data_owner_id_revision_idx ON binary_data (owner_id, revision);
+CREATE INDEX tombstones_owner_id_revision_idx ON tombstones (owner_id, revision);
+
+CREATE INDEX passwords_owner_id_service_idx ON passwords (owner_id, service);
+CREATE INDEX cards_owner_id_bank_idx ON cards (owner_id, bank);
+CREATE INDEX binary_data_owner_id_title_idx ON binary_data (owner_id, title);
@@ -0,0 +1,3 @@
+DELETE FROM tombstones WHERE type = 'note';
+
+DROP TABLE IF EXISTS notes;
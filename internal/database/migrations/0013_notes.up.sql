@@ -0,0 +1,16 @@
+-- secure notes: the title is looked up by, the markdown body and the tags are encrypted by the client
+CREATE TABLE notes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    owner_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    title TEXT NOT NULL,
+    body TEXT NOT NULL,
+    tags TEXT NOT NULL DEFAULT '',
+    version BIGINT NOT NULL DEFAULT 1,
+    revision BIGINT NOT NULL DEFAULT nextval('vault_revision_seq'),
+    modified_by VARCHAR(64) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX notes_owner_id_revision_idx ON notes (owner_id, revision);
+CREATE INDEX notes_owner_id_title_idx ON notes (owner_id, title);
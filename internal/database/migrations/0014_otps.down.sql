@@ -0,0 +1,3 @@
+DELETE FROM tombstones WHERE type = 'otp';
+
+DROP TABLE IF EXISTS otps;
@@ -0,0 +1,18 @@
+-- authenticator secrets: the issuer is looked up by, the otpauth URI, the account
+-- and the link to a password are encrypted by the client
+CREATE TABLE otps (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    owner_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    issuer TEXT NOT NULL,
+    account TEXT NOT NULL,
+    uri TEXT NOT NULL,
+    password_id TEXT NOT NULL DEFAULT '',
+    version BIGINT NOT NULL DEFAULT 1,
+    revision BIGINT NOT NULL DEFAULT nextval('vault_revision_seq'),
+    modified_by VARCHAR(64) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX otps_owner_id_revision_idx ON otps (owner_id, revision);
+CREATE INDEX otps_owner_id_issuer_idx ON otps (owner_id, issuer);
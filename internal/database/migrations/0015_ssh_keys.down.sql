@@ -0,0 +1,3 @@
+DELETE FROM tombstones WHERE type = 'ssh';
+
+DROP TABLE IF EXISTS ssh_keys;
@@ -0,0 +1,22 @@
+-- ssh keys: the name is looked up by, the keys, the passphrase and the agent constraints
+-- are encrypted by the client
+CREATE TABLE ssh_keys (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    owner_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    comment TEXT NOT NULL,
+    private_key TEXT NOT NULL,
+    public_key TEXT NOT NULL DEFAULT '',
+    certificate TEXT NOT NULL DEFAULT '',
+    passphrase TEXT NOT NULL DEFAULT '',
+    confirm TEXT NOT NULL DEFAULT '',
+    lifetime TEXT NOT NULL DEFAULT '',
+    version BIGINT NOT NULL DEFAULT 1,
+    revision BIGINT NOT NULL DEFAULT nextval('vault_revision_seq'),
+    modified_by VARCHAR(64) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX ssh_keys_owner_id_revision_idx ON ssh_keys (owner_id, revision);
+CREATE INDEX ssh_keys_owner_id_name_idx ON ssh_keys (owner_id, name);
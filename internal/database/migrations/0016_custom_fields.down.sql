@@ -0,0 +1,6 @@
+ALTER TABLE notes DROP COLUMN custom;
+ALTER TABLE ssh_keys DROP COLUMN tags, DROP COLUMN custom;
+ALTER TABLE otps DROP COLUMN tags, DROP COLUMN custom;
+ALTER TABLE binary_data DROP COLUMN tags, DROP COLUMN custom;
+ALTER TABLE cards DROP COLUMN tags, DROP COLUMN custom;
+ALTER TABLE passwords DROP COLUMN tags, DROP COLUMN custom;
@@ -0,0 +1,8 @@
+-- every item has tags, plain or encrypted by the client as a whole, and the encrypted list of its custom fields;
+-- the notes have had encrypted tags from the start
+ALTER TABLE passwords ADD COLUMN tags TEXT NOT NULL DEFAULT '', ADD COLUMN custom TEXT NOT NULL DEFAULT '';
+ALTER TABLE cards ADD COLUMN tags TEXT NOT NULL DEFAULT '', ADD COLUMN custom TEXT NOT NULL DEFAULT '';
+ALTER TABLE binary_data ADD COLUMN tags TEXT NOT NULL DEFAULT '', ADD COLUMN custom TEXT NOT NULL DEFAULT '';
+ALTER TABLE otps ADD COLUMN tags TEXT NOT NULL DEFAULT '', ADD COLUMN custom TEXT NOT NULL DEFAULT '';
+ALTER TABLE ssh_keys ADD COLUMN tags TEXT NOT NULL DEFAULT '', ADD COLUMN custom TEXT NOT NULL DEFAULT '';
+ALTER TABLE notes ADD COLUMN custom TEXT NOT NULL DEFAULT '';
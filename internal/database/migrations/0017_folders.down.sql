@@ -0,0 +1,10 @@
+ALTER TABLE binary_data DROP COLUMN folder_id;
+ALTER TABLE ssh_keys DROP COLUMN folder_id;
+ALTER TABLE otps DROP COLUMN folder_id;
+ALTER TABLE notes DROP COLUMN folder_id;
+ALTER TABLE cards DROP COLUMN folder_id;
+ALTER TABLE passwords DROP COLUMN folder_id;
+
+DELETE FROM tombstones WHERE type = 'folder';
+
+DROP TABLE IF EXISTS folders;
@@ -0,0 +1,33 @@
+-- nested folders: the name is encrypted by the client, folder_id is the parent folder;
+-- every item is in at most one folder, the items at the top level have no folder
+CREATE TABLE folders (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    owner_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    folder_id UUID REFERENCES folders (id) ON DELETE SET NULL,
+    name TEXT NOT NULL,
+    tags TEXT NOT NULL DEFAULT '',
+    custom TEXT NOT NULL DEFAULT '',
+    version BIGINT NOT NULL DEFAULT 1,
+    revision BIGINT NOT NULL DEFAULT nextval('vault_revision_seq'),
+    modified_by VARCHAR(64) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX folders_owner_id_revision_idx ON folders (owner_id, revision);
+CREATE INDEX folders_owner_id_name_idx ON folders (owner_id, name);
+CREATE INDEX folders_folder_id_idx ON folders (folder_id);
+
+ALTER TABLE passwords ADD COLUMN folder_id UUID REFERENCES folders (id) ON DELETE SET NULL;
+ALTER TABLE cards ADD COLUMN folder_id UUID REFERENCES folders (id) ON DELETE SET NULL;
+ALTER TABLE notes ADD COLUMN folder_id UUID REFERENCES folders (id) ON DELETE SET NULL;
+ALTER TABLE otps ADD COLUMN folder_id UUID REFERENCES folders (id) ON DELETE SET NULL;
+ALTER TABLE ssh_keys ADD COLUMN folder_id UUID REFERENCES folders (id) ON DELETE SET NULL;
+ALTER TABLE binary_data ADD COLUMN folder_id UUID REFERENCES folders (id) ON DELETE SET NULL;
+
+CREATE INDEX passwords_folder_id_idx ON passwords (folder_id);
+CREATE INDEX cards_folder_id_idx ON cards (folder_id);
+CREATE INDEX notes_folder_id_idx ON notes (folder_id);
+CREATE INDEX otps_folder_id_idx ON otps (folder_id);
+CREATE INDEX ssh_keys_folder_id_idx ON ssh_keys (folder_id);
+CREATE INDEX binary_data_folder_id_idx ON binary_data (folder_id);
@@ -0,0 +1,7 @@
+ALTER TABLE folders DROP COLUMN search_index;
+ALTER TABLE binary_data DROP COLUMN search_index;
+ALTER TABLE ssh_keys DROP COLUMN search_index;
+ALTER TABLE otps DROP COLUMN search_index;
+ALTER TABLE notes DROP COLUMN search_index;
+ALTER TABLE cards DROP COLUMN search_index;
+ALTER TABLE passwords DROP COLUMN search_index;
@@ -0,0 +1,17 @@
+-- the blind search index of the name and the tags of every item:
+-- the keyed hashes of the tokens made by the client, separated by spaces
+ALTER TABLE passwords ADD COLUMN search_index TEXT NOT NULL DEFAULT '';
+ALTER TABLE cards ADD COLUMN search_index TEXT NOT NULL DEFAULT '';
+ALTER TABLE notes ADD COLUMN search_index TEXT NOT NULL DEFAULT '';
+ALTER TABLE otps ADD COLUMN search_index TEXT NOT NULL DEFAULT '';
+ALTER TABLE ssh_keys ADD COLUMN search_index TEXT NOT NULL DEFAULT '';
+ALTER TABLE binary_data ADD COLUMN search_index TEXT NOT NULL DEFAULT '';
+ALTER TABLE folders ADD COLUMN search_index TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX passwords_search_index_idx ON passwords USING GIN (string_to_array(search_index, ' '));
+CREATE INDEX cards_search_index_idx ON cards USING GIN (string_to_array(search_index, ' '));
+CREATE INDEX notes_search_index_idx ON notes USING GIN (string_to_array(search_index, ' '));
+CREATE INDEX otps_search_index_idx ON otps USING GIN (string_to_array(search_index, ' '));
+CREATE INDEX ssh_keys_search_index_idx ON ssh_keys USING GIN (string_to_array(search_index, ' '));
+CREATE INDEX binary_data_search_index_idx ON binary_data USING GIN (string_to_array(search_index, ' '));
+CREATE INDEX folders_search_index_idx ON folders USING GIN (string_to_array(search_index, ' '));
@@ -0,0 +1,7 @@
+ALTER TABLE folders DROP COLUMN secret_tags;
+ALTER TABLE binary_data DROP COLUMN secret_tags;
+ALTER TABLE ssh_keys DROP COLUMN secret_tags;
+ALTER TABLE otps DROP COLUMN secret_tags;
+ALTER TABLE notes DROP COLUMN secret_tags;
+ALTER TABLE cards DROP COLUMN secret_tags;
+ALTER TABLE passwords DROP COLUMN secret_tags;
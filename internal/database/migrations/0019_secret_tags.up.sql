@@ -0,0 +1,17 @@
+-- the tags encrypted by the client are flagged, so a plain tag is never taken for a ciphertext.
+-- The clients have stored the encrypted tags as envelopes and stripped the envelope prefix from the plain ones
+ALTER TABLE passwords ADD COLUMN secret_tags BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE cards ADD COLUMN secret_tags BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE notes ADD COLUMN secret_tags BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE otps ADD COLUMN secret_tags BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE ssh_keys ADD COLUMN secret_tags BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE binary_data ADD COLUMN secret_tags BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE folders ADD COLUMN secret_tags BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE passwords SET secret_tags = TRUE WHERE tags LIKE '$%';
+UPDATE cards SET secret_tags = TRUE WHERE tags LIKE '$%';
+UPDATE notes SET secret_tags = TRUE WHERE tags LIKE '$%';
+UPDATE otps SET secret_tags = TRUE WHERE tags LIKE '$%';
+UPDATE ssh_keys SET secret_tags = TRUE WHERE tags LIKE '$%';
+UPDATE binary_data SET secret_tags = TRUE WHERE tags LIKE '$%';
+UPDATE folders SET secret_tags = TRUE WHERE tags LIKE '$%';
@@ -0,0 +1,8 @@
+-- the account passwords stored before hashing was introduced are hashed with bcrypt
+-- of the cost the server uses (passwordCost), so the logins don't rehash them.
+-- An account of the old DES clients keeps the hash of its encrypted password: the new client
+-- sends the encrypted credentials once, then the server stores the hash of the plain password
+CREATE EXTENSION IF NOT EXISTS pgcrypto;
+
+UPDATE users SET password = crypt(password, gen_salt('bf', 12)), updated_at = NOW()
+    WHERE password NOT LIKE '$2_$%';
@@ -0,0 +1 @@
+ALTER TABLE binary_data ALTER COLUMN data DROP DEFAULT;
@@ -0,0 +1,3 @@
+-- the content of the files is kept in the blob store, the server moves the content stored here before
+-- into it at the start and nothing writes the column since
+ALTER TABLE binary_data ALTER COLUMN data SET DEFAULT ''::bytea;
@@ -6,10 +6,12 @@ package mock_database
 
 import (
 	context "context"
+	sql "database/sql"
 	reflect "reflect"
 
 	storage "github.com/EgorKo25/GophKeeper/internal/storage"
 	gomock "github.com/golang/mock/gomock"
+	sqlx "github.com/jmoiron/sqlx"
 )
 
 // MockDatabase is a mock of Database interface.
@@ -49,6 +51,34 @@ func (mr *MockDatabaseMockRecorder) Add(ctx, src, login interface{}) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Add", reflect.TypeOf((*MockDatabase)(nil).Add), ctx, src, login)
 }
 
+// AddSession mocks base method.
+func (m *MockDatabase) AddSession(ctx context.Context, session *storage.Session) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddSession", ctx, session)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddSession indicates an expected call of AddSession.
+func (mr *MockDatabaseMockRecorder) AddSession(ctx, session interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddSession", reflect.TypeOf((*MockDatabase)(nil).AddSession), ctx, session)
+}
+
+// AddUpload mocks base method.
+func (m *MockDatabase) AddUpload(ctx context.Context, upload *storage.Upload, login string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddUpload", ctx, upload, login)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddUpload indicates an expected call of AddUpload.
+func (mr *MockDatabaseMockRecorder) AddUpload(ctx, upload, login interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddUpload", reflect.TypeOf((*MockDatabase)(nil).AddUpload), ctx, upload, login)
+}
+
 // CheckUser mocks base method.
 func (m *MockDatabase) CheckUser(ctx context.Context, user *storage.User) (bool, error) {
 	m.ctrl.T.Helper()
@@ -64,6 +94,21 @@ func (mr *MockDatabaseMockRecorder) CheckUser(ctx, user interface{}) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckUser", reflect.TypeOf((*MockDatabase)(nil).CheckUser), ctx, user)
 }
 
+// CompleteUpload mocks base method.
+func (m *MockDatabase) CompleteUpload(ctx context.Context, upload *storage.Upload, bin *storage.BinaryData, received map[int]int64, login string) ([]int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CompleteUpload", ctx, upload, bin, received, login)
+	ret0, _ := ret[0].([]int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CompleteUpload indicates an expected call of CompleteUpload.
+func (mr *MockDatabaseMockRecorder) CompleteUpload(ctx, upload, bin, received, login interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompleteUpload", reflect.TypeOf((*MockDatabase)(nil).CompleteUpload), ctx, upload, bin, received, login)
+}
+
 // Delete mocks base method.
 func (m *MockDatabase) Delete(ctx context.Context, src any, login string) error {
 	m.ctrl.T.Helper()
@@ -78,6 +123,65 @@ func (mr *MockDatabaseMockRecorder) Delete(ctx, src, login interface{}) *gomock.
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockDatabase)(nil).Delete), ctx, src, login)
 }
 
+// FileChunks mocks base method.
+func (m *MockDatabase) FileChunks(ctx context.Context, bin *storage.BinaryData, login string) ([]storage.Chunk, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FileChunks", ctx, bin, login)
+	ret0, _ := ret[0].([]storage.Chunk)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FileChunks indicates an expected call of FileChunks.
+func (mr *MockDatabaseMockRecorder) FileChunks(ctx, bin, login interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FileChunks", reflect.TypeOf((*MockDatabase)(nil).FileChunks), ctx, bin, login)
+}
+
+// Find mocks base method.
+func (m *MockDatabase) Find(ctx context.Context, tokens []string, minScore, limit int, login string) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Find", ctx, tokens, minScore, limit, login)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Find indicates an expected call of Find.
+func (mr *MockDatabaseMockRecorder) Find(ctx, tokens, minScore, limit, login interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Find", reflect.TypeOf((*MockDatabase)(nil).Find), ctx, tokens, minScore, limit, login)
+}
+
+// List mocks base method.
+func (m *MockDatabase) List(ctx context.Context, itemType string, limit, offset int, login string) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx, itemType, limit, offset, login)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockDatabaseMockRecorder) List(ctx, itemType, limit, offset, login interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockDatabase)(nil).List), ctx, itemType, limit, offset, login)
+}
+
+// Move mocks base method.
+func (m *MockDatabase) Move(ctx context.Context, src any, login string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Move", ctx, src, login)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Move indicates an expected call of Move.
+func (mr *MockDatabaseMockRecorder) Move(ctx, src, login interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Move", reflect.TypeOf((*MockDatabase)(nil).Move), ctx, src, login)
+}
+
 // Read mocks base method.
 func (m *MockDatabase) Read(ctx context.Context, src any, login string) ([]byte, error) {
 	m.ctrl.T.Helper()
@@ -93,6 +197,122 @@ func (mr *MockDatabaseMockRecorder) Read(ctx, src, login interface{}) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Read", reflect.TypeOf((*MockDatabase)(nil).Read), ctx, src, login)
 }
 
+// ReadChunk mocks base method.
+func (m *MockDatabase) ReadChunk(ctx context.Context, bin *storage.BinaryData, n int, login string) (*storage.Chunk, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadChunk", ctx, bin, n, login)
+	ret0, _ := ret[0].(*storage.Chunk)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadChunk indicates an expected call of ReadChunk.
+func (mr *MockDatabaseMockRecorder) ReadChunk(ctx, bin, n, login interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadChunk", reflect.TypeOf((*MockDatabase)(nil).ReadChunk), ctx, bin, n, login)
+}
+
+// ReadFile mocks base method.
+func (m *MockDatabase) ReadFile(ctx context.Context, bin *storage.BinaryData, login string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadFile", ctx, bin, login)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReadFile indicates an expected call of ReadFile.
+func (mr *MockDatabaseMockRecorder) ReadFile(ctx, bin, login interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadFile", reflect.TypeOf((*MockDatabase)(nil).ReadFile), ctx, bin, login)
+}
+
+// ReadUpload mocks base method.
+func (m *MockDatabase) ReadUpload(ctx context.Context, upload *storage.Upload, login string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadUpload", ctx, upload, login)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReadUpload indicates an expected call of ReadUpload.
+func (mr *MockDatabaseMockRecorder) ReadUpload(ctx, upload, login interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadUpload", reflect.TypeOf((*MockDatabase)(nil).ReadUpload), ctx, upload, login)
+}
+
+// RevokeSessions mocks base method.
+func (m *MockDatabase) RevokeSessions(ctx context.Context, login, family string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeSessions", ctx, login, family)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeSessions indicates an expected call of RevokeSessions.
+func (mr *MockDatabaseMockRecorder) RevokeSessions(ctx, login, family interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeSessions", reflect.TypeOf((*MockDatabase)(nil).RevokeSessions), ctx, login, family)
+}
+
+// RotateSession mocks base method.
+func (m *MockDatabase) RotateSession(ctx context.Context, tokenHash string, next *storage.Session) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RotateSession", ctx, tokenHash, next)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RotateSession indicates an expected call of RotateSession.
+func (mr *MockDatabaseMockRecorder) RotateSession(ctx, tokenHash, next interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RotateSession", reflect.TypeOf((*MockDatabase)(nil).RotateSession), ctx, tokenHash, next)
+}
+
+// Search mocks base method.
+func (m *MockDatabase) Search(ctx context.Context, src any, login string) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Search", ctx, src, login)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Search indicates an expected call of Search.
+func (mr *MockDatabaseMockRecorder) Search(ctx, src, login interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Search", reflect.TypeOf((*MockDatabase)(nil).Search), ctx, src, login)
+}
+
+// StoredChunks mocks base method.
+func (m *MockDatabase) StoredChunks(ctx context.Context, ids []string, login string) (map[string]bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StoredChunks", ctx, ids, login)
+	ret0, _ := ret[0].(map[string]bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// StoredChunks indicates an expected call of StoredChunks.
+func (mr *MockDatabaseMockRecorder) StoredChunks(ctx, ids, login interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StoredChunks", reflect.TypeOf((*MockDatabase)(nil).StoredChunks), ctx, ids, login)
+}
+
+// Sync mocks base method.
+func (m *MockDatabase) Sync(ctx context.Context, since int64, login string) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Sync", ctx, since, login)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Sync indicates an expected call of Sync.
+func (mr *MockDatabaseMockRecorder) Sync(ctx, since, login interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Sync", reflect.TypeOf((*MockDatabase)(nil).Sync), ctx, since, login)
+}
+
 // Update mocks base method.
 func (m *MockDatabase) Update(ctx context.Context, src any, login string) error {
 	m.ctrl.T.Helper()
@@ -106,3 +326,120 @@ func (mr *MockDatabaseMockRecorder) Update(ctx, src, login interface{}) *gomock.
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockDatabase)(nil).Update), ctx, src, login)
 }
+
+// UpgradeUser mocks base method.
+func (m *MockDatabase) UpgradeUser(ctx context.Context, legacy string, user *storage.User) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpgradeUser", ctx, legacy, user)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpgradeUser indicates an expected call of UpgradeUser.
+func (mr *MockDatabaseMockRecorder) UpgradeUser(ctx, legacy, user interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpgradeUser", reflect.TypeOf((*MockDatabase)(nil).UpgradeUser), ctx, legacy, user)
+}
+
+// Uploads mocks base method.
+func (m *MockDatabase) Uploads(ctx context.Context, login string) ([]storage.Upload, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Uploads", ctx, login)
+	ret0, _ := ret[0].([]storage.Upload)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Uploads indicates an expected call of Uploads.
+func (mr *MockDatabaseMockRecorder) Uploads(ctx, login interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Uploads", reflect.TypeOf((*MockDatabase)(nil).Uploads), ctx, login)
+}
+
+// Usage mocks base method.
+func (m *MockDatabase) Usage(ctx context.Context, login string) (*storage.Usage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Usage", ctx, login)
+	ret0, _ := ret[0].(*storage.Usage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Usage indicates an expected call of Usage.
+func (mr *MockDatabaseMockRecorder) Usage(ctx, login interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Usage", reflect.TypeOf((*MockDatabase)(nil).Usage), ctx, login)
+}
+
+// Mockexecer is a mock of execer interface.
+type Mockexecer struct {
+	ctrl     *gomock.Controller
+	recorder *MockexecerMockRecorder
+}
+
+// MockexecerMockRecorder is the mock recorder for Mockexecer.
+type MockexecerMockRecorder struct {
+	mock *Mockexecer
+}
+
+// NewMockexecer creates a new mock instance.
+func NewMockexecer(ctrl *gomock.Controller) *Mockexecer {
+	mock := &Mockexecer{ctrl: ctrl}
+	mock.recorder = &MockexecerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *Mockexecer) EXPECT() *MockexecerMockRecorder {
+	return m.recorder
+}
+
+// BindNamed mocks base method.
+func (m *Mockexecer) BindNamed(query string, arg interface{}) (string, []interface{}, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BindNamed", query, arg)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].([]interface{})
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// BindNamed indicates an expected call of BindNamed.
+func (mr *MockexecerMockRecorder) BindNamed(query, arg interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BindNamed", reflect.TypeOf((*Mockexecer)(nil).BindNamed), query, arg)
+}
+
+// NamedExecContext mocks base method.
+func (m *Mockexecer) NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NamedExecContext", ctx, query, arg)
+	ret0, _ := ret[0].(sql.Result)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NamedExecContext indicates an expected call of NamedExecContext.
+func (mr *MockexecerMockRecorder) NamedExecContext(ctx, query, arg interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NamedExecContext", reflect.TypeOf((*Mockexecer)(nil).NamedExecContext), ctx, query, arg)
+}
+
+// QueryRowxContext mocks base method.
+func (m *Mockexecer) QueryRowxContext(ctx context.Context, query string, args ...interface{}) *sqlx.Row {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{ctx, query}
+	for _, a := range args {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "QueryRowxContext", varargs...)
+	ret0, _ := ret[0].(*sqlx.Row)
+	return ret0
+}
+
+// QueryRowxContext indicates an expected call of QueryRowxContext.
+func (mr *MockexecerMockRecorder) QueryRowxContext(ctx, query interface{}, args ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{ctx, query}, args...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QueryRowxContext", reflect.TypeOf((*Mockexecer)(nil).QueryRowxContext), varargs...)
+}
@@ -0,0 +1,115 @@
+package database
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/EgorKo25/GophKeeper/internal/storage"
+)
+
+// passwordCost is a bcrypt cost for account passwords, the migration hashing the plain passwords uses it too.
+// Hashes with another cost are rehashed on the next login
+const passwordCost = 12
+
+// dummyHash is compared against when the user does not exist,
+// so the response time does not reveal registered logins
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("gophkeeper"), passwordCost)
+
+// hashPassword hashes an account password
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+// isHashed reports whether the stored password is a bcrypt hash
+func isHashed(stored string) bool {
+	return strings.HasPrefix(stored, "$2a$") ||
+		strings.HasPrefix(stored, "$2b$") ||
+		strings.HasPrefix(stored, "$2y$")
+}
+
+// verifyPassword compares the password with the stored value.
+// rehash is true when the stored value must be replaced with a fresh hash
+func verifyPassword(stored, password string) (ok bool, rehash bool) {
+	if stored == "" {
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return false, false
+	}
+
+	if !isHashed(stored) {
+		ok = subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+		return ok, ok
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)) != nil {
+		return false, false
+	}
+
+	cost, err := bcrypt.Cost([]byte(stored))
+
+	return true, err != nil || cost != passwordCost
+}
+
+// updateUserPassword replaces the stored password of the user with a fresh hash
+func (m *ManagerDB) updateUserPassword(ctx context.Context, login, password string) error {
+
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	childCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	_, err = m.Db.ExecContext(childCtx,
+		`UPDATE users SET password = $1, updated_at = NOW() WHERE username = $2;`, hash, login)
+
+	return err
+}
+
+// UpgradeUser renames the account the old DES clients registered under the encrypted login
+// and replaces its password with the hash of the plain one.
+// The rows of the user reference it by id, so the vault and the sessions follow the account
+func (m *ManagerDB) UpgradeUser(ctx context.Context, legacy string, user *storage.User) error {
+
+	hash, err := hashPassword(user.Password)
+	if err != nil {
+		return err
+	}
+
+	childCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	res, err := m.Db.ExecContext(childCtx,
+		`UPDATE users SET username = $1, password = $2, updated_at = NOW() WHERE username = $3;`,
+		user.Login, hash, legacy)
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return ErrUserExists
+	}
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
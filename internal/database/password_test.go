@@ -0,0 +1,40 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestVerifyPassword(t *testing.T) {
+	current, err := hashPassword("testpassword")
+	require.NoError(t, err)
+
+	cheap, err := bcrypt.GenerateFromPassword([]byte("testpassword"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		stored   string
+		password string
+		ok       bool
+		rehash   bool
+	}{
+		{name: "current hash", stored: current, password: "testpassword", ok: true},
+		{name: "wrong password", stored: current, password: "wrong", ok: false},
+		{name: "outdated cost", stored: string(cheap), password: "testpassword", ok: true, rehash: true},
+		{name: "plaintext", stored: "testpassword", password: "testpassword", ok: true, rehash: true},
+		{name: "wrong plaintext", stored: "testpassword", password: "wrong", ok: false},
+		{name: "unknown user", stored: "", password: "", ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, rehash := verifyPassword(tt.stored, tt.password)
+
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.rehash, rehash)
+		})
+	}
+}
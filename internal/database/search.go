@@ -0,0 +1,131 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/EgorKo25/GophKeeper/internal/storage"
+)
+
+// Search returns all items of the user of the kind of src.
+// The names are encrypted with random nonces, the items are found by the words of their names with Find
+func (m *ManagerDB) Search(ctx context.Context, src any, login string) ([]byte, error) {
+	childCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	data, ok := src.(storage.Item)
+	if !ok {
+		return nil, errors.New("unknown searching type " + fmt.Sprintf("%T", src))
+	}
+
+	*data.Header().LoginOwner = login
+
+	kind := data.Kind()
+
+	query, args, err := m.Db.BindNamed(`SELECT `+itemColumns(kind)+` FROM `+kind.Table+`
+		WHERE owner_id = user_id(:login_owner) ORDER BY id;`, data)
+	if err != nil {
+		return []byte(""), err
+	}
+
+	found := make(storage.Items)
+	err = selectItems(childCtx, m.Db, found, kind, query, args...)
+	if err != nil {
+		return []byte(""), err
+	}
+
+	if found[kind.Name] == nil {
+		return []byte("[]"), nil
+	}
+
+	return json.Marshal(found[kind.Name])
+}
+
+// itemsQuery selects the metadata of all vault items of the user, the name is the search field of the kind.
+// The tags are plain or encrypted by the client as secret_tags tells, the folders are listed along with the items
+func itemsQuery() string {
+
+	union := make([]string, 0, len(storage.Kinds()))
+	for _, kind := range storage.Kinds() {
+		union = append(union, `SELECT id, '`+kind.Name+`' AS type, `+kind.Search().Name+` AS name,
+			tags, secret_tags, `+folderColumn+`, owner_id, created_at, updated_at FROM `+kind.Table)
+	}
+
+	return `SELECT id, type, name, tags, secret_tags, folder_id, created_at, updated_at FROM (
+		` + strings.Join(union, `
+		UNION ALL
+		`) + `
+	) AS items WHERE owner_id = user_id($1) AND ($2 = '' OR type = $2)`
+}
+
+// List returns a page of the vault items metadata ordered by creation time.
+// An empty item type lists the items of all types
+func (m *ManagerDB) List(ctx context.Context, itemType string, limit, offset int, login string) ([]byte, error) {
+	childCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	list := storage.ItemList{
+		Items:  []storage.ItemMeta{},
+		Offset: offset,
+	}
+
+	err := m.Db.GetContext(childCtx, &list.Total,
+		`SELECT COUNT(*) FROM (`+itemsQuery()+`) AS counted;`, login, itemType)
+	if err != nil {
+		return []byte(""), err
+	}
+
+	err = m.Db.SelectContext(childCtx, &list.Items,
+		itemsQuery()+` ORDER BY created_at, id LIMIT $3 OFFSET $4;`, login, itemType, limit, offset)
+	if err != nil {
+		return []byte(""), err
+	}
+
+	return json.Marshal(list)
+}
+
+// indexTokens is the search index of the item as an array of the blinded tokens
+const indexTokens = `string_to_array(search_index, ' ')`
+
+// findQuery selects the metadata of the vault items whose search index has at least $3 of the tokens $2,
+// the score of an item is the number of the tokens its index has
+func findQuery() string {
+
+	union := make([]string, 0, len(storage.Kinds()))
+	for _, kind := range storage.Kinds() {
+		union = append(union, `SELECT id, '`+kind.Name+`' AS type, `+kind.Search().Name+` AS name,
+			tags, secret_tags, `+folderColumn+`, created_at, updated_at,
+			cardinality(ARRAY(SELECT unnest(`+indexTokens+`) INTERSECT SELECT unnest($2::text[]))) AS score
+			FROM `+kind.Table+` WHERE owner_id = user_id($1) AND `+indexTokens+` && $2::text[]`)
+	}
+
+	return `SELECT id, type, name, tags, secret_tags, folder_id, score, created_at, updated_at FROM (
+		` + strings.Join(union, `
+		UNION ALL
+		`) + `
+	) AS found WHERE score >= $3 ORDER BY score DESC, updated_at DESC, id LIMIT $4`
+}
+
+// Find returns the metadata of the vault items matching the blinded tokens of a query, the best matches first.
+// The server compares the hashes only, it learns neither the words of the query nor the names of the items
+func (m *ManagerDB) Find(ctx context.Context, tokens []string, minScore, limit int, login string) ([]byte, error) {
+	childCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	list := storage.ItemList{
+		Items: []storage.ItemMeta{},
+	}
+
+	err := m.Db.SelectContext(childCtx, &list.Items, findQuery()+`;`, login, tokens, minScore, limit)
+	if err != nil {
+		return []byte(""), err
+	}
+
+	list.Total = len(list.Items)
+
+	return json.Marshal(list)
+}
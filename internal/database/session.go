@@ -0,0 +1,124 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/EgorKo25/GophKeeper/internal/storage"
+)
+
+var (
+	ErrSessionReused = errors.New("refresh token reused")
+)
+
+// AddSession stores a new refresh token session and removes the expired ones of the user
+func (m *ManagerDB) AddSession(ctx context.Context, session *storage.Session) error {
+	childCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	_, err := m.Db.ExecContext(childCtx,
+		`DELETE FROM sessions WHERE owner_id = user_id($1) AND expires_at < NOW();`, session.LoginOwner)
+	if err != nil {
+		return err
+	}
+
+	return m.addSession(childCtx, m.Db, session)
+}
+
+// addSession inserts the session
+func (m *ManagerDB) addSession(childCtx context.Context, db execer, session *storage.Session) error {
+
+	query := `INSERT INTO sessions (id, family, owner_id, token_hash, expires_at)
+							VALUES  (:id, :family, user_id(:login_owner), :token_hash, :expires_at);`
+
+	_, err := db.NamedExecContext(childCtx, query, session)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RotateSession marks the presented refresh token as used and stores the next one of the family.
+// Presenting a used or revoked token means it was stolen,
+// so the whole family is revoked and ErrSessionReused is returned
+func (m *ManagerDB) RotateSession(ctx context.Context, tokenHash string, next *storage.Session) error {
+	childCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	var current storage.Session
+
+	tx, err := m.Db.BeginTxx(childCtx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	err = tx.GetContext(childCtx, &current,
+		`SELECT id, family, `+ownerColumn+`, token_hash, expires_at, created_at, used, revoked
+		FROM sessions WHERE token_hash = $1 FOR UPDATE;`, tokenHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	if current.Used || current.Revoked {
+		_, err = tx.ExecContext(childCtx,
+			`UPDATE sessions SET revoked = TRUE WHERE family = $1;`, current.Family)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+
+		return ErrSessionReused
+	}
+
+	if current.ExpiresAt.Before(time.Now()) {
+		return ErrNotFound
+	}
+
+	_, err = tx.ExecContext(childCtx,
+		`UPDATE sessions SET used = TRUE WHERE id = $1;`, current.Id)
+	if err != nil {
+		return err
+	}
+
+	next.Family = current.Family
+	next.LoginOwner = current.LoginOwner
+
+	err = m.addSession(childCtx, tx, next)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RevokeSessions revokes the refresh tokens of the family,
+// an empty family revokes every session of the user
+func (m *ManagerDB) RevokeSessions(ctx context.Context, login, family string) error {
+	childCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	query := `UPDATE sessions SET revoked = TRUE WHERE owner_id = user_id($1) AND family = $2;`
+	args := []any{login, family}
+
+	if family == "" {
+		query = `UPDATE sessions SET revoked = TRUE WHERE owner_id = user_id($1);`
+		args = args[:1]
+	}
+
+	_, err := m.Db.ExecContext(childCtx, query, args...)
+
+	return err
+}
@@ -0,0 +1,85 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/EgorKo25/GophKeeper/internal/storage"
+)
+
+// addTombstone records the deletion of an item, so other devices of the user delete it too
+func addTombstone(ctx context.Context, db execer, id, itemType, login string) error {
+
+	query := `INSERT INTO tombstones (id, type, owner_id)
+							VALUES  (:id, :type, user_id(:login_owner));`
+
+	_, err := db.NamedExecContext(ctx, query, map[string]any{
+		"id":          id,
+		"type":        itemType,
+		"login_owner": login,
+	})
+
+	return err
+}
+
+// Sync returns the items changed and deleted since the revision.
+// The vault lock is taken exclusively, so every change with a revision
+// below the returned cursor has been committed and none will be missed
+func (m *ManagerDB) Sync(ctx context.Context, since int64, login string) ([]byte, error) {
+
+	childCtx, cancel := context.WithTimeout(ctx, vaultTimeout)
+	defer cancel()
+
+	delta := storage.SyncDelta{
+		Cursor:  since,
+		Items:   make(storage.Items),
+		Deleted: []storage.Tombstone{},
+	}
+
+	tx, err := m.Db.BeginTxx(childCtx, nil)
+	if err != nil {
+		return []byte(""), err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	err = lockVault(childCtx, tx, login, false)
+	if err != nil {
+		return []byte(""), err
+	}
+
+	revisions := make([]string, 0, len(storage.Kinds())+1)
+	for _, kind := range storage.Kinds() {
+		err = selectItems(childCtx, tx, delta.Items, kind,
+			`SELECT `+itemColumns(kind)+` FROM `+kind.Table+` WHERE owner_id = user_id($1) AND revision > $2 ORDER BY revision;`,
+			login, since)
+		if err != nil {
+			return []byte(""), err
+		}
+
+		revisions = append(revisions, `(SELECT COALESCE(MAX(revision), 0) FROM `+kind.Table+` WHERE owner_id = user_id($1))`)
+	}
+	revisions = append(revisions, `(SELECT COALESCE(MAX(revision), 0) FROM tombstones WHERE owner_id = user_id($1))`)
+
+	err = tx.SelectContext(childCtx, &delta.Deleted,
+		`SELECT id, type FROM tombstones WHERE owner_id = user_id($1) AND revision > $2 ORDER BY revision;`,
+		login, since)
+	if err != nil {
+		return []byte(""), err
+	}
+
+	err = tx.GetContext(childCtx, &delta.Cursor,
+		`SELECT GREATEST($2, `+strings.Join(revisions, `, `)+`);`, login, since)
+	if err != nil {
+		return []byte(""), err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return []byte(""), err
+	}
+
+	return json.Marshal(delta)
+}
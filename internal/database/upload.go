@@ -0,0 +1,199 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/EgorKo25/GophKeeper/internal/storage"
+)
+
+const uploadColumns = `id, ` + ownerColumn + `, item_id, title, fingerprint, manifest, chunk_ids, size, chunks, created_at`
+
+// AddUpload starts a chunked upload of a file
+func (m *ManagerDB) AddUpload(ctx context.Context, upload *storage.Upload, login string) error {
+	childCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	upload.LoginOwner = login
+
+	query := `INSERT INTO uploads (owner_id, item_id, title, fingerprint, manifest, chunk_ids, size, chunks)
+							VALUES  (user_id(:login_owner), :item_id, :title, :fingerprint, :manifest, :chunk_ids, :size, :chunks)
+							RETURNING id, created_at;`
+
+	return queryReturning(childCtx, m.Db, query, upload, &upload.Id, &upload.CreatedAt)
+}
+
+// ReadUpload reads the upload by id
+func (m *ManagerDB) ReadUpload(ctx context.Context, upload *storage.Upload, login string) error {
+	childCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	upload.LoginOwner = login
+
+	query := `SELECT ` + uploadColumns + ` FROM uploads WHERE id = :id AND owner_id = user_id(:login_owner);`
+
+	rows, err := m.Db.NamedQueryContext(childCtx, query, upload)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return ErrNotFound
+	}
+
+	return rows.StructScan(upload)
+}
+
+// Uploads returns the unfinished uploads of the user, the oldest first
+func (m *ManagerDB) Uploads(ctx context.Context, login string) ([]storage.Upload, error) {
+	childCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	uploads := []storage.Upload{}
+
+	err := m.Db.SelectContext(childCtx, &uploads,
+		`SELECT `+uploadColumns+` FROM uploads WHERE owner_id = user_id($1) ORDER BY created_at;`, login)
+	if err != nil {
+		return nil, err
+	}
+
+	return uploads, nil
+}
+
+// CompleteUpload stores the uploaded file as a new item or as the content of the item the upload replaces
+// and finishes the upload in one transaction. The file refers to the chunks of the user by their ids:
+// a received chunk with a new id is kept where it was uploaded, a chunk stored before is shared.
+// The numbers of the received chunks the file doesn't keep are returned, they can be removed.
+// A chunk neither stored nor received fails the upload with ErrMissingChunk, the hash of the content is taken from bin
+func (m *ManagerDB) CompleteUpload(ctx context.Context, upload *storage.Upload, bin *storage.BinaryData,
+	received map[int]int64, login string) ([]int, error) {
+
+	childCtx, cancel := context.WithTimeout(ctx, vaultTimeout)
+	defer cancel()
+
+	bin.Id = upload.ItemId
+	bin.Title = upload.Title
+	bin.LoginOwner = login
+	bin.Chunks = upload.Chunks
+	bin.Manifest = upload.Manifest
+	bin.Key = ""
+	bin.BlobKey = ""
+	bin.Version = upload.Version
+
+	var unused []int
+
+	// the counters of the chunks are changed, so the changes of the files of the user are serialized
+	err := m.withVaultLock(childCtx, login, false, func(tx *sqlx.Tx) error {
+
+		var err error
+
+		bin.Size, unused, err = acquireChunks(childCtx, tx, upload, received, login)
+		if err != nil {
+			return err
+		}
+
+		if bin.Id == "" {
+			err = queryReturning(childCtx, tx, `INSERT INTO binary_data
+				(title, owner_id, size, chunks, manifest, content_hash, modified_by)
+				VALUES  (:title, user_id(:login_owner), :size, :chunks, :manifest, :content_hash, :modified_by)
+				RETURNING id, version, revision;`, bin, &bin.Id, &bin.Version, &bin.Revision)
+		} else {
+			err = updateReturning(childCtx, tx, `UPDATE binary_data
+				SET title = :title, size = :size, chunks = :chunks, manifest = :manifest, file_key = '',
+				content_hash = :content_hash, blob_key = '', modified_by = :modified_by, version = version + 1,
+				updated_at = NOW(), revision = nextval('vault_revision_seq')
+				WHERE id = :id AND owner_id = user_id(:login_owner) AND version = :version
+				RETURNING version, revision;`,
+				`SELECT id FROM binary_data WHERE id = :id AND owner_id = user_id(:login_owner);`,
+				bin, &bin.Version, &bin.Revision)
+			if err == nil {
+				err = releaseChunks(childCtx, tx, bin)
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		for n, id := range upload.ChunkIds {
+			_, err = tx.ExecContext(childCtx,
+				`INSERT INTO file_chunks (file_id, n, owner_id, chunk_id) VALUES ($1, $2, user_id($3), $4);`,
+				bin.Id, n, login, id)
+			if err != nil {
+				return err
+			}
+		}
+
+		// the upload may have been expired by the garbage collector meanwhile, its chunks are removed then
+		res, err := tx.ExecContext(childCtx, `DELETE FROM uploads WHERE id = $1 AND owner_id = user_id($2);`, upload.Id, login)
+		if err != nil {
+			return err
+		}
+
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if affected == 0 {
+			return ErrNotFound
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return unused, nil
+}
+
+// BlobKeys returns the keys of the blobs of the stored files, the stored chunks and the unfinished uploads of all users.
+// The blobs of the files and the chunks put into the quarantine are kept as well
+func (m *ManagerDB) BlobKeys(ctx context.Context) ([]string, error) {
+	childCtx, cancel := context.WithTimeout(ctx, vaultTimeout)
+	defer cancel()
+
+	keys := []string{}
+
+	err := m.Db.SelectContext(childCtx, &keys,
+		`SELECT blob_key FROM binary_data WHERE blob_key <> ''
+		UNION ALL
+		SELECT id::text FROM uploads
+		UNION ALL
+		SELECT DISTINCT blob_key FROM chunks
+		UNION ALL
+		SELECT DISTINCT data->>'blob_key' FROM quarantine WHERE data->>'blob_key' <> '';`)
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// ExpireUploads deletes the uploads started before the time and returns their ids, the keys of their blobs
+func (m *ManagerDB) ExpireUploads(ctx context.Context, before time.Time) ([]string, error) {
+	childCtx, cancel := context.WithTimeout(ctx, vaultTimeout)
+	defer cancel()
+
+	ids := []string{}
+
+	err := m.Db.SelectContext(childCtx, &ids, `DELETE FROM uploads WHERE created_at < $1 RETURNING id::text;`, before)
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// ReadFile reads the file item together with the key of its blob
+func (m *ManagerDB) ReadFile(ctx context.Context, bin *storage.BinaryData, login string) error {
+	childCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	bin.LoginOwner = login
+
+	return m.readItem(childCtx, bin)
+}
@@ -0,0 +1,117 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// vaultLockSpace is the first key of the advisory locks over user vaults
+const vaultLockSpace = 1
+
+// lockVault takes a transaction level advisory lock over the user vault,
+// it is released on commit or rollback even if the handler has failed.
+// Adding items shares the lock, replacing the whole vault takes it exclusively
+func lockVault(ctx context.Context, tx *sqlx.Tx, login string, shared bool) error {
+
+	query := `SELECT pg_advisory_xact_lock($1, hashtext($2));`
+	if shared {
+		query = `SELECT pg_advisory_xact_lock_shared($1, hashtext($2));`
+	}
+
+	_, err := tx.ExecContext(ctx, query, vaultLockSpace, login)
+
+	return err
+}
+
+// withVaultLock runs fn in a transaction holding the vault lock of the user
+func (m *ManagerDB) withVaultLock(ctx context.Context, login string, shared bool, fn func(tx *sqlx.Tx) error) error {
+
+	tx, err := m.Db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	err = lockVault(ctx, tx, login, shared)
+	if err != nil {
+		return err
+	}
+
+	err = fn(tx)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// checkVersion checks the result of an update or delete guarded by the item version.
+// When no row is affected, exists tells a stale version from a missing item
+func checkVersion(ctx context.Context, db execer, res sql.Result, exists string, arg any) error {
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected > 0 {
+		return nil
+	}
+
+	return missingItem(ctx, db, exists, arg)
+}
+
+// updateReturning runs an update guarded by the item version and scans the columns it returns.
+// When no row is updated, exists tells a stale version from a missing item
+func updateReturning(ctx context.Context, db execer, query, exists string, arg any, dest ...any) error {
+
+	err := queryReturning(ctx, db, query, arg, dest...)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	return missingItem(ctx, db, exists, arg)
+}
+
+// missingItem returns ErrConflict if the item queried by exists is stored with another version
+// and ErrNotFound if it is not stored at all.
+// It runs in the transaction of the failed change, so it sees the same state of the vault
+func missingItem(ctx context.Context, db execer, exists string, arg any) error {
+
+	var id string
+
+	err := queryReturning(ctx, db, exists, arg, &id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	return ErrConflict
+}
+
+// replaceItem updates one item of the vault by its id and version
+func replaceItem(ctx context.Context, db execer, query string, arg any) error {
+
+	res, err := db.NamedExecContext(ctx, query, arg)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrConflict
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+package dialog
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/EgorKo25/GophKeeper/internal/sshagent"
+	"github.com/EgorKo25/GophKeeper/internal/storage"
+)
+
+// ServeAgent serves the ssh keys of the vault over the ssh-agent protocol on the unix socket until interrupted.
+// The keys are decrypted in memory only, by default the socket is created in a directory only the user can access
+func (d *Manager) ServeAgent(socket string) error {
+
+	err := d.SelectAuth()
+	if err != nil {
+		return err
+	}
+
+	err = d.unlock()
+	if err != nil {
+		return err
+	}
+
+	a := sshagent.New(d.confirmSign)
+
+	if d.loadKeys(a) == 0 {
+		fmt.Println(myStyler(myStyler("В хранилище нет SSH-ключей")))
+		return nil
+	}
+
+	if socket == "" {
+		dir, err := os.MkdirTemp(runtimeDir(), "gophkeeper-agent-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+
+		socket = filepath.Join(dir, "agent.sock")
+	}
+
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	err = os.Chmod(socket, 0o600)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		<-ctx.Done()
+		_ = l.Close()
+	}()
+
+	fmt.Printf("SSH_AUTH_SOCK=%s; export SSH_AUTH_SOCK;\n", socket)
+	fmt.Println(myStyler("Агент запущен, нажмите Ctrl+C для остановки"))
+
+	err = a.Serve(l)
+	_ = a.RemoveAll()
+
+	fmt.Println(myStyler("Агент остановлен"))
+	return err
+}
+
+// loadKeys adds the ssh keys of the local copy of the vault to the agent and returns their number,
+// a key that can't be opened is skipped
+func (d *Manager) loadKeys(a *sshagent.Agent) (n int) {
+
+	for _, item := range d.store.Vault().Items[storage.SSHKeyKind.Name] {
+		plain := make(map[string]string)
+		for _, f := range storage.SSHKeyKind.Fields {
+			plain[f.Name], _ = d.e.Decrypt(f.Value(item))
+		}
+
+		key, err := d.agentKey(plain)
+		if err == nil {
+			err = a.AddKey(key)
+		}
+		if err != nil {
+			fmt.Println(myStyler(myStyler("Ключ "+plain["name"]+" не загружен: ")), err)
+			continue
+		}
+
+		fmt.Println(myStyler("Загружен ключ: "), plain["name"])
+		n++
+	}
+
+	return n
+}
+
+// agentKey opens the key with the plain values of the fields
+func (d *Manager) agentKey(plain map[string]string) (key sshagent.Key, err error) {
+
+	key.PrivateKey, err = sshagent.ParsePrivateKey([]byte(plain["private_key"]), []byte(plain["passphrase"]))
+	if err != nil {
+		return key, err
+	}
+
+	if plain["certificate"] != "" {
+		key.Certificate, err = sshagent.ParseCertificate([]byte(plain["certificate"]))
+		if err != nil {
+			return key, err
+		}
+	}
+
+	if plain["lifetime"] != "" {
+		key.Lifetime, err = time.ParseDuration(plain["lifetime"])
+		if err != nil {
+			return key, err
+		}
+	}
+
+	key.Comment = plain["comment"]
+	if key.Comment == "" {
+		key.Comment = plain["name"]
+	}
+
+	key.Confirm = plain["confirm"] == "y"
+
+	return key, nil
+}
+
+// confirmSign asks the user whether to sign with the key
+func (d *Manager) confirmSign(comment string) bool {
+	return d.myPrompt(fmt.Sprintf("Разрешить подпись ключом %s? (y/n)", comment)) == "y"
+}
+
+// runtimeDir returns the directory of the user runtime files
+func runtimeDir() string {
+
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return dir
+	}
+
+	return os.TempDir()
+}
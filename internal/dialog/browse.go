@@ -0,0 +1,138 @@
+package dialog
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/EgorKo25/GophKeeper/internal/storage"
+
+	"github.com/manifoldco/promptui"
+)
+
+// Browse shows all vault items in a filterable list and opens the chosen one
+func (d *Manager) Browse() (err error) {
+
+	var code int
+	var items []storage.ItemMeta
+
+	items, code, err = d.listItems()
+	if code != 200 {
+		return d.listFailed(code, err)
+	}
+
+	if len(items) == 0 {
+		fmt.Println(myStyler("Хранилище пусто"))
+		return nil
+	}
+
+	labels := make([]string, 0, len(items))
+	for _, item := range items {
+		name, _ := d.e.Decrypt(item.Name)
+		title := item.Type
+		if kind, ok := storage.KindOf(item.Type); ok {
+			title = kind.Title
+		}
+
+		label := fmt.Sprintf("%s: %s", title, name)
+		if tags := d.tags(item.Tags, item.SecretTags); len(tags) > 0 {
+			label += " [" + strings.Join(tags, ", ") + "]"
+		}
+		// the local copy doesn't keep the time of the changes
+		if !item.UpdatedAt.IsZero() {
+			label += fmt.Sprintf(" (изменено %s)", item.UpdatedAt.Local().Format("02.01.2006 15:04"))
+		}
+		labels = append(labels, label)
+	}
+
+	prompt := promptui.Select{
+		Label: "Выберите запись",
+		Items: labels,
+		Size:  10,
+		Searcher: func(input string, index int) bool {
+			return strings.Contains(strings.ToLower(labels[index]), strings.ToLower(input))
+		},
+		StartInSearchMode: true,
+	}
+
+	i, _, err := prompt.Run()
+	if err != nil {
+		return err
+	}
+
+	return d.openItem(items[i])
+}
+
+// listItems downloads the metadata of all vault items page by page
+func (d *Manager) listItems() (items []storage.ItemMeta, code int, err error) {
+
+	var tmp any
+
+	for {
+		code, tmp, d.cookie, err = d.c.Get(d.cookie, fmt.Sprintf("/user/items?offset=%d", len(items)))
+		if code != 200 {
+			return nil, code, err
+		}
+
+		page := tmp.(storage.ItemList)
+		items = append(items, page.Items...)
+
+		if len(page.Items) == 0 || len(items) >= page.Total {
+			return items, code, nil
+		}
+	}
+}
+
+// listFailed reports the failed listing of the vault items
+func (d *Manager) listFailed(code int, err error) error {
+
+	if err != nil {
+		fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
+		return err
+	}
+	if code == 401 {
+		fmt.Println(myStyler(myStyler("Сессия истекла, войдите снова")))
+		return d.SelectAuth()
+	}
+
+	fmt.Println(myStyler("Не удалось получить список записей"))
+	return nil
+}
+
+// openItem reads the item by its id and shows it
+func (d *Manager) openItem(item storage.ItemMeta) (err error) {
+
+	var code int
+	var tmp any
+
+	kind, ok := storage.KindOf(item.Type)
+	if !ok {
+		return errors.New("unknown type")
+	}
+
+	src := kind.New()
+	*src.Header().Id = item.Id
+
+	code, tmp, d.cookie, err = d.c.Send(src, item.Type, d.cookie, "/user/read")
+	if code != 200 {
+		if err != nil {
+			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
+			return
+		}
+		if code == 401 {
+			fmt.Println(myStyler(myStyler("Сессия истекла, войдите снова")))
+			return d.SelectAuth()
+		}
+
+		fmt.Println(myStyler("Запись удалена"))
+		return
+	}
+
+	if found, ok := tmp.(storage.Item); ok {
+		d.showItem(found)
+		d.revealHidden(found)
+	}
+
+	fmt.Println(myStyler("Готово"))
+	return nil
+}
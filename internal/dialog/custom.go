@@ -0,0 +1,261 @@
+package dialog
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/EgorKo25/GophKeeper/internal/storage"
+
+	"github.com/manifoldco/promptui"
+)
+
+// fieldTypes are the types of the custom fields in the order they are offered
+var fieldTypes = []string{storage.FieldText, storage.FieldHidden, storage.FieldURL, storage.FieldDate}
+
+// fieldTypeTitles are the titles of the custom field types shown to the user
+var fieldTypeTitles = map[string]string{
+	storage.FieldText:   "Текст",
+	storage.FieldHidden: "Скрытое",
+	storage.FieldURL:    "Ссылка",
+	storage.FieldDate:   "Дата",
+}
+
+// tags decrypts the tags encrypted as a whole, plain tags are returned as is
+func (d *Manager) tags(tags string, secret bool) []string {
+
+	if secret {
+		tags, _ = d.e.Decrypt(tags)
+	}
+
+	return storage.SplitTags(tags)
+}
+
+// itemTags decrypts the tags of the item
+func (d *Manager) itemTags(item storage.Item) []string {
+	return d.tags(*item.Header().Tags, *item.Header().SecretTags)
+}
+
+// setTags sets the tags of the item, they are encrypted as a whole if secret
+func (d *Manager) setTags(item storage.Item, tags []string, secret bool) (err error) {
+
+	joined := storage.JoinTags(tags)
+	secret = secret && joined != ""
+
+	if secret {
+		joined, err = d.e.Encrypt(joined)
+	}
+
+	*item.Header().Tags = joined
+	*item.Header().SecretTags = secret
+	return err
+}
+
+// customFields decrypts the custom fields of the item
+func (d *Manager) customFields(item storage.Item) ([]storage.CustomField, error) {
+
+	var fields []storage.CustomField
+
+	if *item.Header().Custom == "" {
+		return nil, nil
+	}
+
+	plain, err := d.e.Decrypt(*item.Header().Custom)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal([]byte(plain), &fields)
+	return fields, err
+}
+
+// setCustomFields encrypts the custom fields of the item as a whole
+func (d *Manager) setCustomFields(item storage.Item, fields []storage.CustomField) error {
+
+	if len(fields) == 0 {
+		*item.Header().Custom = ""
+		return nil
+	}
+
+	plain, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+
+	*item.Header().Custom, err = d.e.Encrypt(string(plain))
+	return err
+}
+
+// editExtras lets the user edit the tags and the custom fields of the item
+func (d *Manager) editExtras(item storage.Item) error {
+
+	tags := storage.SplitTags(d.myEdit("Теги через запятую", strings.Join(d.itemTags(item), ", ")))
+
+	secret := "y"
+	if *item.Header().Tags != "" && !*item.Header().SecretTags {
+		secret = "n"
+	}
+	if len(tags) > 0 {
+		secret = d.myEdit("Шифровать теги? (y/n)", secret)
+	}
+
+	err := d.setTags(item, tags, secret == "y")
+	if err != nil {
+		return err
+	}
+
+	fields, err := d.customFields(item)
+	if err != nil {
+		return err
+	}
+
+	for {
+		labels := make([]string, 0, len(fields)+2)
+		for _, f := range fields {
+			labels = append(labels, fmt.Sprintf("%s (%s)", f.Name, fieldTypeTitles[f.Type]))
+		}
+		labels = append(labels, "Добавить поле", "Готово")
+
+		prompt := promptui.Select{
+			Label: "Дополнительные поля",
+			Items: labels,
+		}
+
+		i, _, err := prompt.Run()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case i == len(fields)+1:
+			return d.setCustomFields(item, fields)
+		case i == len(fields):
+			f, err := d.inputCustomField(storage.CustomField{})
+			if err != nil {
+				fmt.Println(myStyler(myStyler("Поле не добавлено: ")), err)
+				continue
+			}
+			fields = append(fields, f)
+		default:
+			if d.myPrompt("Удалить поле? (y — удалить, иначе изменить)") == "y" {
+				fields = append(fields[:i], fields[i+1:]...)
+				continue
+			}
+
+			f, err := d.inputCustomField(fields[i])
+			if err != nil {
+				fmt.Println(myStyler(myStyler("Поле не изменено: ")), err)
+				continue
+			}
+			fields[i] = f
+		}
+	}
+}
+
+// inputCustomField asks the name, the type and the value of the custom field, current is the field to edit
+func (d *Manager) inputCustomField(current storage.CustomField) (storage.CustomField, error) {
+
+	f := storage.CustomField{Name: strings.TrimSpace(d.myEdit("Название поля", current.Name))}
+
+	cursor := 0
+	for i, t := range fieldTypes {
+		if t == current.Type {
+			cursor = i
+		}
+	}
+
+	titles := make([]string, 0, len(fieldTypes))
+	for _, t := range fieldTypes {
+		titles = append(titles, fieldTypeTitles[t])
+	}
+
+	prompt := promptui.Select{
+		Label:     "Тип поля",
+		Items:     titles,
+		CursorPos: cursor,
+	}
+
+	i, _, err := prompt.Run()
+	if err != nil {
+		return f, err
+	}
+
+	f.Type = fieldTypes[i]
+
+	switch f.Type {
+	case storage.FieldHidden:
+		f.Value = d.myPassword("Значение")
+	case storage.FieldDate:
+		f.Value = strings.TrimSpace(d.myEdit("Дата (ГГГГ-ММ-ДД)", current.Value))
+	default:
+		f.Value = strings.TrimSpace(d.myEdit("Значение", current.Value))
+	}
+
+	return f, f.Validate()
+}
+
+// askExtras offers the user to add the tags and the custom fields to the new item
+func (d *Manager) askExtras(item storage.Item) error {
+
+	if d.myPrompt("Добавить теги и дополнительные поля? (y/n)") != "y" {
+		return nil
+	}
+
+	return d.editExtras(item)
+}
+
+// showExtras prints the tags and the custom fields of the item, the values of the hidden fields are masked
+func (d *Manager) showExtras(item storage.Item) {
+
+	if tags := d.itemTags(item); len(tags) > 0 {
+		fmt.Println("Теги:", strings.Join(tags, ", "))
+	}
+
+	fields, err := d.customFields(item)
+	if err != nil {
+		fmt.Println(myStyler(myStyler("Дополнительные поля повреждены: ")), err)
+		return
+	}
+
+	for _, f := range fields {
+		value := f.Value
+		if f.Type == storage.FieldHidden {
+			value = "********"
+		}
+		fmt.Printf("%s: %s\n", f.Name, value)
+	}
+}
+
+// fieldNames returns the names of the custom fields of the item to show them in a table
+func (d *Manager) fieldNames(item storage.Item) string {
+
+	fields, _ := d.customFields(item)
+
+	names := make([]string, 0, len(fields))
+	for _, f := range fields {
+		names = append(names, f.Name)
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// revealHidden prints the values of the hidden custom fields of the item if the user asks
+func (d *Manager) revealHidden(item storage.Item) {
+
+	fields, _ := d.customFields(item)
+
+	hidden := false
+	for _, f := range fields {
+		hidden = hidden || f.Type == storage.FieldHidden
+	}
+
+	if !hidden || d.myPrompt("Показать скрытые поля? (y/n)") != "y" {
+		return
+	}
+
+	for _, f := range fields {
+		if f.Type == storage.FieldHidden {
+			fmt.Printf("%s: %s\n", f.Name, f.Value)
+		}
+	}
+}
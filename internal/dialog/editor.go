@@ -0,0 +1,134 @@
+package dialog
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// errNoEditor is returned when the user has refused to edit the text on a disk
+var errNoEditor = errors.New("no memory-backed directory for the editor")
+
+// editText opens the editor on a temporary file with the text and returns the edited text.
+// The file is kept in a directory only the user can access on a memory-backed file system,
+// so the plain text never reaches a disk, and the directory is wiped afterwards
+func (d *Manager) editText(label, text string) (string, error) {
+
+	dir, err := editorDir()
+	if err != nil {
+		dir, err = d.diskDir()
+		if err != nil {
+			return "", err
+		}
+	}
+	defer wipeDir(dir)
+
+	path := filepath.Join(dir, "note.md")
+
+	err = os.WriteFile(path, []byte(text), 0o600)
+	if err != nil {
+		return "", err
+	}
+
+	args := append(strings.Fields(editorCommand()), path)
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	fmt.Println(myStyler(label + ": сохраните файл и закройте редактор"))
+
+	err = cmd.Run()
+	if err != nil {
+		return "", err
+	}
+
+	res, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(res), "\n"), nil
+}
+
+// editorCommand returns the editor of the user
+func editorCommand() string {
+
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if editor := strings.TrimSpace(os.Getenv(env)); editor != "" {
+			return editor
+		}
+	}
+
+	if runtime.GOOS == "windows" {
+		return "notepad"
+	}
+
+	return "vi"
+}
+
+// editorDir creates a directory only the user can access in the first memory-backed directory
+func editorDir() (string, error) {
+
+	for _, base := range []string{os.Getenv("XDG_RUNTIME_DIR"), "/dev/shm"} {
+		if base == "" || !inMemory(base) {
+			continue
+		}
+
+		// the directory is created with 0700
+		dir, err := os.MkdirTemp(base, "gophkeeper-")
+		if err == nil {
+			return dir, nil
+		}
+	}
+
+	return "", errNoEditor
+}
+
+// diskDir creates a directory for the editor on a disk, the user confirms it by typing the path of its parent.
+// Any other answer refuses
+func (d *Manager) diskDir() (string, error) {
+
+	base := os.TempDir()
+
+	fmt.Println(myStyler(fmt.Sprintf("Нет каталога в памяти, временный файл будет записан на диск в %s", base)))
+	if d.myPrompt("Введите этот путь, чтобы продолжить") != base {
+		fmt.Println(myStyler("Редактирование отменено"))
+		return "", errNoEditor
+	}
+
+	return os.MkdirTemp(base, "gophkeeper-")
+}
+
+// wipeDir overwrites the files of the directory with zeros and removes it,
+// the swap and backup files of the editor are wiped along with the text
+func wipeDir(dir string) {
+
+	_ = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+
+		f, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			return nil
+		}
+		defer f.Close()
+
+		_, _ = f.Write(make([]byte, info.Size()))
+		_ = f.Sync()
+
+		return nil
+	})
+
+	_ = os.RemoveAll(dir)
+}
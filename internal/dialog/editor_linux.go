@@ -0,0 +1,22 @@
+//go:build linux
+
+package dialog
+
+import "syscall"
+
+// file system magic numbers of tmpfs and ramfs
+const (
+	tmpfsMagic = 0x01021994
+	ramfsMagic = 0x858458f6
+)
+
+// inMemory reports whether the directory is on a memory-backed file system
+func inMemory(dir string) bool {
+
+	var st syscall.Statfs_t
+	if syscall.Statfs(dir, &st) != nil {
+		return false
+	}
+
+	return uint32(st.Type) == tmpfsMagic || uint32(st.Type) == ramfsMagic
+}
@@ -0,0 +1,20 @@
+//go:build linux
+
+package dialog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInMemory_Linux(t *testing.T) {
+	assert.False(t, inMemory("/proc"))
+
+	if inMemory("/dev/shm") {
+		dir, err := editorDir()
+		if assert.NoError(t, err) {
+			wipeDir(dir)
+		}
+	}
+}
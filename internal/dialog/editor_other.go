@@ -0,0 +1,9 @@
+//go:build !linux
+
+package dialog
+
+// inMemory reports whether the directory is on a memory-backed file system,
+// it is known only on Linux
+func inMemory(string) bool {
+	return false
+}
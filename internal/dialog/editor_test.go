@@ -0,0 +1,61 @@
+package dialog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEditorDir(t *testing.T) {
+	disk := t.TempDir()
+	t.Setenv("XDG_RUNTIME_DIR", disk)
+
+	dir, err := editorDir()
+	if err != nil {
+		assert.ErrorIs(t, err, errNoEditor)
+		return
+	}
+	defer wipeDir(dir)
+
+	assert.True(t, inMemory(filepath.Dir(dir)))
+	assert.Equal(t, inMemory(disk), strings.HasPrefix(dir, disk))
+
+	info, err := os.Stat(dir)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o700), info.Mode().Perm())
+}
+
+func TestInMemory(t *testing.T) {
+	assert.False(t, inMemory(filepath.Join(t.TempDir(), "missing")))
+}
+
+func TestWipeDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "editor")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "backup"), 0o700))
+
+	note := filepath.Join(dir, "note.md")
+	swap := filepath.Join(dir, "backup", ".note.md.swp")
+	require.NoError(t, os.WriteFile(note, []byte("secret note"), 0o600))
+	require.NoError(t, os.WriteFile(swap, []byte("secret swap"), 0o600))
+
+	// the links keep the content of the files after the directory is removed
+	links := map[string]string{note: filepath.Join(t.TempDir(), "note"), swap: filepath.Join(t.TempDir(), "swap")}
+	for path, link := range links {
+		if os.Link(path, link) != nil {
+			t.Skip("hard links are not supported")
+		}
+	}
+
+	wipeDir(dir)
+
+	assert.NoDirExists(t, dir)
+	for _, link := range links {
+		data, err := os.ReadFile(link)
+		require.NoError(t, err)
+		assert.Equal(t, make([]byte, len("secret note")), data)
+	}
+}
@@ -0,0 +1,29 @@
+package dialog
+
+import (
+	"github.com/manifoldco/promptui"
+)
+
+// choose lets the user choose one of the found items and returns its index.
+// Nothing is asked when there is only one item, -1 is returned when there are none
+func (d *Manager) choose(label string, items []string) (int, error) {
+
+	switch len(items) {
+	case 0:
+		return -1, nil
+	case 1:
+		return 0, nil
+	}
+
+	prompt := promptui.Select{
+		Label: label,
+		Items: items,
+	}
+
+	i, _, err := prompt.Run()
+	if err != nil {
+		return -1, err
+	}
+
+	return i, nil
+}
@@ -0,0 +1,369 @@
+package dialog
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/EgorKo25/GophKeeper/internal/storage"
+
+	"github.com/manifoldco/promptui"
+)
+
+// Actions offered below the content of the folder
+const (
+	folderUp     = ".. (наверх)"
+	folderAdd    = "Новая папка"
+	folderMoveIn = "Переместить сюда"
+	folderRename = "Переименовать папку"
+	folderDelete = "Удалить папку"
+	folderExit   = "Выйти в меню"
+)
+
+// Folders lets the user walk the folders of the vault and open the items in them,
+// the folders are created, renamed and deleted here and the items are moved between them
+func (d *Manager) Folders() error {
+
+	current, up := "", ""
+
+	for {
+		items, code, err := d.listItems()
+		if code != 200 {
+			return d.listFailed(code, err)
+		}
+
+		folders := folderMetas(items)
+
+		current, up = enterFolder(folders, current, up)
+
+		content := folderContent(items, current)
+
+		var labels []string
+		for _, item := range content {
+			labels = append(labels, d.metaLabel(item))
+		}
+
+		prompt := promptui.Select{
+			Label: "Папка " + d.folderPath(folders, current),
+			Items: append(labels, folderActions(current)...),
+			Size:  10,
+		}
+
+		i, choice, err := prompt.Run()
+		if err != nil {
+			return err
+		}
+
+		if i < len(content) {
+			if content[i].Type == storage.FolderKind.Name {
+				current = content[i].Id
+				continue
+			}
+
+			err = d.openItem(content[i])
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		switch choice {
+		case folderUp:
+			current = up
+		case folderAdd:
+			err = d.addFolder(current)
+		case folderMoveIn:
+			err = d.moveHere(items, folders, current)
+		case folderRename:
+			err = d.renameFolder(current)
+		case folderDelete:
+			err = d.deleteFolder(current)
+		case folderExit:
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// enterFolder returns the folder to show and its parent,
+// a folder deleted on another device is replaced with its parent or with the top level
+func enterFolder(folders map[string]storage.ItemMeta, current, up string) (string, string) {
+
+	if _, ok := folders[current]; !ok {
+		current = ""
+		if _, ok := folders[up]; ok {
+			current = up
+		}
+	}
+
+	return current, folders[current].FolderId
+}
+
+// folderContent returns the items and the folders in the folder
+func folderContent(items []storage.ItemMeta, folder string) []storage.ItemMeta {
+
+	var content []storage.ItemMeta
+	for _, item := range items {
+		if item.FolderId == folder {
+			content = append(content, item)
+		}
+	}
+
+	return content
+}
+
+// folderActions returns the actions offered in the folder, the top level can't be left, renamed or deleted
+func folderActions(folder string) []string {
+
+	if folder == "" {
+		return []string{folderAdd, folderMoveIn, folderExit}
+	}
+
+	return []string{folderUp, folderAdd, folderMoveIn, folderRename, folderDelete, folderExit}
+}
+
+// folderMetas returns the folders among the items by their ids, the top level has the empty id
+func folderMetas(items []storage.ItemMeta) map[string]storage.ItemMeta {
+
+	folders := map[string]storage.ItemMeta{"": {}}
+	for _, item := range items {
+		if item.Type == storage.FolderKind.Name {
+			folders[item.Id] = item
+		}
+	}
+
+	return folders
+}
+
+// folderPath returns the names of the folder and of the folders it is in
+func (d *Manager) folderPath(folders map[string]storage.ItemMeta, id string) string {
+
+	var names []string
+
+	// the depth is limited by the number of the folders in case the local copy is inconsistent
+	for i := 0; id != "" && i < len(folders); i++ {
+		folder, ok := folders[id]
+		if !ok {
+			break
+		}
+
+		name, _ := d.e.Decrypt(folder.Name)
+		names = append([]string{name}, names...)
+		id = folder.FolderId
+	}
+
+	return "/" + strings.Join(names, "/")
+}
+
+// metaLabel names the listed item by its kind and name, the folders end with a slash
+func (d *Manager) metaLabel(item storage.ItemMeta) string {
+
+	name, _ := d.e.Decrypt(item.Name)
+
+	if item.Type == storage.FolderKind.Name {
+		return name + "/"
+	}
+
+	title := item.Type
+	if kind, ok := storage.KindOf(item.Type); ok {
+		title = kind.Title
+	}
+
+	return fmt.Sprintf("%s: %s", title, name)
+}
+
+// addFolder creates a folder in the parent folder
+func (d *Manager) addFolder(parent string) (err error) {
+
+	var code int
+
+	name := strings.TrimSpace(d.myPrompt("Название папки"))
+	if name == "" {
+		fmt.Println(myStyler("Папка не создана: пустое название"))
+		return nil
+	}
+
+	f := &storage.Folder{FolderId: parent}
+
+	err = d.setValues(f, map[string]string{"name": name})
+	if err != nil {
+		fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
+		return err
+	}
+
+	d.indexItem(f)
+
+	code, _, d.cookie, err = d.c.Send(f, storage.FolderKind.Name, d.cookie, "/user/add")
+	if code == 202 {
+		fmt.Println(myStyler(msgQueued))
+		return nil
+	}
+	if code != 200 {
+		return d.itemFailed(code, err)
+	}
+
+	fmt.Println(myStyler("Папка создана"))
+	return nil
+}
+
+// readFolder reads the folder by its id
+func (d *Manager) readFolder(id string) (f *storage.Folder, code int, err error) {
+
+	var tmp any
+
+	code, tmp, d.cookie, err = d.c.Send(&storage.Folder{Id: id}, storage.FolderKind.Name, d.cookie, "/user/read")
+	if code != 200 {
+		return nil, code, err
+	}
+
+	f, ok := tmp.(*storage.Folder)
+	if !ok {
+		return nil, 404, nil
+	}
+
+	return f, code, nil
+}
+
+// renameFolder asks the new name of the folder,
+// a folder changed on another device is renamed only if the user confirms it
+func (d *Manager) renameFolder(id string) error {
+
+	f, code, err := d.readFolder(id)
+	if code != 200 {
+		return d.itemFailed(code, err)
+	}
+
+	current, _ := d.e.Decrypt(f.Name)
+
+	name := strings.TrimSpace(d.myEdit("Название папки", current))
+	if name == "" || name == current {
+		fmt.Println(myStyler("Изменения не внесены"))
+		return nil
+	}
+
+	err = d.setValues(f, map[string]string{"name": name})
+	if err != nil {
+		fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
+		return err
+	}
+
+	d.indexItem(f)
+
+	var tmp any
+
+	code, tmp, d.cookie, err = d.c.Send(f, storage.FolderKind.Name, d.cookie, "/user/update")
+	for code == 409 {
+		var retry bool
+
+		retry, err = d.confirmConflict(tmp, &f.Version, "Всё равно переименовать? (y/n)")
+		if err != nil || !retry {
+			fmt.Println(myStyler("Изменения не внесены"))
+			return err
+		}
+
+		code, tmp, d.cookie, err = d.c.Send(f, storage.FolderKind.Name, d.cookie, "/user/update")
+	}
+	if code == 202 {
+		fmt.Println(myStyler(msgQueued))
+		return nil
+	}
+	if code != 200 {
+		return d.itemFailed(code, err)
+	}
+
+	fmt.Println(myStyler("Папка переименована"))
+	return nil
+}
+
+// deleteFolder deletes the folder, the server moves its content to the folder it is in
+func (d *Manager) deleteFolder(id string) error {
+
+	f, code, err := d.readFolder(id)
+	if code != 200 {
+		return d.itemFailed(code, err)
+	}
+
+	if d.myPrompt("Удалить папку? Её содержимое будет перемещено уровнем выше (y/n)") != "y" {
+		fmt.Println(myStyler("Данные не удалены"))
+		return nil
+	}
+
+	return d.removeItem(f)
+}
+
+// moveHere lets the user choose an item or a folder from the other folders and moves it into the folder
+func (d *Manager) moveHere(items []storage.ItemMeta, folders map[string]storage.ItemMeta, folder string) error {
+
+	others := otherItems(items, folder)
+
+	var labels []string
+	for _, item := range others {
+		labels = append(labels, fmt.Sprintf("%s (%s)", d.metaLabel(item), d.folderPath(folders, item.FolderId)))
+	}
+
+	if len(others) == 0 {
+		fmt.Println(myStyler("Нет записей в других папках"))
+		return nil
+	}
+
+	prompt := promptui.Select{
+		Label: "Выберите запись",
+		Items: labels,
+		Size:  10,
+		Searcher: func(input string, index int) bool {
+			return strings.Contains(strings.ToLower(labels[index]), strings.ToLower(input))
+		},
+		StartInSearchMode: true,
+	}
+
+	i, _, err := prompt.Run()
+	if err != nil {
+		return err
+	}
+
+	return d.moveItem(others[i], folder)
+}
+
+// otherItems returns the items and the folders which can be moved into the folder
+func otherItems(items []storage.ItemMeta, folder string) []storage.ItemMeta {
+
+	var others []storage.ItemMeta
+	for _, item := range items {
+		if item.FolderId != folder && item.Id != folder {
+			others = append(others, item)
+		}
+	}
+
+	return others
+}
+
+// moveItem moves the item or the folder into the folder, an empty one is the top level
+func (d *Manager) moveItem(item storage.ItemMeta, folder string) (err error) {
+
+	var code int
+
+	kind, ok := storage.KindOf(item.Type)
+	if !ok {
+		return fmt.Errorf("unknown type %s", item.Type)
+	}
+
+	src := kind.New()
+	*src.Header().Id = item.Id
+	*src.Header().Folder = folder
+
+	code, _, d.cookie, err = d.c.Send(src, kind.Name, d.cookie, "/user/move")
+	switch code {
+	case 200:
+		fmt.Println(myStyler("Запись перемещена"))
+		return nil
+	case 202:
+		fmt.Println(myStyler(msgQueued))
+		return nil
+	case 422:
+		fmt.Println(myStyler("Папку нельзя переместить в неё саму или в её подпапку"))
+		return nil
+	}
+
+	return d.itemFailed(code, err)
+}
@@ -0,0 +1,126 @@
+package dialog
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/EgorKo25/GophKeeper/internal/client"
+	"github.com/EgorKo25/GophKeeper/internal/storage"
+)
+
+// testTree returns the listed items of a vault with the folders /Work/Mail
+func testTree(t *testing.T, d *Manager) []storage.ItemMeta {
+	return []storage.ItemMeta{
+		{Id: "f1", Type: storage.FolderKind.Name, Name: sealed(t, d.e, "Work")},
+		{Id: "c1", Type: storage.CardKind.Name, Name: sealed(t, d.e, "Bank")},
+		{Id: "f2", Type: storage.FolderKind.Name, Name: sealed(t, d.e, "Mail"), FolderId: "f1"},
+		{Id: "p1", Type: storage.PasswordKind.Name, Name: sealed(t, d.e, "yandex"), FolderId: "f2"},
+	}
+}
+
+// ids returns the ids of the items
+func ids(items []storage.ItemMeta) []string {
+	res := []string{}
+	for _, item := range items {
+		res = append(res, item.Id)
+	}
+	return res
+}
+
+func TestFolderMetas(t *testing.T) {
+	d := &Manager{e: testCrypto(t, "secret")}
+
+	folders := folderMetas(testTree(t, d))
+
+	assert.Len(t, folders, 3)
+	assert.Contains(t, folders, "", "the top level")
+	assert.Equal(t, "f1", folders["f2"].FolderId)
+	assert.NotContains(t, folders, "p1")
+}
+
+func TestFolderPath(t *testing.T) {
+	d := &Manager{e: testCrypto(t, "secret")}
+	folders := folderMetas(testTree(t, d))
+
+	assert.Equal(t, "/", d.folderPath(folders, ""))
+	assert.Equal(t, "/Work", d.folderPath(folders, "f1"))
+	assert.Equal(t, "/Work/Mail", d.folderPath(folders, "f2"))
+	assert.Equal(t, "/", d.folderPath(folders, "gone"))
+
+	// the path of an inconsistent local copy is cut at the number of the folders
+	cycle := folders["f1"]
+	cycle.FolderId = "f2"
+	folders["f1"] = cycle
+	assert.Equal(t, "/Work/Mail/Work", d.folderPath(folders, "f1"))
+}
+
+func TestMetaLabel(t *testing.T) {
+	d := &Manager{e: testCrypto(t, "secret")}
+	items := testTree(t, d)
+
+	assert.Equal(t, "Work/", d.metaLabel(items[0]))
+	assert.Equal(t, storage.PasswordKind.Title+": yandex", d.metaLabel(items[3]))
+	assert.Equal(t, "unknown: x", d.metaLabel(storage.ItemMeta{Type: "unknown", Name: sealed(t, d.e, "x")}))
+}
+
+func TestFolderNavigation(t *testing.T) {
+	d := &Manager{e: testCrypto(t, "secret")}
+	items := testTree(t, d)
+	folders := folderMetas(items)
+
+	current, up := enterFolder(folders, "f2", "")
+	assert.Equal(t, []string{"f2", "f1"}, []string{current, up})
+
+	// the folder deleted on another device is left for its parent or for the top level
+	current, up = enterFolder(folders, "gone", "f1")
+	assert.Equal(t, []string{"f1", ""}, []string{current, up})
+
+	current, up = enterFolder(folders, "gone", "gone too")
+	assert.Equal(t, []string{"", ""}, []string{current, up})
+
+	assert.Equal(t, []string{"f1", "c1"}, ids(folderContent(items, "")))
+	assert.Equal(t, []string{"f2"}, ids(folderContent(items, "f1")))
+	assert.Equal(t, []string{"p1"}, ids(folderContent(items, "f2")))
+
+	assert.NotContains(t, folderActions(""), folderUp)
+	assert.NotContains(t, folderActions(""), folderDelete)
+	assert.Equal(t, []string{folderUp, folderAdd, folderMoveIn, folderRename, folderDelete, folderExit},
+		folderActions("f1"))
+
+	// a folder is not moved into itself, the content of the folder is already there
+	assert.Equal(t, []string{"c1", "p1"}, ids(otherItems(items, "f1")))
+	assert.Equal(t, []string{"f2", "p1"}, ids(otherItems(items, "")))
+}
+
+func TestMoveItem(t *testing.T) {
+	var moved []storage.Password
+	code := http.StatusOK
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/user/move", r.URL.Path)
+		assert.Equal(t, storage.PasswordKind.Name, r.Header.Get("Data-Type"))
+
+		var pass storage.Password
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&pass))
+		moved = append(moved, pass)
+
+		w.WriteHeader(code)
+	}))
+	defer server.Close()
+
+	d := &Manager{e: testCrypto(t, "secret"), c: client.NewClient(server.URL, "laptop")}
+
+	require.NoError(t, d.moveItem(storage.ItemMeta{Id: "p1", Type: storage.PasswordKind.Name}, "f1"))
+
+	code = http.StatusUnprocessableEntity
+	require.NoError(t, d.moveItem(storage.ItemMeta{Id: "p1", Type: storage.PasswordKind.Name}, ""))
+
+	assert.Equal(t, []storage.Password{{Id: "p1", FolderId: "f1"}, {Id: "p1"}}, moved)
+
+	assert.Error(t, d.moveItem(storage.ItemMeta{Id: "x1", Type: "unknown"}, ""))
+}
@@ -26,17 +26,21 @@ type Manager struct {
 	functions map[string]func(string) error
 	cookie    []*http.Cookie
 	user      *storage.User
+	secret    string
 
-	e *mycrypto.Crypto
-	c *client.Client
+	e      *mycrypto.Crypto
+	cc     *mycrypto.ContentCrypto
+	c      *client.Client
+	store  *client.Cache
+	syncer *client.Syncer
 }
 
 // NewManager is a constructor Manager
-func NewManager(c *client.Client, e *mycrypto.Crypto) *Manager {
+func NewManager(c *client.Client, secret string) *Manager {
 
 	var dial Manager
 
-	dial.e = e
+	dial.secret = secret
 	dial.c = c
 
 	function := make(map[string]func(string) error)
@@ -62,6 +66,11 @@ func (d *Manager) Run() error {
 		return err
 	}
 
+	err = d.unlock()
+	if err != nil {
+		return err
+	}
+
 	for {
 		err = d.SelectFunc()
 		if err != nil {
@@ -117,9 +126,12 @@ func (d *Manager) SelectAuth() error {
 // SelectFunc is a function for user can select one of function app
 func (d *Manager) SelectFunc() error {
 
+	d.reconnect()
+
 	prompt := promptui.Select{
-		Label: "Выберте функцию",
-		Items: []string{"Add", "Update", "Read", "Delete", "Delete an account", "Exit"},
+		Label: "Выберте функцию " + d.status(),
+		Items: []string{"Browse", "Folders", "Search", "Add", "Update", "Read", "Delete", "OTP code", "Sync", "Rejected changes", "Usage", "Rotate key",
+			"Logout", "Logout all devices", "Delete an account", "Exit"},
 	}
 
 	_, result, err := prompt.Run()
@@ -127,23 +139,81 @@ func (d *Manager) SelectFunc() error {
 		return err
 	}
 
-	if result == "Exit" {
+	switch result {
+	case "Exit":
 		os.Exit(0)
+	case "Browse":
+		return d.Browse()
+	case "Folders":
+		return d.Folders()
+	case "Search":
+		return d.Find()
+	case "OTP code":
+		return d.Code()
+	case "Sync":
+		return d.Sync()
+	case "Rejected changes":
+		return d.Rejected()
+	case "Usage":
+		return d.Usage()
+	case "Rotate key":
+		return d.RotateKey()
+	case "Logout":
+		return d.Logout("/user/logout")
+	case "Logout all devices":
+		return d.Logout("/user/logout/all")
+	case "Delete an account":
+		return d.deleteUser()
 	}
 
-	prompt.Label = "Выберите тип данных"
-	prompt.Items = []string{"password", "card", "binary data"}
-
-	_, dataType, _ := prompt.Run()
+	kind, err := d.chooseKind()
+	if err != nil {
+		return err
+	}
 
 	if v, ok := d.functions[result]; ok {
-		return v(dataType)
+		return v(kind.Name)
 	}
 
 	return errors.New("unknown function")
 
 }
 
+// Logout ends the session on the server and returns to authorization
+func (d *Manager) Logout(path string) (err error) {
+
+	var code int
+
+	code, _, d.cookie, err = d.c.Send(nil, "", d.cookie, path)
+	if code != 200 {
+		fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
+		return err
+	}
+
+	fmt.Println(myStyler("Вы вышли из аккаунта"))
+
+	return d.signOut()
+}
+
+// signOut forgets the session, the keys and the local copy of the vault and returns to authorization
+func (d *Manager) signOut() error {
+
+	d.cookie = nil
+	d.user = nil
+	d.e = nil
+	d.cc = nil
+	d.secret = ""
+	d.store = nil
+	d.syncer = nil
+
+	err := d.SelectAuth()
+	if err != nil {
+		return err
+	}
+
+	return d.unlock()
+}
+
 // myPrompt is a function for printing control
 func (d *Manager) myPrompt(label string) string {
 	prompt := promptui.Prompt{
@@ -154,424 +224,286 @@ func (d *Manager) myPrompt(label string) string {
 	return res
 }
 
-// Add is a facade for adding new data into server
-func (d *Manager) Add(dataType string) error {
-	switch dataType {
-	case "password":
-		return d.addPassword(d.user.Login)
-	case "card":
-		return d.addCard(d.user.Login)
-	case "binary data":
-		return d.addBinData(d.user.Login)
-	case "user":
-		return d.addUser()
-	default:
-		return errors.New("unknown type")
+// myPassword is a function for reading hidden input
+func (d *Manager) myPassword(label string) string {
+	prompt := promptui.Prompt{
+		Label: myStyler(myStyler(label)),
+		Mask:  '*',
 	}
+
+	res, _ := prompt.Run()
+	return res
 }
 
-func (d *Manager) addUser() (err error) {
+// maxUnlockAttempts is the number of the tries to enter the master password
+const maxUnlockAttempts = 3
 
-	var pass storage.User
+// unlock derives the vault key from the master password
+// and the key parameters stored on the server.
+// The vault with outdated parameters is offered to be rotated
+func (d *Manager) unlock() (err error) {
+
+	var meta storage.KeyMeta
 	var code int
+	var tmp any
 
-	pass.Login, err = d.e.Encrypt(d.myPrompt("Введите вашу почту"))
+	code, tmp, d.cookie, err = d.c.Send(&meta, "keymeta", d.cookie, "/user/read")
 	if err != nil {
-		if err != nil {
-			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
-			return
-		}
+		fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
+		return err
 	}
-	pass.Email, err = d.e.Encrypt(d.myPrompt("Введите ваш логин"))
-	if err != nil {
-		if err != nil {
-			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
-			return
-		}
+
+	switch code {
+	case 200:
+		meta = tmp.(storage.KeyMeta)
+
+		err = d.openVault(&meta)
+	case 404:
+		err = d.createKeyMeta(&meta)
+	default:
+		fmt.Println(myStyler(myStyler("Не удалось получить параметры ключа")))
+		return errors.New("can't read key metadata")
 	}
-	pass.Password, err = d.e.Encrypt(d.myPrompt("Введите ваш пароль"))
 	if err != nil {
-		if err != nil {
-			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
-			return
-		}
+		return err
 	}
 
-	d.user = &pass
+	d.store.SetKeyMeta(&meta)
 
-	code, _, d.cookie, err = d.c.Send(&pass, "user", d.cookie, "/user/register")
-	if code != 200 {
-		if err != nil {
-			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
-			return
-		}
-		if code == 400 {
-			fmt.Println(myStyler(myStyler("Неправильный формат данных")))
-			return d.addUser()
-		}
-		return
+	err = d.unlockCache()
+	if err != nil {
+		return err
+	}
+
+	if keyParams(&meta).Outdated() &&
+		d.myPrompt("Параметры ключа устарели. Обновить их сейчас? Мастер-пароль можно оставить прежним (y/n)") == "y" {
+		return d.RotateKey()
 	}
 
-	fmt.Println(myStyler("Готово"))
 	return nil
 }
 
-func (d *Manager) addPassword(login string) (err error) {
+// openVault derives the vault key from the master password and checks it with the stored verifier,
+// a wrong password is asked again up to maxUnlockAttempts times
+func (d *Manager) openVault(meta *storage.KeyMeta) (err error) {
 
-	var pass storage.Password
-	var code int
+	params := keyParams(meta)
 
-	pass.LoginOwner = login
+	for attempt := 1; ; attempt++ {
+		if d.secret == "" {
+			d.secret = d.myPassword("Введите мастер-пароль")
+		}
 
-	pass.Service, err = d.e.Encrypt(d.myPrompt("Введите название сервиса"))
-	if err != nil {
+		d.e, err = mycrypto.NewCrypto(d.secret, params)
 		if err != nil {
 			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
-			return
+			return err
 		}
-	}
-	pass.Login, err = d.e.Encrypt(d.myPrompt("Введите ваш логин в сервису"))
-	if err != nil {
-		if err != nil {
-			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
-			return
+
+		err = d.e.Verify(meta.Check)
+		if err == nil {
+			return nil
 		}
-	}
-	pass.Password, err = d.e.Encrypt(d.myPrompt("Введите ваш пароль в сервису"))
-	if err != nil {
-		if err != nil {
-			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
-			return
+
+		d.e = nil
+		d.secret = ""
+
+		if attempt == maxUnlockAttempts {
+			fmt.Println(myStyler(myStyler("Неверный мастер-пароль, попытки исчерпаны")))
+			return err
 		}
-	}
 
-	code, _, d.cookie, err = d.c.Send(&pass, "password", d.cookie, "/user/add")
-	if code != 200 {
-		fmt.Println(myStyler("Что-то пошло не так"))
-		return err
+		fmt.Println(myStyler(myStyler("Неверный мастер-пароль")))
 	}
-
-	fmt.Println(myStyler("Готово"))
-	return nil
 }
 
-func (d *Manager) addCard(login string) (err error) {
+// createKeyMeta derives the key of a new vault with fresh parameters and stores them on the server.
+// The key is not used until the parameters are stored, otherwise the next unlock derives another key
+func (d *Manager) createKeyMeta(meta *storage.KeyMeta) (err error) {
 
-	var pass storage.Card
 	var code int
 
-	pass.LoginOwner = login
-
-	pass.Bank, err = d.e.Encrypt(d.myPrompt("Введите название банка"))
-	if err != nil {
-		if err != nil {
-			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
-			return
-		}
-	}
-	pass.Number, err = d.e.Encrypt(d.myPrompt("Введите ваш номер карты"))
-	if err != nil {
-		if err != nil {
-			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
-			return
-		}
+	if d.secret == "" {
+		d.secret = d.myPassword("Введите мастер-пароль")
 	}
-	pass.DataEnd, err = d.e.Encrypt(d.myPrompt("Введите ваш дату окончания карты"))
-	if err != nil {
-		if err != nil {
-			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
-			return
-		}
-	}
-	pass.SecretCode, err = d.e.Encrypt(d.myPrompt("Введите ваш секретный код"))
-	if err != nil {
-		if err != nil {
-			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
-			return
-		}
-	}
-	pass.Owner, err = d.e.Encrypt(d.myPrompt("Введите владельца карты"))
+
+	params, err := mycrypto.NewKeyParams()
 	if err != nil {
-		if err != nil {
-			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
-			return
-		}
+		return err
 	}
 
-	code, _, d.cookie, err = d.c.Send(&pass, "card", d.cookie, "/user/add")
-	if code != 200 {
-		fmt.Println(myStyler("Что-то пошло не так: "), err)
+	e, err := mycrypto.NewCrypto(d.secret, params)
+	if err != nil {
 		return err
 	}
 
-	fmt.Println(myStyler("Готово"))
-	return nil
-}
-
-func (d *Manager) addBinData(login string) (err error) {
-
-	var pass storage.BinaryData
-	var code int
-
-	pass.LoginOwner = login
-
-	pass.Title, _ = d.e.Encrypt(d.myPrompt("Введите название файла"))
-	path := d.myPrompt("Введите путь к файлу")
+	*meta = storage.KeyMeta{
+		Salt:    params.Salt,
+		Time:    params.Time,
+		Memory:  params.Memory,
+		Threads: params.Threads,
+	}
 
-	pass.Data, err = os.ReadFile(path)
+	meta.Check, err = e.Verifier()
 	if err != nil {
-		fmt.Println(myStyler("Что-то пошло не так"))
 		return err
 	}
 
-	data, err := d.e.Encrypt(string(pass.Data))
+	code, _, d.cookie, err = d.c.Send(meta, "keymeta", d.cookie, "/user/add")
 	if err != nil {
-		fmt.Println(myStyler("Что-то пошло не так"))
+		fmt.Println(myStyler(myStyler("Не удалось сохранить параметры ключа: ")), err)
 		return err
 	}
-
-	pass.Data = []byte(data)
-
-	code, _, d.cookie, err = d.c.Send(&pass, "bin", d.cookie, "/user/add")
 	if code != 200 {
-		fmt.Println(myStyler("Что-то пошло не так: "))
-		return err
+		fmt.Println(myStyler(myStyler("Не удалось сохранить параметры ключа")))
+		return fmt.Errorf("can't save key metadata: status %d", code)
 	}
 
-	fmt.Println(myStyler("Готово"))
+	d.e = e
+
 	return nil
 }
 
-// Read is a facade for reading data from server
-func (d *Manager) Read(dataType string) error {
-	switch dataType {
-	case "password":
-		return d.readPassword()
-	case "card":
-		return d.readCard()
-	case "binary data":
-		return d.readBinData()
-	case "user":
-		return d.readUser()
-	default:
-		return errors.New("unknown type")
-
+// keyParams converts stored key metadata into key derivation parameters
+func keyParams(meta *storage.KeyMeta) *mycrypto.KeyParams {
+	return &mycrypto.KeyParams{
+		Salt:    meta.Salt,
+		Time:    meta.Time,
+		Memory:  meta.Memory,
+		Threads: meta.Threads,
 	}
 }
 
-func (d *Manager) readUser() (err error) {
-
-	var pass storage.User
-	var code int
-
-	pass.Login, err = d.e.Encrypt(d.myPrompt("Введите ваш логин"))
-	if err != nil {
-		if err != nil {
-			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
-			return
-		}
-	}
-	pass.Password, err = d.e.Encrypt(d.myPrompt("Введите ваш пароль"))
-	if err != nil {
-		if err != nil {
-			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
-			return
-		}
+// Add is a facade for adding new data into server, the data type is "user" or the name of an item kind
+func (d *Manager) Add(dataType string) error {
+	if dataType == "user" {
+		return d.addUser()
 	}
 
-	d.user = &pass
-
-	code, _, d.cookie, err = d.c.Send(&pass, "user", d.cookie, "/user/login")
-	if code != 200 {
-		if err != nil {
-			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
-			return
-		}
-		if code == 403 {
-			fmt.Println(myStyler(myStyler("Нет такого пользователя")))
-			return d.SelectAuth()
-		}
-		return
+	kind, ok := storage.KindOf(dataType)
+	if !ok {
+		return errors.New("unknown type")
 	}
 
-	fmt.Println(myStyler("Готово"))
-	return nil
+	return d.addItem(kind)
 }
 
-func (d *Manager) readPassword() (err error) {
+func (d *Manager) addUser() (err error) {
 
+	var pass storage.User
 	var code int
-	var pass storage.Password
-	var tmp any
 
-	pass.LoginOwner = d.user.Login
+	pass.Login = d.myPrompt("Введите ваш логин")
+	pass.Email = d.myPrompt("Введите вашу почту")
+	pass.Password = d.myPassword("Введите ваш пароль")
+
+	d.user = &pass
 
-	pass.Service, err = d.e.Encrypt(d.myPrompt("Введите название сервиса"))
+	err = d.openCache(pass.Login)
 	if err != nil {
-		if err != nil {
-			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
-			return
-		}
+		fmt.Println(myStyler(myStyler("Не удалось открыть локальную копию: ")), err)
+		return
 	}
 
-	code, tmp, d.cookie, err = d.c.Send(&pass, "password", d.cookie, "/user/read")
+	code, _, d.cookie, err = d.c.Send(&pass, "user", d.cookie, "/user/register")
 	if code != 200 {
 		if err != nil {
 			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
 			return
 		}
-		if code == 403 {
-			fmt.Println(myStyler(myStyler("Нет такого пользователя")))
-			return d.SelectAuth()
+		if code == 400 {
+			fmt.Println(myStyler(myStyler("Неправильный формат данных")))
+			return d.addUser()
+		}
+		if code == 409 {
+			fmt.Println(myStyler(myStyler("Логин или почта уже заняты")))
+			return d.addUser()
 		}
-
-		fmt.Println(myStyler("Нет такого сервиса"))
 		return
 	}
 
-	pass.Service, _ = d.e.Decrypt(tmp.(storage.Password).Service)
-	pass.Login, _ = d.e.Decrypt(tmp.(storage.Password).Login)
-	pass.Password, _ = d.e.Decrypt(tmp.(storage.Password).Password)
-
-	fmt.Printf("Название сервиса: %s\nЛогин: %s\nПароль: %s\n", pass.Service, pass.Login, pass.Password)
-
 	fmt.Println(myStyler("Готово"))
 	return nil
 }
 
-func (d *Manager) readCard() (err error) {
+// addBinData uploads the file in chunks, so it is never read into memory whole.
+// The tags and the custom fields are added to the uploaded file
+func (d *Manager) addBinData() (err error) {
 
 	var code int
-	var pass storage.Card
+	var id string
 	var tmp any
 
-	pass.LoginOwner = d.user.Login
+	title, _ := d.e.Encrypt(d.myPrompt("Введите название файла"))
+	path := d.myPrompt("Введите путь к файлу")
 
-	pass.Bank, err = d.e.Encrypt(d.myPrompt("Введите название банка"))
-	if err != nil {
-		if err != nil {
-			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
-			return
-		}
+	id, code, err = d.upload(path, title, "")
+	if code != 200 {
+		return d.transferFailed(code, err)
 	}
 
-	code, tmp, d.cookie, err = d.c.Send(&pass, "card", d.cookie, "/user/read")
+	code, tmp, err = d.complete(path, id, 0)
 	if code != 200 {
-		if err != nil {
-			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
-			return
-		}
-		if code == 403 {
-			fmt.Println(myStyler(myStyler("Нет такого пользователя")))
-			return d.SelectAuth()
-		}
-
-		fmt.Println(myStyler("Нет такой карты"))
-		return
+		return d.transferFailed(code, err)
 	}
 
-	pass.Bank, _ = d.e.Decrypt(tmp.(storage.Card).Bank)
-	pass.Number, _ = d.e.Decrypt(tmp.(storage.Card).Number)
-	pass.DataEnd, _ = d.e.Decrypt(tmp.(storage.Card).DataEnd)
-	pass.SecretCode, _ = d.e.Decrypt(tmp.(storage.Card).SecretCode)
-
-	fmt.Printf("Название банка: %s\nНомер карты: %s\nДата окончания: %s\nСекретный код: %s\n",
-		pass.Bank, pass.Number, pass.DataEnd, pass.SecretCode)
-
-	fmt.Println(myStyler("Готово"))
-	return nil
-}
-
-func (d *Manager) readBinData() (err error) {
-
-	var code int
-	var pass storage.BinaryData
-	var tmp any
-
-	pass.LoginOwner = d.user.Login
-
-	pass.Title, err = d.e.Encrypt(d.myPrompt("Введите название файла"))
-	if err != nil {
-		if err != nil {
-			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
-			return
-		}
+	bin, ok := tmp.(storage.Item)
+	if !ok {
+		fmt.Println(myStyler("Готово"))
+		return nil
 	}
 
-	code, tmp, d.cookie, err = d.c.Send(&pass, "bin", d.cookie, "/user/read")
-	if code != 200 {
+	if d.myPrompt("Добавить теги и дополнительные поля? (y/n)") == "y" {
+		err = d.editExtras(bin)
 		if err != nil {
 			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
-			return
-		}
-		if code == 403 {
-			fmt.Println(myStyler(myStyler("Нет такого пользователя")))
-			return d.SelectAuth()
+			return err
 		}
-
-		fmt.Println(myStyler("Нет такого файла"))
-		return
 	}
 
-	pass.Title, _ = d.e.Decrypt(tmp.(storage.BinaryData).Title)
-	data, _ := d.e.Decrypt(string(tmp.(storage.BinaryData).Data))
-
-	pass.Data = []byte(data)
-
-	fmt.Printf("Название название файла: %s\nСодержимое: %s\n",
-		pass.Title, pass.Data)
-
-	fmt.Println(myStyler("Готово"))
-	return nil
+	// the file is created by the upload without the search index
+	return d.saveItem(bin)
 }
 
-// Update is a facade for updating data from server
-func (d *Manager) Update(dataType string) error {
-	switch dataType {
-	case "password":
-		return d.updatePassword()
-	case "card":
-		return d.updateCard()
-	case "binary data":
-		return d.updateBinData()
-	default:
-		return errors.New("unknown type")
+// Read is a facade for reading data from server, the data type is "user" or the name of an item kind
+func (d *Manager) Read(dataType string) error {
+	if dataType == "user" {
+		return d.readUser()
+	}
 
+	kind, ok := storage.KindOf(dataType)
+	if !ok {
+		return errors.New("unknown type")
 	}
+
+	return d.readItem(kind)
 }
 
-func (d *Manager) updatePassword() (err error) {
+func (d *Manager) readUser() (err error) {
 
+	var pass storage.User
 	var code int
-	var pass storage.Password
-	var tmp any
 
-	pass.LoginOwner = d.user.Login
+	pass.Login = d.myPrompt("Введите ваш логин")
+	pass.Password = d.myPassword("Введите ваш пароль")
 
-	pass.Service, err = d.e.Encrypt(d.myPrompt("Введите название сервиса"))
-	if err != nil {
-		if err != nil {
-			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
-			return
-		}
-	}
-	pass.Login, err = d.e.Encrypt(d.myPrompt("Введите новый логин (если он не изменилося введите старый)"))
-	if err != nil {
-		if err != nil {
-			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
-			return
-		}
-	}
-	pass.Password, err = d.e.Encrypt(d.myPrompt("Введите новый пароль (если он не изменилося введите старый)"))
+	d.user = &pass
+
+	err = d.openCache(pass.Login)
 	if err != nil {
-		if err != nil {
-			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
-			return
-		}
+		fmt.Println(myStyler(myStyler("Не удалось открыть локальную копию: ")), err)
+		return
 	}
 
-	code, tmp, d.cookie, err = d.c.Send(&pass, "password", d.cookie, "/user/update")
+	code, _, d.cookie, err = d.c.Send(&pass, "user", d.cookie, "/user/login")
+	if code == 403 && d.legacyCredentials(&pass) {
+		code, _, d.cookie, err = d.c.Send(&pass, "user", d.cookie, "/user/login")
+		pass.LegacyLogin, pass.LegacyPassword = "", ""
+	}
 	if code != 200 {
+		if errors.Is(err, client.ErrOffline) {
+			return d.openOffline()
+		}
 		if err != nil {
 			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
 			return
@@ -580,276 +512,165 @@ func (d *Manager) updatePassword() (err error) {
 			fmt.Println(myStyler(myStyler("Нет такого пользователя")))
 			return d.SelectAuth()
 		}
-
-		fmt.Println(myStyler("Нет такого файла"))
+		if code == 409 {
+			fmt.Println(myStyler(myStyler("Логин занят другим аккаунтом, войдите с логином, под которым регистрировались")))
+			return d.SelectAuth()
+		}
 		return
 	}
 
-	pass.Service, _ = d.e.Decrypt(tmp.(storage.Password).Service)
-	pass.Login, _ = d.e.Decrypt(tmp.(storage.Password).Login)
-	pass.Password, _ = d.e.Decrypt(tmp.(storage.Password).Password)
-
-	fmt.Printf("Название сервиса: %s\nЛогин: %s\nПароль: %s\n", pass.Service, pass.Login, pass.Password)
-
 	fmt.Println(myStyler("Готово"))
 	return nil
 }
 
-func (d *Manager) updateCard() (err error) {
-
-	var code int
-	var pass storage.Card
-	var tmp any
+// legacyCredentials adds the login and the password encrypted like the old DES clients sent them,
+// so the server finds the account they registered. It is false when the secret is not a DES key,
+// such an account can't exist then
+func (d *Manager) legacyCredentials(user *storage.User) bool {
 
-	pass.LoginOwner = d.user.Login
-
-	pass.Bank, err = d.e.Encrypt(d.myPrompt("Введите название банка"))
-	if err != nil {
-		if err != nil {
-			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
-			return
-		}
-	}
-	pass.Number, err = d.e.Encrypt(d.myPrompt("Введите новый номер карты (если он не изменилося введите старый)"))
-	if err != nil {
-		if err != nil {
-			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
-			return
-		}
-	}
-	pass.DataEnd, err = d.e.Encrypt(d.myPrompt("Введите новую дату окончания (если она не изменилося введите старый)"))
-	if err != nil {
-		if err != nil {
-			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
-			return
-		}
-	}
-	pass.SecretCode, err = d.e.Encrypt(d.myPrompt("Введите новый секретный код (если он не изменилося введите старый)"))
-	if err != nil {
-		if err != nil {
-			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
-			return
-		}
-	}
-	pass.LoginOwner, err = d.e.Encrypt(d.myPrompt("Введите новое ФИО владельца (если оно не изменилося введите старый)"))
+	login, err := mycrypto.LegacyEncrypt(d.secret, user.Login)
 	if err != nil {
-		if err != nil {
-			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
-			return
-		}
+		return false
 	}
 
-	code, tmp, d.cookie, err = d.c.Send(&pass, "card", d.cookie, "/user/update")
-	if code != 200 {
-		if err != nil {
-			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
-			return
-		}
-		if code == 403 {
-			return d.SelectAuth()
-		}
-
-		fmt.Println(myStyler("Нет такогой карты"))
-		return
+	password, err := mycrypto.LegacyEncrypt(d.secret, user.Password)
+	if err != nil {
+		return false
 	}
 
-	fmt.Println(myStyler("Изения внесены!"))
+	user.LegacyLogin, user.LegacyPassword = login, password
 
-	pass.Bank, _ = d.e.Decrypt(tmp.(storage.Card).Bank)
-	pass.Number, _ = d.e.Decrypt(tmp.(storage.Card).Number)
-	pass.DataEnd, _ = d.e.Decrypt(tmp.(storage.Card).DataEnd)
-	pass.SecretCode, _ = d.e.Decrypt(tmp.(storage.Card).SecretCode)
-
-	fmt.Printf("Название банка: %s\nНомер карты: %s\nДата окончания: %s\nСекретный код: %s\n",
-		pass.Bank, pass.Number, pass.DataEnd, pass.SecretCode)
-
-	fmt.Println(myStyler("Готово"))
-	return nil
+	return true
 }
 
-func (d *Manager) updateBinData() (err error) {
+// readBinData finds the file, shows it and downloads the content stored in chunks
+func (d *Manager) readBinData() (err error) {
 
 	var code int
-	var pass storage.BinaryData
-	var tmp any
-
-	pass.LoginOwner = d.user.Login
-
-	pass.Title, err = d.e.Encrypt(d.myPrompt("Введите название файла"))
-	if err != nil {
-		if err != nil {
-			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
-			return
-		}
-	}
-
-	path := d.myPrompt("Введите путь к новому файлу")
-
-	pass.Data, err = os.ReadFile(path)
-	if err != nil {
-		fmt.Println(myStyler("Что-то пошло не так"))
-		return err
+	var item storage.Item
 
+	item, code, err = d.findItem(storage.FileKind)
+	if code != 200 || item == nil {
+		return d.itemFailed(code, err)
 	}
 
-	data, err := d.e.Encrypt(string(pass.Data))
-	if err != nil {
-		fmt.Println(myStyler("Что-то пошло не так"))
-		return err
-	}
+	pass := item.(*storage.BinaryData)
 
-	pass.Data = []byte(data)
+	d.showBinData(pass)
 
-	code, tmp, d.cookie, err = d.c.Send(&pass, "bin", d.cookie, "/user/update")
-	if code != 200 {
-		if err != nil {
-			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
-			return
+	if pass.Chunks > 0 {
+		path := d.myPrompt("Введите путь для сохранения файла (пусто — не сохранять)")
+		if path != "" {
+			code, err = d.download(pass, path)
+			if code != 200 {
+				return d.transferFailed(code, err)
+			}
 		}
-		if code == 403 {
-			fmt.Println(myStyler(myStyler("Нет такого пользователя")))
-			return d.SelectAuth()
-		}
-
-		fmt.Println(myStyler("Нет такого файла"))
-		return
 	}
 
-	fmt.Println(myStyler("Данные обновлены"))
-
-	pass.Title, _ = d.e.Decrypt(tmp.(storage.BinaryData).Title)
-	data, _ = d.e.Decrypt(string(tmp.(storage.BinaryData).Data))
+	fmt.Println(myStyler("Готово"))
+	return nil
+}
 
-	pass.Data = []byte(data)
+// showBinData decrypts and prints the name and the size of the file
+func (d *Manager) showBinData(bin *storage.BinaryData) {
 
-	fmt.Printf("Название название файла: %s\nСодержимое: %s\n",
-		pass.Title, pass.Data)
+	title, _ := d.e.Decrypt(bin.Title)
 
-	fmt.Println(myStyler("Готово"))
-	return nil
+	fmt.Printf("Название название файла: %s\nРазмер: %d байт\n", title, plainSize(bin))
 }
 
-// Delete is a facade for deleting data from server
-func (d *Manager) Delete(dataType string) error {
-	switch dataType {
-	case "password":
-		return d.deletePassword()
-	case "card":
-		return d.deleteCard()
-	case "binary data":
-		return d.deleteBinData()
-	case "delete an account":
-		return d.deleteUser()
-	default:
-		return errors.New("unknown type")
+// Update is a facade for updating data from server, the data type is the name of an item kind
+func (d *Manager) Update(dataType string) error {
 
+	kind, ok := storage.KindOf(dataType)
+	if !ok {
+		return errors.New("unknown type")
 	}
+
+	return d.updateItem(kind)
 }
 
-func (d *Manager) deletePassword() (err error) {
+// updateBinData finds the file and uploads its new content or changes its tags and custom fields
+func (d *Manager) updateBinData() (err error) {
 
-	var pass storage.Password
 	var code int
+	var item storage.Item
+	var tmp any
+
+	item, code, err = d.findItem(storage.FileKind)
+	if code != 200 || item == nil {
+		return d.itemFailed(code, err)
+	}
 
-	pass.LoginOwner = d.user.Login
+	pass := item.(*storage.BinaryData)
+
+	prompt := promptui.Select{
+		Label: "Что изменить?",
+		Items: []string{"Содержимое файла", "Теги и дополнительные поля"},
+	}
 
-	pass.Service, err = d.e.Encrypt(d.myPrompt("Введите название сервиса"))
+	i, _, err := prompt.Run()
 	if err != nil {
-		if err != nil {
-			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
-			return
-		}
+		return err
 	}
 
-	code, _, d.cookie, err = d.c.Send(&pass, "password", d.cookie, "/user/delete")
-	if code != 200 {
+	if i == 1 {
+		err = d.editExtras(pass)
 		if err != nil {
 			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
-			return d.SelectFunc()
-		}
-		if code == 403 {
-			fmt.Println(myStyler(myStyler("Нет такого пользователя")))
-			return d.SelectAuth()
+			return err
 		}
 
-		fmt.Println(myStyler("Нет такого файла"), err)
-		return d.SelectFunc()
+		return d.saveItem(pass)
 	}
 
-	fmt.Println(myStyler("Данные удалены"))
-
-	return nil
-}
+	path := d.myPrompt("Введите путь к новому файлу")
 
-func (d *Manager) deleteCard() (err error) {
+	var id string
 
-	var pass storage.Card
-	var code int
+	id, code, err = d.upload(path, pass.Title, pass.Id)
+	if code != 200 {
+		return d.transferFailed(code, err)
+	}
 
-	pass.LoginOwner = d.user.Login
+	code, tmp, err = d.complete(path, id, pass.Version)
+	for code == 409 {
+		var retry bool
 
-	pass.Bank, err = d.e.Encrypt(d.myPrompt("Введите название сервиса"))
-	if err != nil {
-		if err != nil {
-			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
-			return
+		retry, err = d.confirmConflict(tmp, &pass.Version, "Всё равно заменить? (y/n)")
+		if err != nil || !retry {
+			fmt.Println(myStyler("Изменения не внесены"))
+			return err
 		}
-	}
 
-	code, _, d.cookie, err = d.c.Send(&pass, "card", d.cookie, "/user/delete")
+		code, tmp, err = d.complete(path, id, pass.Version)
+	}
 	if code != 200 {
-		if err != nil {
-			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")))
-			return d.SelectFunc()
-		}
-		if code == 403 {
-			fmt.Println(myStyler(myStyler("Нет такого пользователя")))
-			return d.SelectAuth()
-		}
-
-		fmt.Println(myStyler("Нет такого файла"), err)
-		return d.SelectFunc()
+		return d.transferFailed(code, err)
 	}
 
-	fmt.Println(myStyler("Данные удалены"))
+	fmt.Println(myStyler("Данные обновлены"))
+
+	d.showItem(tmp.(storage.Item))
 
+	fmt.Println(myStyler("Готово"))
 	return nil
 }
 
-func (d *Manager) deleteBinData() (err error) {
-
-	var pass storage.BinaryData
-	var code int
-
-	pass.LoginOwner = d.user.Login
-
-	pass.Title, err = d.e.Encrypt(d.myPrompt("Введите название файла"))
-	if err != nil {
-		if err != nil {
-			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
-			return
-		}
-	}
-
-	code, _, d.cookie, err = d.c.Send(&pass, "bin", d.cookie, "/user/delete")
-	if code != 200 {
-		if err != nil {
-			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")))
-			return d.SelectFunc()
-		}
-		if code == 403 {
-			fmt.Println(myStyler(myStyler("Нет такого пользователя")))
-			return d.SelectAuth()
-		}
+// Delete is a facade for deleting data from server, the data type is the name of an item kind
+func (d *Manager) Delete(dataType string) error {
 
-		fmt.Println(myStyler("Нет такого файла"), err)
-		return d.SelectFunc()
+	kind, ok := storage.KindOf(dataType)
+	if !ok {
+		return errors.New("unknown type")
 	}
-	fmt.Println(myStyler("Данные удалены"))
 
-	return nil
+	return d.deleteItem(kind)
 }
 
+// deleteUser deletes the account confirmed with its password,
+// the local copy of the vault is removed and the user returns to authorization
 func (d *Manager) deleteUser() (err error) {
 
 	var pass storage.User
@@ -860,23 +681,33 @@ func (d *Manager) deleteUser() (err error) {
 	}
 
 	pass.Login = d.user.Login
+	pass.Password = d.myPassword("Введите пароль от аккаунта")
 
 	code, _, d.cookie, err = d.c.Send(&pass, "user", d.cookie, "/user/delete")
 	if code != 200 {
 		if err != nil {
-			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")))
+			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
 			return d.SelectFunc()
 		}
-		if code == 403 {
-			fmt.Println(myStyler(myStyler("Нет такого пользователя")))
+		if code == 401 {
+			fmt.Println(myStyler(myStyler("Сессия истекла, войдите снова")))
 			return d.SelectAuth()
 		}
+		if code == 403 {
+			fmt.Println(myStyler(myStyler("Неверный пароль, аккаунт не удалён")))
+			return d.SelectFunc()
+		}
 
-		fmt.Println(myStyler("Нет такого файла"), err)
+		fmt.Println(myStyler(myStyler("Не удалось удалить аккаунт")))
 		return d.SelectFunc()
 	}
 
-	fmt.Println(myStyler("Данные удалены"))
+	err = d.store.Remove()
+	if err != nil {
+		fmt.Println(myStyler(myStyler("Не удалось удалить локальную копию: ")), err)
+	}
 
-	return nil
+	fmt.Println(myStyler("Аккаунт и данные удалены"))
+
+	return d.signOut()
 }
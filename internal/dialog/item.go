@@ -0,0 +1,476 @@
+package dialog
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/EgorKo25/GophKeeper/internal/client"
+	"github.com/EgorKo25/GophKeeper/internal/storage"
+	"github.com/EgorKo25/GophKeeper/pkg/blindindex"
+
+	"github.com/manifoldco/promptui"
+)
+
+// chooseKind lets the user choose the kind of the items
+func (d *Manager) chooseKind() (*storage.Kind, error) {
+
+	kinds := storage.Kinds()
+
+	titles := make([]string, 0, len(kinds))
+	for _, kind := range kinds {
+		titles = append(titles, kind.Title)
+	}
+
+	prompt := promptui.Select{
+		Label: "Выберите тип данных",
+		Items: titles,
+	}
+
+	i, _, err := prompt.Run()
+	if err != nil {
+		return nil, err
+	}
+
+	return kinds[i], nil
+}
+
+// setValues encrypts the plain values of the fields by their names and sets them to the item,
+// an empty value of an optional field is kept empty
+func (d *Manager) setValues(item storage.Item, values map[string]string) error {
+
+	for _, f := range item.Kind().Fields {
+		value, ok := values[f.Name]
+		if !ok {
+			continue
+		}
+
+		if value != "" || !f.Optional {
+			var err error
+
+			value, err = d.e.Encrypt(value)
+			if err != nil {
+				return err
+			}
+		}
+
+		f.SetValue(item, value)
+	}
+
+	return nil
+}
+
+// input asks the plain value of the field, current is the value to edit.
+// A multiline field is edited in the editor
+func (d *Manager) input(f storage.Field, current string) (string, error) {
+	if f.Multiline {
+		return d.editText(f.Label, current)
+	}
+
+	if current == "" {
+		return d.myPrompt(f.Label), nil
+	}
+
+	return d.myEdit(f.Label, current), nil
+}
+
+// editable returns the fields of the kind the user changes after the item is created
+func editable(kind *storage.Kind) []storage.Field {
+
+	var fields []storage.Field
+	for _, f := range kind.Fields {
+		if !f.Search && !f.Optional {
+			fields = append(fields, f)
+		}
+	}
+
+	return fields
+}
+
+// itemFailed reports the failed request for the item
+func (d *Manager) itemFailed(code int, err error) error {
+	switch {
+	case errors.Is(err, client.ErrOffline):
+		fmt.Println(myStyler("Нет связи с сервером, используется локальная копия"))
+		return nil
+	case err != nil:
+		fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
+		return err
+	case code == 401:
+		fmt.Println(myStyler(myStyler("Сессия истекла, войдите снова")))
+		return d.SelectAuth()
+	case code == 404 || code == 200:
+		fmt.Println(myStyler("Запись не найдена"))
+		return nil
+	}
+
+	fmt.Println(myStyler("Что-то пошло не так"))
+	return nil
+}
+
+// addItem asks the fields of a new item and adds it
+func (d *Manager) addItem(kind *storage.Kind) (err error) {
+
+	switch kind {
+	case storage.FileKind:
+		return d.addBinData()
+	case storage.OTPKind:
+		return d.addOTP()
+	case storage.SSHKeyKind:
+		return d.addSSHKey()
+	}
+
+	item := kind.New()
+
+	for _, f := range kind.Fields {
+		if f.Optional {
+			continue
+		}
+
+		var value string
+
+		value, err = d.input(f, "")
+		if err == nil {
+			value, err = d.e.Encrypt(value)
+		}
+		if err != nil {
+			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
+			return
+		}
+
+		f.SetValue(item, value)
+	}
+
+	return d.sendItem(item)
+}
+
+// sendItem offers to add the tags and the custom fields and adds the item with the encrypted fields and its search index
+func (d *Manager) sendItem(item storage.Item) (err error) {
+
+	var code int
+
+	err = d.askExtras(item)
+	if err != nil {
+		fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
+		return err
+	}
+
+	d.indexItem(item)
+
+	code, _, d.cookie, err = d.c.Send(item, item.Kind().Name, d.cookie, "/user/add")
+	if code == 202 {
+		fmt.Println(myStyler(msgQueued))
+		return nil
+	}
+	if code != 200 {
+		fmt.Println(myStyler("Что-то пошло не так: "), err)
+		return err
+	}
+
+	fmt.Println(myStyler("Готово"))
+	return nil
+}
+
+// findItem finds the items of the kind by the words of the search field and lets the user choose one of them,
+// an empty answer lists all items of the kind. The item is nil when nothing is found
+func (d *Manager) findItem(kind *storage.Kind) (item storage.Item, code int, err error) {
+
+	var found []storage.Item
+
+	tokens := blindindex.Query(d.myPrompt(kind.Search().Label + " (пусто — все записи)"))
+	if len(tokens) == 0 {
+		found, code, err = d.kindItems(kind)
+	} else {
+		found, code, err = d.findKind(kind, tokens)
+	}
+	if code != 200 {
+		return nil, code, err
+	}
+
+	labels := make([]string, 0, len(found))
+	for i, item := range found {
+		labels = append(labels, d.itemLabel(item, i))
+	}
+
+	i, err := d.choose("Выберите запись", labels)
+	if i < 0 {
+		return nil, code, err
+	}
+
+	return found[i], code, nil
+}
+
+// kindItems reads all items of the kind
+func (d *Manager) kindItems(kind *storage.Kind) (_ []storage.Item, code int, err error) {
+
+	var tmp any
+
+	code, tmp, d.cookie, err = d.c.Send(kind.New(), kind.Name, d.cookie, "/user/search")
+	if code != 200 {
+		return nil, code, err
+	}
+
+	found, _ := tmp.([]storage.Item)
+
+	return found, code, nil
+}
+
+// findKind finds the items of the kind by the blinded tokens of the query like Find does and reads them,
+// the best matches first. An item deleted meanwhile is skipped
+func (d *Manager) findKind(kind *storage.Kind, tokens []string) (_ []storage.Item, code int, err error) {
+
+	var tmp any
+
+	d.buildIndex()
+
+	code, tmp, d.cookie, err = d.c.Get(d.cookie, d.findPath(tokens))
+	if code != 200 {
+		return nil, code, err
+	}
+
+	var found []storage.Item
+	for _, meta := range tmp.(storage.ItemList).Items {
+		if meta.Type != kind.Name {
+			continue
+		}
+
+		src := kind.New()
+		*src.Header().Id = meta.Id
+
+		code, tmp, d.cookie, err = d.c.Send(src, kind.Name, d.cookie, "/user/read")
+		if code == 404 {
+			continue
+		}
+		if code != 200 {
+			return nil, code, err
+		}
+
+		if item, ok := tmp.(storage.Item); ok {
+			found = append(found, item)
+		}
+	}
+
+	return found, 200, nil
+}
+
+// itemLabel names the found item by its first one-line field the user fills in or by its tags,
+// a secret field shows only its last characters
+func (d *Manager) itemLabel(item storage.Item, i int) string {
+
+	for _, f := range editable(item.Kind()) {
+		if f.Multiline {
+			continue
+		}
+
+		value, _ := d.e.Decrypt(f.Value(item))
+		if value == "" {
+			break
+		}
+		if f.Secret && len(value) > 4 {
+			value = "**** " + value[len(value)-4:]
+		}
+
+		return value
+	}
+
+	if tags := d.itemTags(item); len(tags) > 0 {
+		return strings.Join(tags, ", ")
+	}
+
+	return fmt.Sprintf("%s %d", item.Kind().Title, i+1)
+}
+
+// readItem finds the item and shows it
+func (d *Manager) readItem(kind *storage.Kind) (err error) {
+
+	var code int
+	var item storage.Item
+
+	if kind == storage.FileKind {
+		return d.readBinData()
+	}
+
+	item, code, err = d.findItem(kind)
+	if code != 200 || item == nil {
+		return d.itemFailed(code, err)
+	}
+
+	d.showItem(item)
+	d.revealHidden(item)
+
+	fmt.Println(myStyler("Готово"))
+	return nil
+}
+
+// showItem decrypts and prints the item
+func (d *Manager) showItem(item storage.Item) {
+
+	defer d.showExtras(item)
+
+	switch item := item.(type) {
+	case *storage.BinaryData:
+		d.showBinData(item)
+		return
+	case *storage.OTP:
+		d.showOTP(item)
+		return
+	case *storage.SSHKey:
+		d.showSSHKey(item)
+		return
+	}
+
+	var b strings.Builder
+	for _, f := range item.Kind().Fields {
+		if f.Optional {
+			continue
+		}
+
+		value, _ := d.e.Decrypt(f.Value(item))
+		if f.Multiline {
+			fmt.Fprintf(&b, "%s:\n%s\n", f.Label, value)
+			continue
+		}
+
+		fmt.Fprintf(&b, "%s: %s\n", f.Label, value)
+	}
+
+	fmt.Print(b.String())
+}
+
+// updateItem finds the item and lets the user edit its fields,
+// a change conflicting with another device is merged
+func (d *Manager) updateItem(kind *storage.Kind) (err error) {
+
+	var code int
+	var item storage.Item
+
+	if kind == storage.FileKind {
+		return d.updateBinData()
+	}
+
+	item, code, err = d.findItem(kind)
+	if code != 200 || item == nil {
+		return d.itemFailed(code, err)
+	}
+
+	for _, f := range editable(kind) {
+		var value string
+
+		value, _ = d.e.Decrypt(f.Value(item))
+
+		value, err = d.input(f, value)
+		if err == nil {
+			value, err = d.e.Encrypt(value)
+		}
+		if err != nil {
+			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
+			return
+		}
+
+		f.SetValue(item, value)
+	}
+
+	switch item := item.(type) {
+	case *storage.OTP:
+		err = d.editOTP(item)
+	case *storage.SSHKey:
+		err = d.editSSHKey(item)
+	}
+	if err == nil && d.myPrompt("Изменить теги и дополнительные поля? (y/n)") == "y" {
+		err = d.editExtras(item)
+	}
+	if err != nil {
+		fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
+		return err
+	}
+
+	return d.saveItem(item)
+}
+
+// saveItem sends the changed item with its search index, a change conflicting with another device is merged
+func (d *Manager) saveItem(item storage.Item) (err error) {
+
+	var code int
+	var tmp any
+
+	kind := item.Kind()
+
+	d.indexItem(item)
+
+	code, tmp, d.cookie, err = d.c.Send(item, kind.Name, d.cookie, "/user/update")
+	for code == 409 {
+		var retry bool
+
+		retry, err = d.mergeItem(item, tmp)
+		if err != nil || !retry {
+			fmt.Println(myStyler("Изменения не внесены"))
+			return err
+		}
+
+		// the name or the tags may be taken from the other device
+		d.indexItem(item)
+
+		code, tmp, d.cookie, err = d.c.Send(item, kind.Name, d.cookie, "/user/update")
+	}
+	if code == 202 {
+		fmt.Println(myStyler(msgQueued))
+		return nil
+	}
+	if code != 200 {
+		return d.itemFailed(code, err)
+	}
+
+	if updated, ok := tmp.(storage.Item); ok {
+		d.showItem(updated)
+	}
+
+	fmt.Println(myStyler("Готово"))
+	return nil
+}
+
+// deleteItem finds the item and deletes it,
+// an item changed on another device is deleted only if the user confirms it
+func (d *Manager) deleteItem(kind *storage.Kind) (err error) {
+
+	var code int
+	var item storage.Item
+
+	item, code, err = d.findItem(kind)
+	if code != 200 || item == nil {
+		return d.itemFailed(code, err)
+	}
+
+	return d.removeItem(item)
+}
+
+// removeItem deletes the item, an item changed on another device is deleted only if the user confirms it
+func (d *Manager) removeItem(item storage.Item) (err error) {
+
+	var code int
+	var tmp any
+
+	kind := item.Kind()
+
+	code, tmp, d.cookie, err = d.c.Send(item, kind.Name, d.cookie, "/user/delete")
+	for code == 409 {
+		var retry bool
+
+		retry, err = d.confirmConflict(tmp, item.Header().Version, "Всё равно удалить? (y/n)")
+		if err != nil || !retry {
+			fmt.Println(myStyler("Данные не удалены"))
+			return err
+		}
+
+		code, tmp, d.cookie, err = d.c.Send(item, kind.Name, d.cookie, "/user/delete")
+	}
+	if code == 202 {
+		fmt.Println(myStyler(msgQueued))
+		return nil
+	}
+	if code != 200 {
+		return d.itemFailed(code, err)
+	}
+
+	fmt.Println(myStyler("Данные удалены"))
+	return nil
+}
@@ -0,0 +1,70 @@
+package dialog
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/EgorKo25/GophKeeper/internal/client"
+	"github.com/EgorKo25/GophKeeper/internal/storage"
+	"github.com/EgorKo25/GophKeeper/pkg/blindindex"
+)
+
+func TestFindKind(t *testing.T) {
+	d := &Manager{e: testCrypto(t, "secret")}
+
+	var tokens []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/user/find":
+			tokens = r.URL.Query()["token"]
+
+			w.Header().Set("Data-Type", "items")
+			_ = json.NewEncoder(w).Encode(storage.ItemList{Items: []storage.ItemMeta{
+				{Id: "p1", Type: storage.PasswordKind.Name},
+				{Id: "c1", Type: storage.CardKind.Name},
+				{Id: "p2", Type: storage.PasswordKind.Name},
+			}, Total: 3})
+		case "/user/read":
+			var pass storage.Password
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&pass))
+
+			// the second password is deleted meanwhile
+			if pass.Id != "p1" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			pass.Service, pass.Version = sealed(t, d.e, "Yandex"), 2
+
+			w.Header().Set("Data-Type", storage.PasswordKind.Name)
+			_ = json.NewEncoder(w).Encode(pass)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	d.c = client.NewClient(server.URL, "laptop")
+	d.store = testStore(t, d)
+
+	found, code, err := d.findKind(storage.PasswordKind, blindindex.Query("yand"))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, code)
+
+	// the server gets the blinded tokens only
+	require.NotEmpty(t, tokens)
+	for _, token := range tokens {
+		assert.NotContains(t, token, "yand")
+	}
+	assert.Contains(t, tokens, d.e.BlindIndex(blindindex.Query("yand")[0]))
+
+	require.Len(t, found, 1)
+	assert.Equal(t, "p1", *found[0].Header().Id)
+	assert.Equal(t, int64(2), *found[0].Header().Version)
+}
@@ -0,0 +1,167 @@
+package dialog
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+
+	"github.com/EgorKo25/GophKeeper/internal/client"
+	"github.com/EgorKo25/GophKeeper/internal/storage"
+	"github.com/EgorKo25/GophKeeper/pkg/mycrypto"
+)
+
+// legacyFields returns the fields of the item encrypted by the old DES clients
+func legacyFields(item storage.Item) []storage.Field {
+
+	var fields []storage.Field
+	for _, f := range item.Kind().Fields {
+		value := f.Value(item)
+		if value == "" || mycrypto.IsEnvelope(value) {
+			continue
+		}
+
+		fields = append(fields, f)
+	}
+
+	return fields
+}
+
+// upgradeLegacy encrypts again the items of the old DES clients with the vault key and indexes them.
+// The items are found by their blind index, so until then they are found only in Browse
+func (d *Manager) upgradeLegacy() {
+
+	var legacy []storage.Item
+	for _, items := range d.store.Vault().Items {
+		for _, item := range items {
+			if len(legacyFields(item)) > 0 {
+				legacy = append(legacy, item)
+			}
+		}
+	}
+
+	if len(legacy) == 0 {
+		return
+	}
+
+	fmt.Println(myStyler(fmt.Sprintf("Записей, зашифрованных старой версией: %d, они будут зашифрованы заново", len(legacy))))
+
+	upgraded := 0
+	for _, item := range legacy {
+		var code int
+		var err error
+
+		err = d.reencrypt(item)
+		if err != nil {
+			fmt.Println(myStyler(myStyler("Запись не расшифрована старым ключом: ")), err)
+			continue
+		}
+
+		d.indexItem(item)
+
+		code, _, d.cookie, err = d.c.Send(item, item.Kind().Name, d.cookie, "/user/update")
+		if err != nil {
+			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
+			return
+		}
+		if code == 200 || code == 202 {
+			upgraded++
+		}
+	}
+
+	fmt.Println(myStyler(fmt.Sprintf("Зашифровано заново записей: %d из %d", upgraded, len(legacy))))
+
+	d.pull()
+}
+
+// reencrypt decrypts the legacy fields of the item and encrypts them with the vault key
+func (d *Manager) reencrypt(item storage.Item) error {
+
+	for _, f := range legacyFields(item) {
+		plain, err := d.e.Decrypt(f.Value(item))
+		if err != nil {
+			return err
+		}
+
+		value, err := d.e.Encrypt(plain)
+		if err != nil {
+			return err
+		}
+
+		f.SetValue(item, value)
+	}
+
+	return nil
+}
+
+// movedFiles returns the files of the vault the server has moved into the blob store
+func movedFiles(vault *storage.UserDate) []*storage.BinaryData {
+
+	var moved []*storage.BinaryData
+	for _, item := range vault.Items[storage.FileKind.Name] {
+		if bin, ok := item.(*storage.BinaryData); ok && movedFile(bin) {
+			moved = append(moved, bin)
+		}
+	}
+
+	return moved
+}
+
+// upgradeFiles uploads again the files the server has moved into the blob store, their content
+// is encrypted with the vault key, so it is encrypted with a file key like the content of the other files.
+// The plain content is kept only in a memory-backed directory, without one the files stay as they are
+func (d *Manager) upgradeFiles() {
+
+	moved := movedFiles(d.store.Vault())
+	if len(moved) == 0 {
+		return
+	}
+
+	dir, err := editorDir()
+	if err != nil {
+		fmt.Println(myStyler(fmt.Sprintf("Файлов старого формата: %d, нет каталога в памяти, чтобы загрузить их заново",
+			len(moved))))
+		return
+	}
+	defer wipeDir(dir)
+
+	fmt.Println(myStyler(fmt.Sprintf("Файлов старого формата: %d, они будут загружены заново", len(moved))))
+
+	upgraded := 0
+	for i, bin := range moved {
+		code, err := d.upgradeFile(bin, filepath.Join(dir, strconv.Itoa(i)))
+		if errors.Is(err, client.ErrOffline) {
+			break
+		}
+		if code == 200 {
+			upgraded++
+			continue
+		}
+		if err != nil {
+			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
+		}
+	}
+
+	fmt.Println(myStyler(fmt.Sprintf("Загружено заново файлов: %d из %d", upgraded, len(moved))))
+
+	d.pull()
+}
+
+// upgradeFile downloads the moved file to path and uploads it again in place of its content,
+// a file changed on another device meanwhile is left to the next login
+func (d *Manager) upgradeFile(bin *storage.BinaryData, path string) (int, error) {
+
+	code, err := d.download(bin, path)
+	if code != 200 {
+		return code, err
+	}
+
+	id, code, err := d.upload(path, bin.Title, bin.Id)
+	if code != 200 {
+		return code, err
+	}
+
+	code, _, err = d.complete(path, id, bin.Version)
+
+	return code, err
+}
@@ -0,0 +1,155 @@
+package dialog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/EgorKo25/GophKeeper/internal/storage"
+
+	"github.com/manifoldco/promptui"
+)
+
+var errConflictResponse = errors.New("unexpected conflict response")
+
+// merge shows the local change next to the version on the server and lets the user resolve the conflict.
+// The kept or edited values of the fields are put into the item, false is returned when the version on the server is kept
+func (d *Manager) merge(mine, theirs storage.Item, fields []storage.Field) (bool, error) {
+
+	fmt.Println(myStyler(myStyler("Запись изменена на другом устройстве: ")), deviceName(*theirs.Header().ModifiedBy))
+
+	d.compare(os.Stdout, mine, theirs, fields)
+
+	prompt := promptui.Select{
+		Label: "Какую версию сохранить?",
+		Items: []string{"Мою", "С сервера", "Редактировать"},
+	}
+
+	i, _, err := prompt.Run()
+	if err != nil {
+		return false, err
+	}
+
+	switch i {
+	case 0:
+		return true, nil
+	case 1:
+		return false, nil
+	}
+
+	for _, f := range fields {
+		my, _ := d.e.Decrypt(f.Value(mine))
+
+		value, err := d.input(f, my)
+		if err == nil {
+			value, err = d.e.Encrypt(value)
+		}
+		if err != nil {
+			return false, err
+		}
+
+		f.SetValue(mine, value)
+	}
+
+	if d.myPrompt("Изменить теги и дополнительные поля? (y/n)") == "y" {
+		err = d.editExtras(mine)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// compare writes the decrypted fields, the tags and the names of the custom fields of both versions side by side
+func (d *Manager) compare(out io.Writer, mine, theirs storage.Item, fields []storage.Field) {
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Поле\tМоя версия\tВерсия на сервере")
+	for _, f := range fields {
+		my, _ := d.e.Decrypt(f.Value(mine))
+		their, _ := d.e.Decrypt(f.Value(theirs))
+		fmt.Fprintf(w, "%s\t%s\t%s\n", f.Label, preview(f, my), preview(f, their))
+	}
+	fmt.Fprintf(w, "Теги\t%s\t%s\n", strings.Join(d.itemTags(mine), ", "),
+		strings.Join(d.itemTags(theirs), ", "))
+	fmt.Fprintf(w, "Дополнительные поля\t%s\t%s\n", d.fieldNames(mine), d.fieldNames(theirs))
+	_ = w.Flush()
+}
+
+// preview returns the first line of a multiline value to show it in a table
+func preview(f storage.Field, value string) string {
+
+	if !f.Multiline {
+		return value
+	}
+
+	lines := strings.SplitN(value, "\n", 2)
+	if len(lines) > 1 {
+		return lines[0] + " …"
+	}
+
+	return lines[0]
+}
+
+// myEdit is a function for editing a value
+func (d *Manager) myEdit(label, value string) string {
+	prompt := promptui.Prompt{
+		Label:     myStyler(myStyler(label)),
+		Default:   value,
+		AllowEdit: true,
+	}
+
+	res, _ := prompt.Run()
+	return res
+}
+
+// deviceName returns the name of the device of the last change shown to the user
+func deviceName(device string) string {
+	if device == "" {
+		return "неизвестное устройство"
+	}
+
+	return device
+}
+
+// mergeItem resolves the conflict of the item update,
+// the item takes the version on the server to be sent again
+func (d *Manager) mergeItem(item storage.Item, tmp any) (bool, error) {
+
+	conflict, ok := tmp.(storage.Conflict)
+	if !ok || conflict.Item == nil || conflict.Item.Kind() != item.Kind() {
+		return false, errConflictResponse
+	}
+
+	theirs := conflict.Item
+
+	retry, err := d.merge(item, theirs, editable(item.Kind()))
+	if err != nil || !retry {
+		return false, err
+	}
+
+	*item.Header().Version = *theirs.Header().Version
+	return true, nil
+}
+
+// confirmConflict shows the version on the server changed since the item was read
+// and asks the question whether to change it anyway, the version of the item is moved to the one on the server then
+func (d *Manager) confirmConflict(tmp any, version *int64, question string) (bool, error) {
+
+	conflict, ok := tmp.(storage.Conflict)
+	if !ok || conflict.Item == nil {
+		return false, errConflictResponse
+	}
+
+	d.showItem(conflict.Item)
+	*version = *conflict.Item.Header().Version
+
+	fmt.Println(myStyler(myStyler("Запись изменена на другом устройстве: ")),
+		deviceName(*conflict.Item.Header().ModifiedBy))
+
+	return d.myPrompt(question) == "y", nil
+}
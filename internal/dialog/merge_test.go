@@ -0,0 +1,81 @@
+package dialog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/EgorKo25/GophKeeper/internal/storage"
+)
+
+func TestPreview(t *testing.T) {
+	note := storage.NoteKind.Fields[1]
+	require.True(t, note.Multiline)
+
+	assert.Equal(t, "first …", preview(note, "first\nsecond\nthird"))
+	assert.Equal(t, "single", preview(note, "single"))
+	assert.Equal(t, "a\nb", preview(storage.NoteKind.Fields[0], "a\nb"), "a single line field is shown as is")
+}
+
+func TestDeviceName(t *testing.T) {
+	assert.Equal(t, "laptop", deviceName("laptop"))
+	assert.Equal(t, "неизвестное устройство", deviceName(""))
+}
+
+func TestCompare(t *testing.T) {
+	d := &Manager{e: testCrypto(t, "secret")}
+
+	note := func(title, body string, tags []string, secret bool, custom ...storage.CustomField) storage.Item {
+		n := &storage.Note{Id: "n1", Version: 2}
+		require.NoError(t, d.setValues(n, map[string]string{"title": title, "body": body}))
+		require.NoError(t, d.setTags(n, tags, secret))
+		require.NoError(t, d.setCustomFields(n, custom))
+		return n
+	}
+
+	mine := note("Plans", "buy milk\nand bread", []string{"home"}, true,
+		storage.CustomField{Name: "shop", Type: "text", Value: "corner"})
+	theirs := note("Plans", "buy tea", []string{"home", "todo"}, false)
+
+	var out bytes.Buffer
+	d.compare(&out, mine, theirs, editable(storage.NoteKind))
+
+	lines := strings.Split(strings.TrimRight(out.String(), "\n"), "\n")
+	require.Len(t, lines, 1+len(editable(storage.NoteKind))+2)
+
+	assert.Regexp(t, `^Поле\s+Моя версия\s+Версия на сервере$`, lines[0])
+	assert.Contains(t, out.String(), "buy milk …")
+	assert.Contains(t, out.String(), "buy tea")
+	assert.NotContains(t, out.String(), "bread", "only the first line of the text is shown")
+	assert.Regexp(t, `^Теги\s+home\s+home, todo$`, lines[len(lines)-2])
+	assert.Regexp(t, `^Дополнительные поля\s+shop\s*$`, lines[len(lines)-1])
+	assert.NotContains(t, out.String(), "corner", "the values of the custom fields are not shown")
+}
+
+func TestMergeItem_UnexpectedResponse(t *testing.T) {
+	d := &Manager{e: testCrypto(t, "secret")}
+
+	item := &storage.Password{Id: "p1", Version: 1}
+
+	for _, tmp := range []any{
+		nil,
+		storage.Conflict{Error: "conflict"},
+		storage.Conflict{Item: &storage.Card{Id: "p1", Version: 2}},
+	} {
+		retry, err := d.mergeItem(item, tmp)
+		assert.False(t, retry)
+		assert.ErrorIs(t, err, errConflictResponse)
+	}
+	assert.Equal(t, int64(1), item.Version, "the version is kept")
+
+	version := int64(1)
+	for _, tmp := range []any{nil, storage.Conflict{Error: "conflict"}} {
+		ok, err := d.confirmConflict(tmp, &version, "?")
+		assert.False(t, ok)
+		assert.ErrorIs(t, err, errConflictResponse)
+	}
+	assert.Equal(t, int64(1), version)
+}
@@ -0,0 +1,251 @@
+package dialog
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/manifoldco/promptui"
+
+	"github.com/EgorKo25/GophKeeper/internal/client"
+	"github.com/EgorKo25/GophKeeper/internal/storage"
+)
+
+const (
+	msgQueued = "Нет связи с сервером, изменение будет отправлено при подключении"
+)
+
+// openCache opens the local copy of the vault of the user
+func (d *Manager) openCache(login string) (err error) {
+
+	d.store, err = d.c.UseCache(login)
+	if err != nil {
+		return err
+	}
+
+	d.syncer = client.NewSyncer(d.c, d.store)
+
+	return nil
+}
+
+// openOffline continues with the local copy of the vault when the server is unreachable.
+// Only the master password protects the vault then
+func (d *Manager) openOffline() error {
+
+	if d.store.KeyMeta() == nil {
+		fmt.Println(myStyler(myStyler("Сервер недоступен, локальной копии хранилища нет")))
+		return client.ErrOffline
+	}
+
+	fmt.Println(myStyler("Сервер недоступен, открыта локальная копия хранилища"))
+	return nil
+}
+
+// unlockCache decrypts the local copy of the vault and updates it from the server.
+// A copy encrypted with an old key is downloaded again, the items of the old DES clients are encrypted again
+// and the files moved by the server into the blob store are uploaded again
+func (d *Manager) unlockCache() error {
+
+	err := d.store.Unlock(d.e)
+	if err != nil {
+		err = d.resetCache()
+		if err != nil {
+			return err
+		}
+	}
+
+	d.pull()
+	d.upgradeLegacy()
+	d.upgradeFiles()
+
+	return nil
+}
+
+// resetCache drops the local copy encrypted with an old key on the confirmation of the user.
+// A copy with unsent changes is never dropped, the user decides what to do with the file
+func (d *Manager) resetCache() error {
+
+	fmt.Println(myStyler("Локальная копия зашифрована старым ключом"))
+
+	if n := d.store.Unsent(); n > 0 {
+		fmt.Println(myStyler(myStyler(fmt.Sprintf("В ней неотправленных изменений: %d, она оставлена как есть: %s",
+			n, d.store.Path()))))
+		return client.ErrCacheLocked
+	}
+
+	if d.myPrompt("Удалить её и загрузить хранилище заново? (y/n)") != "y" {
+		return client.ErrCacheLocked
+	}
+
+	d.store.Reset()
+
+	return d.store.Unlock(d.e)
+}
+
+// pull updates the local copy of the vault, it is kept as is when the server is unreachable
+func (d *Manager) pull() {
+
+	code, _, cookie, _ := d.syncer.Pull(d.cookie)
+	if code == 200 {
+		d.cookie = cookie
+	}
+}
+
+// reconnect tries to reach the server while offline,
+// the pending changes are sent before the local copy is updated
+func (d *Manager) reconnect() {
+
+	if d.syncer == nil || d.c.Status().Online {
+		return
+	}
+
+	d.pull()
+}
+
+// status returns the indicator of the connection and of the pending changes
+func (d *Manager) status() string {
+
+	st := d.c.Status()
+
+	res := "[онлайн]"
+	if !st.Online {
+		res = "[офлайн]"
+	}
+
+	if st.Pending > 0 {
+		res += fmt.Sprintf(" [в очереди: %d]", st.Pending)
+	}
+	if st.Rejected > 0 {
+		res += fmt.Sprintf(" [отклонено сервером: %d]", st.Rejected)
+	}
+
+	return res
+}
+
+// actions names the changes by their paths
+var actions = map[string]string{
+	"/user/add":    "Добавление",
+	"/user/update": "Изменение",
+	"/user/delete": "Удаление",
+	"/user/move":   "Перемещение",
+}
+
+// Rejected lists the changes the server has refused on replay,
+// a change is sent again over the stored version of the item or dropped
+func (d *Manager) Rejected() error {
+
+	rejected := d.store.Rejected()
+	if len(rejected) == 0 {
+		fmt.Println(myStyler("Отклонённых изменений нет"))
+		return nil
+	}
+
+	labels := make([]string, 0, len(rejected)+1)
+	for _, r := range rejected {
+		labels = append(labels, d.rejectedLabel(r))
+	}
+	labels = append(labels, "Назад")
+
+	prompt := promptui.Select{
+		Label: "Изменения, отклонённые сервером",
+		Items: labels,
+	}
+
+	i, _, err := prompt.Run()
+	if err != nil || i == len(rejected) {
+		return err
+	}
+
+	return d.resolveRejected(i, rejected[i])
+}
+
+// rejectedItem decodes the item of the rejected change
+func rejectedItem(r client.Rejected) (storage.Item, error) {
+
+	kind, ok := storage.KindOf(r.DataType)
+	if !ok {
+		return nil, fmt.Errorf("unknown item type %q", r.DataType)
+	}
+
+	item := kind.New()
+
+	return item, json.Unmarshal(r.Body, item)
+}
+
+// rejectedLabel names the rejected change by its action, the item and the status of the server
+func (d *Manager) rejectedLabel(r client.Rejected) string {
+
+	action, ok := actions[r.Path]
+	if !ok {
+		action = r.Path
+	}
+
+	item, err := rejectedItem(r)
+	if err != nil {
+		return fmt.Sprintf("%s: %s (код %d)", action, r.DataType, r.Code)
+	}
+
+	meta := storage.ItemMeta{Type: item.Kind().Name, Name: item.Kind().Search().Value(item)}
+
+	return fmt.Sprintf("%s: %s (код %d)", action, d.metaLabel(meta), r.Code)
+}
+
+// storedVersion returns the version of the item in the local copy, it is empty for an unknown item
+func (d *Manager) storedVersion(item storage.Item) string {
+
+	for _, stored := range d.store.Vault().Items[item.Kind().Name] {
+		if *stored.Header().Id == *item.Header().Id {
+			return strconv.FormatInt(*stored.Header().Version, 10)
+		}
+	}
+
+	return ""
+}
+
+// resolveRejected shows the rejected change and sends it again or drops it
+func (d *Manager) resolveRejected(i int, r client.Rejected) error {
+
+	item, err := rejectedItem(r)
+	if err == nil && r.Path != "/user/delete" {
+		d.showItem(item)
+	}
+
+	prompt := promptui.Select{
+		Label: d.rejectedLabel(r),
+		Items: []string{"Отправить заново", "Отбросить", "Назад"},
+	}
+
+	_, res, err := prompt.Run()
+	if err != nil {
+		return err
+	}
+
+	switch res {
+	case "Отправить заново":
+		// the change of an item replaces the version the local copy has,
+		// an item deleted on the server is not found then
+		version := r.Version
+		if item != nil && r.Path != "/user/add" {
+			if stored := d.storedVersion(item); stored != "" {
+				version = strconv.Quote(stored)
+			}
+		}
+
+		err = d.store.Retry(i, version)
+		if err != nil {
+			return err
+		}
+
+		d.pull()
+	case "Отбросить":
+		err = d.store.Discard(i)
+		if err != nil {
+			return err
+		}
+	default:
+		return nil
+	}
+
+	fmt.Println(myStyler("Готово " + d.status()))
+	return nil
+}
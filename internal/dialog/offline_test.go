@@ -0,0 +1,35 @@
+package dialog
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/EgorKo25/GophKeeper/internal/client"
+	"github.com/EgorKo25/GophKeeper/internal/storage"
+)
+
+func TestRejectedLabel(t *testing.T) {
+	d := &Manager{e: testCrypto(t, "secret")}
+
+	body, err := json.Marshal(&storage.Password{Id: "1", Service: sealed(t, d.e, "Yandex"), Version: 3})
+	require.NoError(t, err)
+
+	r := client.Rejected{
+		Pending: client.Pending{Path: "/user/update", DataType: storage.PasswordKind.Name, Body: body},
+		Code:    409,
+	}
+
+	item, err := rejectedItem(r)
+	require.NoError(t, err)
+	assert.Equal(t, "1", *item.Header().Id)
+
+	assert.Equal(t, "Изменение: "+storage.PasswordKind.Title+": Yandex (код 409)", d.rejectedLabel(r))
+
+	r.DataType = "unknown"
+	_, err = rejectedItem(r)
+	assert.Error(t, err)
+	assert.Equal(t, "Изменение: unknown (код 409)", d.rejectedLabel(r))
+}
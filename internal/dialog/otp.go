@@ -0,0 +1,309 @@
+package dialog
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/EgorKo25/GophKeeper/internal/storage"
+	"github.com/EgorKo25/GophKeeper/pkg/otp"
+
+	"github.com/manifoldco/promptui"
+)
+
+// addOTP imports the authenticator secret from the otpauth:// URI or asks its parameters,
+// the secret may be linked to a password of the same service
+func (d *Manager) addOTP() error {
+
+	key, err := d.inputKey()
+	if err != nil {
+		fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
+		return nil
+	}
+
+	o := &storage.OTP{}
+
+	o.PasswordId, err = d.linkPassword()
+	if err != nil {
+		return err
+	}
+
+	err = d.setKey(o, key)
+	if err != nil {
+		fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
+		return err
+	}
+
+	return d.sendItem(o)
+}
+
+// inputKey reads the otpauth:// URI of the QR code or asks the secret and the parameters of the codes
+func (d *Manager) inputKey() (*otp.Key, error) {
+
+	uri := d.myPrompt("Ссылка otpauth:// (пусто — ввести секрет вручную)")
+	if uri != "" {
+		key, err := otp.Parse(uri)
+		if err == nil && key.Issuer == "" {
+			key.Issuer = d.myPrompt("Название сервиса")
+		}
+		return key, err
+	}
+
+	i, err := d.choose("Тип кодов", []string{"По времени (TOTP)", "По счётчику (HOTP)"})
+	if i < 0 {
+		return nil, err
+	}
+
+	typ := otp.TypeTOTP
+	if i == 1 {
+		typ = otp.TypeHOTP
+	}
+
+	key, err := otp.NewKey(typ, d.myPassword("Секрет (base32)"))
+	if err != nil {
+		return nil, err
+	}
+
+	key.Issuer = d.myPrompt("Название сервиса")
+	key.Account = d.myPrompt("Аккаунт")
+
+	prompt := promptui.Select{
+		Label: "Алгоритм",
+		Items: []string{"SHA1", "SHA256", "SHA512"},
+	}
+
+	_, key.Algorithm, err = prompt.Run()
+	if err != nil {
+		return nil, err
+	}
+
+	key.Digits, err = strconv.Atoi(d.myEdit("Количество цифр", strconv.Itoa(otp.DefaultDigits)))
+	if err != nil {
+		return nil, otp.ErrInvalidDigits
+	}
+
+	if typ == otp.TypeTOTP {
+		key.Period, err = strconv.Atoi(d.myEdit("Период, секунд", strconv.Itoa(otp.DefaultPeriod)))
+		if err != nil {
+			return nil, otp.ErrInvalidPeriod
+		}
+	}
+
+	return key, key.Validate()
+}
+
+// setKey encrypts the fields of the secret from the key
+func (d *Manager) setKey(o *storage.OTP, key *otp.Key) error {
+	return d.setValues(o, map[string]string{"issuer": key.Issuer, "account": key.Account, "uri": key.URI()})
+}
+
+// otpKey decrypts the key of the secret
+func (d *Manager) otpKey(o *storage.OTP) (*otp.Key, error) {
+
+	uri, err := d.e.Decrypt(o.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	return otp.Parse(uri)
+}
+
+// linkPassword lets the user choose the password the secret is linked to,
+// the encrypted id of the password is returned or an empty string
+func (d *Manager) linkPassword() (string, error) {
+
+	if d.myPrompt("Связать с паролем? (y/n)") != "y" {
+		return "", nil
+	}
+
+	item, code, err := d.findItem(storage.PasswordKind)
+	if code != 200 || item == nil {
+		return "", d.itemFailed(code, err)
+	}
+
+	return d.e.Encrypt(*item.Header().Id)
+}
+
+// editOTP checks the edited otpauth:// URI of the secret and lets the user change the linked password
+func (d *Manager) editOTP(o *storage.OTP) (err error) {
+
+	_, err = d.otpKey(o)
+	if err != nil {
+		return err
+	}
+
+	if d.myPrompt("Изменить связанный пароль? (y/n)") != "y" {
+		return nil
+	}
+
+	o.PasswordId, err = d.linkPassword()
+	return err
+}
+
+// linkedPassword reads the password the secret is linked to, nil is returned when there is no such password
+func (d *Manager) linkedPassword(o *storage.OTP) *storage.Password {
+
+	if o.PasswordId == "" {
+		return nil
+	}
+
+	id, err := d.e.Decrypt(o.PasswordId)
+	if err != nil {
+		return nil
+	}
+
+	code, tmp, cookie, err := d.c.Send(&storage.Password{Id: id}, storage.PasswordKind.Name, d.cookie, "/user/read")
+	if err != nil || code != 200 {
+		return nil
+	}
+	d.cookie = cookie
+
+	pass, _ := tmp.(*storage.Password)
+	return pass
+}
+
+// showOTP prints the secret without the shared key, the code of a time-based secret and the linked password
+func (d *Manager) showOTP(o *storage.OTP) {
+
+	issuer, _ := d.e.Decrypt(o.Issuer)
+	account, _ := d.e.Decrypt(o.Account)
+
+	fmt.Printf("Название сервиса: %s\nАккаунт: %s\n", issuer, account)
+
+	key, err := d.otpKey(o)
+	if err != nil {
+		fmt.Println(myStyler(myStyler("Секрет повреждён: ")), err)
+		return
+	}
+
+	fmt.Printf("Тип: %s, %s, %d цифр\n", key.Type, key.Algorithm, key.Digits)
+	if key.Type == otp.TypeTOTP {
+		fmt.Printf("Код: %s\n", groupCode(key.Code(time.Now())))
+	}
+
+	if o.PasswordId == "" {
+		return
+	}
+
+	pass := d.linkedPassword(o)
+	if pass == nil {
+		fmt.Println("Связанный пароль не найден")
+		return
+	}
+
+	service, _ := d.e.Decrypt(pass.Service)
+	login, _ := d.e.Decrypt(pass.Login)
+	fmt.Printf("Связанный пароль: %s, логин %s\n", service, login)
+}
+
+// Code shows the current code of the authenticator secret.
+// The code of a time-based secret is refreshed with a countdown until Enter is pressed,
+// the counter of a counter-based secret is moved forward and saved before the code is shown
+func (d *Manager) Code() error {
+
+	item, code, err := d.findItem(storage.OTPKind)
+	if code != 200 || item == nil {
+		return d.itemFailed(code, err)
+	}
+
+	o := item.(*storage.OTP)
+
+	key, err := d.otpKey(o)
+	if err != nil {
+		fmt.Println(myStyler(myStyler("Секрет повреждён: ")), err)
+		return nil
+	}
+
+	if pass := d.linkedPassword(o); pass != nil {
+		login, _ := d.e.Decrypt(pass.Login)
+		fmt.Println(myStyler("Логин: "), login)
+	}
+
+	if key.Type == otp.TypeHOTP {
+		return d.nextCode(o, key)
+	}
+
+	d.countdown(key)
+	return nil
+}
+
+// nextCode moves the counter of the secret forward, saves it and shows the code of the used counter.
+// Offline the raised counter is saved in the local copy, so the next code is never the same.
+// The code is not shown when the counter has been used on another device
+func (d *Manager) nextCode(o *storage.OTP, key *otp.Key) (err error) {
+
+	var code int
+
+	res := key.Code(time.Now())
+	key.Counter++
+
+	err = d.setKey(o, key)
+	if err != nil {
+		fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
+		return err
+	}
+
+	code, _, d.cookie, err = d.c.Send(o, storage.OTPKind.Name, d.cookie, "/user/update")
+	switch code {
+	case 200, 202:
+	case 409:
+		fmt.Println(myStyler(myStyler("Счётчик изменён на другом устройстве, запросите код снова")))
+		return nil
+	default:
+		return d.itemFailed(code, err)
+	}
+
+	fmt.Println(myStyler("Код: "), groupCode(res))
+	return nil
+}
+
+// countdown prints the code of the time-based key and the seconds it is valid for until Enter is pressed
+func (d *Manager) countdown(key *otp.Key) {
+
+	fmt.Println(myStyler("Нажмите Enter, чтобы вернуться"))
+
+	refreshCode(key, os.Stdin, os.Stdout, time.Second)
+}
+
+// refreshCode prints the code of the key to out every interval until a line is read from in
+func refreshCode(key *otp.Key, in io.Reader, out io.Writer, interval time.Duration) {
+
+	done := make(chan struct{})
+	go func() {
+		_, _ = bufio.NewReader(in).ReadString('\n')
+		close(done)
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		fmt.Fprint(out, codeLine(key, time.Now()))
+
+		select {
+		case <-done:
+			fmt.Fprintln(out)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// codeLine returns the code of the key at the time and the seconds it is valid for,
+// the line overwrites the previous one
+func codeLine(key *otp.Key, now time.Time) string {
+
+	left := math.Ceil(key.Remaining(now).Seconds())
+
+	return fmt.Sprintf("\r%s  осталось %2.f с ", myStyler(groupCode(key.Code(now))), left)
+}
+
+// groupCode splits the code in two halves to be read easier
+func groupCode(code string) string {
+	half := (len(code) + 1) / 2
+	return code[:half] + " " + code[half:]
+}
@@ -0,0 +1,182 @@
+package dialog
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/EgorKo25/GophKeeper/internal/client"
+	"github.com/EgorKo25/GophKeeper/internal/storage"
+	"github.com/EgorKo25/GophKeeper/pkg/otp"
+)
+
+// rfcKey is the time-based key of the test vectors of RFC 6238
+var rfcKey = &otp.Key{Type: otp.TypeTOTP, Secret: []byte("12345678901234567890"), Algorithm: "SHA1", Digits: 8, Period: 30}
+
+func TestGroupCode(t *testing.T) {
+	assert.Equal(t, "123 456", groupCode("123456"))
+	assert.Equal(t, "1234 567", groupCode("1234567"))
+}
+
+func TestCodeLine(t *testing.T) {
+	line := codeLine(rfcKey, time.Unix(59, 0))
+
+	assert.True(t, strings.HasPrefix(line, "\r"), "the line overwrites the previous one")
+	assert.Contains(t, line, "9428 7082")
+	assert.Contains(t, line, "осталось  1 с")
+
+	assert.Contains(t, codeLine(rfcKey, time.Unix(1111111109, 0)), "0708 1804")
+	assert.Contains(t, codeLine(rfcKey, time.Unix(60, 0)), "осталось 30 с")
+}
+
+func TestRefreshCode(t *testing.T) {
+	in, enter := io.Pipe()
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_, _ = enter.Write([]byte("\n"))
+	}()
+
+	var out bytes.Buffer
+
+	done := make(chan struct{})
+	go func() {
+		refreshCode(rfcKey, in, &out, 10*time.Millisecond)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the countdown doesn't stop on Enter")
+	}
+
+	assert.Greater(t, strings.Count(out.String(), "\r"), 1, "the code is refreshed")
+	assert.True(t, strings.HasSuffix(out.String(), "\n"))
+}
+
+func TestKeyRoundTrip(t *testing.T) {
+	d := &Manager{e: testCrypto(t, "secret")}
+
+	key := *rfcKey
+	key.Issuer, key.Account = "Example", "alice"
+
+	o := &storage.OTP{}
+	require.NoError(t, d.setKey(o, &key))
+	assert.NotContains(t, o.URI, "otpauth")
+
+	res, err := d.otpKey(o)
+	require.NoError(t, err)
+	assert.Equal(t, &key, res)
+}
+
+func TestLinkedPassword(t *testing.T) {
+	var requested []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var pass storage.Password
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&pass))
+		requested = append(requested, pass.Id)
+
+		if pass.Id != "p1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Data-Type", storage.PasswordKind.Name)
+		_ = json.NewEncoder(w).Encode(&storage.Password{Id: "p1", Service: "yandex"})
+	}))
+	defer server.Close()
+
+	d := &Manager{e: testCrypto(t, "secret"), c: client.NewClient(server.URL, "laptop")}
+
+	assert.Nil(t, d.linkedPassword(&storage.OTP{}), "not linked")
+	assert.Nil(t, d.linkedPassword(&storage.OTP{PasswordId: "p1"}), "the id is not encrypted")
+
+	pass := d.linkedPassword(&storage.OTP{PasswordId: sealed(t, d.e, "p1")})
+	require.NotNil(t, pass)
+	assert.Equal(t, "yandex", pass.Service)
+
+	assert.Nil(t, d.linkedPassword(&storage.OTP{PasswordId: sealed(t, d.e, "p2")}), "deleted")
+
+	assert.Equal(t, []string{"p1", "p2"}, requested)
+}
+
+// captureStdout returns what fn prints
+func captureStdout(t *testing.T, fn func()) string {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	fn()
+
+	require.NoError(t, w.Close())
+
+	out, err := io.ReadAll(r)
+	require.NoError(t, err)
+
+	return string(out)
+}
+
+func TestNextCode_Offline(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	// nothing listens on the port, the client works with the local copy
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	d := &Manager{e: testCrypto(t, "secret"), c: client.NewClient(server.URL, "laptop")}
+
+	var err error
+	d.store, err = d.c.UseCache("testuser")
+	require.NoError(t, err)
+	require.NoError(t, d.store.Unlock(d.e))
+
+	key := otp.Key{Type: otp.TypeHOTP, Issuer: "Example", Secret: []byte("12345678901234567890"),
+		Algorithm: "SHA1", Digits: 6}
+
+	o := &storage.OTP{Id: "o1", Version: 1}
+	require.NoError(t, d.setKey(o, &key))
+	require.NoError(t, d.store.Apply(&storage.SyncDelta{Cursor: 1, Items: storage.Items{storage.OTPKind.Name: {o}}}))
+
+	// every code is read from the local copy like Code does
+	var codes []string
+	for i := 0; i < 2; i++ {
+		stored := d.store.Vault().Items[storage.OTPKind.Name][0].(*storage.OTP)
+
+		key, err := d.otpKey(stored)
+		require.NoError(t, err)
+
+		codes = append(codes, captureStdout(t, func() {
+			require.NoError(t, d.nextCode(stored, key))
+		}))
+	}
+
+	// the test vectors of RFC 4226 for the counters 0 and 1
+	assert.Contains(t, codes[0], "755 224")
+	assert.Contains(t, codes[1], "287 082")
+
+	stored := d.store.Vault().Items[storage.OTPKind.Name][0].(*storage.OTP)
+	assert.Equal(t, int64(3), stored.Version)
+
+	key2, err := d.otpKey(stored)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), key2.Counter)
+
+	pending := d.store.Pending()
+	require.Len(t, pending, 2)
+	assert.Equal(t, []string{`"1"`, `"2"`}, []string{pending[0].Version, pending[1].Version})
+}
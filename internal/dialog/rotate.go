@@ -0,0 +1,275 @@
+package dialog
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/EgorKo25/GophKeeper/internal/storage"
+	"github.com/EgorKo25/GophKeeper/pkg/mycrypto"
+)
+
+// RotateKey re-encrypts the whole vault with a new master password.
+// The vault is replaced on the server in one transaction,
+// so until it is committed the old master password stays valid.
+// The key isn't changed while the local copy has unsent changes
+func (d *Manager) RotateKey() (err error) {
+
+	var code int
+	var tmp any
+
+	current := d.myPassword("Введите текущий мастер-пароль")
+
+	code, tmp, d.cookie, err = d.c.Send(&storage.UserDate{}, "vault", d.cookie, "/user/read")
+	if code != 200 {
+		fmt.Println(myStyler(myStyler("Не удалось загрузить хранилище: ")), err)
+		return err
+	}
+
+	stored := tmp.(storage.UserDate)
+
+	// the queued changes are encrypted with the old key and the local copy is downloaded again,
+	// the pending ones are sent before the vault is read, so only those the server has refused are left
+	if n := d.store.Unsent(); n > 0 {
+		fmt.Println(myStyler(myStyler(fmt.Sprintf("Неотправленных изменений: %d, отправьте их (Sync) "+
+			"или разберите отклонённые (Rejected changes) и повторите смену ключа", n))))
+		return nil
+	}
+
+	// the content of the moved files is encrypted with the vault key itself
+	if n := len(movedFiles(&stored)); n > 0 {
+		fmt.Println(myStyler(myStyler(fmt.Sprintf("Файлов старого формата: %d, войдите заново, чтобы они были загружены заново",
+			n))))
+		return nil
+	}
+
+	old, err := currentKey(current, stored.KeyMeta)
+	if err != nil {
+		fmt.Println(myStyler(myStyler("Неверный мастер-пароль")))
+		return nil
+	}
+
+	secret := d.myPassword("Введите новый мастер-пароль")
+	if secret == "" || secret != d.myPassword("Повторите новый мастер-пароль") {
+		fmt.Println(myStyler(myStyler("Пароли не совпадают")))
+		return nil
+	}
+
+	plain, err := mapVault(&stored, old.Decrypt)
+	if err != nil {
+		fmt.Println(myStyler(myStyler("Не удалось расшифровать хранилище: ")), err)
+		return err
+	}
+
+	params, err := mycrypto.NewKeyParams()
+	if err != nil {
+		return err
+	}
+
+	e, err := mycrypto.NewCrypto(secret, params)
+	if err != nil {
+		return err
+	}
+
+	rotated, err := mapVault(plain, e.Encrypt)
+	if err != nil {
+		fmt.Println(myStyler(myStyler("Не удалось зашифровать хранилище: ")), err)
+		return err
+	}
+
+	// the blind index is keyed with the master password as well
+	indexVault(e, rotated, plain)
+
+	rotated.KeyMeta = &storage.KeyMeta{
+		Salt:    params.Salt,
+		Time:    params.Time,
+		Memory:  params.Memory,
+		Threads: params.Threads,
+	}
+
+	rotated.KeyMeta.Check, err = e.Verifier()
+	if err != nil {
+		return err
+	}
+
+	if stored.KeyMeta != nil && stored.KeyMeta.ContentKey != "" {
+		rotated.KeyMeta.ContentKey, err = rekey(old, e, stored.KeyMeta.ContentKey)
+		if err != nil {
+			fmt.Println(myStyler(myStyler("Не удалось зашифровать ключ файлов: ")), err)
+			return err
+		}
+	}
+
+	err = verifyVault(e, rotated, plain)
+	if err != nil {
+		fmt.Println(myStyler(myStyler("Мастер-пароль не изменён: ")), err)
+		return err
+	}
+
+	code, _, d.cookie, err = d.c.Send(rotated, "vault", d.cookie, "/user/update")
+	if code == 409 {
+		fmt.Println(myStyler(myStyler("Хранилище изменено на другом устройстве, повторите попытку")))
+		return nil
+	}
+	if code != 200 {
+		fmt.Println(myStyler(myStyler("Мастер-пароль не изменён: ")), err)
+		return err
+	}
+
+	// the server increments the version of every replaced item
+	bumpVersions(plain)
+
+	code, tmp, d.cookie, err = d.c.Send(&storage.UserDate{}, "vault", d.cookie, "/user/read")
+	if code != 200 {
+		fmt.Println(myStyler(myStyler("Не удалось проверить хранилище: ")), err)
+		return err
+	}
+
+	stored = tmp.(storage.UserDate)
+
+	err = verifyVault(e, &stored, plain)
+	if err != nil {
+		fmt.Println(myStyler(myStyler("Хранилище на сервере не прошло проверку: ")), err)
+		return err
+	}
+
+	d.e = e
+	d.secret = secret
+
+	// the cached items are encrypted with the old key, they are downloaded again
+	d.store.Reset()
+
+	err = d.store.Rekey(e, rotated.KeyMeta)
+	if err != nil {
+		fmt.Println(myStyler(myStyler("Не удалось сохранить локальную копию: ")), err)
+	}
+
+	d.pull()
+
+	fmt.Println(myStyler("Мастер-пароль изменён"))
+	return nil
+}
+
+// currentKey derives the key of the vault from the master password and checks it with the stored verifier
+func currentKey(secret string, meta *storage.KeyMeta) (*mycrypto.Crypto, error) {
+
+	if meta == nil {
+		return nil, errors.New("no key metadata")
+	}
+
+	e, err := mycrypto.NewCrypto(secret, keyParams(meta))
+	if err != nil {
+		return nil, err
+	}
+
+	return e, e.Verify(meta.Check)
+}
+
+// rekey encrypts the value encrypted with the old key with the new one
+func rekey(old, e *mycrypto.Crypto, value string) (string, error) {
+
+	plain, err := old.Decrypt(value)
+	if err != nil {
+		return "", err
+	}
+
+	return e.Encrypt(plain)
+}
+
+// verifyVault checks that the vault decrypted with e is equal to plain
+func verifyVault(e *mycrypto.Crypto, vault, plain *storage.UserDate) error {
+	if vault.KeyMeta == nil || e.Verify(vault.KeyMeta.Check) != nil {
+		return errors.New("key check mismatch")
+	}
+
+	if vault.KeyMeta.ContentKey != "" {
+		if _, err := e.Decrypt(vault.KeyMeta.ContentKey); err != nil {
+			return errors.New("content key mismatch")
+		}
+	}
+
+	res, err := mapVault(vault, e.Decrypt)
+	if err != nil {
+		return err
+	}
+
+	if !reflect.DeepEqual(res, plain) {
+		return errors.New("vault content mismatch")
+	}
+
+	return nil
+}
+
+// indexVault sets the blind index of every item of the vault made from the plain copy of the items
+func indexVault(e *mycrypto.Crypto, vault, plain *storage.UserDate) {
+	for _, kind := range storage.Kinds() {
+		for i, item := range vault.Items[kind.Name] {
+			p := plain.Items[kind.Name][i]
+
+			*item.Header().Index = searchIndex(e, kind.Search().Value(p), storage.SplitTags(*p.Header().Tags))
+		}
+	}
+}
+
+// bumpVersions increments the version of every item of the vault
+func bumpVersions(vault *storage.UserDate) {
+	for _, items := range vault.Items {
+		for _, item := range items {
+			*item.Header().Version++
+		}
+	}
+}
+
+// mapVault returns a copy of the vault items with fn applied to every encrypted field, the plain tags are kept.
+// Ids and versions are kept, the server matches the items by them
+func mapVault(vault *storage.UserDate, fn func(value string) (string, error)) (*storage.UserDate, error) {
+
+	var err error
+
+	apply := func(value string) string {
+		if err != nil {
+			return ""
+		}
+
+		var res string
+		res, err = fn(value)
+		return res
+	}
+
+	res := storage.UserDate{
+		Items: make(storage.Items),
+	}
+
+	for _, kind := range storage.Kinds() {
+		items := make([]storage.Item, 0, len(vault.Items[kind.Name]))
+
+		for _, item := range vault.Items[kind.Name] {
+			mapped := kind.New()
+			*mapped.Header().Id = *item.Header().Id
+			*mapped.Header().Version = *item.Header().Version
+
+			for _, f := range kind.Fields {
+				// a file has no content in the vault and a file uploaded before the shared chunks has no manifest,
+				// the chunks are encrypted with the file key or the content key, so only the keys are encrypted again
+				if value := f.Value(item); value != "" || !f.Optional {
+					f.SetValue(mapped, apply(value))
+				}
+			}
+
+			h, mh := item.Header(), mapped.Header()
+			*mh.Tags, *mh.SecretTags = *h.Tags, *h.SecretTags
+			if *h.SecretTags {
+				*mh.Tags = apply(*h.Tags)
+			}
+			if *h.Custom != "" {
+				*mh.Custom = apply(*h.Custom)
+			}
+
+			items = append(items, mapped)
+		}
+
+		res.Items[kind.Name] = items
+	}
+
+	return &res, err
+}
@@ -0,0 +1,148 @@
+package dialog
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/EgorKo25/GophKeeper/internal/client"
+	"github.com/EgorKo25/GophKeeper/internal/storage"
+	"github.com/EgorKo25/GophKeeper/pkg/mycrypto"
+)
+
+// testParams are cheap key derivation parameters for tests
+var testParams = &mycrypto.KeyParams{
+	Salt:    []byte("0123456789abcdef"),
+	Time:    1,
+	Memory:  1024,
+	Threads: 1,
+}
+
+// testCrypto derives a vault key for tests
+func testCrypto(t *testing.T, secret string) *mycrypto.Crypto {
+	e, err := mycrypto.NewCrypto(secret, testParams)
+	require.NoError(t, err)
+
+	return e
+}
+
+// sealed encrypts the value
+func sealed(t *testing.T, e *mycrypto.Crypto, value string) string {
+	res, err := e.Encrypt(value)
+	require.NoError(t, err)
+
+	return res
+}
+
+func TestCurrentKey(t *testing.T) {
+	e := testCrypto(t, "old-secret")
+
+	check, err := e.Verifier()
+	require.NoError(t, err)
+
+	meta := &storage.KeyMeta{Salt: testParams.Salt, Time: testParams.Time, Memory: testParams.Memory,
+		Threads: testParams.Threads, Check: check}
+
+	_, err = currentKey("old-secret", meta)
+	assert.NoError(t, err)
+
+	_, err = currentKey("wrong", meta)
+	assert.ErrorIs(t, err, mycrypto.ErrWrongPassword)
+
+	_, err = currentKey("old-secret", nil)
+	assert.Error(t, err)
+}
+
+func TestMapVault(t *testing.T) {
+	old, e := testCrypto(t, "old-secret"), testCrypto(t, "new-secret")
+
+	vault := &storage.UserDate{Items: storage.Items{
+		storage.PasswordKind.Name: {
+			&storage.Password{Id: "1", Version: 2, Service: sealed(t, old, "Yandex"),
+				Login: sealed(t, old, "me"), Password: sealed(t, old, "secret"),
+				Tags: sealed(t, old, "work, chat"), SecretTags: true},
+			// a plain tag may look like a ciphertext
+			&storage.Password{Id: "2", Version: 1, Service: sealed(t, old, "Bank"),
+				Login: sealed(t, old, "me"), Password: sealed(t, old, "secret"),
+				Tags: "$money, bank"},
+		},
+	}}
+
+	plain, err := mapVault(vault, old.Decrypt)
+	require.NoError(t, err)
+
+	first := plain.Items[storage.PasswordKind.Name][0].(*storage.Password)
+	assert.Equal(t, "Yandex", first.Service)
+	assert.Equal(t, "work, chat", first.Tags)
+	assert.True(t, first.SecretTags)
+	assert.Equal(t, "$money, bank", plain.Items[storage.PasswordKind.Name][1].(*storage.Password).Tags)
+
+	rotated, err := mapVault(plain, e.Encrypt)
+	require.NoError(t, err)
+
+	indexVault(e, rotated, plain)
+
+	check, err := e.Verifier()
+	require.NoError(t, err)
+	rotated.KeyMeta = &storage.KeyMeta{Check: check}
+
+	require.NoError(t, verifyVault(e, rotated, plain))
+
+	items := rotated.Items[storage.PasswordKind.Name]
+	service, err := e.Decrypt(items[0].(*storage.Password).Service)
+	require.NoError(t, err)
+	assert.Equal(t, "Yandex", service)
+	assert.Equal(t, "$money, bank", items[1].(*storage.Password).Tags)
+	assert.Equal(t, searchIndex(e, "Yandex", []string{"work", "chat"}), *items[0].Header().Index)
+	assert.Equal(t, searchIndex(e, "Bank", []string{"$money", "bank"}), *items[1].Header().Index)
+}
+
+func TestRotateKey_Unsent(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	var paths []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+
+		switch r.URL.Path {
+		case "/user/update":
+			w.WriteHeader(http.StatusBadRequest)
+		case "/user/read":
+			w.Header().Set("Data-Type", "vault")
+			_ = json.NewEncoder(w).Encode(storage.UserDate{Items: storage.Items{}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	d := &Manager{e: testCrypto(t, "secret"), c: client.NewClient(server.URL, "laptop")}
+
+	var err error
+	d.store, err = d.c.UseCache("testuser")
+	require.NoError(t, err)
+	require.NoError(t, d.store.Unlock(d.e))
+
+	body, err := json.Marshal(&storage.Password{Id: "p1", Service: sealed(t, d.e, "Yandex"), Version: 1})
+	require.NoError(t, err)
+	require.NoError(t, d.store.Enqueue(client.Pending{Path: "/user/update", DataType: storage.PasswordKind.Name,
+		Version: `"1"`, Body: body}))
+
+	e := d.e
+
+	out := captureStdout(t, func() {
+		require.NoError(t, d.RotateKey())
+	})
+
+	// the change is sent before the vault is read, the refused one stays with the old key
+	assert.Contains(t, out, "Неотправленных изменений: 1")
+	assert.Equal(t, []string{"/user/update", "/user/read"}, paths)
+	assert.Len(t, d.store.Rejected(), 1)
+	assert.Same(t, e, d.e)
+}
@@ -0,0 +1,142 @@
+package dialog
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/EgorKo25/GophKeeper/internal/storage"
+	"github.com/EgorKo25/GophKeeper/pkg/blindindex"
+	"github.com/EgorKo25/GophKeeper/pkg/mycrypto"
+
+	"github.com/manifoldco/promptui"
+)
+
+// searchIndex returns the blind index of the plain name and tags of an item.
+// The hashes are sorted, so their order doesn't tell the prefixes of a word from each other
+func searchIndex(e *mycrypto.Crypto, name string, tags []string) string {
+
+	tokens := blindindex.Tokens(append([]string{name}, tags...)...)
+
+	blinded := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		blinded = append(blinded, e.BlindIndex(token))
+	}
+	sort.Strings(blinded)
+
+	return strings.Join(blinded, " ")
+}
+
+// indexItem sets the blind index of the item made from its name and tags
+func (d *Manager) indexItem(item storage.Item) {
+
+	name, _ := d.e.Decrypt(item.Kind().Search().Value(item))
+
+	*item.Header().Index = searchIndex(d.e, name, d.itemTags(item))
+}
+
+// Find searches the items by the words of their names and tags, the words may be incomplete or mistyped.
+// The query is sent as the blinded tokens, the server sees neither the words nor the names
+func (d *Manager) Find() (err error) {
+
+	var code int
+	var tmp any
+
+	d.buildIndex()
+
+	tokens := blindindex.Query(d.myPrompt("Поиск"))
+	if len(tokens) == 0 {
+		fmt.Println(myStyler("Пустой запрос"))
+		return nil
+	}
+
+	code, tmp, d.cookie, err = d.c.Get(d.cookie, d.findPath(tokens))
+	if code != 200 {
+		return d.listFailed(code, err)
+	}
+
+	found := tmp.(storage.ItemList).Items
+	if len(found) == 0 {
+		fmt.Println(myStyler("Ничего не найдено"))
+		return nil
+	}
+
+	labels := make([]string, 0, len(found))
+	for _, item := range found {
+		label := d.metaLabel(item)
+		if tags := d.tags(item.Tags, item.SecretTags); len(tags) > 0 {
+			label += " [" + strings.Join(tags, ", ") + "]"
+		}
+		labels = append(labels, label)
+	}
+
+	prompt := promptui.Select{
+		Label: "Найденные записи",
+		Items: labels,
+		Size:  10,
+	}
+
+	i, _, err := prompt.Run()
+	if err != nil {
+		return err
+	}
+
+	if found[i].Type == storage.FolderKind.Name {
+		fmt.Println(myStyler("Папки открываются в разделе Folders"))
+		return nil
+	}
+
+	return d.openItem(found[i])
+}
+
+// findPath returns the path of the search by the blinded tokens of the query
+func (d *Manager) findPath(tokens []string) string {
+
+	query := url.Values{}
+	for _, token := range tokens {
+		query.Add("token", d.e.BlindIndex(token))
+	}
+
+	return "/user/find?" + query.Encode()
+}
+
+// buildIndex offers to index the items of the local copy added before the search index or on the older clients.
+// An item changed meanwhile on another device is left for the next time
+func (d *Manager) buildIndex() {
+
+	var missing []storage.Item
+	for _, items := range d.store.Vault().Items {
+		for _, item := range items {
+			if *item.Header().Index == "" {
+				missing = append(missing, item)
+			}
+		}
+	}
+
+	if len(missing) == 0 ||
+		d.myPrompt(fmt.Sprintf("Записей без поискового индекса: %d. Проиндексировать? (y/n)", len(missing))) != "y" {
+		return
+	}
+
+	indexed := 0
+	for _, item := range missing {
+		var code int
+		var err error
+
+		d.indexItem(item)
+
+		code, _, d.cookie, err = d.c.Send(item, item.Kind().Name, d.cookie, "/user/update")
+		if err != nil {
+			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
+			return
+		}
+		if code == 200 || code == 202 {
+			indexed++
+		}
+	}
+
+	fmt.Println(myStyler(fmt.Sprintf("Проиндексировано записей: %d из %d", indexed, len(missing))))
+
+	d.pull()
+}
@@ -0,0 +1,181 @@
+package dialog
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/EgorKo25/GophKeeper/internal/sshagent"
+	"github.com/EgorKo25/GophKeeper/internal/storage"
+)
+
+// errCertMismatch is returned when the certificate is issued for another key
+var errCertMismatch = errors.New("the certificate is issued for another key")
+
+// addSSHKey reads the private key from a file or the editor, the public key is derived from it
+func (d *Manager) addSSHKey() error {
+
+	values := map[string]string{"name": d.myPrompt("Название ключа")}
+
+	private, err := d.readText("Закрытый ключ")
+	if err == nil {
+		values["private_key"] = private
+		values["comment"] = d.myPrompt("Комментарий")
+
+		err = d.sshOptions(values, map[string]string{})
+	}
+	if err != nil {
+		fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
+		return nil
+	}
+
+	k := &storage.SSHKey{}
+
+	err = d.setValues(k, values)
+	if err != nil {
+		fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
+		return err
+	}
+
+	return d.sendItem(k)
+}
+
+// readText reads the text from a file or the editor
+func (d *Manager) readText(label string) (string, error) {
+
+	path := d.myPrompt(label + ": путь к файлу (пусто — ввести в редакторе)")
+	if path == "" {
+		return d.editText(label, "")
+	}
+
+	text, err := os.ReadFile(path)
+	return string(text), err
+}
+
+// sshOptions derives the public key from the private key of the values and asks the passphrase,
+// the certificate and the constraints of the key in the agent, current are the plain values of the edited key
+func (d *Manager) sshOptions(values, current map[string]string) error {
+
+	passphrase := ""
+
+	key, err := sshagent.ParsePrivateKey([]byte(values["private_key"]), nil)
+	if sshagent.IsProtected(err) {
+		passphrase = current["passphrase"]
+		if passphrase == "" {
+			passphrase = d.myPassword("Парольная фраза ключа")
+		}
+
+		key, err = sshagent.ParsePrivateKey([]byte(values["private_key"]), []byte(passphrase))
+	}
+	if err != nil {
+		return err
+	}
+
+	values["passphrase"] = passphrase
+
+	values["public_key"], err = sshagent.PublicKey(key)
+	if err != nil {
+		return err
+	}
+
+	values["certificate"] = current["certificate"]
+
+	label := "Путь к сертификату (пусто — без сертификата)"
+	if current["certificate"] != "" {
+		label = "Путь к сертификату (пусто — оставить текущий, «-» — удалить)"
+	}
+
+	switch path := d.myPrompt(label); path {
+	case "":
+	case "-":
+		values["certificate"] = ""
+	default:
+		text, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		values["certificate"] = strings.TrimSpace(string(text))
+	}
+
+	if values["certificate"] != "" {
+		cert, err := sshagent.ParseCertificate([]byte(values["certificate"]))
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(string(ssh.MarshalAuthorizedKey(cert.Key))) != values["public_key"] {
+			return errCertMismatch
+		}
+	}
+
+	values["confirm"] = d.myEdit("Подтверждать каждую подпись в агенте? (y/n)", current["confirm"])
+	if values["confirm"] != "y" {
+		values["confirm"] = ""
+	}
+
+	values["lifetime"] = strings.TrimSpace(
+		d.myEdit("Время жизни в агенте, например 8h (пусто — без ограничения)", current["lifetime"]))
+	if values["lifetime"] != "" {
+		_, err = time.ParseDuration(values["lifetime"])
+	}
+
+	return err
+}
+
+// editSSHKey derives the public key from the edited private key and lets the user change the options of the key
+func (d *Manager) editSSHKey(k *storage.SSHKey) error {
+
+	values := make(map[string]string)
+	current := make(map[string]string)
+
+	for _, f := range storage.SSHKeyKind.Fields {
+		value, _ := d.e.Decrypt(f.Value(k))
+		current[f.Name] = value
+	}
+
+	values["private_key"] = current["private_key"]
+
+	err := d.sshOptions(values, current)
+	if err != nil {
+		return err
+	}
+
+	delete(values, "private_key")
+
+	return d.setValues(k, values)
+}
+
+// showSSHKey prints the ssh key without the private key, it is served by the agent
+func (d *Manager) showSSHKey(k *storage.SSHKey) {
+
+	plain := make(map[string]string)
+	for _, f := range storage.SSHKeyKind.Fields {
+		plain[f.Name], _ = d.e.Decrypt(f.Value(k))
+	}
+
+	fmt.Printf("Название ключа: %s\nКомментарий: %s\nОткрытый ключ: %s\n",
+		plain["name"], plain["comment"], plain["public_key"])
+
+	if plain["passphrase"] != "" {
+		fmt.Println("Ключ защищён парольной фразой")
+	}
+
+	if cert, err := sshagent.ParseCertificate([]byte(plain["certificate"])); err == nil {
+		fmt.Printf("Сертификат: %s, принципалы %s\n", cert.KeyId, strings.Join(cert.ValidPrincipals, ", "))
+		if cert.ValidBefore != ssh.CertTimeInfinity {
+			fmt.Printf("Сертификат действует до %s\n", time.Unix(int64(cert.ValidBefore), 0).Format(time.DateTime))
+		}
+	}
+
+	if plain["confirm"] == "y" {
+		fmt.Println("Каждая подпись в агенте подтверждается")
+	}
+	if plain["lifetime"] != "" {
+		fmt.Println("Время жизни в агенте:", plain["lifetime"])
+	}
+
+	fmt.Println("Закрытый ключ не показывается, используйте агент: client agent")
+}
@@ -0,0 +1,54 @@
+package dialog
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/EgorKo25/GophKeeper/internal/client"
+	"github.com/EgorKo25/GophKeeper/internal/storage"
+)
+
+// Sync pulls the changes of the vault made since the last sync, e.g. on other devices
+func (d *Manager) Sync() (err error) {
+
+	var code int
+	var delta *storage.SyncDelta
+
+	code, delta, d.cookie, err = d.syncer.Pull(d.cookie)
+	if code != 200 {
+		if errors.Is(err, client.ErrOffline) {
+			fmt.Println(myStyler("Нет связи с сервером, используется локальная копия"))
+			return nil
+		}
+		if err != nil {
+			fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
+			return
+		}
+		if code == 401 {
+			fmt.Println(myStyler(myStyler("Сессия истекла, войдите снова")))
+			return d.SelectAuth()
+		}
+
+		fmt.Println(myStyler("Не удалось синхронизировать хранилище"))
+		return
+	}
+
+	vault := d.store.Vault()
+
+	fmt.Printf("Изменено записей: %d\nУдалено записей: %d\nВсего записей: %d\n",
+		countItems(delta.Items), len(delta.Deleted), countItems(vault.Items))
+
+	fmt.Println(myStyler("Готово"))
+	return nil
+}
+
+// countItems returns the number of the items of all kinds
+func countItems(items storage.Items) int {
+
+	var n int
+	for _, list := range items {
+		n += len(list)
+	}
+
+	return n
+}
@@ -0,0 +1,532 @@
+package dialog
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+
+	"github.com/EgorKo25/GophKeeper/internal/client"
+	"github.com/EgorKo25/GophKeeper/internal/storage"
+	"github.com/EgorKo25/GophKeeper/pkg/mycrypto"
+)
+
+var (
+	errTransfer    = errors.New("file transfer failed")
+	errFileChanged = errors.New("the file has changed during the upload")
+	errManifest    = errors.New("the chunks don't match the file")
+)
+
+// completeAttempts limits the completions of an upload that lacks chunks released meanwhile
+const completeAttempts = 3
+
+// upload sends the file at path to the server in encrypted chunks and returns the id of the upload.
+// The upload replaces the content of the item when its id is given.
+// The chunks the user has already stored aren't sent again, neither are the chunks
+// of an interrupted upload of the same file, it is resumed
+func (d *Manager) upload(path, title, item string) (id string, code int, err error) {
+
+	var tmp any
+
+	cc, code, err := d.content()
+	if cc == nil {
+		return "", code, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", 0, err
+	}
+
+	size := info.Size()
+	chunks := int((size + client.ChunkSize - 1) / client.ChunkSize)
+	if chunks == 0 {
+		chunks = 1
+	}
+
+	ids, err := chunkIDs(f, size, chunks, cc)
+	if err != nil {
+		return "", 0, err
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", 0, err
+	}
+
+	fingerprint, err := d.e.EncryptDeterministic(abs + "|" + strconv.FormatInt(size, 10) + "|" +
+		strconv.FormatInt(info.ModTime().UnixNano(), 10))
+	if err != nil {
+		return "", 0, err
+	}
+
+	code, tmp, d.cookie, err = d.c.Get(d.cookie, "/user/uploads")
+	if code != 200 {
+		return "", code, err
+	}
+
+	uploads, _ := tmp.([]storage.Upload)
+
+	upload := resumable(uploads, fingerprint, item, ids)
+	if upload == nil {
+		manifest, err := d.e.Encrypt(mycrypto.Manifest(ids))
+		if err != nil {
+			return "", 0, err
+		}
+
+		code, tmp, d.cookie, err = d.c.Send(&storage.Upload{
+			ItemId:      item,
+			Title:       title,
+			Fingerprint: fingerprint,
+			Manifest:    manifest,
+			ChunkIds:    ids,
+			Size:        size + int64(chunks)*mycrypto.ChunkOverhead,
+			Chunks:      chunks,
+		}, "upload", d.cookie, "/user/upload")
+		if code != 200 {
+			return "", code, err
+		}
+
+		created, ok := tmp.(storage.Upload)
+		if !ok {
+			return "", 0, errTransfer
+		}
+		upload = &created
+	} else {
+		fmt.Println(myStyler("Продолжается прерванная загрузка"))
+	}
+
+	code, err = d.sendChunks(f, size, upload, cc)
+	if code != 200 {
+		return "", code, err
+	}
+
+	return upload.Id, 200, nil
+}
+
+// complete completes the upload of the file at path, the replaced file is guarded by the version.
+// The chunks the server has lost meanwhile are sent again
+func (d *Manager) complete(path, id string, version int64) (code int, res any, err error) {
+
+	for attempt := 0; ; attempt++ {
+		code, res, d.cookie, err = d.c.CompleteUpload(d.cookie, id, version)
+		if code != 422 || attempt == completeAttempts {
+			return code, res, err
+		}
+
+		upload, ok := res.(storage.Upload)
+		if !ok {
+			return 0, nil, errTransfer
+		}
+
+		cc, code, err := d.content()
+		if cc == nil {
+			return code, nil, err
+		}
+
+		code, err = d.resend(path, &upload, cc)
+		if code != 200 {
+			return code, nil, err
+		}
+	}
+}
+
+// resend sends the chunks of the file at path the server lacks
+func (d *Manager) resend(path string, upload *storage.Upload, cc *mycrypto.ContentCrypto) (int, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	return d.sendChunks(f, info.Size(), upload, cc)
+}
+
+// sendChunks encrypts and sends the chunks of the file the server hasn't received.
+// A chunk that doesn't match its id means the file has changed since the upload started
+func (d *Manager) sendChunks(f *os.File, size int64, upload *storage.Upload, cc *mycrypto.ContentCrypto) (code int, err error) {
+
+	received := make(map[int]bool, len(upload.Received))
+	for _, n := range upload.Received {
+		received[n] = true
+	}
+
+	buf := make([]byte, client.ChunkSize)
+
+	for n := 0; n < upload.Chunks; n++ {
+		if received[n] {
+			continue
+		}
+
+		plain, err := readChunk(f, size, n, buf)
+		if err != nil {
+			return 0, err
+		}
+
+		if n >= len(upload.ChunkIds) || cc.ChunkID(plain) != upload.ChunkIds[n] {
+			fmt.Println()
+			return 0, errFileChanged
+		}
+
+		sealed, err := cc.EncryptChunk(plain, upload.ChunkIds[n])
+		if err != nil {
+			return 0, err
+		}
+
+		code, d.cookie, err = d.c.PutChunk(d.cookie, upload.Id, n, sealed)
+		if code != 200 {
+			fmt.Println()
+			return code, err
+		}
+
+		progress("Загружено", n+1, upload.Chunks)
+	}
+	fmt.Println()
+
+	return 200, nil
+}
+
+// resumable finds the unfinished upload of the same file to the same item
+func resumable(uploads []storage.Upload, fingerprint, item string, ids []string) *storage.Upload {
+
+	for i := range uploads {
+		u := &uploads[i]
+		if u.Fingerprint == fingerprint && u.ItemId == item && reflect.DeepEqual([]string(u.ChunkIds), ids) {
+			return u
+		}
+	}
+
+	return nil
+}
+
+// content returns the crypto of the file chunks of the user.
+// The content key is created by the first device that uploads a file and kept with the key metadata,
+// when two devices create it at once the one stored first is used by both
+func (d *Manager) content() (*mycrypto.ContentCrypto, int, error) {
+
+	if d.cc != nil {
+		return d.cc, 200, nil
+	}
+
+	meta, code, err := d.readKeyMeta()
+	if meta == nil {
+		return nil, code, err
+	}
+
+	if meta.ContentKey == "" {
+		key, err := mycrypto.NewFileKey()
+		if err != nil {
+			return nil, 0, err
+		}
+
+		meta.ContentKey, err = d.e.Encrypt(hex.EncodeToString(key))
+		if err != nil {
+			return nil, 0, err
+		}
+
+		code, _, d.cookie, err = d.c.Send(meta, "keymeta", d.cookie, "/user/update")
+		if code != 200 {
+			return nil, code, err
+		}
+
+		meta, code, err = d.readKeyMeta()
+		if meta == nil {
+			return nil, code, err
+		}
+	}
+
+	key, err := d.fileKey(meta.ContentKey)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	d.cc, err = mycrypto.NewContentCrypto(key)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	d.store.SetKeyMeta(meta)
+
+	return d.cc, 200, nil
+}
+
+// readKeyMeta reads the key metadata of the user from the server
+func (d *Manager) readKeyMeta() (_ *storage.KeyMeta, code int, err error) {
+
+	var tmp any
+
+	code, tmp, d.cookie, err = d.c.Send(&storage.KeyMeta{}, "keymeta", d.cookie, "/user/read")
+	if code != 200 {
+		return nil, code, err
+	}
+
+	meta, ok := tmp.(storage.KeyMeta)
+	if !ok {
+		return nil, 0, errTransfer
+	}
+
+	return &meta, 200, nil
+}
+
+// chunkIDs returns the ids of the chunks of the file in order
+func chunkIDs(f *os.File, size int64, chunks int, cc *mycrypto.ContentCrypto) ([]string, error) {
+
+	ids := make([]string, 0, chunks)
+	buf := make([]byte, client.ChunkSize)
+
+	for n := 0; n < chunks; n++ {
+		plain, err := readChunk(f, size, n, buf)
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, cc.ChunkID(plain))
+	}
+
+	return ids, nil
+}
+
+// readChunk reads the n-th plain chunk of the file into buf
+func readChunk(f *os.File, size int64, n int, buf []byte) ([]byte, error) {
+
+	offset := int64(n) * client.ChunkSize
+	plain := buf[:min64(client.ChunkSize, size-offset)]
+
+	_, err := io.ReadFull(io.NewSectionReader(f, offset, int64(len(plain))), plain)
+	if err != nil {
+		return nil, err
+	}
+
+	return plain, nil
+}
+
+// download saves the file stored in chunks to path.
+// The chunks are written to a partial file first, an interrupted download continues from it
+func (d *Manager) download(bin *storage.BinaryData, path string) (code int, err error) {
+
+	decrypt, code, err := d.decrypter(bin)
+	if decrypt == nil {
+		return code, err
+	}
+
+	// the partial file belongs to the version of the item, another version is downloaded anew
+	part := path + "." + strconv.FormatInt(bin.Version, 10) + ".part"
+
+	f, err := os.OpenFile(part, os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	// only the complete chunks are kept, the only chunk of a moved file may be of any size
+	start := int(info.Size() / client.ChunkSize)
+	if start > bin.Chunks || movedFile(bin) {
+		start = 0
+	}
+
+	err = f.Truncate(int64(start) * client.ChunkSize)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+
+	for n := start; n < bin.Chunks; n++ {
+		var sealed []byte
+
+		code, sealed, d.cookie, err = d.c.GetChunk(d.cookie, bin.Id, n)
+		if code != 200 {
+			fmt.Println()
+			return code, err
+		}
+
+		plain, err := decrypt(sealed, n)
+		if err != nil {
+			return 0, err
+		}
+
+		_, err = f.Write(plain)
+		if err != nil {
+			return 0, err
+		}
+
+		progress("Скачано", n+1, bin.Chunks)
+	}
+	fmt.Println()
+
+	err = f.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	return 200, os.Rename(part, path)
+}
+
+// decrypter returns the function decrypting the n-th chunk of the file.
+// The ids of the shared chunks are checked against the manifest of the file,
+// so the server can't reorder, drop or substitute the chunks
+func (d *Manager) decrypter(bin *storage.BinaryData) (_ func(sealed []byte, n int) ([]byte, error), code int, err error) {
+
+	if movedFile(bin) {
+		return func(sealed []byte, n int) ([]byte, error) {
+			plain, err := d.e.Decrypt(string(sealed))
+			return []byte(plain), err
+		}, 200, nil
+	}
+
+	if bin.Manifest == "" {
+		key, err := d.fileKey(bin.Key)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		fc, err := mycrypto.NewFileCrypto(key)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		return func(sealed []byte, n int) ([]byte, error) {
+			return fc.DecryptChunk(sealed, n, bin.Chunks)
+		}, 200, nil
+	}
+
+	cc, code, err := d.content()
+	if cc == nil {
+		return nil, code, err
+	}
+
+	var tmp any
+
+	code, tmp, d.cookie, err = d.c.Get(d.cookie, "/user/download/"+bin.Id)
+	if code != 200 {
+		return nil, code, err
+	}
+
+	ids, _ := tmp.([]string)
+
+	manifest, err := d.e.Decrypt(bin.Manifest)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if len(ids) != bin.Chunks || mycrypto.Manifest(ids) != manifest {
+		return nil, 0, errManifest
+	}
+
+	return func(sealed []byte, n int) ([]byte, error) {
+		return cc.DecryptChunk(sealed, ids[n])
+	}, 200, nil
+}
+
+// fileKey decrypts the key of the file with the vault key
+func (d *Manager) fileKey(wrapped string) ([]byte, error) {
+
+	key, err := d.e.Decrypt(wrapped)
+	if err != nil {
+		return nil, err
+	}
+
+	return hex.DecodeString(key)
+}
+
+// transferFailed prints why the file transfer has failed
+func (d *Manager) transferFailed(code int, err error) error {
+	switch {
+	case errors.Is(err, client.ErrOffline):
+		fmt.Println(myStyler("Нет связи с сервером, файлы передаются только при подключении"))
+		return nil
+	case err != nil:
+		fmt.Println(myStyler(myStyler("Что-то пошло не так: ")), err)
+		return err
+	case code == 401:
+		fmt.Println(myStyler(myStyler("Сессия истекла, войдите снова")))
+		return d.SelectAuth()
+	case code == 413:
+		fmt.Println(myStyler("Файл слишком большой"))
+		return nil
+	case code == 404:
+		fmt.Println(myStyler("Нет такого файла"))
+		return nil
+	}
+
+	fmt.Println(myStyler("Что-то пошло не так"))
+	return nil
+}
+
+// Usage prints the size of the files of the user and how much of it the shared chunks save
+func (d *Manager) Usage() (err error) {
+
+	var code int
+	var tmp any
+
+	code, tmp, d.cookie, err = d.c.Get(d.cookie, "/user/usage")
+	if code != 200 {
+		return d.transferFailed(code, err)
+	}
+
+	usage, ok := tmp.(storage.Usage)
+	if !ok {
+		return d.transferFailed(0, errTransfer)
+	}
+
+	fmt.Printf("Файлов: %d\nРазмер файлов: %d байт\nХранится: %d байт\n", usage.Files, usage.Logical, usage.Physical)
+	if usage.Logical > usage.Physical {
+		fmt.Printf("Сэкономлено на повторяющихся частях: %d байт\n", usage.Logical-usage.Physical)
+	}
+
+	return nil
+}
+
+// plainSize returns the size of the file stored in chunks before the encryption,
+// the size of a moved file is the size of its encrypted content
+func plainSize(bin *storage.BinaryData) int64 {
+	if movedFile(bin) {
+		return bin.Size
+	}
+
+	return bin.Size - int64(bin.Chunks)*mycrypto.ChunkOverhead
+}
+
+// movedFile reports whether the file was stored in the vault before the blob store,
+// the server has moved its content encrypted with the vault key into one chunk
+func movedFile(bin *storage.BinaryData) bool {
+	return bin.Manifest == "" && bin.Key == ""
+}
+
+// progress prints the number of transferred chunks in place
+func progress(label string, done, total int) {
+	fmt.Printf("\r%s: %d%%", label, done*100/total)
+}
+
+// min64 returns the smaller of a and b
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,40 @@
+package dialog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/EgorKo25/GophKeeper/internal/storage"
+	"github.com/EgorKo25/GophKeeper/pkg/mycrypto"
+)
+
+func TestMovedFiles(t *testing.T) {
+	moved := &storage.BinaryData{Id: "moved", Chunks: 1, Size: 40}
+	keyed := &storage.BinaryData{Id: "keyed", Chunks: 2, Key: "wrapped"}
+	shared := &storage.BinaryData{Id: "shared", Chunks: 2, Manifest: "manifest"}
+
+	vault := &storage.UserDate{Items: storage.Items{storage.FileKind.Name: {moved, keyed, shared}}}
+
+	assert.Equal(t, []*storage.BinaryData{moved}, movedFiles(vault))
+
+	// the content of a moved file is sealed as a whole
+	assert.Equal(t, int64(40), plainSize(moved))
+	assert.Equal(t, 2*int64(-mycrypto.ChunkOverhead), plainSize(keyed))
+}
+
+func TestDecrypter_MovedFile(t *testing.T) {
+	d := &Manager{e: testCrypto(t, "secret")}
+
+	decrypt, code, err := d.decrypter(&storage.BinaryData{Id: "moved", Chunks: 1})
+	require.NoError(t, err)
+	require.Equal(t, 200, code)
+
+	plain, err := decrypt([]byte(sealed(t, d.e, "content")), 0)
+	require.NoError(t, err)
+	assert.Equal(t, "content", string(plain))
+
+	_, err = decrypt([]byte(sealed(t, testCrypto(t, "other"), "content")), 0)
+	assert.Error(t, err)
+}
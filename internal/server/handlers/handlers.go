@@ -8,9 +8,14 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/EgorKo25/GophKeeper/pkg/auth"
+	"github.com/EgorKo25/GophKeeper/pkg/blindindex"
 
+	"github.com/EgorKo25/GophKeeper/internal/blob"
 	"github.com/EgorKo25/GophKeeper/internal/database"
 	"github.com/EgorKo25/GophKeeper/internal/storage"
 )
@@ -18,19 +23,40 @@ import (
 var (
 	cantRead      = "can't read request body: %s"
 	cantUnmarshal = "can't unmarshal json obj: %s"
+
+	uuidPattern   = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	devicePattern = regexp.MustCompile(`^[0-9A-Za-z._-]{0,64}$`)
+	chunkPattern  = regexp.MustCompile(`^[0-9a-f]{64}$`)
+	tokenPattern  = regexp.MustCompile(`^[0-9A-Za-z_-]{22}$`)
+)
+
+// DeviceHeader is a header with the id of the client device, it is stored as the author of the changes
+const DeviceHeader = "Device-Id"
+
+// Page size of the item list
+const (
+	defaultLimit = 50
+	maxLimit     = 200
 )
 
 // Handler handler struct
 type Handler struct {
-	Db database.Database
-	Au *auth.Auth
+	Db    database.Database
+	Au    *auth.Auth
+	Blobs blob.BlobStore
+	// MaxBlobSize and MaxChunkSize limit the uploaded files and their chunks
+	MaxBlobSize  int64
+	MaxChunkSize int64
 }
 
 // NewHandler Handler constructor
-func NewHandler(db *database.ManagerDB, au *auth.Auth) *Handler {
+func NewHandler(db *database.ManagerDB, au *auth.Auth, blobs blob.BlobStore, maxBlobSize, maxChunkSize int64) *Handler {
 	return &Handler{
-		Db: db,
-		Au: au,
+		Db:           db,
+		Au:           au,
+		Blobs:        blobs,
+		MaxBlobSize:  maxBlobSize,
+		MaxChunkSize: maxChunkSize,
 	}
 }
 
@@ -38,7 +64,6 @@ func NewHandler(db *database.ManagerDB, au *auth.Auth) *Handler {
 func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 
 	var user storage.User
-	var cookies []*http.Cookie
 
 	ctx := context.Background()
 
@@ -61,30 +86,34 @@ func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = h.Db.Read(ctx, &user, user.Login)
+	err = h.Db.Add(ctx, &user, user.Login)
+	if errors.Is(err, database.ErrUserExists) {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		log.Printf("error: %s", err)
+		log.Printf("add user error: %s", err)
 		return
 	}
 
-	err = h.Db.Add(ctx, &user, user.Login)
+	cookies, session, err := h.Au.GenerateTokensAndCreateCookie(&user, "")
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		log.Printf("add user error: %s", err)
+		log.Printf("create cookie error: %s", err)
 		return
 	}
 
-	cookies, err = h.Au.GenerateTokensAndCreateCookie(&user)
+	err = h.Db.AddSession(ctx, session)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		log.Printf("create cookie error: %s", err)
+		log.Printf("add session error: %s", err)
 		return
 	}
 
-	http.SetCookie(w, cookies[0])
-	http.SetCookie(w, cookies[1])
-	http.SetCookie(w, cookies[2])
+	for _, cookie := range cookies {
+		http.SetCookie(w, cookie)
+	}
 
 	w.WriteHeader(http.StatusOK)
 }
@@ -92,7 +121,6 @@ func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 // Login authorize user
 func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 	var user storage.User
-	var cookies []*http.Cookie
 
 	ctx := context.Background()
 
@@ -111,6 +139,13 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	isUserExist, err := h.Db.CheckUser(ctx, &user)
+	if err == nil && !isUserExist && user.LegacyLogin != "" {
+		isUserExist, err = h.upgradeUser(ctx, &user)
+	}
+	if errors.Is(err, database.ErrUserExists) {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		log.Printf("%s", err)
@@ -122,36 +157,154 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cookies, err = h.Au.GenerateTokensAndCreateCookie(&user)
+	cookies, session, err := h.Au.GenerateTokensAndCreateCookie(&user, "")
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		log.Printf("create cookie error: %s", err)
 		return
 	}
 
-	log.Println(cookies)
-	http.SetCookie(w, cookies[0])
-	http.SetCookie(w, cookies[1])
-	http.SetCookie(w, cookies[2])
+	err = h.Db.AddSession(ctx, session)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("add session error: %s", err)
+		return
+	}
+
+	for _, cookie := range cookies {
+		http.SetCookie(w, cookie)
+	}
 
 	w.WriteHeader(http.StatusOK)
 }
 
-// Add user data to database
-func (h *Handler) Add(w http.ResponseWriter, r *http.Request) {
+// upgradeUser checks the credentials encrypted like the old DES clients sent them,
+// the account they registered is renamed to the plain login and gets the hash of the plain password.
+// ErrUserExists is returned when the plain login belongs to another account
+func (h *Handler) upgradeUser(ctx context.Context, user *storage.User) (bool, error) {
+
+	ok, err := h.Db.CheckUser(ctx, &storage.User{Login: user.LegacyLogin, Password: user.LegacyPassword})
+	if err != nil || !ok {
+		return false, err
+	}
+
+	err = h.Db.UpgradeUser(ctx, user.LegacyLogin, user)
+	if err != nil {
+		return false, err
+	}
+
+	log.Printf("account of an old client upgraded to %s", user.Login)
+
+	return true, nil
+}
+
+// Refresh issues a new pair of tokens by the refresh token.
+// Every refresh token can be used only once
+func (h *Handler) Refresh(w http.ResponseWriter, r *http.Request) {
 
 	ctx := context.Background()
 
-	body, err := io.ReadAll(r.Body)
+	refresh, err := r.Cookie(auth.RefreshCookie)
 	if err != nil {
-		log.Printf(cantRead, err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	cookies, old, session, err := h.Au.RefreshTokens(refresh.Value)
+	if err != nil {
+		log.Printf("refresh token error: %s", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	err = h.Db.RotateSession(ctx, old.TokenHash, session)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrSessionReused):
+			log.Printf("refresh token reused, session family %s of %s revoked", old.Family, old.LoginOwner)
+		case errors.Is(err, database.ErrNotFound):
+		default:
+			log.Printf("rotate session error: %s", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		for _, cookie := range h.Au.ClearCookies() {
+			http.SetCookie(w, cookie)
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	for _, cookie := range cookies {
+		http.SetCookie(w, cookie)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// Logout revokes the current session
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	h.logout(w, r, false)
+}
+
+// LogoutAll revokes every session of the user on all devices
+func (h *Handler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	h.logout(w, r, true)
+}
+
+// logout revokes the session family of the refresh token or all sessions of its owner
+func (h *Handler) logout(w http.ResponseWriter, r *http.Request, all bool) {
+
+	ctx := context.Background()
+
+	refresh, err := r.Cookie(auth.RefreshCookie)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	session, err := h.Au.ParseRefreshToken(refresh.Value)
+	if err != nil {
+		log.Printf("parse token error: %s", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	family := session.Family
+	if all {
+		family = ""
+	}
+
+	err = h.Db.RevokeSessions(ctx, session.LoginOwner, family)
+	if err != nil {
+		log.Printf("revoke sessions error: %s", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	cook, err := r.Cookie("User")
+	for _, cookie := range h.Au.ClearCookies() {
+		http.SetCookie(w, cookie)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// Add user data to database
+func (h *Handler) Add(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.Background()
+
+	login, ok := auth.FromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		log.Printf("%s", err)
+		log.Printf(cantRead, err)
+		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
@@ -168,39 +321,55 @@ func (h *Handler) Add(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.Db.Add(ctx, data, cook.Value)
+	if !uploaded(w, data) || !modifiedBy(w, r, data) {
+		return
+	}
+
+	err = h.Db.Add(ctx, data, login)
 	if err != nil {
 		log.Printf("%s", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	res, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("error: %s", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	setETag(w, data)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Data-Type", resType)
+	_, _ = w.Write(res)
 }
 
-// anyTypeUnmarshal is a Unmarshaler for my custom type
+// anyTypeUnmarshal is a Unmarshaler for my custom type, the vault items are read as their registered kind
 func anyTypeUnmarshal(t string, body []byte) (any, error) {
-	switch t {
-	case "card":
-		res := storage.Card{}
-		err := json.Unmarshal(body, &res)
+
+	if kind, ok := storage.KindOf(t); ok {
+		res := kind.New()
+		err := json.Unmarshal(body, res)
 		if err != nil {
 			log.Printf(cantUnmarshal, err)
 			return nil, err
 		}
-		return &res, nil
-	case "password":
-		res := storage.Password{}
+		return res, nil
+	}
+
+	switch t {
+	case "keymeta":
+		res := storage.KeyMeta{}
 		err := json.Unmarshal(body, &res)
 		if err != nil {
 			log.Printf(cantUnmarshal, err)
 			return nil, err
 		}
 		return &res, nil
-	case "bin":
-		res := storage.BinaryData{}
+	case "vault":
+		res := storage.UserDate{}
 		err := json.Unmarshal(body, &res)
-		log.Println(res)
 		if err != nil {
 			log.Printf(cantUnmarshal, err)
 			return nil, err
@@ -217,6 +386,12 @@ func (h *Handler) Read(w http.ResponseWriter, r *http.Request) {
 
 	ctx := context.Background()
 
+	login, ok := auth.FromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -231,15 +406,22 @@ func (h *Handler) Read(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cook, _ := r.Cookie("User")
+	if !hasID(w, data) {
+		return
+	}
 
-	res, err := h.Db.Read(ctx, data, cook.Value)
+	res, err := h.Db.Read(ctx, data, login)
 	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
 		log.Println(err)
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
+	setETag(w, data)
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Data-Type", resType)
 	_, _ = w.Write(res)
@@ -251,6 +433,12 @@ func (h *Handler) Update(w http.ResponseWriter, r *http.Request) {
 
 	ctx := context.Background()
 
+	login, ok := auth.FromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		log.Printf(cantRead, err)
@@ -271,12 +459,17 @@ func (h *Handler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cook, _ := r.Cookie("User")
+	if !hasID(w, data) || !precondition(w, r, data) || !modifiedBy(w, r, data) {
+		return
+	}
 
-	err = h.Db.Update(ctx, data, cook.Value)
+	err = h.Db.Update(ctx, data, login)
+	if errors.Is(err, database.ErrConflict) {
+		h.conflict(ctx, w, data, login)
+		return
+	}
 	if err != nil {
-		log.Printf("error: %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeStoreError(w, err)
 		return
 	}
 
@@ -287,6 +480,7 @@ func (h *Handler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setETag(w, data)
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Data-Type", resType)
 	_, _ = w.Write(res)
@@ -298,6 +492,12 @@ func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
 
 	ctx := context.Background()
 
+	login, ok := auth.FromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -311,19 +511,453 @@ func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if resType == "user" {
+		h.deleteUser(ctx, w, body, login)
+		return
+	}
+
 	data, err := anyTypeUnmarshal(resType, body)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	cook, _ := r.Cookie("User")
+	if !hasID(w, data) || !precondition(w, r, data) {
+		return
+	}
+
+	deleted := h.fileBlob(ctx, data, login)
+
+	err = h.Db.Delete(ctx, data, login)
+	if errors.Is(err, database.ErrConflict) {
+		h.conflict(ctx, w, data, login)
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	h.removeBlob(deleted)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// deleteUser deletes the account of the session, the password of the account from the body is required.
+// The login from the body is ignored
+func (h *Handler) deleteUser(ctx context.Context, w http.ResponseWriter, body []byte, login string) {
+
+	var user storage.User
 
-	err = h.Db.Delete(ctx, data, cook.Value)
+	err := json.Unmarshal(body, &user)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		log.Printf(cantUnmarshal, err)
+		return
+	}
+
+	ok, err := h.Db.CheckUser(ctx, &storage.User{Login: login, Password: user.Password})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("%s", err)
+		return
+	}
+
+	if !ok {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	err = h.Db.Delete(ctx, &storage.User{}, login)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// Move moves the item or the folder of the Data-Type into the folder of its folder_id,
+// an empty folder_id moves it to the top level
+func (h *Handler) Move(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.Background()
+
+	login, ok := auth.FromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf(cantRead, err)
+		return
+	}
+
+	resType := r.Header.Get("Data-Type")
+	data, err := anyTypeUnmarshal(resType, body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	item, ok := data.(storage.Item)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	folder := *item.Header().Folder
+	if folder != "" && !uuidPattern.MatchString(folder) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if !hasID(w, data) || !modifiedBy(w, r, data) {
+		return
+	}
+
+	err = h.Db.Move(ctx, data, login)
+	if err != nil {
+		writeStoreError(w, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 }
+
+// Search lists all user items of the kind, the response is a list of the items.
+// The names are encrypted with random nonces and never compared, a filter by the name is refused:
+// the items are found by the words of their names in Find
+func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.Background()
+
+	login, ok := auth.FromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf(cantRead, err)
+		return
+	}
+
+	resType := r.Header.Get("Data-Type")
+	data, err := anyTypeUnmarshal(resType, body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	item, ok := data.(storage.Item)
+	if !ok || item.Kind().Search().Value(item) != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	res, err := h.Db.Search(ctx, data, login)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Data-Type", resType+"-list")
+	_, _ = w.Write(res)
+}
+
+// Items lists the metadata of user items without the secret fields.
+// The query parameters are type, limit and offset
+func (h *Handler) Items(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.Background()
+
+	login, ok := auth.FromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+
+	itemType := query.Get("type")
+	if _, ok := storage.KindOf(itemType); !ok && itemType != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	limit, err := queryInt(query.Get("limit"), defaultLimit)
+	if err != nil || limit < 1 || limit > maxLimit {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	offset, err := queryInt(query.Get("offset"), 0)
+	if err != nil || offset < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	res, err := h.Db.List(ctx, itemType, limit, offset, login)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Data-Type", "items")
+	_, _ = w.Write(res)
+}
+
+// Find finds user items by the blinded tokens of a search query, the query parameters are token and limit.
+// The items having enough of the tokens are listed without the secret fields, the best matches first
+func (h *Handler) Find(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.Background()
+
+	login, ok := auth.FromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+
+	tokens := query["token"]
+	if len(tokens) == 0 || len(tokens) > blindindex.MaxQuery {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	for _, token := range tokens {
+		if !tokenPattern.MatchString(token) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	limit, err := queryInt(query.Get("limit"), defaultLimit)
+	if err != nil || limit < 1 || limit > maxLimit {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	res, err := h.Db.Find(ctx, tokens, blindindex.MinScore(len(tokens)), limit, login)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Data-Type", "items")
+	_, _ = w.Write(res)
+}
+
+// Sync returns user items changed and deleted since the revision in the since query parameter
+func (h *Handler) Sync(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.Background()
+
+	login, ok := auth.FromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	since, err := queryInt(r.URL.Query().Get("since"), 0)
+	if err != nil || since < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	res, err := h.Db.Sync(ctx, int64(since), login)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Data-Type", "sync")
+	_, _ = w.Write(res)
+}
+
+// queryInt parses an integer query parameter, an empty parameter has the default value
+func queryInt(value string, def int) (int, error) {
+	if value == "" {
+		return def, nil
+	}
+
+	return strconv.Atoi(value)
+}
+
+// itemID returns the id of a vault item, nil for the types without an id
+func itemID(data any) *string {
+	if item, ok := data.(storage.Item); ok {
+		return item.Header().Id
+	}
+
+	return nil
+}
+
+// hasID checks that a vault item is addressed by a valid id,
+// otherwise the response is written and false is returned
+func hasID(w http.ResponseWriter, data any) bool {
+
+	id := itemID(data)
+	if id != nil && !uuidPattern.MatchString(*id) {
+		w.WriteHeader(http.StatusBadRequest)
+		return false
+	}
+
+	return true
+}
+
+// itemVersion returns the version of a vault item, nil for the types without a version
+func itemVersion(data any) *int64 {
+	if item, ok := data.(storage.Item); ok {
+		return item.Header().Version
+	}
+
+	return nil
+}
+
+// precondition puts the version from the If-Match header into the item.
+// A change of an item without the version the client has read is refused,
+// in that case the response is written and false is returned
+func precondition(w http.ResponseWriter, r *http.Request, data any) bool {
+
+	version := itemVersion(data)
+	if version == nil {
+		return true
+	}
+
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		w.WriteHeader(http.StatusPreconditionRequired)
+		return false
+	}
+
+	v, err := strconv.ParseInt(strings.Trim(strings.TrimPrefix(header, "W/"), `"`), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return false
+	}
+
+	*version = v
+	return true
+}
+
+// setETag sets the item version as the response ETag
+func setETag(w http.ResponseWriter, data any) {
+	if version := itemVersion(data); version != nil {
+		w.Header().Set("ETag", strconv.Quote(strconv.FormatInt(*version, 10)))
+	}
+}
+
+// writeStoreError writes the status of a failed change of the vault
+func writeStoreError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, database.ErrConflict):
+		w.WriteHeader(http.StatusConflict)
+	case errors.Is(err, database.ErrNotFound):
+		w.WriteHeader(http.StatusNotFound)
+	case errors.Is(err, database.ErrFolderCycle):
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	default:
+		log.Printf("error: %s", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// uploaded refuses a file sent in the request body, files are created and their content
+// is stored in the blob store through uploads, an update of a file changes only its metadata.
+// In that case the response is written and false is returned
+func uploaded(w http.ResponseWriter, data any) bool {
+
+	if _, ok := data.(*storage.BinaryData); ok {
+		w.WriteHeader(http.StatusBadRequest)
+		return false
+	}
+
+	return true
+}
+
+// modifiedBy puts the device from the request header into the changed items.
+// An invalid device id is refused, in that case the response is written and false is returned
+func modifiedBy(w http.ResponseWriter, r *http.Request, data any) bool {
+
+	device := r.Header.Get(DeviceHeader)
+	if !devicePattern.MatchString(device) {
+		w.WriteHeader(http.StatusBadRequest)
+		return false
+	}
+
+	switch t := data.(type) {
+	case storage.Item:
+		*t.Header().ModifiedBy = device
+	case *storage.UserDate:
+		for _, items := range t.Items {
+			for _, item := range items {
+				*item.Header().ModifiedBy = device
+			}
+		}
+	}
+
+	return true
+}
+
+// conflict writes the rejection of a change of a stale version with the current version of the item,
+// so the client can merge the changes and retry
+func (h *Handler) conflict(ctx context.Context, w http.ResponseWriter, data any, login string) {
+
+	stale, ok := data.(storage.Item)
+	if !ok {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+
+	current := stale.Kind().New()
+	*current.Header().Id = *stale.Header().Id
+
+	res := storage.Conflict{
+		Error: database.ErrConflict.Error(),
+		Type:  current.Kind().Name,
+		Item:  current,
+	}
+
+	item, err := h.Db.Read(ctx, current, login)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	err = json.Unmarshal(item, current)
+	if err != nil {
+		log.Printf("error: %s", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	body, err := json.Marshal(&res)
+	if err != nil {
+		log.Printf("error: %s", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	setETag(w, current)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Data-Type", "conflict")
+	w.WriteHeader(http.StatusConflict)
+	_, _ = w.Write(body)
+}
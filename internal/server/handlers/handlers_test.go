@@ -6,6 +6,8 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/EgorKo25/GophKeeper/internal/server/handlers"
@@ -14,12 +16,16 @@ import (
 
 	"github.com/EgorKo25/GophKeeper/pkg/auth"
 
+	"github.com/EgorKo25/GophKeeper/internal/database"
 	mock_database "github.com/EgorKo25/GophKeeper/internal/database/mocks"
 	"github.com/EgorKo25/GophKeeper/internal/storage"
 
 	"github.com/golang/mock/gomock"
 )
 
+// itemID is an id of the vault item the tests operate on
+const itemID = "0b0a6f3e-1c6d-4c1e-9a53-2f3b1d8a7c10"
+
 func TestHandler_Register(t *testing.T) {
 	type fields struct {
 		db *mock_database.MockDatabase
@@ -46,8 +52,8 @@ func TestHandler_Register(t *testing.T) {
 				}
 
 				gomock.InOrder(
-					f.db.EXPECT().Read(ctx, &user, "testuser").Return(nil, nil),
 					f.db.EXPECT().Add(ctx, &user, "testuser").Return(nil),
+					f.db.EXPECT().AddSession(ctx, gomock.Any()).Return(nil),
 				)
 
 			},
@@ -59,6 +65,30 @@ func TestHandler_Register(t *testing.T) {
 			},
 			expectedStatus: http.StatusOK,
 		},
+		{
+			name: "user exists",
+			prepare: func(f *fields) {
+
+				ctx := context.Background()
+				user := storage.User{
+					Login:    "testuser",
+					Password: "testpassword",
+					Email:    "testemail@test.com",
+				}
+
+				gomock.InOrder(
+					f.db.EXPECT().Add(ctx, &user, "testuser").Return(database.ErrUserExists),
+				)
+
+			},
+			request: "/user/add",
+			user: storage.User{
+				Login:    "testuser",
+				Password: "testpassword",
+				Email:    "testemail@test.com",
+			},
+			expectedStatus: http.StatusConflict,
+		},
 		{
 			name:    "missing login",
 			prepare: func(f *fields) {},
@@ -91,7 +121,7 @@ func TestHandler_Register(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 
-			au := auth.NewAuth("some-secret")
+			au := auth.NewAuth("some-access-secret", "some-refresh-secret")
 
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
@@ -152,6 +182,7 @@ func TestHandler_Login(t *testing.T) {
 
 				gomock.InOrder(
 					f.db.EXPECT().CheckUser(ctx, &user).Return(true, nil),
+					f.db.EXPECT().AddSession(ctx, gomock.Any()).Return(nil),
 				)
 
 			},
@@ -201,11 +232,80 @@ func TestHandler_Login(t *testing.T) {
 			},
 			expectedStatus: http.StatusForbidden,
 		},
+		{
+			name: "legacy account",
+			prepare: func(f *fields) {
+				ctx := context.Background()
+				user := storage.User{
+					Login:          "testuser",
+					Password:       "testpassword",
+					LegacyLogin:    "4a1f0e9b2c3d5e6f",
+					LegacyPassword: "0123456789abcdef",
+				}
+
+				gomock.InOrder(
+					f.db.EXPECT().CheckUser(ctx, &user).Return(false, nil),
+					f.db.EXPECT().CheckUser(ctx, &storage.User{
+						Login:    "4a1f0e9b2c3d5e6f",
+						Password: "0123456789abcdef",
+					}).Return(true, nil),
+					f.db.EXPECT().UpgradeUser(ctx, "4a1f0e9b2c3d5e6f", &user).Return(nil),
+					f.db.EXPECT().AddSession(ctx, gomock.Any()).Return(nil),
+				)
+			},
+			request: "/user/login",
+			user: storage.User{
+				Login:          "testuser",
+				Password:       "testpassword",
+				LegacyLogin:    "4a1f0e9b2c3d5e6f",
+				LegacyPassword: "0123456789abcdef",
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "legacy account wrong password",
+			prepare: func(f *fields) {
+				ctx := context.Background()
+
+				gomock.InOrder(
+					f.db.EXPECT().CheckUser(ctx, gomock.Any()).Return(false, nil),
+					f.db.EXPECT().CheckUser(ctx, gomock.Any()).Return(false, nil),
+				)
+			},
+			request: "/user/login",
+			user: storage.User{
+				Login:          "testuser",
+				Password:       "wrong",
+				LegacyLogin:    "4a1f0e9b2c3d5e6f",
+				LegacyPassword: "fedcba9876543210",
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name: "legacy account login taken",
+			prepare: func(f *fields) {
+				ctx := context.Background()
+
+				gomock.InOrder(
+					f.db.EXPECT().CheckUser(ctx, gomock.Any()).Return(false, nil),
+					f.db.EXPECT().CheckUser(ctx, gomock.Any()).Return(true, nil),
+					f.db.EXPECT().UpgradeUser(ctx, "4a1f0e9b2c3d5e6f", gomock.Any()).Return(database.ErrUserExists),
+				)
+			},
+			request: "/user/login",
+			user: storage.User{
+				Login:          "testuser",
+				Password:       "testpassword",
+				LegacyLogin:    "4a1f0e9b2c3d5e6f",
+				LegacyPassword: "0123456789abcdef",
+			},
+			expectedStatus: http.StatusConflict,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 
-			au := auth.NewAuth("some-secret")
+			au := auth.NewAuth("some-access-secret", "some-refresh-secret")
 
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
@@ -299,6 +399,34 @@ func TestHandler_Add(t *testing.T) {
 			expectedStatus: http.StatusOK,
 			dataType:       "password",
 		},
+		{
+			name: "success add note",
+			prepare: func(f *fields) {
+
+				ctx := context.Background()
+
+				gomock.InOrder(
+					f.db.EXPECT().Add(
+						ctx,
+						&storage.Note{
+							Title:      "shopping",
+							LoginOwner: "testuser",
+							Body:       "milk\nbread",
+						},
+						"testuser",
+					).Return(nil),
+				)
+			},
+
+			request: "/user/add",
+			pass: storage.Note{
+				Title:      "shopping",
+				LoginOwner: "testuser",
+				Body:       "milk\nbread",
+			},
+			expectedStatus: http.StatusOK,
+			dataType:       "note",
+		},
 		{
 			name: "success add card",
 			prepare: func(f *fields) {
@@ -333,12 +461,23 @@ func TestHandler_Add(t *testing.T) {
 			expectedStatus: http.StatusOK,
 			dataType:       "card",
 		},
+		{
+			name:    "file without an upload",
+			prepare: func(f *fields) {},
+
+			request: "/user/add",
+			pass: storage.BinaryData{
+				Title: "title",
+			},
+			expectedStatus: http.StatusBadRequest,
+			dataType:       "bin",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 
-			au := auth.NewAuth("some-secret")
+			au := auth.NewAuth("some-access-secret", "some-refresh-secret")
 
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
@@ -362,12 +501,7 @@ func TestHandler_Add(t *testing.T) {
 
 			w := httptest.NewRecorder()
 
-			cook := &http.Cookie{
-				Name:  "User",
-				Value: "testuser",
-			}
-
-			request.AddCookie(cook)
+			request = request.WithContext(auth.NewContext(request.Context(), "testuser"))
 
 			h := handlers.Handler{Db: f.db, Au: au}
 
@@ -396,6 +530,7 @@ func TestHandler_Delete(t *testing.T) {
 		request        string
 		pass           any
 		dataType       string
+		ifMatch        string
 	}{
 		{
 			name:    "empty header Data-Type",
@@ -403,12 +538,41 @@ func TestHandler_Delete(t *testing.T) {
 
 			request: "/user/delete",
 			pass: storage.Password{
+				Id:         itemID,
 				Service:    "yandex",
 				LoginOwner: "testuser",
 			},
 			expectedStatus: http.StatusBadRequest,
 			dataType:       "",
 		},
+		{
+			name: "delete the account of the session",
+			prepare: func(f *fields) {
+				ctx := context.Background()
+
+				gomock.InOrder(
+					f.db.EXPECT().CheckUser(ctx, &storage.User{Login: "testuser", Password: "secret"}).Return(true, nil),
+					f.db.EXPECT().Delete(ctx, &storage.User{}, "testuser").Return(nil),
+				)
+			},
+
+			request:        "/user/delete",
+			pass:           storage.User{Login: "someone", Password: "secret"},
+			expectedStatus: http.StatusOK,
+			dataType:       "user",
+		},
+		{
+			name: "delete the account with a wrong password",
+			prepare: func(f *fields) {
+				f.db.EXPECT().CheckUser(context.Background(), &storage.User{Login: "testuser", Password: "wrong"}).
+					Return(false, nil)
+			},
+
+			request:        "/user/delete",
+			pass:           storage.User{Password: "wrong"},
+			expectedStatus: http.StatusForbidden,
+			dataType:       "user",
+		},
 		{
 			name: "success delete password",
 			prepare: func(f *fields) {
@@ -419,8 +583,10 @@ func TestHandler_Delete(t *testing.T) {
 					f.db.EXPECT().Delete(
 						ctx,
 						&storage.Password{
+							Id:         itemID,
 							Service:    "yandex",
 							LoginOwner: "testuser",
+							Version:    3,
 						},
 						"testuser",
 					).Return(nil),
@@ -429,11 +595,13 @@ func TestHandler_Delete(t *testing.T) {
 
 			request: "/user/delete",
 			pass: storage.Password{
+				Id:         itemID,
 				Service:    "yandex",
 				LoginOwner: "testuser",
 			},
 			expectedStatus: http.StatusOK,
 			dataType:       "password",
+			ifMatch:        `"3"`,
 		},
 		{
 			name: "success delete card",
@@ -445,8 +613,10 @@ func TestHandler_Delete(t *testing.T) {
 					f.db.EXPECT().Delete(
 						ctx,
 						&storage.Card{
+							Id:         itemID,
 							Bank:       "yandex",
 							LoginOwner: "testuser",
+							Version:    3,
 						},
 						"testuser",
 					).Return(nil),
@@ -455,18 +625,100 @@ func TestHandler_Delete(t *testing.T) {
 
 			request: "/user/delete",
 			pass: storage.Card{
+				Id:         itemID,
 				Bank:       "yandex",
 				LoginOwner: "testuser",
 			},
 			expectedStatus: http.StatusOK,
 			dataType:       "card",
+			ifMatch:        `"3"`,
+		},
+		{
+			name:    "invalid id",
+			prepare: func(f *fields) {},
+
+			request: "/user/delete",
+			pass: storage.Password{
+				Id:      "1",
+				Service: "yandex",
+			},
+			expectedStatus: http.StatusBadRequest,
+			dataType:       "password",
+			ifMatch:        `"3"`,
+		},
+		{
+			name:    "missing If-Match",
+			prepare: func(f *fields) {},
+
+			request: "/user/delete",
+			pass: storage.Password{
+				Id:         itemID,
+				Service:    "yandex",
+				LoginOwner: "testuser",
+			},
+			expectedStatus: http.StatusPreconditionRequired,
+			dataType:       "password",
+		},
+		{
+			name:    "malformed If-Match",
+			prepare: func(f *fields) {},
+
+			request: "/user/delete",
+			pass: storage.Password{
+				Id:         itemID,
+				Service:    "yandex",
+				LoginOwner: "testuser",
+			},
+			expectedStatus: http.StatusBadRequest,
+			dataType:       "password",
+			ifMatch:        "*",
+		},
+		{
+			name: "stale version",
+			prepare: func(f *fields) {
+
+				ctx := context.Background()
+
+				f.db.EXPECT().Delete(ctx, gomock.Any(), "testuser").Return(database.ErrConflict)
+				f.db.EXPECT().Read(ctx, &storage.Password{Id: itemID}, "testuser").
+					Return([]byte(`{"id":"`+itemID+`","service":"yandex","version":3}`), nil)
+			},
+
+			request: "/user/delete",
+			pass: storage.Password{
+				Id:         itemID,
+				Service:    "yandex",
+				LoginOwner: "testuser",
+			},
+			expectedStatus: http.StatusConflict,
+			dataType:       "password",
+			ifMatch:        `"2"`,
+		},
+		{
+			name: "not found",
+			prepare: func(f *fields) {
+
+				ctx := context.Background()
+
+				f.db.EXPECT().Delete(ctx, gomock.Any(), "testuser").Return(database.ErrNotFound)
+			},
+
+			request: "/user/delete",
+			pass: storage.Password{
+				Id:         itemID,
+				Service:    "yandex",
+				LoginOwner: "testuser",
+			},
+			expectedStatus: http.StatusNotFound,
+			dataType:       "password",
+			ifMatch:        `"2"`,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 
-			au := auth.NewAuth("some-secret")
+			au := auth.NewAuth("some-access-secret", "some-refresh-secret")
 
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
@@ -479,6 +731,9 @@ func TestHandler_Delete(t *testing.T) {
 			request := httptest.NewRequest(http.MethodPost, tt.request, bytes.NewBuffer(body))
 
 			request.Header.Set("Data-Type", tt.dataType)
+			if tt.ifMatch != "" {
+				request.Header.Set("If-Match", tt.ifMatch)
+			}
 
 			f := &fields{
 				db: mock_database.NewMockDatabase(ctrl),
@@ -490,12 +745,7 @@ func TestHandler_Delete(t *testing.T) {
 
 			w := httptest.NewRecorder()
 
-			cook := &http.Cookie{
-				Name:  "User",
-				Value: "testuser",
-			}
-
-			request.AddCookie(cook)
+			request = request.WithContext(auth.NewContext(request.Context(), "testuser"))
 
 			h := handlers.Handler{Db: f.db, Au: au}
 
@@ -509,3 +759,1058 @@ func TestHandler_Delete(t *testing.T) {
 		})
 	}
 }
+
+func TestHandler_Update(t *testing.T) {
+	type fields struct {
+		db *mock_database.MockDatabase
+	}
+
+	current := storage.Password{Id: itemID, Service: "yandex", Password: "theirs", Version: 3, ModifiedBy: "laptop"}
+
+	tests := []struct {
+		name             string
+		prepare          func(f *fields)
+		pass             storage.Password
+		ifMatch          string
+		device           string
+		expectedStatus   int
+		expectedETag     string
+		expectedConflict *storage.Conflict
+	}{
+		{
+			name: "success",
+			prepare: func(f *fields) {
+				f.db.EXPECT().Update(
+					context.Background(),
+					&storage.Password{Id: itemID, Service: "yandex", Password: "new", Version: 1, ModifiedBy: "workstation"},
+					"testuser",
+				).DoAndReturn(func(_ context.Context, src any, _ string) error {
+					src.(*storage.Password).Version++
+					return nil
+				})
+			},
+			pass:           storage.Password{Id: itemID, Service: "yandex", Password: "new"},
+			ifMatch:        `"1"`,
+			device:         "workstation",
+			expectedStatus: http.StatusOK,
+			expectedETag:   `"2"`,
+		},
+		{
+			name:           "missing If-Match",
+			pass:           storage.Password{Id: itemID, Service: "yandex", Password: "new"},
+			expectedStatus: http.StatusPreconditionRequired,
+		},
+		{
+			name:           "invalid device",
+			pass:           storage.Password{Id: itemID, Service: "yandex", Password: "new"},
+			ifMatch:        `"1"`,
+			device:         "work station",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "stale version",
+			prepare: func(f *fields) {
+				body, _ := json.Marshal(current)
+
+				f.db.EXPECT().Update(context.Background(), gomock.Any(), "testuser").Return(database.ErrConflict)
+				f.db.EXPECT().Read(context.Background(), &storage.Password{Id: itemID}, "testuser").Return(body, nil)
+			},
+			pass:           storage.Password{Id: itemID, Service: "yandex", Password: "new"},
+			ifMatch:        `W/"1"`,
+			expectedStatus: http.StatusConflict,
+			expectedETag:   `"3"`,
+			expectedConflict: &storage.Conflict{
+				Error: database.ErrConflict.Error(),
+				Type:  "password",
+				Item:  &current,
+			},
+		},
+		{
+			name: "deleted on another device",
+			prepare: func(f *fields) {
+				f.db.EXPECT().Update(context.Background(), gomock.Any(), "testuser").Return(database.ErrConflict)
+				f.db.EXPECT().Read(context.Background(), gomock.Any(), "testuser").Return(nil, database.ErrNotFound)
+			},
+			pass:           storage.Password{Id: itemID, Service: "yandex", Password: "new"},
+			ifMatch:        `"1"`,
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			f := &fields{
+				db: mock_database.NewMockDatabase(ctrl),
+			}
+
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			h := handlers.Handler{Db: f.db, Au: auth.NewAuth("some-access-secret", "some-refresh-secret")}
+
+			result := updatePassword(t, &h, tt.pass, tt.ifMatch, tt.device)
+			defer result.Body.Close()
+
+			assert.Equal(t, tt.expectedStatus, result.StatusCode)
+			assert.Equal(t, tt.expectedETag, result.Header.Get("ETag"))
+
+			if tt.expectedConflict != nil {
+				var conflict storage.Conflict
+
+				assert.Equal(t, "conflict", result.Header.Get("Data-Type"))
+				assert.NoError(t, json.NewDecoder(result.Body).Decode(&conflict))
+				assert.Equal(t, tt.expectedConflict, &conflict)
+			}
+		})
+	}
+}
+
+func TestHandler_Update_File(t *testing.T) {
+	type fields struct {
+		db *mock_database.MockDatabase
+	}
+
+	tests := []struct {
+		name           string
+		prepare        func(f *fields)
+		bin            storage.BinaryData
+		expectedStatus int
+	}{
+		{
+			name: "tags of the file",
+			prepare: func(f *fields) {
+				f.db.EXPECT().Update(context.Background(),
+					&storage.BinaryData{Id: itemID, Title: "title", Tags: "work", Version: 1}, "testuser").Return(nil)
+			},
+			bin:            storage.BinaryData{Id: itemID, Title: "title", Tags: "work"},
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			f := &fields{
+				db: mock_database.NewMockDatabase(ctrl),
+			}
+
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			body, err := json.Marshal(tt.bin)
+			if err != nil {
+				t.Errorf("err marshal: %s", err)
+			}
+
+			request := httptest.NewRequest(http.MethodPost, "/user/update", bytes.NewBuffer(body))
+			request.Header.Set("Data-Type", "bin")
+			request.Header.Set("If-Match", `"1"`)
+			request = request.WithContext(auth.NewContext(request.Context(), "testuser"))
+
+			w := httptest.NewRecorder()
+
+			h := handlers.Handler{Db: f.db, Au: auth.NewAuth("some-access-secret", "some-refresh-secret")}
+
+			http.HandlerFunc(h.Update)(w, request)
+
+			result := w.Result()
+			defer result.Body.Close()
+
+			assert.Equal(t, tt.expectedStatus, result.StatusCode)
+		})
+	}
+}
+
+func TestHandler_Update_Concurrent(t *testing.T) {
+
+	const clients = 10
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	db := mock_database.NewMockDatabase(ctrl)
+
+	// the mock stores a single item and applies a change only to its current version
+	var mu sync.Mutex
+	version := int64(1)
+
+	db.EXPECT().Update(context.Background(), gomock.Any(), "testuser").
+		DoAndReturn(func(_ context.Context, src any, _ string) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			pass := src.(*storage.Password)
+			if pass.Version != version {
+				return database.ErrConflict
+			}
+
+			version++
+			pass.Version = version
+			return nil
+		}).Times(clients)
+
+	db.EXPECT().Read(context.Background(), gomock.Any(), "testuser").
+		DoAndReturn(func(_ context.Context, src any, _ string) ([]byte, error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			return json.Marshal(storage.Password{Id: itemID, Service: "yandex", Password: "new", Version: version})
+		}).Times(clients - 1)
+
+	h := handlers.Handler{Db: db, Au: auth.NewAuth("some-access-secret", "some-refresh-secret")}
+
+	statuses := make(chan int, clients)
+
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			result := updatePassword(t, &h, storage.Password{Id: itemID, Service: "yandex", Password: "new"}, `"1"`, "")
+			defer result.Body.Close()
+
+			statuses <- result.StatusCode
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	count := make(map[int]int)
+	for status := range statuses {
+		count[status]++
+	}
+
+	assert.Equal(t, 1, count[http.StatusOK])
+	assert.Equal(t, clients-1, count[http.StatusConflict])
+	assert.Equal(t, int64(2), version)
+}
+
+// updatePassword sends the password to the Update handler on behalf of testuser from the device
+func updatePassword(t *testing.T, h *handlers.Handler, pass storage.Password, ifMatch, device string) *http.Response {
+
+	body, err := json.Marshal(pass)
+	if err != nil {
+		t.Errorf("err marshal: %s", err)
+	}
+
+	request := httptest.NewRequest(http.MethodPost, "/user/update", bytes.NewBuffer(body))
+	request.Header.Set("Data-Type", "password")
+	if ifMatch != "" {
+		request.Header.Set("If-Match", ifMatch)
+	}
+	if device != "" {
+		request.Header.Set(handlers.DeviceHeader, device)
+	}
+	request = request.WithContext(auth.NewContext(request.Context(), "testuser"))
+
+	w := httptest.NewRecorder()
+
+	http.HandlerFunc(h.Update)(w, request)
+
+	return w.Result()
+}
+
+func TestHandler_Read(t *testing.T) {
+	type fields struct {
+		db *mock_database.MockDatabase
+	}
+
+	tests := []struct {
+		name           string
+		fields         fields
+		prepare        func(f *fields)
+		expectedStatus int
+		au             *auth.Auth
+		request        string
+		pass           any
+		dataType       string
+	}{
+		{
+			name: "success read key metadata",
+			prepare: func(f *fields) {
+
+				ctx := context.Background()
+
+				gomock.InOrder(
+					f.db.EXPECT().Read(
+						ctx,
+						&storage.KeyMeta{},
+						"testuser",
+					).Return([]byte(`{"time":3}`), nil),
+				)
+			},
+
+			request:        "/user/read",
+			pass:           storage.KeyMeta{},
+			expectedStatus: http.StatusOK,
+			dataType:       "keymeta",
+		},
+		{
+			name: "key metadata not found",
+			prepare: func(f *fields) {
+
+				ctx := context.Background()
+
+				gomock.InOrder(
+					f.db.EXPECT().Read(
+						ctx,
+						&storage.KeyMeta{},
+						"testuser",
+					).Return(nil, database.ErrNotFound),
+				)
+			},
+
+			request:        "/user/read",
+			pass:           storage.KeyMeta{},
+			expectedStatus: http.StatusNotFound,
+			dataType:       "keymeta",
+		},
+		{
+			name: "success read password by id",
+			prepare: func(f *fields) {
+
+				ctx := context.Background()
+
+				f.db.EXPECT().Read(
+					ctx,
+					&storage.Password{Id: itemID},
+					"testuser",
+				).Return([]byte(`{"id":"`+itemID+`"}`), nil)
+			},
+
+			request:        "/user/read",
+			pass:           storage.Password{Id: itemID},
+			expectedStatus: http.StatusOK,
+			dataType:       "password",
+		},
+		{
+			name:           "password without id",
+			prepare:        func(f *fields) {},
+			request:        "/user/read",
+			pass:           storage.Password{Service: "yandex"},
+			expectedStatus: http.StatusBadRequest,
+			dataType:       "password",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			au := auth.NewAuth("some-access-secret", "some-refresh-secret")
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			body, err := json.Marshal(tt.pass)
+			if err != nil {
+				t.Errorf("err marshal: %s", err)
+			}
+
+			request := httptest.NewRequest(http.MethodPost, tt.request, bytes.NewBuffer(body))
+
+			request.Header.Set("Data-Type", tt.dataType)
+
+			f := &fields{
+				db: mock_database.NewMockDatabase(ctrl),
+			}
+
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			w := httptest.NewRecorder()
+
+			request = request.WithContext(auth.NewContext(request.Context(), "testuser"))
+
+			h := handlers.Handler{Db: f.db, Au: au}
+
+			handle := http.HandlerFunc(h.Read)
+
+			handle(w, request)
+
+			result := w.Result()
+
+			assert.Equal(t, tt.expectedStatus, result.StatusCode)
+		})
+	}
+}
+
+func TestHandler_Search(t *testing.T) {
+	type fields struct {
+		db *mock_database.MockDatabase
+	}
+
+	tests := []struct {
+		name             string
+		prepare          func(f *fields)
+		pass             any
+		dataType         string
+		expectedStatus   int
+		expectedDataType string
+	}{
+		{
+			name: "all passwords",
+			prepare: func(f *fields) {
+				f.db.EXPECT().Search(
+					context.Background(),
+					&storage.Password{},
+					"testuser",
+				).Return([]byte(`[{"service":"yandex"},{"service":"mail"}]`), nil)
+			},
+			pass:             storage.Password{},
+			dataType:         "password",
+			expectedStatus:   http.StatusOK,
+			expectedDataType: "password-list",
+		},
+		{
+			name:           "filter by the name",
+			pass:           storage.Password{Service: "yandex"},
+			dataType:       "password",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "type without search",
+			pass:           storage.KeyMeta{},
+			dataType:       "keymeta",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			body, err := json.Marshal(tt.pass)
+			if err != nil {
+				t.Errorf("err marshal: %s", err)
+			}
+
+			request := httptest.NewRequest(http.MethodPost, "/user/search", bytes.NewBuffer(body))
+			request.Header.Set("Data-Type", tt.dataType)
+			request = request.WithContext(auth.NewContext(request.Context(), "testuser"))
+
+			f := &fields{
+				db: mock_database.NewMockDatabase(ctrl),
+			}
+
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			w := httptest.NewRecorder()
+
+			h := handlers.Handler{Db: f.db, Au: auth.NewAuth("some-access-secret", "some-refresh-secret")}
+
+			http.HandlerFunc(h.Search)(w, request)
+
+			result := w.Result()
+			defer result.Body.Close()
+
+			assert.Equal(t, tt.expectedStatus, result.StatusCode)
+			assert.Equal(t, tt.expectedDataType, result.Header.Get("Data-Type"))
+		})
+	}
+}
+
+func TestHandler_Items(t *testing.T) {
+	type fields struct {
+		db *mock_database.MockDatabase
+	}
+
+	tests := []struct {
+		name           string
+		prepare        func(f *fields)
+		request        string
+		expectedStatus int
+	}{
+		{
+			name: "first page of all items",
+			prepare: func(f *fields) {
+				f.db.EXPECT().List(context.Background(), "", 50, 0, "testuser").
+					Return([]byte(`{"items":[],"total":0,"offset":0}`), nil)
+			},
+			request:        "/user/items",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "page of cards",
+			prepare: func(f *fields) {
+				f.db.EXPECT().List(context.Background(), "card", 10, 20, "testuser").
+					Return([]byte(`{"items":[],"total":0,"offset":20}`), nil)
+			},
+			request:        "/user/items?type=card&limit=10&offset=20",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "unknown type",
+			request:        "/user/items?type=user",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "limit too large",
+			request:        "/user/items?limit=1000",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "negative offset",
+			request:        "/user/items?offset=-1",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			request := httptest.NewRequest(http.MethodGet, tt.request, nil)
+			request = request.WithContext(auth.NewContext(request.Context(), "testuser"))
+
+			f := &fields{
+				db: mock_database.NewMockDatabase(ctrl),
+			}
+
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			w := httptest.NewRecorder()
+
+			h := handlers.Handler{Db: f.db, Au: auth.NewAuth("some-access-secret", "some-refresh-secret")}
+
+			http.HandlerFunc(h.Items)(w, request)
+
+			result := w.Result()
+			defer result.Body.Close()
+
+			assert.Equal(t, tt.expectedStatus, result.StatusCode)
+			if tt.expectedStatus == http.StatusOK {
+				assert.Equal(t, "items", result.Header.Get("Data-Type"))
+			}
+		})
+	}
+}
+
+func TestHandler_Find(t *testing.T) {
+	type fields struct {
+		db *mock_database.MockDatabase
+	}
+
+	tokens := []string{"AAAAAAAAAAAAAAAAAAAAAA", "BBBBBBBBBBBBBBBBBBBB-_", "CCCCCCCCCCCCCCCCCCCCCC",
+		"DDDDDDDDDDDDDDDDDDDDDD", "EEEEEEEEEEEEEEEEEEEEEE", "FFFFFFFFFFFFFFFFFFFFFF",
+		"GGGGGGGGGGGGGGGGGGGGGG", "HHHHHHHHHHHHHHHHHHHHHH"}
+
+	tests := []struct {
+		name           string
+		prepare        func(f *fields)
+		request        string
+		expectedStatus int
+	}{
+		{
+			name: "one token",
+			prepare: func(f *fields) {
+				f.db.EXPECT().Find(context.Background(), tokens[:1], 1, 50, "testuser").
+					Return([]byte(`{"items":[],"total":0,"offset":0}`), nil)
+			},
+			request:        "/user/find?token=" + tokens[0],
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "a quarter of the tokens must match",
+			prepare: func(f *fields) {
+				f.db.EXPECT().Find(context.Background(), tokens, 2, 10, "testuser").
+					Return([]byte(`{"items":[],"total":0,"offset":0}`), nil)
+			},
+			request:        "/user/find?limit=10&token=" + strings.Join(tokens, "&token="),
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "no tokens",
+			request:        "/user/find",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "plain word instead of a token",
+			request:        "/user/find?token=yandex",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "limit too large",
+			request:        "/user/find?limit=1000&token=" + tokens[0],
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			request := httptest.NewRequest(http.MethodGet, tt.request, nil)
+			request = request.WithContext(auth.NewContext(request.Context(), "testuser"))
+
+			f := &fields{
+				db: mock_database.NewMockDatabase(ctrl),
+			}
+
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			w := httptest.NewRecorder()
+
+			h := handlers.Handler{Db: f.db, Au: auth.NewAuth("some-access-secret", "some-refresh-secret")}
+
+			http.HandlerFunc(h.Find)(w, request)
+
+			result := w.Result()
+			defer result.Body.Close()
+
+			assert.Equal(t, tt.expectedStatus, result.StatusCode)
+		})
+	}
+}
+
+func TestHandler_Sync(t *testing.T) {
+	type fields struct {
+		db *mock_database.MockDatabase
+	}
+
+	tests := []struct {
+		name           string
+		prepare        func(f *fields)
+		request        string
+		expectedStatus int
+	}{
+		{
+			name: "full sync",
+			prepare: func(f *fields) {
+				f.db.EXPECT().Sync(context.Background(), int64(0), "testuser").
+					Return([]byte(`{"cursor":7}`), nil)
+			},
+			request:        "/user/sync",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "changes since a cursor",
+			prepare: func(f *fields) {
+				f.db.EXPECT().Sync(context.Background(), int64(7), "testuser").
+					Return([]byte(`{"cursor":7}`), nil)
+			},
+			request:        "/user/sync?since=7",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "malformed cursor",
+			request:        "/user/sync?since=abc",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			request := httptest.NewRequest(http.MethodGet, tt.request, nil)
+			request = request.WithContext(auth.NewContext(request.Context(), "testuser"))
+
+			f := &fields{
+				db: mock_database.NewMockDatabase(ctrl),
+			}
+
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			w := httptest.NewRecorder()
+
+			h := handlers.Handler{Db: f.db, Au: auth.NewAuth("some-access-secret", "some-refresh-secret")}
+
+			http.HandlerFunc(h.Sync)(w, request)
+
+			result := w.Result()
+			defer result.Body.Close()
+
+			assert.Equal(t, tt.expectedStatus, result.StatusCode)
+		})
+	}
+}
+
+func TestHandler_Move(t *testing.T) {
+	type fields struct {
+		db *mock_database.MockDatabase
+	}
+
+	const folderID = "7c4e2a1b-3d5f-4e6a-8b9c-0d1e2f3a4b5c"
+
+	tests := []struct {
+		name           string
+		prepare        func(f *fields)
+		dataType       string
+		item           any
+		expectedStatus int
+	}{
+		{
+			name: "password into a folder",
+			prepare: func(f *fields) {
+				f.db.EXPECT().Move(context.Background(),
+					&storage.Password{Id: itemID, FolderId: folderID}, "testuser").Return(nil)
+			},
+			dataType:       "password",
+			item:           storage.Password{Id: itemID, FolderId: folderID},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "folder to the top level",
+			prepare: func(f *fields) {
+				f.db.EXPECT().Move(context.Background(), &storage.Folder{Id: folderID}, "testuser").Return(nil)
+			},
+			dataType:       "folder",
+			item:           storage.Folder{Id: folderID},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "folder into its subfolder",
+			prepare: func(f *fields) {
+				f.db.EXPECT().Move(context.Background(), gomock.Any(), "testuser").Return(database.ErrFolderCycle)
+			},
+			dataType:       "folder",
+			item:           storage.Folder{Id: folderID, FolderId: itemID},
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "unknown folder",
+			prepare: func(f *fields) {
+				f.db.EXPECT().Move(context.Background(), gomock.Any(), "testuser").Return(database.ErrNotFound)
+			},
+			dataType:       "card",
+			item:           storage.Card{Id: itemID, FolderId: folderID},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "invalid folder id",
+			dataType:       "password",
+			item:           storage.Password{Id: itemID, FolderId: "inbox"},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "not a vault item",
+			dataType:       "keymeta",
+			item:           storage.KeyMeta{},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			body, err := json.Marshal(tt.item)
+			if err != nil {
+				t.Errorf("err marshal: %s", err)
+			}
+
+			request := httptest.NewRequest(http.MethodPost, "/user/move", bytes.NewBuffer(body))
+			request.Header.Set("Data-Type", tt.dataType)
+			request = request.WithContext(auth.NewContext(request.Context(), "testuser"))
+
+			f := &fields{
+				db: mock_database.NewMockDatabase(ctrl),
+			}
+
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			w := httptest.NewRecorder()
+
+			h := handlers.Handler{Db: f.db, Au: auth.NewAuth("some-access-secret", "some-refresh-secret")}
+
+			http.HandlerFunc(h.Move)(w, request)
+
+			result := w.Result()
+			defer result.Body.Close()
+
+			assert.Equal(t, tt.expectedStatus, result.StatusCode)
+		})
+	}
+}
+
+func TestHandler_Refresh(t *testing.T) {
+	type fields struct {
+		db *mock_database.MockDatabase
+	}
+
+	au := auth.NewAuth("some-access-secret", "some-refresh-secret")
+
+	cookies, session, err := au.GenerateTokensAndCreateCookie(&storage.User{Login: "testuser"}, "")
+	if err != nil {
+		t.Fatalf("create cookie error: %s", err)
+	}
+
+	tokens := make(map[string]string)
+	for _, cookie := range cookies {
+		tokens[cookie.Name] = cookie.Value
+	}
+
+	tests := []struct {
+		name           string
+		prepare        func(f *fields)
+		cookie         *http.Cookie
+		expectedStatus int
+	}{
+		{
+			name: "success",
+			prepare: func(f *fields) {
+				f.db.EXPECT().RotateSession(context.Background(), session.TokenHash, gomock.Any()).Return(nil)
+			},
+			cookie:         &http.Cookie{Name: auth.RefreshCookie, Value: tokens[auth.RefreshCookie]},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "reused refresh token",
+			prepare: func(f *fields) {
+				f.db.EXPECT().RotateSession(context.Background(), session.TokenHash, gomock.Any()).
+					Return(database.ErrSessionReused)
+			},
+			cookie:         &http.Cookie{Name: auth.RefreshCookie, Value: tokens[auth.RefreshCookie]},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "revoked or unknown refresh token",
+			prepare: func(f *fields) {
+				f.db.EXPECT().RotateSession(context.Background(), session.TokenHash, gomock.Any()).
+					Return(database.ErrNotFound)
+			},
+			cookie:         &http.Cookie{Name: auth.RefreshCookie, Value: tokens[auth.RefreshCookie]},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "missing refresh token",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "access token instead of refresh token",
+			cookie:         &http.Cookie{Name: auth.RefreshCookie, Value: tokens[auth.AccessCookie]},
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			request := httptest.NewRequest(http.MethodPost, "/user/refresh", nil)
+
+			if tt.cookie != nil {
+				request.AddCookie(tt.cookie)
+			}
+
+			f := &fields{
+				db: mock_database.NewMockDatabase(ctrl),
+			}
+
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			w := httptest.NewRecorder()
+
+			h := handlers.Handler{Db: f.db, Au: au}
+
+			handle := http.HandlerFunc(h.Refresh)
+
+			handle(w, request)
+
+			result := w.Result()
+			defer result.Body.Close()
+
+			assert.Equal(t, tt.expectedStatus, result.StatusCode)
+		})
+	}
+}
+
+func TestHandler_Logout(t *testing.T) {
+	type fields struct {
+		db *mock_database.MockDatabase
+	}
+
+	au := auth.NewAuth("some-access-secret", "some-refresh-secret")
+
+	cookies, session, err := au.GenerateTokensAndCreateCookie(&storage.User{Login: "testuser"}, "")
+	if err != nil {
+		t.Fatalf("create cookie error: %s", err)
+	}
+
+	var refresh *http.Cookie
+	for _, cookie := range cookies {
+		if cookie.Name == auth.RefreshCookie {
+			refresh = &http.Cookie{Name: cookie.Name, Value: cookie.Value}
+		}
+	}
+
+	tests := []struct {
+		name           string
+		prepare        func(f *fields)
+		all            bool
+		cookie         *http.Cookie
+		expectedStatus int
+	}{
+		{
+			name: "logout current session",
+			prepare: func(f *fields) {
+				f.db.EXPECT().RevokeSessions(context.Background(), "testuser", session.Family).Return(nil)
+			},
+			cookie:         refresh,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "logout all devices",
+			prepare: func(f *fields) {
+				f.db.EXPECT().RevokeSessions(context.Background(), "testuser", "").Return(nil)
+			},
+			all:            true,
+			cookie:         refresh,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "missing refresh token",
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			request := httptest.NewRequest(http.MethodPost, "/user/logout", nil)
+
+			if tt.cookie != nil {
+				request.AddCookie(tt.cookie)
+			}
+
+			f := &fields{
+				db: mock_database.NewMockDatabase(ctrl),
+			}
+
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			w := httptest.NewRecorder()
+
+			h := handlers.Handler{Db: f.db, Au: au}
+
+			handle := http.HandlerFunc(h.Logout)
+			if tt.all {
+				handle = h.LogoutAll
+			}
+
+			handle(w, request)
+
+			result := w.Result()
+			defer result.Body.Close()
+
+			assert.Equal(t, tt.expectedStatus, result.StatusCode)
+
+			if tt.expectedStatus == http.StatusOK {
+				for _, cookie := range result.Cookies() {
+					assert.Empty(t, cookie.Value, cookie.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestHandler_Add_Identity(t *testing.T) {
+	type fields struct {
+		db *mock_database.MockDatabase
+	}
+
+	tests := []struct {
+		name           string
+		prepare        func(f *fields)
+		login          string
+		cookie         *http.Cookie
+		expectedStatus int
+	}{
+		{
+			name:           "unauthenticated request",
+			cookie:         &http.Cookie{Name: "User", Value: "testuser"},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "user cookie is ignored",
+			prepare: func(f *fields) {
+				f.db.EXPECT().Add(context.Background(), gomock.Any(), "testuser").Return(nil)
+			},
+			login:          "testuser",
+			cookie:         &http.Cookie{Name: "User", Value: "another"},
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			body, err := json.Marshal(storage.Password{Service: "yandex"})
+			if err != nil {
+				t.Errorf("err marshal: %s", err)
+			}
+
+			request := httptest.NewRequest(http.MethodPost, "/user/add", bytes.NewBuffer(body))
+			request.Header.Set("Data-Type", "password")
+			request.AddCookie(tt.cookie)
+
+			if tt.login != "" {
+				request = request.WithContext(auth.NewContext(request.Context(), tt.login))
+			}
+
+			f := &fields{
+				db: mock_database.NewMockDatabase(ctrl),
+			}
+
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+
+			w := httptest.NewRecorder()
+
+			h := handlers.Handler{Db: f.db, Au: auth.NewAuth("some-access-secret", "some-refresh-secret")}
+
+			handle := http.HandlerFunc(h.Add)
+
+			handle(w, request)
+
+			result := w.Result()
+			defer result.Body.Close()
+
+			assert.Equal(t, tt.expectedStatus, result.StatusCode)
+		})
+	}
+}
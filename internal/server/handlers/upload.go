@@ -0,0 +1,534 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+
+	"github.com/EgorKo25/GophKeeper/internal/blob"
+	"github.com/EgorKo25/GophKeeper/internal/database"
+	"github.com/EgorKo25/GophKeeper/internal/storage"
+	"github.com/EgorKo25/GophKeeper/pkg/auth"
+)
+
+// CreateUpload starts a chunked upload of a file.
+// The upload with an item id replaces the content of the item when it is completed.
+// The chunks the user has already stored are marked as received, the client doesn't send them
+func (h *Handler) CreateUpload(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.Background()
+
+	login, ok := auth.FromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf(cantRead, err)
+		return
+	}
+
+	var upload storage.Upload
+
+	err = json.Unmarshal(body, &upload)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		log.Printf(cantUnmarshal, err)
+		return
+	}
+
+	if !h.validUpload(&upload) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if upload.Size > h.MaxBlobSize {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	err = h.Db.AddUpload(ctx, &upload, login)
+	if err != nil {
+		log.Printf("add upload error: %s", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = h.received(ctx, &upload, login)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res, err := json.Marshal(&upload)
+	if err != nil {
+		log.Printf("error: %s", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Data-Type", "upload")
+	_, _ = w.Write(res)
+}
+
+// validUpload checks the description of a new upload, every chunk carries at least one byte
+func (h *Handler) validUpload(upload *storage.Upload) bool {
+	switch {
+	case upload.Manifest == "" || upload.Fingerprint == "":
+		return false
+	case upload.ItemId != "" && !uuidPattern.MatchString(upload.ItemId):
+		return false
+	case upload.Chunks < 1 || int64(upload.Chunks) > upload.Size:
+		return false
+	case upload.Size > int64(upload.Chunks)*h.MaxChunkSize:
+		return false
+	case len(upload.ChunkIds) != upload.Chunks:
+		return false
+	}
+
+	for _, id := range upload.ChunkIds {
+		if !chunkPattern.MatchString(id) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Uploads lists the unfinished uploads of the user with the numbers of the received chunks,
+// so the client can resume them
+func (h *Handler) Uploads(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.Background()
+
+	login, ok := auth.FromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	uploads, err := h.Db.Uploads(ctx, login)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	for i := range uploads {
+		err = h.received(ctx, &uploads[i], login)
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	res, err := json.Marshal(uploads)
+	if err != nil {
+		log.Printf("error: %s", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Data-Type", "uploads")
+	_, _ = w.Write(res)
+}
+
+// PutChunk stores the encrypted chunk of the upload, the body is the chunk itself.
+// A chunk may be sent again, the chunks together can't exceed the size of the upload
+func (h *Handler) PutChunk(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.Background()
+
+	login, ok := auth.FromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	upload, ok := h.readUpload(ctx, w, r, login)
+	if !ok {
+		return
+	}
+
+	n, err := strconv.Atoi(chi.URLParam(r, "n"))
+	if err != nil || n < 0 || n >= upload.Chunks {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	chunks, err := h.Blobs.Chunks(upload.Id)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	limit := upload.Size
+	for i, size := range chunks {
+		if i != n {
+			limit -= size
+		}
+	}
+	if limit > h.MaxChunkSize {
+		limit = h.MaxChunkSize
+	}
+
+	_, err = h.Blobs.Put(upload.Id, n, http.MaxBytesReader(w, r.Body, limit))
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		log.Printf("put chunk error: %s", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// CompleteUpload stores the uploaded file once all its chunks are received or stored before.
+// Replacing the content of an item requires the version the client has read in the If-Match header.
+// When a chunk is missing, the upload with the received chunks is returned with 422
+func (h *Handler) CompleteUpload(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.Background()
+
+	login, ok := auth.FromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	upload, ok := h.readUpload(ctx, w, r, login)
+	if !ok {
+		return
+	}
+
+	chunks, err := h.Blobs.Chunks(upload.Id)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	bin := &storage.BinaryData{Hash: chunksHash(upload.ChunkIds)}
+	if !modifiedBy(w, r, bin) {
+		return
+	}
+
+	var replaced string
+
+	if upload.ItemId != "" {
+		current := &storage.BinaryData{Id: upload.ItemId}
+		if !precondition(w, r, current) {
+			return
+		}
+
+		upload.Version = current.Version
+		replaced = h.fileBlob(ctx, current, login)
+	}
+
+	unused, err := h.Db.CompleteUpload(ctx, upload, bin, chunks, login)
+	if errors.Is(err, database.ErrMissingChunk) {
+		h.missingChunks(ctx, w, upload, login)
+		return
+	}
+	if errors.Is(err, database.ErrConflict) {
+		h.conflict(ctx, w, &storage.BinaryData{Id: upload.ItemId}, login)
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	h.removeBlob(replaced)
+
+	for _, n := range unused {
+		err = h.Blobs.RemoveChunk(upload.Id, n)
+		if err != nil {
+			log.Printf("remove chunk error: %s", err)
+		}
+	}
+
+	res, err := json.Marshal(bin)
+	if err != nil {
+		log.Printf("error: %s", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	setETag(w, bin)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Data-Type", storage.FileKind.Name)
+	_, _ = w.Write(res)
+}
+
+// missingChunks responds to the completion of the upload that lacks chunks with the chunks the server has
+func (h *Handler) missingChunks(ctx context.Context, w http.ResponseWriter, upload *storage.Upload, login string) {
+
+	err := h.received(ctx, upload, login)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	res, err := json.Marshal(upload)
+	if err != nil {
+		log.Printf("error: %s", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Data-Type", "upload")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	_, _ = w.Write(res)
+}
+
+// Download streams the encrypted chunk of the file
+func (h *Handler) Download(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.Background()
+
+	login, ok := auth.FromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	bin := &storage.BinaryData{Id: chi.URLParam(r, "id")}
+	if !hasID(w, bin) {
+		return
+	}
+
+	n, err := strconv.Atoi(chi.URLParam(r, "n"))
+	if err != nil || n < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = h.Db.ReadFile(ctx, bin, login)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	if n >= bin.Chunks {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	key, blobN := bin.BlobKey, n
+
+	// the chunks of the file may be shared with other files
+	if bin.Manifest != "" {
+		chunk, err := h.Db.ReadChunk(ctx, bin, n, login)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+
+		key, blobN = chunk.BlobKey, chunk.BlobN
+	}
+
+	chunk, size, err := h.Blobs.Get(key, blobN)
+	if errors.Is(err, blob.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("get chunk error: %s", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer chunk.Close()
+
+	setETag(w, bin)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	_, err = io.Copy(w, chunk)
+	if err != nil {
+		log.Printf("download error: %s", err)
+	}
+}
+
+// FileChunks returns the ids of the chunks of the file in order, the client checks the chunks against them.
+// The list is empty for the files stored before the chunks were shared
+func (h *Handler) FileChunks(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.Background()
+
+	login, ok := auth.FromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	bin := &storage.BinaryData{Id: chi.URLParam(r, "id")}
+	if !hasID(w, bin) {
+		return
+	}
+
+	err := h.Db.ReadFile(ctx, bin, login)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	chunks, err := h.Db.FileChunks(ctx, bin, login)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	ids := make([]string, 0, len(chunks))
+	for _, chunk := range chunks {
+		ids = append(ids, chunk.Id)
+	}
+
+	res, err := json.Marshal(ids)
+	if err != nil {
+		log.Printf("error: %s", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	setETag(w, bin)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Data-Type", "chunk-ids")
+	_, _ = w.Write(res)
+}
+
+// Usage reports the size of the files of the user and the size of their stored chunks
+func (h *Handler) Usage(w http.ResponseWriter, r *http.Request) {
+
+	ctx := context.Background()
+
+	login, ok := auth.FromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	usage, err := h.Db.Usage(ctx, login)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	res, err := json.Marshal(usage)
+	if err != nil {
+		log.Printf("error: %s", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Data-Type", "usage")
+	_, _ = w.Write(res)
+}
+
+// received puts the numbers of the chunks the server has got or the user has stored before into the upload
+func (h *Handler) received(ctx context.Context, upload *storage.Upload, login string) error {
+
+	chunks, err := h.Blobs.Chunks(upload.Id)
+	if err != nil {
+		return err
+	}
+
+	stored, err := h.Db.StoredChunks(ctx, upload.ChunkIds, login)
+	if err != nil {
+		return err
+	}
+
+	upload.Received = make([]int, 0, upload.Chunks)
+	for n, id := range upload.ChunkIds {
+		if _, ok := chunks[n]; ok || stored[id] {
+			upload.Received = append(upload.Received, n)
+		}
+	}
+
+	return nil
+}
+
+// chunksHash returns the SHA-256 of the chunk ids in order
+func chunksHash(ids []string) string {
+
+	hash := sha256.New()
+	for _, id := range ids {
+		hash.Write([]byte(id))
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// readUpload reads the upload addressed by the id in the path,
+// otherwise the response is written and false is returned
+func (h *Handler) readUpload(ctx context.Context, w http.ResponseWriter, r *http.Request, login string) (*storage.Upload, bool) {
+
+	upload := &storage.Upload{Id: chi.URLParam(r, "id")}
+	if !uuidPattern.MatchString(upload.Id) {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, false
+	}
+
+	err := h.Db.ReadUpload(ctx, upload, login)
+	if err != nil {
+		writeStoreError(w, err)
+		return nil, false
+	}
+
+	return upload, true
+}
+
+// fileBlob returns the blob of the file of the version the deletion or replacement is guarded by,
+// it is removed once the change succeeds. An empty key is returned for other items
+// and for a stale version, whose blob is not known to be replaced
+func (h *Handler) fileBlob(ctx context.Context, data any, login string) string {
+
+	bin, ok := data.(*storage.BinaryData)
+	if !ok || h.Blobs == nil {
+		return ""
+	}
+
+	current := &storage.BinaryData{Id: bin.Id}
+
+	err := h.Db.ReadFile(ctx, current, login)
+	if err != nil || current.Version != bin.Version {
+		return ""
+	}
+
+	return current.BlobKey
+}
+
+// removeBlob removes the blob of a deleted or replaced file
+func (h *Handler) removeBlob(key string) {
+	if key == "" {
+		return
+	}
+
+	err := h.Blobs.Remove(key)
+	if err != nil {
+		log.Printf("remove blob error: %s", err)
+	}
+}
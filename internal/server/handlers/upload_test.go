@@ -0,0 +1,366 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/EgorKo25/GophKeeper/internal/blob"
+	"github.com/EgorKo25/GophKeeper/internal/database"
+	mock_database "github.com/EgorKo25/GophKeeper/internal/database/mocks"
+	"github.com/EgorKo25/GophKeeper/internal/server/handlers"
+	"github.com/EgorKo25/GophKeeper/internal/storage"
+	"github.com/EgorKo25/GophKeeper/pkg/auth"
+)
+
+// uploadID is an id of the upload the tests operate on
+const uploadID = "5d1c2e3f-4a5b-4c6d-8e7f-9a0b1c2d3e4f"
+
+// chunkIDs are the ids of the chunks of the uploaded file
+var chunkIDs = storage.ChunkIds{strings.Repeat("a", 64), strings.Repeat("b", 64)}
+
+// newUploadServer routes the transfer requests of testuser to the handler
+func newUploadServer(t *testing.T, db database.Database) (*httptest.Server, blob.BlobStore) {
+
+	blobs, err := blob.NewFileStore(t.TempDir())
+	require.NoError(t, err)
+
+	h := &handlers.Handler{Db: db, Blobs: blobs, MaxBlobSize: 100, MaxChunkSize: 10}
+
+	r := chi.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(auth.NewContext(r.Context(), "testuser")))
+		})
+	})
+	r.Post("/user/upload", h.CreateUpload)
+	r.Get("/user/uploads", h.Uploads)
+	r.Put("/user/upload/{id}/{n}", h.PutChunk)
+	r.Post("/user/upload/{id}/complete", h.CompleteUpload)
+	r.Get("/user/download/{id}", h.FileChunks)
+	r.Get("/user/download/{id}/{n}", h.Download)
+	r.Get("/user/usage", h.Usage)
+	r.Post("/user/delete", h.Delete)
+
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+
+	return server, blobs
+}
+
+// request sends the request to the server and returns the status and the response body
+func request(t *testing.T, method, url string, body []byte, header map[string]string) (int, []byte) {
+
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	require.NoError(t, err)
+
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	res, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	return resp.StatusCode, res
+}
+
+func TestHandler_CreateUpload(t *testing.T) {
+	upload := func(change func(u *storage.Upload)) storage.Upload {
+		u := storage.Upload{Title: "title", Fingerprint: "fp", Manifest: "m", ChunkIds: chunkIDs, Size: 15, Chunks: 2}
+		if change != nil {
+			change(&u)
+		}
+		return u
+	}
+
+	tests := []struct {
+		name             string
+		upload           storage.Upload
+		prepare          func(db *mock_database.MockDatabase)
+		expectedStatus   int
+		expectedReceived []int
+	}{
+		{
+			name:   "success",
+			upload: upload(nil),
+			prepare: func(db *mock_database.MockDatabase) {
+				db.EXPECT().AddUpload(gomock.Any(), gomock.Any(), "testuser").
+					DoAndReturn(func(_ context.Context, upload *storage.Upload, _ string) error {
+						upload.Id = uploadID
+						return nil
+					})
+				db.EXPECT().StoredChunks(gomock.Any(), []string(chunkIDs), "testuser").
+					Return(map[string]bool{chunkIDs[1]: true}, nil)
+			},
+			expectedStatus:   http.StatusOK,
+			expectedReceived: []int{1},
+		},
+		{
+			name:           "without chunks",
+			upload:         upload(func(u *storage.Upload) { u.Chunks, u.ChunkIds = 0, nil }),
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "without manifest",
+			upload:         upload(func(u *storage.Upload) { u.Manifest = "" }),
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "chunk ids not matching chunks",
+			upload:         upload(func(u *storage.Upload) { u.ChunkIds = chunkIDs[:1] }),
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid chunk id",
+			upload:         upload(func(u *storage.Upload) { u.ChunkIds = storage.ChunkIds{chunkIDs[0], "../chunk"} }),
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "chunks larger than the limit",
+			upload:         upload(func(u *storage.Upload) { u.Size = 25 }),
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "file larger than the limit",
+			upload: upload(func(u *storage.Upload) {
+				u.Size, u.Chunks = 101, 11
+				for i := 2; i < 11; i++ {
+					u.ChunkIds = append(u.ChunkIds, strings.Repeat("c", 64))
+				}
+			}),
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:           "invalid item id",
+			upload:         upload(func(u *storage.Upload) { u.ItemId = "1" }),
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			db := mock_database.NewMockDatabase(ctrl)
+			if tt.prepare != nil {
+				tt.prepare(db)
+			}
+
+			server, _ := newUploadServer(t, db)
+
+			body, err := json.Marshal(tt.upload)
+			require.NoError(t, err)
+
+			code, res := request(t, http.MethodPost, server.URL+"/user/upload", body, nil)
+			assert.Equal(t, tt.expectedStatus, code)
+
+			if code == http.StatusOK {
+				var created storage.Upload
+				require.NoError(t, json.Unmarshal(res, &created))
+				assert.Equal(t, uploadID, created.Id)
+				assert.Equal(t, tt.expectedReceived, created.Received)
+			}
+		})
+	}
+}
+
+func TestHandler_UploadAndDownload(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	db := mock_database.NewMockDatabase(ctrl)
+
+	readUpload := func(_ context.Context, upload *storage.Upload, _ string) error {
+		*upload = storage.Upload{Id: upload.Id, ItemId: itemID, Manifest: "m", ChunkIds: chunkIDs, Size: 15, Chunks: 2}
+		return nil
+	}
+	db.EXPECT().ReadUpload(gomock.Any(), gomock.Any(), "testuser").DoAndReturn(readUpload).AnyTimes()
+	db.EXPECT().StoredChunks(gomock.Any(), []string(chunkIDs), "testuser").Return(map[string]bool{}, nil).AnyTimes()
+
+	server, blobs := newUploadServer(t, db)
+
+	chunk := func(n string) string {
+		return server.URL + "/user/upload/" + uploadID + "/" + n
+	}
+
+	code, _ := request(t, http.MethodPut, chunk("0"), []byte("0123456789a"), nil)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, code, "chunk larger than the limit")
+
+	code, _ = request(t, http.MethodPut, chunk("2"), []byte("01234"), nil)
+	assert.Equal(t, http.StatusBadRequest, code, "chunk out of the upload")
+
+	code, _ = request(t, http.MethodPut, chunk("0"), []byte("0123456789"), nil)
+	assert.Equal(t, http.StatusOK, code)
+
+	code, _ = request(t, http.MethodPut, chunk("1"), []byte("abcdef"), nil)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, code, "chunks larger than the upload")
+
+	db.EXPECT().Uploads(gomock.Any(), "testuser").
+		Return([]storage.Upload{{Id: uploadID, ChunkIds: chunkIDs, Chunks: 2}}, nil)
+
+	code, res := request(t, http.MethodGet, server.URL+"/user/uploads", nil, nil)
+	require.Equal(t, http.StatusOK, code)
+
+	var uploads []storage.Upload
+	require.NoError(t, json.Unmarshal(res, &uploads))
+	assert.Equal(t, []int{0}, uploads[0].Received)
+
+	code, _ = request(t, http.MethodPost, chunk("complete"), nil, nil)
+	assert.Equal(t, http.StatusPreconditionRequired, code, "replace without the version")
+
+	const oldBlob = "3c9b8f0e-2d4a-4b6c-9e1f-7a8b9c0d1e2f"
+	_, err := blobs.Put(oldBlob, 0, bytes.NewReader([]byte("old")))
+	require.NoError(t, err)
+
+	readOld := func(_ context.Context, bin *storage.BinaryData, _ string) error {
+		bin.Version, bin.BlobKey = 3, oldBlob
+		return nil
+	}
+
+	header := map[string]string{"If-Match": `"3"`, handlers.DeviceHeader: "laptop"}
+
+	gomock.InOrder(
+		db.EXPECT().ReadFile(gomock.Any(), gomock.Any(), "testuser").DoAndReturn(readOld),
+		db.EXPECT().CompleteUpload(gomock.Any(), gomock.Any(), gomock.Any(), map[int]int64{0: 10}, "testuser").
+			Return(nil, database.ErrMissingChunk),
+	)
+
+	code, res = request(t, http.MethodPost, chunk("complete"), nil, header)
+	require.Equal(t, http.StatusUnprocessableEntity, code, "missing chunk")
+
+	var missing storage.Upload
+	require.NoError(t, json.Unmarshal(res, &missing))
+	assert.Equal(t, []int{0}, missing.Received)
+
+	code, _ = request(t, http.MethodPut, chunk("1"), []byte("abcde"), nil)
+	assert.Equal(t, http.StatusOK, code)
+
+	gomock.InOrder(
+		db.EXPECT().ReadFile(gomock.Any(), gomock.Any(), "testuser").DoAndReturn(readOld),
+		db.EXPECT().CompleteUpload(gomock.Any(), gomock.Any(), gomock.Any(), map[int]int64{0: 10, 1: 5}, "testuser").
+			DoAndReturn(func(_ context.Context, upload *storage.Upload, bin *storage.BinaryData,
+				_ map[int]int64, _ string) ([]int, error) {
+				assert.Equal(t, int64(3), upload.Version)
+				assert.Equal(t, "laptop", bin.ModifiedBy)
+				assert.Equal(t, "fa0dafbf43f1f551e536353e9d1a942a8e86e41a0b58dfeaf264ef217f6b862a", bin.Hash)
+				bin.Id, bin.Chunks, bin.Manifest, bin.Version = itemID, upload.Chunks, upload.Manifest, 4
+				// the second chunk is stored already
+				return []int{1}, nil
+			}),
+	)
+
+	code, _ = request(t, http.MethodPost, chunk("complete"), nil, header)
+	require.Equal(t, http.StatusOK, code)
+
+	chunks, err := blobs.Chunks(oldBlob)
+	require.NoError(t, err)
+	assert.Empty(t, chunks, "the replaced blob is removed")
+
+	chunks, err = blobs.Chunks(uploadID)
+	require.NoError(t, err)
+	assert.Equal(t, map[int]int64{0: 10}, chunks, "the chunk stored before is removed")
+
+	readFile := func(_ context.Context, bin *storage.BinaryData, _ string) error {
+		bin.Chunks, bin.Manifest, bin.Version = 2, "m", 4
+		return nil
+	}
+	db.EXPECT().ReadFile(gomock.Any(), gomock.Any(), "testuser").DoAndReturn(readFile).Times(3)
+	db.EXPECT().ReadChunk(gomock.Any(), gomock.Any(), 0, "testuser").
+		Return(&storage.Chunk{Id: chunkIDs[0], BlobKey: uploadID, BlobN: 0}, nil)
+	db.EXPECT().FileChunks(gomock.Any(), gomock.Any(), "testuser").
+		Return([]storage.Chunk{{Id: chunkIDs[0]}, {Id: chunkIDs[1]}}, nil)
+
+	code, res = request(t, http.MethodGet, server.URL+"/user/download/"+itemID+"/0", nil, nil)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "0123456789", string(res))
+
+	code, _ = request(t, http.MethodGet, server.URL+"/user/download/"+itemID+"/2", nil, nil)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, res = request(t, http.MethodGet, server.URL+"/user/download/"+itemID, nil, nil)
+	require.Equal(t, http.StatusOK, code)
+
+	var ids []string
+	require.NoError(t, json.Unmarshal(res, &ids))
+	assert.Equal(t, []string(chunkIDs), ids)
+}
+
+func TestHandler_Usage(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	db := mock_database.NewMockDatabase(ctrl)
+
+	usage := &storage.Usage{Files: 2, Chunks: 3, Logical: 300, Physical: 200}
+	db.EXPECT().Usage(gomock.Any(), "testuser").Return(usage, nil)
+
+	server, _ := newUploadServer(t, db)
+
+	code, res := request(t, http.MethodGet, server.URL+"/user/usage", nil, nil)
+	require.Equal(t, http.StatusOK, code)
+
+	var got storage.Usage
+	require.NoError(t, json.Unmarshal(res, &got))
+	assert.Equal(t, *usage, got)
+}
+
+func TestHandler_DeleteRemovesBlob(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	db := mock_database.NewMockDatabase(ctrl)
+
+	server, blobs := newUploadServer(t, db)
+
+	_, err := blobs.Put(uploadID, 0, bytes.NewReader([]byte("chunk")))
+	require.NoError(t, err)
+
+	readFile := func(_ context.Context, bin *storage.BinaryData, _ string) error {
+		bin.Version, bin.BlobKey = 2, uploadID
+		return nil
+	}
+
+	gomock.InOrder(
+		db.EXPECT().ReadFile(gomock.Any(), gomock.Any(), "testuser").DoAndReturn(readFile),
+		db.EXPECT().Delete(gomock.Any(), gomock.Any(), "testuser").Return(database.ErrConflict),
+		db.EXPECT().Read(gomock.Any(), gomock.Any(), "testuser").Return([]byte(`{"id":"`+itemID+`","version":2}`), nil),
+		db.EXPECT().ReadFile(gomock.Any(), gomock.Any(), "testuser").DoAndReturn(readFile),
+		db.EXPECT().Delete(gomock.Any(), gomock.Any(), "testuser").Return(nil),
+	)
+
+	body, err := json.Marshal(storage.BinaryData{Id: itemID})
+	require.NoError(t, err)
+
+	header := map[string]string{"Data-Type": "bin", "If-Match": `"1"`}
+
+	code, _ := request(t, http.MethodPost, server.URL+"/user/delete", body, header)
+	assert.Equal(t, http.StatusConflict, code)
+
+	chunks, err := blobs.Chunks(uploadID)
+	require.NoError(t, err)
+	assert.Len(t, chunks, 1, "the blob of a stale version is kept")
+
+	header["If-Match"] = `"2"`
+
+	code, _ = request(t, http.MethodPost, server.URL+"/user/delete", body, header)
+	assert.Equal(t, http.StatusOK, code)
+
+	chunks, err = blobs.Chunks(uploadID)
+	require.NoError(t, err)
+	assert.Empty(t, chunks)
+}
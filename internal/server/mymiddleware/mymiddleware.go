@@ -1,14 +1,8 @@
 package mymiddleware
 
 import (
-	"context"
 	"log"
 	"net/http"
-	"time"
-
-	"github.com/EgorKo25/GophKeeper/internal/storage"
-
-	"github.com/EgorKo25/GophKeeper/internal/database"
 
 	"github.com/EgorKo25/GophKeeper/pkg/auth"
 )
@@ -16,109 +10,51 @@ import (
 // MyMiddleware middleware struct
 type MyMiddleware struct {
 	au *auth.Auth
-	db *database.ManagerDB
 }
 
 // NewMyMiddleware middleware struct constructor
-func NewMyMiddleware(au *auth.Auth, db *database.ManagerDB) *MyMiddleware {
+func NewMyMiddleware(au *auth.Auth) *MyMiddleware {
 	return &MyMiddleware{
 		au: au,
-		db: db,
 	}
 }
 
-func (m *MyMiddleware) CheckUserStatus(next http.Handler) http.Handler {
-
-	var user storage.User
-	ctx := context.Background()
-
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		login, _ := r.Cookie("User")
-
-		user.Login = login.Value
-		user.Status = true
-
-		_, err := m.db.Read(ctx, &user, login.Value)
-		if err != nil {
-			if err == database.ErrRace {
-				w.WriteHeader(http.StatusTooManyRequests)
-				return
-			}
-			log.Println(err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-
-		err = m.db.Update(ctx, &user, login.Value)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-
-		next.ServeHTTP(w, r)
-
-		user.Status = false
-
-		err = m.db.Update(ctx, user, login.Value)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-
-		w.WriteHeader(http.StatusOK)
-	})
-}
-
-// CheckCookie middleware for a check cookie
+// CheckCookie middleware for a check access token,
+// it puts the login of the verified user into the request context
 func (m *MyMiddleware) CheckCookie(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
-		u, err := r.Cookie("User")
-		if err == http.ErrNoCookie {
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
-			return
-		}
-
-		access, err := r.Cookie("Accesses-token")
+		access, err := r.Cookie(auth.AccessCookie)
 		if err == http.ErrNoCookie {
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
 
-		refresh, err := r.Cookie("Accesses-token")
-		if err == http.ErrNoCookie {
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
-			return
-		}
-
-		_, err = m.au.ParseWithClaims(refresh.Value)
+		login, err := m.au.ParseAccessToken(access.Value)
 		if err != nil {
 			log.Printf("parse token error: %s", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
 
-		_, err = m.au.ParseWithClaims(access.Value)
-		if err != nil {
-			log.Printf("parse token error: %s", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
+		next.ServeHTTP(w, r.WithContext(auth.NewContext(r.Context(), login)))
+	})
+}
 
-		if time.Until(access.Expires) < 5*time.Minute {
+// LimitBody middleware for a limit of the request body size,
+// a larger body is refused before it is read
+func (m *MyMiddleware) LimitBody(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
-			cookies, err := m.au.RefreshTokens(access.Value, refresh.Value, u.Value)
-			if err != nil {
-				log.Printf("create cookie error: %s", err)
-				w.WriteHeader(http.StatusInternalServerError)
+			if r.ContentLength > limit {
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
 				return
 			}
-			http.SetCookie(w, cookies[0])
-			http.SetCookie(w, cookies[1])
-			http.SetCookie(w, cookies[2])
-			next.ServeHTTP(w, r)
-			return
-		}
 
-	})
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+
+			next.ServeHTTP(w, r)
+		})
+	}
 }
@@ -0,0 +1,146 @@
+package mymiddleware_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/EgorKo25/GophKeeper/internal/server/mymiddleware"
+	"github.com/EgorKo25/GophKeeper/internal/storage"
+	"github.com/EgorKo25/GophKeeper/pkg/auth"
+)
+
+func TestMyMiddleware_CheckCookie(t *testing.T) {
+	au := auth.NewAuth("some-access-secret", "some-refresh-secret")
+
+	cookies, _, err := au.GenerateTokensAndCreateCookie(&storage.User{Login: "testuser"}, "")
+	if err != nil {
+		t.Fatalf("create cookie error: %s", err)
+	}
+
+	tokens := make(map[string]string)
+	for _, cookie := range cookies {
+		tokens[cookie.Name] = cookie.Value
+	}
+
+	tests := []struct {
+		name           string
+		cookies        []*http.Cookie
+		expectedStatus int
+		expectedLogin  string
+	}{
+		{
+			name:           "valid access token",
+			cookies:        []*http.Cookie{{Name: auth.AccessCookie, Value: tokens[auth.AccessCookie]}},
+			expectedStatus: http.StatusOK,
+			expectedLogin:  "testuser",
+		},
+		{
+			name: "user cookie does not override the token",
+			cookies: []*http.Cookie{
+				{Name: auth.AccessCookie, Value: tokens[auth.AccessCookie]},
+				{Name: "User", Value: "another"},
+			},
+			expectedStatus: http.StatusOK,
+			expectedLogin:  "testuser",
+		},
+		{
+			name:           "refresh token instead of access token",
+			cookies:        []*http.Cookie{{Name: auth.AccessCookie, Value: tokens[auth.RefreshCookie]}},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "missing access token",
+			cookies:        []*http.Cookie{{Name: "User", Value: "testuser"}},
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			var login string
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				login, _ = auth.FromContext(r.Context())
+				w.WriteHeader(http.StatusOK)
+			})
+
+			request := httptest.NewRequest(http.MethodPost, "/user/read", nil)
+			for _, cookie := range tt.cookies {
+				request.AddCookie(cookie)
+			}
+
+			w := httptest.NewRecorder()
+
+			m := mymiddleware.NewMyMiddleware(au)
+
+			m.CheckCookie(next).ServeHTTP(w, request)
+
+			result := w.Result()
+			defer result.Body.Close()
+
+			assert.Equal(t, tt.expectedStatus, result.StatusCode)
+			assert.Equal(t, tt.expectedLogin, login)
+		})
+	}
+}
+
+func TestMyMiddleware_LimitBody(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		unknownLength  bool
+		expectedStatus int
+	}{
+		{
+			name:           "body within the limit",
+			body:           "0123456789",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "declared length over the limit",
+			body:           "0123456789a",
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:           "streamed body over the limit",
+			body:           "0123456789a",
+			unknownLength:  true,
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if _, err := io.ReadAll(r.Body); err != nil {
+					w.WriteHeader(http.StatusRequestEntityTooLarge)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			})
+
+			request := httptest.NewRequest(http.MethodPost, "/user/add", strings.NewReader(tt.body))
+			if tt.unknownLength {
+				request.ContentLength = -1
+			}
+
+			w := httptest.NewRecorder()
+
+			m := mymiddleware.NewMyMiddleware(nil)
+
+			m.LimitBody(10)(next).ServeHTTP(w, request)
+
+			result := w.Result()
+			defer result.Body.Close()
+
+			assert.Equal(t, tt.expectedStatus, result.StatusCode)
+		})
+	}
+}
@@ -9,7 +9,7 @@ import (
 )
 
 // NewRouter router for a server
-func NewRouter(handler *handlers.Handler, middle *mymiddleware.MyMiddleware) chi.Router {
+func NewRouter(handler *handlers.Handler, middle *mymiddleware.MyMiddleware, maxBodySize int64) chi.Router {
 	r := chi.NewRouter()
 
 	r.Use(middleware.Logger)
@@ -17,14 +17,29 @@ func NewRouter(handler *handlers.Handler, middle *mymiddleware.MyMiddleware) chi
 	r.Group(func(r chi.Router) {
 		r.Post("/user/register", handler.Register)
 		r.Post("/user/login", handler.Login)
+		r.Post("/user/refresh", handler.Refresh)
+		r.Post("/user/logout", handler.Logout)
+		r.Post("/user/logout/all", handler.LogoutAll)
 	})
 	r.Group(func(r chi.Router) {
 		r.Use(middle.CheckCookie)
-		r.Use(middle.CheckUserStatus)
+		r.Use(middle.LimitBody(maxBodySize))
 		r.Post("/user/add", handler.Add)
 		r.Post("/user/read", handler.Read)
+		r.Post("/user/search", handler.Search)
+		r.Get("/user/items", handler.Items)
+		r.Get("/user/find", handler.Find)
+		r.Get("/user/sync", handler.Sync)
 		r.Post("/user/update", handler.Update)
 		r.Post("/user/delete", handler.Delete)
+		r.Post("/user/move", handler.Move)
+		r.Post("/user/upload", handler.CreateUpload)
+		r.Get("/user/uploads", handler.Uploads)
+		r.Put("/user/upload/{id}/{n}", handler.PutChunk)
+		r.Post("/user/upload/{id}/complete", handler.CompleteUpload)
+		r.Get("/user/download/{id}", handler.FileChunks)
+		r.Get("/user/download/{id}/{n}", handler.Download)
+		r.Get("/user/usage", handler.Usage)
 	})
 
 	return r
@@ -0,0 +1,225 @@
+// Package sshagent is a package for serving the ssh keys of the vault over the ssh-agent protocol.
+// The keys are held in memory only and are dropped when their lifetime ends
+package sshagent
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+var (
+	ErrReadOnly = errors.New("agent: keys are added from the vault only")
+	ErrDenied   = errors.New("agent: signing is denied by the user")
+	ErrNoCert   = errors.New("agent: not a certificate of the key")
+)
+
+// Key is a decrypted key of the vault
+type Key struct {
+	// PrivateKey is a key parsed by ParsePrivateKey
+	PrivateKey any
+	// Certificate is served along with the key if it is not nil
+	Certificate *ssh.Certificate
+	Comment     string
+	// Confirm asks the user before every signature made with the key
+	Confirm bool
+	// Lifetime is the time the key is served for, zero is unlimited
+	Lifetime time.Duration
+}
+
+// Agent is an ssh agent serving the keys of the vault.
+// Signing with a key added with Confirm is asked from the user with the confirm function
+type Agent struct {
+	agent.ExtendedAgent
+
+	confirm func(comment string) bool
+	// ask allows one question to the user at a time
+	ask sync.Mutex
+
+	mu sync.Mutex
+	// confirmed are the comments of the keys signing with which is confirmed by the marshaled public keys
+	confirmed map[string]string
+}
+
+// New is a constructor Agent
+func New(confirm func(comment string) bool) *Agent {
+	return &Agent{
+		ExtendedAgent: agent.NewKeyring().(agent.ExtendedAgent),
+		confirm:       confirm,
+		confirmed:     make(map[string]string),
+	}
+}
+
+// AddKey adds the key and its certificate,
+// the key is removed from memory when its lifetime ends
+func (a *Agent) AddKey(key Key) error {
+
+	signer, err := ssh.NewSignerFromKey(key.PrivateKey)
+	if err != nil {
+		return err
+	}
+
+	added := agent.AddedKey{
+		PrivateKey:   key.PrivateKey,
+		Comment:      key.Comment,
+		LifetimeSecs: uint32(key.Lifetime / time.Second),
+	}
+
+	publics := []ssh.PublicKey{signer.PublicKey()}
+
+	if key.Certificate != nil && !bytes.Equal(key.Certificate.Key.Marshal(), signer.PublicKey().Marshal()) {
+		return ErrNoCert
+	}
+
+	err = a.ExtendedAgent.Add(added)
+	if err != nil {
+		return err
+	}
+
+	if key.Certificate != nil {
+		added.Certificate = key.Certificate
+		err = a.ExtendedAgent.Add(added)
+		if err != nil {
+			return err
+		}
+		publics = append(publics, key.Certificate)
+	}
+
+	if key.Confirm {
+		a.mu.Lock()
+		for _, pub := range publics {
+			a.confirmed[string(pub.Marshal())] = key.Comment
+		}
+		a.mu.Unlock()
+	}
+
+	if key.Lifetime > 0 {
+		time.AfterFunc(key.Lifetime, func() {
+			for _, pub := range publics {
+				_ = a.Remove(pub)
+			}
+		})
+	}
+
+	return nil
+}
+
+// Add implements agent.Agent, the keys of the clients are refused
+func (a *Agent) Add(agent.AddedKey) error {
+	return ErrReadOnly
+}
+
+// Remove implements agent.Agent
+func (a *Agent) Remove(key ssh.PublicKey) error {
+
+	a.mu.Lock()
+	delete(a.confirmed, string(key.Marshal()))
+	a.mu.Unlock()
+
+	return a.ExtendedAgent.Remove(key)
+}
+
+// RemoveAll implements agent.Agent
+func (a *Agent) RemoveAll() error {
+
+	a.mu.Lock()
+	a.confirmed = make(map[string]string)
+	a.mu.Unlock()
+
+	return a.ExtendedAgent.RemoveAll()
+}
+
+// Sign implements agent.Agent
+func (a *Agent) Sign(key ssh.PublicKey, data []byte) (*ssh.Signature, error) {
+	return a.SignWithFlags(key, data, 0)
+}
+
+// SignWithFlags implements agent.ExtendedAgent, the user is asked to confirm the signature if the key requires it
+func (a *Agent) SignWithFlags(key ssh.PublicKey, data []byte, flags agent.SignatureFlags) (*ssh.Signature, error) {
+
+	a.mu.Lock()
+	comment, ok := a.confirmed[string(key.Marshal())]
+	a.mu.Unlock()
+
+	if ok {
+		a.ask.Lock()
+		allowed := a.confirm(comment)
+		a.ask.Unlock()
+
+		if !allowed {
+			return nil, ErrDenied
+		}
+	}
+
+	return a.ExtendedAgent.SignWithFlags(key, data, flags)
+}
+
+// Serve serves the agent protocol on the connections accepted by the listener until it is closed
+func (a *Agent) Serve(l net.Listener) error {
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		go func() {
+			defer conn.Close()
+			_ = agent.ServeAgent(a, conn)
+		}()
+	}
+}
+
+// ParsePrivateKey parses the private key in the OpenSSH or PEM format,
+// the passphrase is used only if the key is protected
+func ParsePrivateKey(pem, passphrase []byte) (any, error) {
+
+	if len(passphrase) == 0 {
+		return ssh.ParseRawPrivateKey(pem)
+	}
+
+	return ssh.ParseRawPrivateKeyWithPassphrase(pem, passphrase)
+}
+
+// IsProtected reports whether the private key can't be parsed without a passphrase
+func IsProtected(err error) bool {
+	var missing *ssh.PassphraseMissingError
+	return errors.As(err, &missing)
+}
+
+// PublicKey returns the public key of the private key in the authorized_keys format
+func PublicKey(private any) (string, error) {
+
+	signer, err := ssh.NewSignerFromKey(private)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey()))), nil
+}
+
+// ParseCertificate parses the certificate in the authorized_keys format
+func ParseCertificate(text []byte) (*ssh.Certificate, error) {
+
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(text)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNoCert, pub.Type())
+	}
+
+	return cert, nil
+}
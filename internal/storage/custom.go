@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Types of the custom fields
+const (
+	FieldText   = "text"
+	FieldHidden = "hidden"
+	FieldURL    = "url"
+	FieldDate   = "date"
+)
+
+// DateLayout is the format of the date custom fields
+const DateLayout = "2006-01-02"
+
+var (
+	ErrFieldName = errors.New("custom field has no name")
+	ErrFieldType = errors.New("unknown custom field type")
+	ErrFieldURL  = errors.New("custom field is not an absolute url")
+	ErrFieldDate = errors.New("custom field is not a date of the format " + DateLayout)
+)
+
+// CustomField is a field the user adds to an item.
+// The list of the custom fields of the item is encrypted as a whole, so the server sees neither the names nor the types
+type CustomField struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// Validate checks the field has a name and its value has the format of its type
+func (f CustomField) Validate() error {
+
+	if strings.TrimSpace(f.Name) == "" {
+		return ErrFieldName
+	}
+
+	switch f.Type {
+	case FieldText, FieldHidden:
+	case FieldURL:
+		u, err := url.Parse(f.Value)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return ErrFieldURL
+		}
+	case FieldDate:
+		_, err := time.Parse(DateLayout, f.Value)
+		if err != nil {
+			return ErrFieldDate
+		}
+	default:
+		return ErrFieldType
+	}
+
+	return nil
+}
+
+// SplitTags returns the tags separated by commas
+func SplitTags(tags string) []string {
+	return cleanTags(strings.Split(tags, ","))
+}
+
+// JoinTags joins the tags with commas
+func JoinTags(tags []string) string {
+	return strings.Join(cleanTags(tags), ", ")
+}
+
+// cleanTags returns the trimmed tags without the empty and repeated ones
+func cleanTags(tags []string) []string {
+
+	res := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+
+		seen[tag] = true
+		res = append(res, tag)
+	}
+
+	return res
+}
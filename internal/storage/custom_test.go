@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCustomField_Validate(t *testing.T) {
+	tests := []struct {
+		field    CustomField
+		expected error
+	}{
+		{CustomField{Name: "PIN", Type: FieldHidden, Value: "1234"}, nil},
+		{CustomField{Name: "Вопрос", Type: FieldText}, nil},
+		{CustomField{Name: "Сайт", Type: FieldURL, Value: "https://example.com/login"}, nil},
+		{CustomField{Name: "Сайт", Type: FieldURL, Value: "example.com"}, ErrFieldURL},
+		{CustomField{Name: "Выдан", Type: FieldDate, Value: "2024-02-29"}, nil},
+		{CustomField{Name: "Выдан", Type: FieldDate, Value: "29.02.2024"}, ErrFieldDate},
+		{CustomField{Name: " ", Type: FieldText}, ErrFieldName},
+		{CustomField{Name: "Счёт", Type: "number"}, ErrFieldType},
+	}
+
+	for _, tt := range tests {
+		assert.ErrorIs(t, tt.field.Validate(), tt.expected, tt.field)
+	}
+}
+
+func TestTags(t *testing.T) {
+	assert.Equal(t, []string{"work", "bank", "личное"}, SplitTags(" work,bank,, личное ,work"))
+	assert.Empty(t, SplitTags(""))
+	assert.Equal(t, "work, bank", JoinTags([]string{"work", " bank", ""}))
+}
@@ -0,0 +1,345 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Item is a vault item of a registered kind
+type Item interface {
+	// Kind returns the kind of the item
+	Kind() *Kind
+	// Header returns the fields every vault item has
+	Header() Header
+}
+
+// Header points to the fields every vault item has.
+// Tags are plain or encrypted as a whole, SecretTags is set for the encrypted ones,
+// Custom is the encrypted list of the custom fields.
+// Folder is the id of the folder the item is in, it is empty for the items at the top level.
+// Index is the blind search index of the name and the tags, the hashes of their tokens separated by spaces
+type Header struct {
+	Id         *string
+	LoginOwner *string
+	Version    *int64
+	Revision   *int64
+	ModifiedBy *string
+	Tags       *string
+	SecretTags *bool
+	Custom     *string
+	Folder     *string
+	Index      *string
+}
+
+// Field describes a field of an item kind.
+// Every field is encrypted by the client with the vault key
+type Field struct {
+	// Name is the column of the field
+	Name string
+	// Label is shown to the user
+	Label string
+	// Search marks the field the items are named by, the items are looked up
+	// by the blind index of its words
+	Search bool
+	// Secret marks the fields which are masked when the items are listed
+	Secret bool
+	// Optional marks the fields which may be empty, they are not asked from the user
+	Optional bool
+	// Multiline marks the fields which are edited as a text in an editor
+	Multiline bool
+
+	index int
+}
+
+// Value returns the value of the field of the item
+func (f Field) Value(item Item) string {
+
+	v := reflect.ValueOf(item).Elem().Field(f.index)
+	if v.Kind() == reflect.Slice {
+		return string(v.Bytes())
+	}
+
+	return v.String()
+}
+
+// SetValue sets the value of the field of the item
+func (f Field) SetValue(item Item, value string) {
+
+	v := reflect.ValueOf(item).Elem().Field(f.index)
+	if v.Kind() == reflect.Slice {
+		v.SetBytes([]byte(value))
+		return
+	}
+
+	v.SetString(value)
+}
+
+// Kind describes a type of the vault items: how they are stored, sent and shown
+type Kind struct {
+	// Name is the data type of the requests and the type of the tombstones
+	Name string
+	// Plural is the key of the items in the vault and the sync delta
+	Plural string
+	// Table is the table of the items
+	Table string
+	// Title is shown to the user
+	Title string
+	// Fields are the fields of the item the user fills in
+	Fields []Field
+	// New returns an empty item of the kind
+	New func() Item
+}
+
+// Search returns the field the items are named by
+func (k *Kind) Search() Field {
+
+	for _, f := range k.Fields {
+		if f.Search {
+			return f
+		}
+	}
+
+	return Field{}
+}
+
+// Columns returns the columns of the item struct
+func (k *Kind) Columns() []string {
+
+	t := reflect.TypeOf(k.New()).Elem()
+
+	columns := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		column := t.Field(i).Tag.Get("db")
+		if column != "" && column != "-" {
+			columns = append(columns, column)
+		}
+	}
+
+	return columns
+}
+
+// kinds are the registered kinds in the order of registration
+var kinds []*Kind
+
+// Register adds the kind to the registry, the fields must be string or []byte fields of the item
+// struct tagged with their names
+func Register(kind *Kind) *Kind {
+
+	if _, ok := KindOf(kind.Name); ok {
+		panic(fmt.Sprintf("kind %s is registered twice", kind.Name))
+	}
+
+	t := reflect.TypeOf(kind.New()).Elem()
+
+	for i := range kind.Fields {
+		f, ok := fieldByTag(t, kind.Fields[i].Name)
+		if !ok || (f.Type.Kind() != reflect.String && f.Type != reflect.TypeOf([]byte(nil))) {
+			panic(fmt.Sprintf("kind %s has no text field %s", kind.Name, kind.Fields[i].Name))
+		}
+		kind.Fields[i].index = f.Index[0]
+	}
+
+	kinds = append(kinds, kind)
+
+	return kind
+}
+
+// fieldByTag returns the struct field with the db tag
+func fieldByTag(t reflect.Type, tag string) (reflect.StructField, bool) {
+
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("db") == tag {
+			return t.Field(i), true
+		}
+	}
+
+	return reflect.StructField{}, false
+}
+
+// KindOf returns the registered kind by name
+func KindOf(name string) (*Kind, bool) {
+
+	for _, kind := range kinds {
+		if kind.Name == name {
+			return kind, true
+		}
+	}
+
+	return nil, false
+}
+
+// Kinds returns the registered kinds in the order of registration
+func Kinds() []*Kind {
+	return kinds
+}
+
+// Items holds the vault items by the kind name
+type Items map[string][]Item
+
+// Add appends the item to the items of its kind
+func (items Items) Add(item Item) {
+	items[item.Kind().Name] = append(items[item.Kind().Name], item)
+}
+
+// marshalItems marshals the struct and adds the items of every kind under its plural key
+func marshalItems(v any, items Items) ([]byte, error) {
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(data, &fields)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, kind := range kinds {
+		list := items[kind.Name]
+		if list == nil {
+			list = []Item{}
+		}
+
+		fields[kind.Plural], err = json.Marshal(list)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(fields)
+}
+
+// unmarshalItems reads the items of every kind from its plural key
+func unmarshalItems(data []byte) (Items, error) {
+
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(data, &fields)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make(Items)
+	for _, kind := range kinds {
+		var list []json.RawMessage
+		if raw, ok := fields[kind.Plural]; ok {
+			err = json.Unmarshal(raw, &list)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", kind.Plural, err)
+			}
+		}
+
+		for _, raw := range list {
+			item := kind.New()
+			err = json.Unmarshal(raw, item)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", kind.Plural, err)
+			}
+			items.Add(item)
+		}
+	}
+
+	return items, nil
+}
+
+// Registered kinds
+var (
+	PasswordKind = Register(&Kind{
+		Name:   "password",
+		Plural: "passwords",
+		Table:  "passwords",
+		Title:  "Пароль",
+		Fields: []Field{
+			{Name: "service", Label: "Название сервиса", Search: true},
+			{Name: "login", Label: "Логин"},
+			{Name: "password", Label: "Пароль", Secret: true},
+		},
+		New: func() Item { return &Password{} },
+	})
+
+	CardKind = Register(&Kind{
+		Name:   "card",
+		Plural: "cards",
+		Table:  "cards",
+		Title:  "Карта",
+		Fields: []Field{
+			{Name: "bank", Label: "Название банка", Search: true},
+			{Name: "number", Label: "Номер карты", Secret: true},
+			{Name: "date_end", Label: "Дата окончания", Secret: true},
+			{Name: "secret_code", Label: "Секретный код", Secret: true},
+			{Name: "owner", Label: "Владелец"},
+		},
+		New: func() Item { return &Card{} },
+	})
+
+	NoteKind = Register(&Kind{
+		Name:   "note",
+		Plural: "notes",
+		Table:  "notes",
+		Title:  "Заметка",
+		Fields: []Field{
+			{Name: "title", Label: "Заголовок", Search: true},
+			{Name: "body", Label: "Текст", Secret: true, Multiline: true},
+		},
+		New: func() Item { return &Note{} },
+	})
+
+	OTPKind = Register(&Kind{
+		Name:   "otp",
+		Plural: "otps",
+		Table:  "otps",
+		Title:  "Одноразовый код",
+		Fields: []Field{
+			{Name: "issuer", Label: "Название сервиса", Search: true},
+			{Name: "account", Label: "Аккаунт"},
+			{Name: "uri", Label: "Ссылка otpauth://", Secret: true},
+			{Name: "password_id", Label: "Связанный пароль", Optional: true},
+		},
+		New: func() Item { return &OTP{} },
+	})
+
+	SSHKeyKind = Register(&Kind{
+		Name:   "ssh",
+		Plural: "ssh_keys",
+		Table:  "ssh_keys",
+		Title:  "SSH-ключ",
+		Fields: []Field{
+			{Name: "name", Label: "Название ключа", Search: true},
+			{Name: "comment", Label: "Комментарий"},
+			{Name: "private_key", Label: "Закрытый ключ", Secret: true, Multiline: true},
+			{Name: "public_key", Label: "Открытый ключ", Optional: true},
+			{Name: "certificate", Label: "Сертификат", Optional: true},
+			{Name: "passphrase", Label: "Парольная фраза", Secret: true, Optional: true},
+			{Name: "confirm", Label: "Подтверждать подпись", Optional: true},
+			{Name: "lifetime", Label: "Время жизни в агенте", Optional: true},
+		},
+		New: func() Item { return &SSHKey{} },
+	})
+
+	// FileKind is the kind of the files, their content is uploaded in chunks
+	FileKind = Register(&Kind{
+		Name:   "bin",
+		Plural: "binary_data",
+		Table:  "binary_data",
+		Title:  "Файл",
+		Fields: []Field{
+			{Name: "title", Label: "Название файла", Search: true},
+			{Name: "manifest", Label: "Манифест", Secret: true, Optional: true},
+			{Name: "file_key", Label: "Ключ файла", Secret: true, Optional: true},
+		},
+		New: func() Item { return &BinaryData{} },
+	})
+
+	// FolderKind is the kind of the folders, the items and the other folders are put in them by their folder id
+	FolderKind = Register(&Kind{
+		Name:   "folder",
+		Plural: "folders",
+		Table:  "folders",
+		Title:  "Папка",
+		Fields: []Field{
+			{Name: "name", Label: "Название папки", Search: true},
+		},
+		New: func() Item { return &Folder{} },
+	})
+)
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKinds(t *testing.T) {
+	for _, kind := range Kinds() {
+		t.Run(kind.Name, func(t *testing.T) {
+			found, ok := KindOf(kind.Name)
+			require.True(t, ok)
+			assert.Same(t, kind, found)
+
+			item := kind.New()
+			assert.Same(t, kind, item.Kind())
+			assert.True(t, kind.Search().Search)
+
+			for _, f := range kind.Fields {
+				f.SetValue(item, "value of "+f.Name)
+				assert.Equal(t, "value of "+f.Name, f.Value(item))
+			}
+
+			*item.Header().Id = "id"
+			assert.Contains(t, kind.Columns(), "id")
+			assert.Contains(t, kind.Columns(), "login_owner")
+		})
+	}
+
+	_, ok := KindOf("unknown")
+	assert.False(t, ok)
+
+	assert.Panics(t, func() {
+		Register(&Kind{Name: "password", New: func() Item { return &Password{} }})
+	})
+}
+
+func TestSyncDelta_JSON(t *testing.T) {
+	delta := SyncDelta{
+		Cursor: 5,
+		Items: Items{
+			"password": {&Password{Id: "p1", Service: "yandex", Version: 2}},
+			"bin":      {&BinaryData{Id: "b1", Title: "notes", Chunks: 3}},
+		},
+		Deleted: []Tombstone{{Id: "c1", Type: "card"}},
+	}
+
+	data, err := json.Marshal(delta)
+	require.NoError(t, err)
+
+	// the items are sent under the plural of their kind, so older clients still read them
+	var fields map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(data, &fields))
+	assert.JSONEq(t, `[]`, string(fields["cards"]))
+	assert.JSONEq(t, `[{"id":"p1","service":"yandex","login_owner":"","login":"","password":"","version":2}]`,
+		string(fields["passwords"]))
+
+	var res SyncDelta
+	require.NoError(t, json.Unmarshal(data, &res))
+	assert.Equal(t, delta.Cursor, res.Cursor)
+	assert.Equal(t, delta.Deleted, res.Deleted)
+	assert.Equal(t, delta.Items["password"], res.Items["password"])
+	assert.Equal(t, delta.Items["bin"], res.Items["bin"])
+	assert.Empty(t, res.Items["card"])
+}
+
+func TestUserDate_JSON(t *testing.T) {
+	vault := UserDate{
+		User:    User{Login: "testuser"},
+		Items:   Items{"card": {&Card{Id: "c1", Bank: "tinkoff"}}},
+		KeyMeta: &KeyMeta{Time: 3},
+	}
+
+	data, err := json.Marshal(vault)
+	require.NoError(t, err)
+
+	var res UserDate
+	require.NoError(t, json.Unmarshal(data, &res))
+	assert.Equal(t, vault.User.Login, res.User.Login)
+	assert.Equal(t, vault.KeyMeta, res.KeyMeta)
+	assert.Equal(t, vault.Items["card"], res.Items["card"])
+}
+
+func TestConflict_JSON(t *testing.T) {
+	conflict := Conflict{
+		Error: "stale",
+		Type:  "password",
+		Item:  &Password{Id: "p1", Version: 3, ModifiedBy: "laptop"},
+	}
+
+	data, err := json.Marshal(conflict)
+	require.NoError(t, err)
+
+	var res Conflict
+	require.NoError(t, json.Unmarshal(data, &res))
+	assert.Equal(t, conflict, res)
+
+	require.NoError(t, json.Unmarshal([]byte(`{"error":"stale"}`), &res))
+	assert.Equal(t, Conflict{Error: "stale"}, res)
+}
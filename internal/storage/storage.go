@@ -1,6 +1,10 @@
 package storage
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
 	"time"
 )
 
@@ -12,37 +16,421 @@ type User struct {
 	Email     string    `json:"email" form:"email" db:"email"`
 	CreatedAt time.Time `db:"created_at"`
 	UpdatedAt time.Time `db:"updated_at"`
-	Status    bool      `db:"status"`
+
+	// LegacyLogin and LegacyPassword are the credentials encrypted like the old DES clients sent them,
+	// the account they registered is renamed to Login on the first login of a new client
+	LegacyLogin    string `json:"legacy_login,omitempty" db:"-"`
+	LegacyPassword string `json:"legacy_passwd,omitempty" db:"-"`
 }
 
 type Card struct {
-	Id         int    `db:"id" json:"id"`
+	Id         string `db:"id" json:"id,omitempty"`
 	Bank       string `db:"bank" json:"bank"`
 	LoginOwner string `db:"login_owner" json:"login_owner"`
 	Number     string `db:"number" json:"number"`
 	DataEnd    string `db:"date_end" json:"date_end"`
 	SecretCode string `db:"secret_code" json:"secret_code"`
 	Owner      string `db:"owner" json:"owner"`
+	FolderId   string `db:"folder_id" json:"folder_id,omitempty"`
+	Tags       string `db:"tags" json:"tags,omitempty"`
+	SecretTags bool   `db:"secret_tags" json:"secret_tags,omitempty"`
+	Custom     string `db:"custom" json:"custom,omitempty"`
+	Index      string `db:"search_index" json:"search_index,omitempty"`
+	Version    int64  `db:"version" json:"version"`
+	Revision   int64  `db:"revision" json:"revision,omitempty"`
+	ModifiedBy string `db:"modified_by" json:"modified_by,omitempty"`
+}
+
+// Kind implements Item
+func (c *Card) Kind() *Kind { return CardKind }
+
+// Header implements Item
+func (c *Card) Header() Header {
+	return Header{&c.Id, &c.LoginOwner, &c.Version, &c.Revision, &c.ModifiedBy, &c.Tags, &c.SecretTags, &c.Custom, &c.FolderId, &c.Index}
 }
 
 type Password struct {
-	Id         int    `db:"id" json:"id,omitempty"`
+	Id         string `db:"id" json:"id,omitempty"`
 	Service    string `db:"service" json:"service"`
 	LoginOwner string `db:"login_owner" json:"login_owner"`
 	Login      string `db:"login" json:"login"`
 	Password   string `db:"password" json:"password"`
+	FolderId   string `db:"folder_id" json:"folder_id,omitempty"`
+	Tags       string `db:"tags" json:"tags,omitempty"`
+	SecretTags bool   `db:"secret_tags" json:"secret_tags,omitempty"`
+	Custom     string `db:"custom" json:"custom,omitempty"`
+	Index      string `db:"search_index" json:"search_index,omitempty"`
+	Version    int64  `db:"version" json:"version"`
+	Revision   int64  `db:"revision" json:"revision,omitempty"`
+	ModifiedBy string `db:"modified_by" json:"modified_by,omitempty"`
+}
+
+// Kind implements Item
+func (p *Password) Kind() *Kind { return PasswordKind }
+
+// Header implements Item
+func (p *Password) Header() Header {
+	return Header{&p.Id, &p.LoginOwner, &p.Version, &p.Revision, &p.ModifiedBy, &p.Tags, &p.SecretTags, &p.Custom, &p.FolderId, &p.Index}
+}
+
+// Note structure describing a secure note, Body is markdown and Tags are separated by commas
+type Note struct {
+	Id         string `db:"id" json:"id,omitempty"`
+	Title      string `db:"title" json:"title"`
+	LoginOwner string `db:"login_owner" json:"login_owner"`
+	Body       string `db:"body" json:"body"`
+	FolderId   string `db:"folder_id" json:"folder_id,omitempty"`
+	Tags       string `db:"tags" json:"tags,omitempty"`
+	SecretTags bool   `db:"secret_tags" json:"secret_tags,omitempty"`
+	Custom     string `db:"custom" json:"custom,omitempty"`
+	Index      string `db:"search_index" json:"search_index,omitempty"`
+	Version    int64  `db:"version" json:"version"`
+	Revision   int64  `db:"revision" json:"revision,omitempty"`
+	ModifiedBy string `db:"modified_by" json:"modified_by,omitempty"`
+}
+
+// Kind implements Item
+func (n *Note) Kind() *Kind { return NoteKind }
+
+// Header implements Item
+func (n *Note) Header() Header {
+	return Header{&n.Id, &n.LoginOwner, &n.Version, &n.Revision, &n.ModifiedBy, &n.Tags, &n.SecretTags, &n.Custom, &n.FolderId, &n.Index}
+}
+
+// OTP structure describing an authenticator secret.
+// URI is the otpauth:// URI with the secret and the parameters of the codes,
+// PasswordId optionally links the secret to the password of the same service
+type OTP struct {
+	Id         string `db:"id" json:"id,omitempty"`
+	Issuer     string `db:"issuer" json:"issuer"`
+	LoginOwner string `db:"login_owner" json:"login_owner"`
+	Account    string `db:"account" json:"account"`
+	URI        string `db:"uri" json:"uri"`
+	PasswordId string `db:"password_id" json:"password_id,omitempty"`
+	FolderId   string `db:"folder_id" json:"folder_id,omitempty"`
+	Tags       string `db:"tags" json:"tags,omitempty"`
+	SecretTags bool   `db:"secret_tags" json:"secret_tags,omitempty"`
+	Custom     string `db:"custom" json:"custom,omitempty"`
+	Index      string `db:"search_index" json:"search_index,omitempty"`
+	Version    int64  `db:"version" json:"version"`
+	Revision   int64  `db:"revision" json:"revision,omitempty"`
+	ModifiedBy string `db:"modified_by" json:"modified_by,omitempty"`
+}
+
+// Kind implements Item
+func (o *OTP) Kind() *Kind { return OTPKind }
+
+// Header implements Item
+func (o *OTP) Header() Header {
+	return Header{&o.Id, &o.LoginOwner, &o.Version, &o.Revision, &o.ModifiedBy, &o.Tags, &o.SecretTags, &o.Custom, &o.FolderId, &o.Index}
+}
+
+// SSHKey structure describing an ssh key.
+// PrivateKey is kept in the OpenSSH or PEM format, a protected key is opened with Passphrase.
+// Confirm and Lifetime are the constraints of the key served by the agent
+type SSHKey struct {
+	Id          string `db:"id" json:"id,omitempty"`
+	Name        string `db:"name" json:"name"`
+	LoginOwner  string `db:"login_owner" json:"login_owner"`
+	Comment     string `db:"comment" json:"comment"`
+	PrivateKey  string `db:"private_key" json:"private_key"`
+	PublicKey   string `db:"public_key" json:"public_key"`
+	Certificate string `db:"certificate" json:"certificate,omitempty"`
+	Passphrase  string `db:"passphrase" json:"passphrase,omitempty"`
+	Confirm     string `db:"confirm" json:"confirm,omitempty"`
+	Lifetime    string `db:"lifetime" json:"lifetime,omitempty"`
+	FolderId    string `db:"folder_id" json:"folder_id,omitempty"`
+	Tags        string `db:"tags" json:"tags,omitempty"`
+	SecretTags  bool   `db:"secret_tags" json:"secret_tags,omitempty"`
+	Custom      string `db:"custom" json:"custom,omitempty"`
+	Index       string `db:"search_index" json:"search_index,omitempty"`
+	Version     int64  `db:"version" json:"version"`
+	Revision    int64  `db:"revision" json:"revision,omitempty"`
+	ModifiedBy  string `db:"modified_by" json:"modified_by,omitempty"`
 }
 
+// Kind implements Item
+func (k *SSHKey) Kind() *Kind { return SSHKeyKind }
+
+// Header implements Item
+func (k *SSHKey) Header() Header {
+	return Header{&k.Id, &k.LoginOwner, &k.Version, &k.Revision, &k.ModifiedBy, &k.Tags, &k.SecretTags, &k.Custom, &k.FolderId, &k.Index}
+}
+
+// BinaryData structure describing a file.
+// The file is uploaded in chunks kept in the blob store:
+// Chunks is their number and Size is their total size.
+// The chunks are shared by the files of the user with the same content, Manifest is the digest
+// of the chunk ids in order encrypted with the vault key and Hash is the SHA-256 of the ids.
+// The files uploaded before have Key, the file key encrypted with the vault key,
+// and Hash is the SHA-256 of their chunks. The files stored in the database before the blob store
+// have neither: the server has moved their content encrypted with the vault key into one chunk
 type BinaryData struct {
-	Id         int    `db:"id" json:"id"`
+	Id         string `db:"id" json:"id,omitempty"`
 	Title      string `db:"title" json:"title"`
 	LoginOwner string `db:"login_owner" json:"login_owner"`
-	Data       []byte `db:"data" json:"data"`
+	Size       int64  `db:"size" json:"size,omitempty"`
+	Chunks     int    `db:"chunks" json:"chunks,omitempty"`
+	Manifest   string `db:"manifest" json:"manifest,omitempty"`
+	Key        string `db:"file_key" json:"key,omitempty"`
+	Hash       string `db:"content_hash" json:"hash,omitempty"`
+	BlobKey    string `db:"blob_key" json:"-"`
+	FolderId   string `db:"folder_id" json:"folder_id,omitempty"`
+	Tags       string `db:"tags" json:"tags,omitempty"`
+	SecretTags bool   `db:"secret_tags" json:"secret_tags,omitempty"`
+	Custom     string `db:"custom" json:"custom,omitempty"`
+	Index      string `db:"search_index" json:"search_index,omitempty"`
+	Version    int64  `db:"version" json:"version"`
+	Revision   int64  `db:"revision" json:"revision,omitempty"`
+	ModifiedBy string `db:"modified_by" json:"modified_by,omitempty"`
+}
+
+// Kind implements Item
+func (b *BinaryData) Kind() *Kind { return FileKind }
+
+// Header implements Item
+func (b *BinaryData) Header() Header {
+	return Header{&b.Id, &b.LoginOwner, &b.Version, &b.Revision, &b.ModifiedBy, &b.Tags, &b.SecretTags, &b.Custom, &b.FolderId, &b.Index}
+}
+
+// Folder structure describing a folder of the vault items.
+// The folders are nested: FolderId is the id of the parent folder, the server keeps the tree without cycles.
+// Only the name is encrypted, the server sees the structure of the tree but not the names
+type Folder struct {
+	Id         string `db:"id" json:"id,omitempty"`
+	Name       string `db:"name" json:"name"`
+	LoginOwner string `db:"login_owner" json:"login_owner"`
+	FolderId   string `db:"folder_id" json:"folder_id,omitempty"`
+	Tags       string `db:"tags" json:"tags,omitempty"`
+	SecretTags bool   `db:"secret_tags" json:"secret_tags,omitempty"`
+	Custom     string `db:"custom" json:"custom,omitempty"`
+	Index      string `db:"search_index" json:"search_index,omitempty"`
+	Version    int64  `db:"version" json:"version"`
+	Revision   int64  `db:"revision" json:"revision,omitempty"`
+	ModifiedBy string `db:"modified_by" json:"modified_by,omitempty"`
+}
+
+// Kind implements Item
+func (f *Folder) Kind() *Kind { return FolderKind }
+
+// Header implements Item
+func (f *Folder) Header() Header {
+	return Header{&f.Id, &f.LoginOwner, &f.Version, &f.Revision, &f.ModifiedBy, &f.Tags, &f.SecretTags, &f.Custom, &f.FolderId, &f.Index}
+}
+
+// Upload structure describing an unfinished chunked upload of a file.
+// An upload with ItemId replaces the content of the file of Version.
+// Fingerprint lets the client find the upload of the same local file to resume it.
+// ChunkIds are the ids of the chunks in order, Received are the chunks the server
+// has got or already stores, so the client sends only the others
+type Upload struct {
+	Id          string    `db:"id" json:"id,omitempty"`
+	LoginOwner  string    `db:"login_owner" json:"login_owner"`
+	ItemId      string    `db:"item_id" json:"item_id,omitempty"`
+	Title       string    `db:"title" json:"title"`
+	Fingerprint string    `db:"fingerprint" json:"fingerprint"`
+	Manifest    string    `db:"manifest" json:"manifest"`
+	ChunkIds    ChunkIds  `db:"chunk_ids" json:"chunk_ids"`
+	Size        int64     `db:"size" json:"size"`
+	Chunks      int       `db:"chunks" json:"chunks"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+	Version     int64     `db:"-" json:"version,omitempty"`
+	Received    []int     `db:"-" json:"received,omitempty"`
+}
+
+// ChunkIds is a list of chunk ids stored as one comma separated column
+type ChunkIds []string
+
+// Value implements driver.Valuer
+func (ids ChunkIds) Value() (driver.Value, error) {
+	return strings.Join(ids, ","), nil
+}
+
+// Scan implements sql.Scanner
+func (ids *ChunkIds) Scan(src any) error {
+
+	var s string
+
+	switch v := src.(type) {
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	case nil:
+	default:
+		return fmt.Errorf("can't scan %T into chunk ids", src)
+	}
+
+	*ids = nil
+	if s != "" {
+		*ids = strings.Split(s, ",")
+	}
+
+	return nil
+}
+
+// Chunk structure describing a chunk of the user's files.
+// Chunks with the same content share the id, Refs counts the places of the chunk in the files.
+// The chunk is kept as the BlobN-th chunk of the blob of the upload it came with
+type Chunk struct {
+	Id      string `db:"id" json:"id"`
+	BlobKey string `db:"blob_key" json:"-"`
+	BlobN   int    `db:"blob_n" json:"-"`
+	Size    int64  `db:"size" json:"size"`
+	Refs    int    `db:"refs" json:"-"`
+}
+
+// Usage structure describing the storage used by the files of the user.
+// Logical is the size of all files, Physical is the size of the stored chunks without the duplicates
+type Usage struct {
+	Files    int   `db:"files" json:"files"`
+	Chunks   int   `db:"chunks" json:"chunks"`
+	Logical  int64 `db:"logical" json:"logical"`
+	Physical int64 `db:"physical" json:"physical"`
+}
+
+// KeyMeta structure describing how the user's vault key is derived.
+// ContentKey is the key of the file chunks encrypted with the vault key
+type KeyMeta struct {
+	Id         int    `db:"id" json:"id,omitempty"`
+	LoginOwner string `db:"login_owner" json:"login_owner"`
+	Salt       []byte `db:"salt" json:"salt"`
+	Time       uint32 `db:"time" json:"time"`
+	Memory     uint32 `db:"memory" json:"memory"`
+	Threads    uint8  `db:"threads" json:"threads"`
+	Check      string `db:"key_check" json:"check"`
+	ContentKey string `db:"content_key" json:"content_key,omitempty"`
+}
+
+// Session structure describing a refresh token issued to the user.
+// Tokens rotated from one login share the family
+type Session struct {
+	Id         string    `db:"id"`
+	Family     string    `db:"family"`
+	LoginOwner string    `db:"login_owner"`
+	TokenHash  string    `db:"token_hash"`
+	ExpiresAt  time.Time `db:"expires_at"`
+	CreatedAt  time.Time `db:"created_at"`
+	Used       bool      `db:"used"`
+	Revoked    bool      `db:"revoked"`
+}
+
+// Conflict structure describing the rejection of a change made to a stale version of an item.
+// It holds the current version of the item and its kind
+type Conflict struct {
+	Error string `json:"error"`
+	Type  string `json:"type,omitempty"`
+	Item  Item   `json:"item,omitempty"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler, the item is read as the kind of the type
+func (c *Conflict) UnmarshalJSON(data []byte) error {
+
+	var raw struct {
+		Error string          `json:"error"`
+		Type  string          `json:"type"`
+		Item  json.RawMessage `json:"item"`
+	}
+
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return err
+	}
+
+	c.Error, c.Type, c.Item = raw.Error, raw.Type, nil
+
+	kind, ok := KindOf(raw.Type)
+	if !ok || len(raw.Item) == 0 || string(raw.Item) == "null" {
+		return nil
+	}
+
+	c.Item = kind.New()
+
+	return json.Unmarshal(raw.Item, c.Item)
+}
+
+// ItemMeta structure describing a vault item without its secret fields, FolderId is the folder the item is in.
+// Score is the number of the query tokens a found item has
+type ItemMeta struct {
+	Id         string    `db:"id" json:"id"`
+	Type       string    `db:"type" json:"type"`
+	Name       string    `db:"name" json:"name"`
+	Tags       string    `db:"tags" json:"tags,omitempty"`
+	SecretTags bool      `db:"secret_tags" json:"secret_tags,omitempty"`
+	FolderId   string    `db:"folder_id" json:"folder_id,omitempty"`
+	Score      int       `db:"score" json:"score,omitempty"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt  time.Time `db:"updated_at" json:"updated_at"`
 }
 
+// ItemList structure describing a page of the vault items
+type ItemList struct {
+	Items  []ItemMeta `json:"items"`
+	Total  int        `json:"total"`
+	Offset int        `json:"offset"`
+}
+
+// Tombstone structure describing a deleted vault item
+type Tombstone struct {
+	Id   string `db:"id" json:"id"`
+	Type string `db:"type" json:"type"`
+}
+
+// SyncDelta structure describing the changes of the vault since a cursor.
+// Cursor is the revision to pull the next changes since.
+// The changed items of every kind are sent under the plural of the kind
+type SyncDelta struct {
+	Cursor  int64       `json:"cursor"`
+	Items   Items       `json:"-"`
+	Deleted []Tombstone `json:"deleted"`
+}
+
+// syncDelta is SyncDelta without the methods
+type syncDelta SyncDelta
+
+// MarshalJSON implements json.Marshaler
+func (d SyncDelta) MarshalJSON() ([]byte, error) {
+	return marshalItems(syncDelta(d), d.Items)
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (d *SyncDelta) UnmarshalJSON(data []byte) (err error) {
+
+	err = json.Unmarshal(data, (*syncDelta)(d))
+	if err != nil {
+		return err
+	}
+
+	d.Items, err = unmarshalItems(data)
+
+	return err
+}
+
+// UserDate structure describing the whole user vault.
+// The items of every kind are sent under the plural of the kind
 type UserDate struct {
-	User       `json:"user"`
-	Cards      []Card       `json:"cards"`
-	Passwords  []Password   `json:"passwords"`
-	BinaryData []BinaryData `json:"binary_data"`
+	User    `json:"user"`
+	Items   Items    `json:"-"`
+	KeyMeta *KeyMeta `json:"key_meta"`
+}
+
+// userDate is UserDate without the methods
+type userDate UserDate
+
+// MarshalJSON implements json.Marshaler
+func (v UserDate) MarshalJSON() ([]byte, error) {
+	return marshalItems(userDate(v), v.Items)
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (v *UserDate) UnmarshalJSON(data []byte) (err error) {
+
+	err = json.Unmarshal(data, (*userDate)(v))
+	if err != nil {
+		return err
+	}
+
+	v.Items, err = unmarshalItems(data)
+
+	return err
 }
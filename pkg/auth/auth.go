@@ -1,6 +1,10 @@
 package auth
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"net/http"
 	"time"
@@ -10,168 +14,250 @@ import (
 	"github.com/dgrijalva/jwt-go"
 )
 
+const (
+	// AccessCookie is a name of the cookie with the access token
+	AccessCookie = "Access-token"
+	// RefreshCookie is a name of the cookie with the refresh token
+	RefreshCookie = "Refresh-token"
+
+	accessTTL  = 15 * time.Minute
+	refreshTTL = 24 * time.Hour
+
+	typeAccess  = "access"
+	typeRefresh = "refresh"
+)
+
 // Auth is a struct for authentication and session control
 type Auth struct {
-	secret string
+	accessSecret  string
+	refreshSecret string
 }
 
-// NewAuth is a contractor
-func NewAuth(secret string) *Auth {
+// NewAuth is a contractor, access and refresh tokens are signed with different secrets
+func NewAuth(accessSecret, refreshSecret string) *Auth {
 	return &Auth{
-		secret: secret,
+		accessSecret:  accessSecret,
+		refreshSecret: refreshSecret,
 	}
 }
 
 var (
 	ErrTokenInvalid    = errors.New("token invalid")
+	ErrTokenType       = errors.New("unexpected token type")
 	ErrClaimsNotOfType = errors.New("token claims are not of type *tokenClaims")
 	ErrSigningMethod   = errors.New("invalid singing method")
 )
 
+// loginKey is a context key of the authenticated user login
+type loginKey struct{}
+
+// NewContext returns a copy of ctx carrying the authenticated user login
+func NewContext(ctx context.Context, login string) context.Context {
+	return context.WithValue(ctx, loginKey{}, login)
+}
+
+// FromContext returns the authenticated user login stored by NewContext
+func FromContext(ctx context.Context) (string, bool) {
+	login, ok := ctx.Value(loginKey{}).(string)
+	return login, ok && login != ""
+}
+
 type claims struct {
-	Name string `json:"name"`
+	Name   string `json:"name"`
+	Type   string `json:"typ"`
+	Family string `json:"fam,omitempty"`
 	jwt.StandardClaims
 }
 
-func (a *Auth) RefreshTokens(access, refresh, login string) ([]*http.Cookie, error) {
-	accessParsed, err := jwt.ParseWithClaims(access, &claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, ErrSigningMethod
-		}
+// RefreshTokens checks the refresh token and issues a new pair of tokens of the same family.
+// It returns the session of the presented token and the session of the new one,
+// the caller must rotate them in the session store
+func (a *Auth) RefreshTokens(refresh string) ([]*http.Cookie, *storage.Session, *storage.Session, error) {
+	old, err := a.ParseRefreshToken(refresh)
+	if err != nil {
+		return nil, nil, nil, err
+	}
 
-		return []byte(a.secret), nil
-	})
+	cookies, session, err := a.GenerateTokensAndCreateCookie(&storage.User{Login: old.LoginOwner}, old.Family)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 
-	refreshParsed, err := jwt.ParseWithClaims(refresh, &claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, ErrSigningMethod
-		}
+	return cookies, old, session, nil
+}
 
-		return []byte(a.secret), nil
-	})
+// ParseAccessToken checks the access token and returns the user login
+func (a *Auth) ParseAccessToken(token string) (string, error) {
+	cl, err := a.parse(token, a.accessSecret, typeAccess)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
-	if accessParsed.Valid && refreshParsed.Valid {
-		return a.GenerateTokensAndCreateCookie(&storage.User{Login: login})
+	return cl.Name, nil
+}
+
+// ParseRefreshToken checks the refresh token and returns its session
+func (a *Auth) ParseRefreshToken(token string) (*storage.Session, error) {
+	cl, err := a.parse(token, a.refreshSecret, typeRefresh)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil, ErrTokenInvalid
+	return &storage.Session{
+		Id:         cl.Id,
+		Family:     cl.Family,
+		LoginOwner: cl.Name,
+		TokenHash:  HashToken(token),
+		ExpiresAt:  time.Unix(cl.ExpiresAt, 0),
+	}, nil
+}
+
+// HashToken returns a hash of the token for storing it in the database
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomID returns a random identifier
+func randomID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
 
+	return hex.EncodeToString(id), nil
 }
 
-func (a *Auth) ParseWithClaims(token string) (string, error) {
+// parse checks the token signature, expiration and type
+func (a *Auth) parse(token, secret, tokenType string) (*claims, error) {
 	tokenParsed, err := jwt.ParseWithClaims(token, &claims{}, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, ErrSigningMethod
 		}
 
-		return []byte(a.secret), nil
+		return []byte(secret), nil
 	})
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	claimsParsed, ok := tokenParsed.Claims.(*claims)
 	if !ok {
-		return "", ErrClaimsNotOfType
+		return nil, ErrClaimsNotOfType
 	}
 
 	if !tokenParsed.Valid {
-		return "", ErrTokenInvalid
+		return nil, ErrTokenInvalid
 	}
 
-	return claimsParsed.Name, nil
+	if claimsParsed.Type != tokenType {
+		return nil, ErrTokenType
+	}
+
+	return claimsParsed, nil
 
 }
 
-func (a *Auth) GenerateTokensAndCreateCookie(user *storage.User) ([]*http.Cookie, error) {
+// GenerateTokensAndCreateCookie generates a new pair of tokens and cookies for them.
+// An empty family starts a new one, e.g. on login.
+// The returned session describes the refresh token and must be stored
+func (a *Auth) GenerateTokensAndCreateCookie(user *storage.User, family string) ([]*http.Cookie, *storage.Session, error) {
 
 	var accessToken, refreshToken string
 	var err error
 
-	accessToken, err = a.generateAccessToken(user)
+	if family == "" {
+		family, err = randomID()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	session := &storage.Session{
+		Family:     family,
+		LoginOwner: user.Login,
+	}
+
+	session.Id, err = randomID()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	refreshToken, err = a.generateRefreshToken(user)
+	now := time.Now()
+	session.ExpiresAt = now.Add(refreshTTL)
+
+	accessToken, err = a.generateToken(&claims{
+		Name: user.Login,
+		Type: typeAccess,
+		StandardClaims: jwt.StandardClaims{
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(accessTTL).Unix(),
+		},
+	}, a.accessSecret)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	exp := time.Now()
+	refreshToken, err = a.generateToken(&claims{
+		Name:   user.Login,
+		Type:   typeRefresh,
+		Family: family,
+		StandardClaims: jwt.StandardClaims{
+			Id:        session.Id,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: session.ExpiresAt.Unix(),
+		},
+	}, a.refreshSecret)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	cookies := make([]*http.Cookie, 3)
-	cookies[0] = a.getUserCookie(user, exp)
-	cookies[1] = a.getAccessCookie(accessToken, exp)
-	cookies[2] = a.getRefreshCookie(refreshToken, exp)
+	session.TokenHash = HashToken(refreshToken)
 
-	return cookies, nil
+	cookies := make([]*http.Cookie, 2)
+	cookies[0] = a.getCookie(AccessCookie, accessToken, accessTTL)
+	cookies[1] = a.getCookie(RefreshCookie, refreshToken, refreshTTL)
 
-}
+	return cookies, session, nil
 
-// getRefreshCookie generate access cookie
-func (a *Auth) getRefreshCookie(token string, exp time.Time) *http.Cookie {
-	return &http.Cookie{
-		Name:    "Refresh-token",
-		Value:   token,
-		Expires: exp,
-	}
 }
 
-// getAccessCookie generate access cookie
-func (a *Auth) getAccessCookie(token string, exp time.Time) *http.Cookie {
-	return &http.Cookie{
-		Name:    "Accesses-token",
-		Value:   token,
-		Expires: exp,
+// ClearCookies returns cookies that remove the session cookies from the client
+func (a *Auth) ClearCookies() []*http.Cookie {
+	cookies := make([]*http.Cookie, 2)
+	cookies[0] = a.getCookie(AccessCookie, "", 0)
+	cookies[1] = a.getCookie(RefreshCookie, "", 0)
+
+	for _, cookie := range cookies {
+		cookie.MaxAge = -1
+		cookie.Expires = time.Unix(0, 0)
 	}
+
+	return cookies
 }
 
-// getUserCookie generate user cookie
-func (a *Auth) getUserCookie(user *storage.User, exp time.Time) *http.Cookie {
+// getCookie generate a session cookie
+func (a *Auth) getCookie(name, value string, ttl time.Duration) *http.Cookie {
 	return &http.Cookie{
-		Name:    "User",
-		Value:   user.Login,
-		Expires: exp,
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Expires:  time.Now().Add(ttl),
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
 	}
 }
 
 // generateToken generate user's jwt token
-func (a *Auth) generateToken(user *storage.User, exp time.Time) (string, error) {
-	cl := &claims{
-		Name: user.Login,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: exp.Unix(),
-		},
-	}
-
+func (a *Auth) generateToken(cl *claims, secret string) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, cl)
 
-	tokenString, err := token.SignedString([]byte(a.secret))
+	tokenString, err := token.SignedString([]byte(secret))
 	if err != nil {
 		return "", err
 	}
 
 	return tokenString, nil
 }
-
-// generateAccessToken generate user's jwt token
-func (a *Auth) generateAccessToken(user *storage.User) (string, error) {
-	exp := time.Now().Add(1 * time.Hour)
-
-	return a.generateToken(user, exp)
-}
-
-// generateRefreshToken generate user's jwt token
-func (a *Auth) generateRefreshToken(user *storage.User) (string, error) {
-
-	exp := time.Now().Add(24 * time.Hour)
-
-	return a.generateToken(user, exp)
-}
@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/EgorKo25/GophKeeper/internal/storage"
+)
+
+// cookieValue returns the value of the named cookie
+func cookieValue(t *testing.T, cookies []*http.Cookie, name string) string {
+	for _, cookie := range cookies {
+		if cookie.Name == name {
+			return cookie.Value
+		}
+	}
+
+	t.Fatalf("cookie %s not found", name)
+	return ""
+}
+
+func TestAuth_GenerateTokensAndCreateCookie(t *testing.T) {
+	a := NewAuth("some-access-secret", "some-refresh-secret")
+
+	cookies, _, err := a.GenerateTokensAndCreateCookie(&storage.User{Login: "testuser"}, "")
+	require.NoError(t, err)
+
+	for _, cookie := range cookies {
+		assert.True(t, cookie.HttpOnly, cookie.Name)
+		assert.True(t, cookie.Secure, cookie.Name)
+		assert.Equal(t, http.SameSiteStrictMode, cookie.SameSite, cookie.Name)
+		assert.True(t, cookie.Expires.After(time.Now()), cookie.Name)
+		assert.Positive(t, cookie.MaxAge, cookie.Name)
+	}
+
+	login, err := a.ParseAccessToken(cookieValue(t, cookies, AccessCookie))
+	require.NoError(t, err)
+	assert.Equal(t, "testuser", login)
+
+	session, err := a.ParseRefreshToken(cookieValue(t, cookies, RefreshCookie))
+	require.NoError(t, err)
+	assert.Equal(t, "testuser", session.LoginOwner)
+}
+
+func TestAuth_TokenTypes(t *testing.T) {
+	a := NewAuth("some-access-secret", "some-refresh-secret")
+
+	cookies, _, err := a.GenerateTokensAndCreateCookie(&storage.User{Login: "testuser"}, "")
+	require.NoError(t, err)
+
+	_, err = a.ParseAccessToken(cookieValue(t, cookies, RefreshCookie))
+	assert.Error(t, err)
+
+	_, err = a.ParseRefreshToken(cookieValue(t, cookies, AccessCookie))
+	assert.Error(t, err)
+
+	same := NewAuth("some-secret", "some-secret")
+
+	cookies, _, err = same.GenerateTokensAndCreateCookie(&storage.User{Login: "testuser"}, "")
+	require.NoError(t, err)
+
+	_, err = same.ParseAccessToken(cookieValue(t, cookies, RefreshCookie))
+	assert.ErrorIs(t, err, ErrTokenType)
+
+	_, err = same.ParseRefreshToken(cookieValue(t, cookies, AccessCookie))
+	assert.ErrorIs(t, err, ErrTokenType)
+}
+
+func TestAuth_RefreshTokens(t *testing.T) {
+	a := NewAuth("some-access-secret", "some-refresh-secret")
+
+	cookies, first, err := a.GenerateTokensAndCreateCookie(&storage.User{Login: "testuser"}, "")
+	require.NoError(t, err)
+	assert.Equal(t, HashToken(cookieValue(t, cookies, RefreshCookie)), first.TokenHash)
+
+	refreshed, old, next, err := a.RefreshTokens(cookieValue(t, cookies, RefreshCookie))
+	require.NoError(t, err)
+
+	assert.Equal(t, first.Id, old.Id)
+	assert.Equal(t, first.TokenHash, old.TokenHash)
+	assert.Equal(t, first.Family, next.Family)
+	assert.NotEqual(t, first.Id, next.Id)
+	assert.Equal(t, HashToken(cookieValue(t, refreshed, RefreshCookie)), next.TokenHash)
+
+	login, err := a.ParseAccessToken(cookieValue(t, refreshed, AccessCookie))
+	require.NoError(t, err)
+	assert.Equal(t, "testuser", login)
+
+	_, _, _, err = a.RefreshTokens(cookieValue(t, cookies, AccessCookie))
+	assert.Error(t, err)
+
+	other := NewAuth("other-access-secret", "other-refresh-secret")
+
+	_, _, _, err = other.RefreshTokens(cookieValue(t, cookies, RefreshCookie))
+	assert.Error(t, err)
+}
+
+func TestAuth_ClearCookies(t *testing.T) {
+	a := NewAuth("some-access-secret", "some-refresh-secret")
+
+	for _, cookie := range a.ClearCookies() {
+		assert.Empty(t, cookie.Value, cookie.Name)
+		assert.Negative(t, cookie.MaxAge, cookie.Name)
+	}
+}
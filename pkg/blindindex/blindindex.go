@@ -0,0 +1,166 @@
+// Package blindindex is a package for making the tokens of an encrypted search index.
+// The words of the names and tags are turned into tokens the client blinds with a keyed hash,
+// so the server matches a query without seeing the words: the prefixes of the words
+// find the incomplete words and the trigrams find the mistyped ones
+package blindindex
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	// MinPrefix and MaxPrefix limit the lengths of the indexed prefixes of a word
+	MinPrefix = 2
+	MaxPrefix = 16
+
+	// MaxWord is the length the words are cut to
+	MaxWord = 32
+
+	// MaxQuery is the number of the query tokens the server accepts
+	MaxQuery = 128
+)
+
+// Kinds of the tokens, a prefix never matches a trigram of the same letters
+const (
+	prefixToken  = "p:"
+	trigramToken = "t:"
+)
+
+// Words returns the normalized words of the texts: lower case letters and digits
+func Words(texts ...string) []string {
+
+	var words []string
+
+	for _, text := range texts {
+		text = strings.ReplaceAll(strings.ToLower(text), "ё", "е")
+
+		for _, word := range strings.FieldsFunc(text, isSeparator) {
+			if r := []rune(word); len(r) > MaxWord {
+				word = string(r[:MaxWord])
+			}
+			words = append(words, word)
+		}
+	}
+
+	return words
+}
+
+// isSeparator reports whether the rune separates the words
+func isSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// Tokens returns the tokens of the texts to index: the prefixes and the trigrams of their words
+func Tokens(texts ...string) []string {
+
+	var tokens tokenSet
+
+	for _, word := range Words(texts...) {
+		r := []rune(word)
+
+		if len(r) < MinPrefix {
+			tokens.add(prefixToken + word)
+		}
+		for n := MinPrefix; n <= len(r) && n <= MaxPrefix; n++ {
+			tokens.add(prefixToken + string(r[:n]))
+		}
+
+		for _, t := range trigrams(r) {
+			tokens.add(trigramToken + t)
+		}
+	}
+
+	return tokens.list
+}
+
+// Query returns the tokens of the search query: its words as prefixes and their trigrams.
+// The words beyond the limit of the tokens are dropped
+func Query(query string) []string {
+
+	var tokens tokenSet
+
+	for _, word := range Words(query) {
+		r := []rune(word)
+
+		prefix := r
+		if len(prefix) > MaxPrefix {
+			prefix = prefix[:MaxPrefix]
+		}
+
+		word := []string{prefixToken + string(prefix)}
+		for _, t := range trigrams(r) {
+			word = append(word, trigramToken+t)
+		}
+
+		if len(tokens.list)+len(word) > MaxQuery {
+			break
+		}
+
+		for _, t := range word {
+			tokens.add(t)
+		}
+	}
+
+	return tokens.list
+}
+
+// MinScore returns the number of the query tokens an item must have to be found,
+// it lets a word with a typo or two match
+func MinScore(query int) int {
+
+	if query < 4 {
+		return 1
+	}
+
+	return query / 4
+}
+
+// Score returns the number of the query tokens the index has
+func Score(index map[string]bool, query []string) int {
+
+	score := 0
+	for _, t := range query {
+		if index[t] {
+			score++
+		}
+	}
+
+	return score
+}
+
+// trigrams returns the trigrams of the word padded like in pg_trgm,
+// so the beginning of the word weighs more than its end
+func trigrams(word []rune) []string {
+
+	padded := append([]rune("  "), word...)
+	padded = append(padded, ' ')
+
+	res := make([]string, 0, len(padded)-2)
+	for i := 0; i+3 <= len(padded); i++ {
+		res = append(res, string(padded[i:i+3]))
+	}
+
+	return res
+}
+
+// tokenSet keeps the tokens in the order they are added without the repeated ones
+type tokenSet struct {
+	list []string
+	seen map[string]bool
+}
+
+// add adds the token unless it is already in the set
+func (s *tokenSet) add(token string) {
+
+	if s.seen == nil {
+		s.seen = make(map[string]bool)
+	}
+
+	if s.seen[token] {
+		return
+	}
+
+	s.seen[token] = true
+	s.list = append(s.list, token)
+}
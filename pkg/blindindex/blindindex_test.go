@@ -0,0 +1,65 @@
+package blindindex
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// found reports whether the item with the texts is found by the query
+func found(query string, texts ...string) bool {
+
+	index := make(map[string]bool)
+	for _, t := range Tokens(texts...) {
+		index[t] = true
+	}
+
+	tokens := Query(query)
+
+	return len(tokens) > 0 && Score(index, tokens) >= MinScore(len(tokens))
+}
+
+func TestWords(t *testing.T) {
+	assert.Equal(t, []string{"my", "bank", "еж", "2fa"}, Words("My  Bank-ЁЖ", "", "2FA!"))
+	assert.Len(t, []rune(Words(strings.Repeat("я", 40))[0]), MaxWord)
+}
+
+func TestTokens(t *testing.T) {
+	assert.Equal(t, []string{"p:a", "t:  a", "t: a "}, Tokens("A"))
+	assert.Equal(t, []string{"p:ab", "p:abc", "t:  a", "t: ab", "t:abc", "t:bc "}, Tokens("abc, ABC"))
+
+	// the prefixes are limited, the trigrams cover the whole word
+	tokens := Tokens(strings.Repeat("x", 20))
+	assert.Contains(t, tokens, "p:"+strings.Repeat("x", MaxPrefix))
+	assert.NotContains(t, tokens, "p:"+strings.Repeat("x", MaxPrefix+1))
+}
+
+func TestQuery(t *testing.T) {
+	assert.Equal(t, []string{"p:ba", "t:  b", "t: ba", "t:ba "}, Query("Ba"))
+	assert.Empty(t, Query(" - "))
+	assert.LessOrEqual(t, len(Query(strings.Repeat("longword ", 50))), MaxQuery)
+}
+
+func TestSearch(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		texts []string
+		found bool
+	}{
+		{name: "whole word", query: "bank", texts: []string{"My Bank"}, found: true},
+		{name: "prefix", query: "ban", texts: []string{"Banking"}, found: true},
+		{name: "typo", query: "yandx", texts: []string{"Yandex"}, found: true},
+		{name: "tag", query: "work", texts: []string{"Slack", "work, chat"}, found: true},
+		{name: "cyrillic", query: "ёлка", texts: []string{"Новогодняя елка"}, found: true},
+		{name: "other word", query: "github", texts: []string{"Yandex"}, found: false},
+		{name: "empty query", query: "", texts: []string{"Yandex"}, found: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.found, found(tt.query, tt.texts...))
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package mycrypto
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// ChunkOverhead is the number of bytes the encryption adds to a chunk of a file
+const ChunkOverhead = 1 + chacha20poly1305.NonceSizeX + chacha20poly1305.Overhead
+
+// FileCrypto is a struct for encrypting the chunks of one file with its own key.
+// The file key is stored encrypted with the vault key,
+// so a new master password doesn't require encrypting the chunks again
+type FileCrypto struct {
+	aead cipher.AEAD
+}
+
+// NewFileKey creates a random file key
+func NewFileKey() ([]byte, error) {
+	key := make([]byte, keyLen)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// NewFileCrypto is a constructor
+func NewFileCrypto(key []byte) (*FileCrypto, error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileCrypto{aead: aead}, nil
+}
+
+// EncryptChunk encrypts the n-th of total chunks of the file.
+// The position is authenticated, so the chunks can't be reordered, dropped or appended
+func (f *FileCrypto) EncryptChunk(plain []byte, n, total int) ([]byte, error) {
+	nonce := make([]byte, f.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, ChunkOverhead+len(plain))
+	out = append(out, versionXChaCha20Poly1305)
+	out = append(out, nonce...)
+
+	return f.aead.Seal(out, nonce, plain, chunkData(n, total)), nil
+}
+
+// DecryptChunk decrypts the n-th of total chunks of the file
+func (f *FileCrypto) DecryptChunk(sealed []byte, n, total int) ([]byte, error) {
+	if len(sealed) < ChunkOverhead {
+		return nil, ErrCiphertextShort
+	}
+
+	if sealed[0] != versionXChaCha20Poly1305 {
+		return nil, ErrUnknownVersion
+	}
+
+	nonce := sealed[1 : 1+f.aead.NonceSize()]
+
+	out, err := f.aead.Open(nil, nonce, sealed[1+f.aead.NonceSize():], chunkData(n, total))
+	if err != nil {
+		return nil, ErrAuthFailed
+	}
+
+	return out, nil
+}
+
+// chunkData returns the authenticated data of the chunk: the version byte and the position
+func chunkData(n, total int) []byte {
+	data := make([]byte, 0, 17)
+	data = append(data, versionXChaCha20Poly1305)
+	data = binary.BigEndian.AppendUint64(data, uint64(n))
+	data = binary.BigEndian.AppendUint64(data, uint64(total))
+
+	return data
+}
+
+// ContentCrypto is a struct for encrypting the chunks of all files of the user with the content key.
+// A chunk is addressed by its id, a keyed hash of its content, so the same chunk is stored once
+// while the ids of different users never match
+type ContentCrypto struct {
+	aead  cipher.AEAD
+	idKey []byte
+}
+
+// NewContentCrypto is a constructor, the key is made with NewFileKey
+func NewContentCrypto(key []byte) (*ContentCrypto, error) {
+	aead, err := chacha20poly1305.NewX(subKey(key, "chunk"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &ContentCrypto{
+		aead:  aead,
+		idKey: subKey(key, "chunk-id"),
+	}, nil
+}
+
+// ChunkID returns the id of the chunk with the content
+func (c *ContentCrypto) ChunkID(plain []byte) string {
+	mac := hmac.New(sha256.New, c.idKey)
+	mac.Write(plain)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// EncryptChunk encrypts the chunk, the id is authenticated
+func (c *ContentCrypto) EncryptChunk(plain []byte, id string) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, ChunkOverhead+len(plain))
+	out = append(out, versionXChaCha20Poly1305)
+	out = append(out, nonce...)
+
+	return c.aead.Seal(out, nonce, plain, contentData(id)), nil
+}
+
+// DecryptChunk decrypts the chunk and checks that its content has the id
+func (c *ContentCrypto) DecryptChunk(sealed []byte, id string) ([]byte, error) {
+	if len(sealed) < ChunkOverhead {
+		return nil, ErrCiphertextShort
+	}
+
+	if sealed[0] != versionXChaCha20Poly1305 {
+		return nil, ErrUnknownVersion
+	}
+
+	nonce := sealed[1 : 1+c.aead.NonceSize()]
+
+	out, err := c.aead.Open(nil, nonce, sealed[1+c.aead.NonceSize():], contentData(id))
+	if err != nil || !hmac.Equal([]byte(c.ChunkID(out)), []byte(id)) {
+		return nil, ErrAuthFailed
+	}
+
+	return out, nil
+}
+
+// Manifest returns the digest of the chunk ids of a file in order
+func Manifest(ids []string) string {
+	hash := sha256.New()
+	for _, id := range ids {
+		hash.Write([]byte(id))
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// contentData returns the authenticated data of the chunk: the version byte and the id
+func contentData(id string) []byte {
+	return append([]byte{versionXChaCha20Poly1305}, id...)
+}
@@ -0,0 +1,88 @@
+package mycrypto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileCrypto_Chunks(t *testing.T) {
+	key, err := NewFileKey()
+	require.NoError(t, err)
+
+	f, err := NewFileCrypto(key)
+	require.NoError(t, err)
+
+	sealed, err := f.EncryptChunk([]byte("chunk"), 1, 3)
+	require.NoError(t, err)
+	assert.Len(t, sealed, len("chunk")+ChunkOverhead)
+
+	plain, err := f.DecryptChunk(sealed, 1, 3)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("chunk"), plain)
+
+	empty, err := f.EncryptChunk(nil, 0, 1)
+	require.NoError(t, err)
+
+	plain, err = f.DecryptChunk(empty, 0, 1)
+	require.NoError(t, err)
+	assert.Empty(t, plain)
+
+	_, err = f.DecryptChunk(sealed, 0, 3)
+	assert.ErrorIs(t, err, ErrAuthFailed, "moved chunk")
+
+	_, err = f.DecryptChunk(sealed, 1, 2)
+	assert.ErrorIs(t, err, ErrAuthFailed, "truncated file")
+
+	_, err = f.DecryptChunk(sealed[:ChunkOverhead-1], 1, 3)
+	assert.ErrorIs(t, err, ErrCiphertextShort)
+
+	other, err := NewFileKey()
+	require.NoError(t, err)
+
+	g, err := NewFileCrypto(other)
+	require.NoError(t, err)
+
+	_, err = g.DecryptChunk(sealed, 1, 3)
+	assert.ErrorIs(t, err, ErrAuthFailed, "another file key")
+}
+
+func TestContentCrypto_Chunks(t *testing.T) {
+	key, err := NewFileKey()
+	require.NoError(t, err)
+
+	c, err := NewContentCrypto(key)
+	require.NoError(t, err)
+
+	id := c.ChunkID([]byte("chunk"))
+	assert.Len(t, id, 64)
+	assert.Equal(t, id, c.ChunkID([]byte("chunk")), "the same content has the same id")
+	assert.NotEqual(t, id, c.ChunkID([]byte("other")))
+
+	sealed, err := c.EncryptChunk([]byte("chunk"), id)
+	require.NoError(t, err)
+	assert.Len(t, sealed, len("chunk")+ChunkOverhead)
+
+	plain, err := c.DecryptChunk(sealed, id)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("chunk"), plain)
+
+	_, err = c.DecryptChunk(sealed, c.ChunkID([]byte("other")))
+	assert.ErrorIs(t, err, ErrAuthFailed, "chunk under another id")
+
+	other, err := NewFileKey()
+	require.NoError(t, err)
+
+	d, err := NewContentCrypto(other)
+	require.NoError(t, err)
+	assert.NotEqual(t, id, d.ChunkID([]byte("chunk")), "ids of another user")
+
+	forged, err := d.EncryptChunk([]byte("forged"), id)
+	require.NoError(t, err)
+
+	_, err = c.DecryptChunk(forged, id)
+	assert.ErrorIs(t, err, ErrAuthFailed, "another content key")
+
+	assert.NotEqual(t, Manifest([]string{"a", "b"}), Manifest([]string{"b", "a"}))
+}
@@ -1,46 +1,218 @@
+// Package mycrypto is a package for client side encryption of user data
 package mycrypto
 
 import (
 	"bytes"
+	"crypto/cipher"
 	"crypto/des"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
 	"errors"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	// versionXChaCha20Poly1305 is the header byte of an XChaCha20-Poly1305 envelope
+	versionXChaCha20Poly1305 byte = 0x01
+
+	// envelopePrefix marks the text form of an envelope.
+	// Legacy DES blobs are plain hex and never start with it.
+	envelopePrefix = "$"
+
+	// verifierText is a known plaintext for checking the master password
+	verifierText = "gophkeeper-key-check"
+
+	// Default Argon2id parameters for new vaults
+	DefaultTime    uint32 = 3
+	DefaultMemory  uint32 = 64 * 1024
+	DefaultThreads uint8  = 4
+
+	saltLen = 16
+	keyLen  = 32
+
+	// blindLen is the length of the blind index hashes
+	blindLen = 16
+)
+
+var (
+	ErrCiphertextShort = errors.New("ciphertext too short")
+	ErrUnknownVersion  = errors.New("unknown ciphertext version")
+	ErrAuthFailed      = errors.New("message authentication failed")
+	ErrWrongPassword   = errors.New("wrong master password")
 )
 
+// KeyParams is a set of Argon2id parameters the vault key is derived with
+type KeyParams struct {
+	Salt    []byte
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+}
+
+// NewKeyParams creates default parameters with a random salt
+func NewKeyParams() (*KeyParams, error) {
+	salt := make([]byte, saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	return &KeyParams{
+		Salt:    salt,
+		Time:    DefaultTime,
+		Memory:  DefaultMemory,
+		Threads: DefaultThreads,
+	}, nil
+}
+
+// Outdated reports whether the parameters are weaker than the current defaults
+func (p *KeyParams) Outdated() bool {
+	return p.Time < DefaultTime || p.Memory < DefaultMemory || len(p.Salt) < saltLen
+}
+
+// Crypto is a struct for encrypting and decrypting user data
 type Crypto struct {
+	aead     cipher.AEAD
+	nonceKey []byte
+	indexKey []byte
+
+	// secret is a raw DES key, it is used only for reading legacy blobs
 	secret []byte
 }
 
-func NewCrypto(secret string) (*Crypto, error) {
-	sec := Crypto{
-		secret: []byte(secret),
+// NewCrypto is a constructor, it derives the vault key from the master password
+func NewCrypto(secret string, params *KeyParams) (*Crypto, error) {
+	if params == nil || len(params.Salt) == 0 || params.Time == 0 || params.Threads == 0 {
+		return nil, errors.New("invalid key derivation parameters")
+	}
+
+	key := argon2.IDKey([]byte(secret), params.Salt, params.Time, params.Memory, params.Threads, keyLen)
+
+	return newCrypto(key, []byte(secret))
+}
+
+// newCrypto creates Crypto from the master key
+func newCrypto(master, legacy []byte) (*Crypto, error) {
+	aead, err := chacha20poly1305.NewX(subKey(master, "encryption"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Crypto{
+		aead:     aead,
+		nonceKey: subKey(master, "nonce"),
+		indexKey: subKey(master, "index"),
+		secret:   legacy,
+	}, nil
+}
+
+// subKey derives an independent key for the given purpose from the master key
+func subKey(master []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, master)
+	mac.Write([]byte("gophkeeper/" + purpose))
+	return mac.Sum(nil)
+}
+
+// Verifier returns a value for checking the master password later with Verify
+func (c *Crypto) Verifier() (string, error) {
+	return c.Encrypt(verifierText)
+}
+
+// Verify checks that the verifier was made with the same key
+func (c *Crypto) Verify(check string) error {
+	text, err := c.Decrypt(check)
+	if err != nil || text != verifierText {
+		return ErrWrongPassword
 	}
 
-	return &sec, nil
+	return nil
 }
 
+// Encrypt encrypts text with a random nonce,
+// so equal texts produce different ciphertexts
 func (c *Crypto) Encrypt(text string) (string, error) {
-	src := []byte(text)
-	block, err := des.NewCipher(c.secret)
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return c.seal(nonce, []byte(text)), nil
+}
+
+// EncryptDeterministic encrypts text with a nonce derived from the text itself.
+// Equal texts produce equal ciphertexts, so it must be used only
+// for the values matched by their ciphertext, like the fingerprints of the uploads
+func (c *Crypto) EncryptDeterministic(text string) (string, error) {
+	mac := hmac.New(sha256.New, c.nonceKey)
+	mac.Write([]byte(text))
+	nonce := mac.Sum(nil)[:c.aead.NonceSize()]
+
+	return c.seal(nonce, []byte(text)), nil
+}
+
+// BlindIndex returns the keyed hash of the search token.
+// Equal tokens give equal hashes, so the server matches them without learning the tokens
+func (c *Crypto) BlindIndex(token string) string {
+	mac := hmac.New(sha256.New, c.indexKey)
+	mac.Write([]byte(token))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:blindLen])
+}
+
+// seal builds the envelope: version byte, nonce and sealed text
+func (c *Crypto) seal(nonce, plain []byte) string {
+	header := []byte{versionXChaCha20Poly1305}
+
+	out := make([]byte, 0, len(header)+len(nonce)+len(plain)+c.aead.Overhead())
+	out = append(out, header...)
+	out = append(out, nonce...)
+	out = c.aead.Seal(out, nonce, plain, header)
+
+	return envelopePrefix + base64.RawURLEncoding.EncodeToString(out)
+}
+
+// IsEnvelope reports whether the text is a value encrypted with Encrypt or EncryptDeterministic
+func IsEnvelope(text string) bool {
+	return strings.HasPrefix(text, envelopePrefix)
+}
+
+// Decrypt decrypts text produced by Encrypt, EncryptDeterministic
+// or by the legacy DES implementation
+func (c *Crypto) Decrypt(decrypted string) (string, error) {
+	if !strings.HasPrefix(decrypted, envelopePrefix) {
+		return c.decryptLegacy(decrypted)
+	}
+
+	src, err := base64.RawURLEncoding.DecodeString(decrypted[len(envelopePrefix):])
 	if err != nil {
 		return "", err
 	}
-	bs := block.BlockSize()
-	src = zeroPadding(src, bs)
-	if len(src)%bs != 0 {
-		return "", errors.New("need a multiple of the blocksize")
+
+	if len(src) < 1+c.aead.NonceSize()+c.aead.Overhead() {
+		return "", ErrCiphertextShort
 	}
-	out := make([]byte, len(src))
-	dst := out
-	for len(src) > 0 {
-		block.Encrypt(dst, src[:bs])
-		src = src[bs:]
-		dst = dst[bs:]
+
+	if src[0] != versionXChaCha20Poly1305 {
+		return "", ErrUnknownVersion
 	}
-	return hex.EncodeToString(out), nil
+
+	header, nonce, sealed := src[:1], src[1:1+c.aead.NonceSize()], src[1+c.aead.NonceSize():]
+
+	out, err := c.aead.Open(nil, nonce, sealed, header)
+	if err != nil {
+		return "", ErrAuthFailed
+	}
+
+	return string(out), nil
 }
 
-func (c *Crypto) Decrypt(decrypted string) (string, error) {
+// decryptLegacy decrypts hex blobs encrypted by DES in ECB mode with zero padding
+func (c *Crypto) decryptLegacy(decrypted string) (string, error) {
 	src, err := hex.DecodeString(decrypted)
 	if err != nil {
 		return "", err
@@ -65,6 +237,22 @@ func (c *Crypto) Decrypt(decrypted string) (string, error) {
 
 }
 
+// LegacyEncrypt encrypts text like the old DES clients did, the secret is the raw 8 byte key.
+// It is used only to find the accounts they registered, the data is never encrypted with it
+func LegacyEncrypt(secret, text string) (string, error) {
+	block, err := des.NewCipher([]byte(secret))
+	if err != nil {
+		return "", err
+	}
+	bs := block.BlockSize()
+	src := zeroPadding([]byte(text), bs)
+	out := make([]byte, len(src))
+	for i := 0; i < len(src); i += bs {
+		block.Encrypt(out[i:i+bs], src[i:i+bs])
+	}
+	return hex.EncodeToString(out), nil
+}
+
 func zeroPadding(ciphertext []byte, blockSize int) []byte {
 	padding := blockSize - len(ciphertext)%blockSize
 	padtext := bytes.Repeat([]byte{0}, padding)
@@ -0,0 +1,199 @@
+package mycrypto
+
+import (
+	"bytes"
+	"crypto/des"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testParams are cheap key derivation parameters for tests
+var testParams = &KeyParams{
+	Salt:    []byte("0123456789abcdef"),
+	Time:    1,
+	Memory:  1024,
+	Threads: 1,
+}
+
+// legacyEncrypt is the DES implementation the old clients used
+func legacyEncrypt(t *testing.T, secret, text string) string {
+	block, err := des.NewCipher([]byte(secret))
+	require.NoError(t, err)
+
+	bs := block.BlockSize()
+	src := []byte(text)
+	src = append(src, bytes.Repeat([]byte{0}, bs-len(src)%bs)...)
+
+	out := make([]byte, len(src))
+	for i := 0; i < len(src); i += bs {
+		block.Encrypt(out[i:i+bs], src[i:i+bs])
+	}
+
+	return hex.EncodeToString(out)
+}
+
+func TestCrypto_EncryptDecrypt(t *testing.T) {
+	c, err := NewCrypto("some-sec", testParams)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		text string
+	}{
+		{name: "empty", text: ""},
+		{name: "text", text: "testpassword"},
+		{name: "trailing zero bytes", text: "binary\x00data\x00\x00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc, err := c.Encrypt(tt.text)
+			require.NoError(t, err)
+
+			dec, err := c.Decrypt(enc)
+			require.NoError(t, err)
+			assert.Equal(t, tt.text, dec)
+		})
+	}
+}
+
+func TestCrypto_Encrypt_Randomized(t *testing.T) {
+	c, err := NewCrypto("some-sec", testParams)
+	require.NoError(t, err)
+
+	first, err := c.Encrypt("testpassword")
+	require.NoError(t, err)
+
+	second, err := c.Encrypt("testpassword")
+	require.NoError(t, err)
+
+	assert.NotEqual(t, first, second)
+
+	assert.True(t, IsEnvelope(first))
+	assert.False(t, IsEnvelope("testpassword"))
+	assert.False(t, IsEnvelope(legacyEncrypt(t, "some-sec", "testpassword")))
+}
+
+func TestCrypto_EncryptDeterministic(t *testing.T) {
+	c, err := NewCrypto("some-sec", testParams)
+	require.NoError(t, err)
+
+	first, err := c.EncryptDeterministic("yandex")
+	require.NoError(t, err)
+
+	second, err := c.EncryptDeterministic("yandex")
+	require.NoError(t, err)
+
+	other, err := c.EncryptDeterministic("google")
+	require.NoError(t, err)
+
+	assert.Equal(t, first, second)
+	assert.NotEqual(t, first, other)
+
+	dec, err := c.Decrypt(first)
+	require.NoError(t, err)
+	assert.Equal(t, "yandex", dec)
+}
+
+func TestCrypto_BlindIndex(t *testing.T) {
+	c, err := NewCrypto("some-sec", testParams)
+	require.NoError(t, err)
+
+	other, err := NewCrypto("other-sec", testParams)
+	require.NoError(t, err)
+
+	token := c.BlindIndex("p:yandex")
+
+	assert.Len(t, token, 22)
+	assert.Equal(t, token, c.BlindIndex("p:yandex"))
+	assert.NotEqual(t, token, c.BlindIndex("p:google"))
+	assert.NotEqual(t, token, other.BlindIndex("p:yandex"))
+
+	// the index key is independent of the deterministic encryption of the same text
+	det, err := c.EncryptDeterministic("p:yandex")
+	require.NoError(t, err)
+	assert.NotContains(t, det, token)
+}
+
+func TestCrypto_Decrypt_Legacy(t *testing.T) {
+	c, err := NewCrypto("some-sec", testParams)
+	require.NoError(t, err)
+
+	dec, err := c.Decrypt(legacyEncrypt(t, "some-sec", "testpassword"))
+	require.NoError(t, err)
+	assert.Equal(t, "testpassword", dec)
+}
+
+func TestLegacyEncrypt(t *testing.T) {
+	enc, err := LegacyEncrypt("some-sec", "testpassword")
+	require.NoError(t, err)
+	assert.Equal(t, legacyEncrypt(t, "some-sec", "testpassword"), enc)
+
+	_, err = LegacyEncrypt("a passphrase", "testpassword")
+	assert.Error(t, err, "not a DES key")
+}
+
+func TestCrypto_Decrypt_Errors(t *testing.T) {
+	c, err := NewCrypto("some-sec", testParams)
+	require.NoError(t, err)
+
+	other, err := NewCrypto("another-secret", testParams)
+	require.NoError(t, err)
+
+	enc, err := c.Encrypt("testpassword")
+	require.NoError(t, err)
+
+	_, err = other.Decrypt(enc)
+	assert.ErrorIs(t, err, ErrAuthFailed)
+
+	tampered := []byte(enc)
+	if i := len(tampered) / 2; tampered[i] == 'A' {
+		tampered[i] = 'B'
+	} else {
+		tampered[i] = 'A'
+	}
+	_, err = c.Decrypt(string(tampered))
+	assert.ErrorIs(t, err, ErrAuthFailed)
+
+	_, err = c.Decrypt(envelopePrefix + "AAAA")
+	assert.ErrorIs(t, err, ErrCiphertextShort)
+}
+
+func TestCrypto_Verify(t *testing.T) {
+	c, err := NewCrypto("some-sec", testParams)
+	require.NoError(t, err)
+
+	check, err := c.Verifier()
+	require.NoError(t, err)
+
+	same, err := NewCrypto("some-sec", testParams)
+	require.NoError(t, err)
+	assert.NoError(t, same.Verify(check))
+
+	wrong, err := NewCrypto("wrong-sec", testParams)
+	require.NoError(t, err)
+	assert.ErrorIs(t, wrong.Verify(check), ErrWrongPassword)
+
+	otherSalt := *testParams
+	otherSalt.Salt = []byte("fedcba9876543210")
+	salted, err := NewCrypto("some-sec", &otherSalt)
+	require.NoError(t, err)
+	assert.ErrorIs(t, salted.Verify(check), ErrWrongPassword)
+}
+
+func TestNewKeyParams(t *testing.T) {
+	first, err := NewKeyParams()
+	require.NoError(t, err)
+
+	second, err := NewKeyParams()
+	require.NoError(t, err)
+
+	assert.NotEqual(t, first.Salt, second.Salt)
+	assert.False(t, first.Outdated())
+	assert.True(t, testParams.Outdated())
+
+	_, err = NewCrypto("some-sec", &KeyParams{})
+	assert.Error(t, err)
+}
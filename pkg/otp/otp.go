@@ -0,0 +1,237 @@
+// Package otp is a package for generating one-time passwords of the authenticator apps (RFC 4226, RFC 6238)
+package otp
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// TypeTOTP is a key generating codes by the time
+	TypeTOTP = "totp"
+	// TypeHOTP is a key generating codes by the counter
+	TypeHOTP = "hotp"
+
+	// Default parameters of the keys, the authenticator apps assume them when the URI omits them
+	DefaultAlgorithm = "SHA1"
+	DefaultDigits    = 6
+	DefaultPeriod    = 30
+
+	scheme = "otpauth"
+)
+
+var (
+	ErrInvalidURI       = errors.New("invalid otpauth uri")
+	ErrInvalidSecret    = errors.New("invalid otp secret")
+	ErrUnknownType      = errors.New("unknown otp type")
+	ErrUnknownAlgorithm = errors.New("unknown otp algorithm")
+	ErrInvalidDigits    = errors.New("otp digits must be from 6 to 8")
+	ErrInvalidPeriod    = errors.New("otp period must be positive")
+)
+
+// algorithms are the hash functions of the keys
+var algorithms = map[string]func() hash.Hash{
+	"SHA1":   sha1.New,
+	"SHA256": sha256.New,
+	"SHA512": sha512.New,
+}
+
+// Key is a shared secret with the parameters of the codes
+type Key struct {
+	Type      string
+	Issuer    string
+	Account   string
+	Secret    []byte
+	Algorithm string
+	Digits    int
+	Period    int
+	Counter   uint64
+}
+
+// NewKey creates a key of the type with the default parameters from the base32 secret
+func NewKey(typ, secret string) (*Key, error) {
+
+	raw, err := decodeSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &Key{
+		Type:      typ,
+		Secret:    raw,
+		Algorithm: DefaultAlgorithm,
+		Digits:    DefaultDigits,
+		Period:    DefaultPeriod,
+	}
+
+	return key, key.Validate()
+}
+
+// Parse reads the key from the otpauth:// URI of the QR code
+func Parse(uri string) (*Key, error) {
+
+	u, err := url.Parse(strings.TrimSpace(uri))
+	if err != nil || u.Scheme != scheme {
+		return nil, ErrInvalidURI
+	}
+
+	q := u.Query()
+
+	key := &Key{
+		Type:      strings.ToLower(u.Host),
+		Algorithm: strings.ToUpper(q.Get("algorithm")),
+		Digits:    DefaultDigits,
+		Period:    DefaultPeriod,
+	}
+
+	if key.Algorithm == "" {
+		key.Algorithm = DefaultAlgorithm
+	}
+
+	key.Secret, err = decodeSecret(q.Get("secret"))
+	if err != nil {
+		return nil, err
+	}
+
+	// the label is "issuer:account", the issuer parameter takes precedence
+	label := strings.TrimPrefix(u.Path, "/")
+	if issuer, account, ok := strings.Cut(label, ":"); ok {
+		key.Issuer, key.Account = strings.TrimSpace(issuer), strings.TrimSpace(account)
+	} else {
+		key.Account = label
+	}
+	if issuer := q.Get("issuer"); issuer != "" {
+		key.Issuer = issuer
+	}
+
+	for name, dst := range map[string]*int{"digits": &key.Digits, "period": &key.Period} {
+		if v := q.Get(name); v != "" {
+			*dst, err = strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidURI, name)
+			}
+		}
+	}
+
+	if v := q.Get("counter"); v != "" {
+		key.Counter, err = strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: counter", ErrInvalidURI)
+		}
+	}
+
+	return key, key.Validate()
+}
+
+// Validate checks the parameters of the key
+func (k *Key) Validate() error {
+
+	switch {
+	case k.Type != TypeTOTP && k.Type != TypeHOTP:
+		return ErrUnknownType
+	case len(k.Secret) == 0:
+		return ErrInvalidSecret
+	case algorithms[k.Algorithm] == nil:
+		return ErrUnknownAlgorithm
+	case k.Digits < 6 || k.Digits > 8:
+		return ErrInvalidDigits
+	case k.Type == TypeTOTP && k.Period <= 0:
+		return ErrInvalidPeriod
+	}
+
+	return nil
+}
+
+// URI returns the otpauth:// URI of the key
+func (k *Key) URI() string {
+
+	q := url.Values{}
+	q.Set("secret", strings.TrimRight(base32.StdEncoding.EncodeToString(k.Secret), "="))
+	q.Set("algorithm", k.Algorithm)
+	q.Set("digits", strconv.Itoa(k.Digits))
+
+	if k.Issuer != "" {
+		q.Set("issuer", k.Issuer)
+	}
+
+	if k.Type == TypeHOTP {
+		q.Set("counter", strconv.FormatUint(k.Counter, 10))
+	} else {
+		q.Set("period", strconv.Itoa(k.Period))
+	}
+
+	label := k.Account
+	if k.Issuer != "" {
+		label = k.Issuer + ":" + k.Account
+	}
+
+	u := url.URL{Scheme: scheme, Host: k.Type, Path: "/" + label, RawQuery: q.Encode()}
+
+	return u.String()
+}
+
+// Code returns the code of the key at the time, a counter-based key uses its counter
+func (k *Key) Code(t time.Time) string {
+
+	counter := k.Counter
+	if k.Type == TypeTOTP {
+		counter = uint64(t.Unix() / int64(k.Period))
+	}
+
+	return k.code(counter)
+}
+
+// Remaining returns the time the code of the time-based key is valid for
+func (k *Key) Remaining(t time.Time) time.Duration {
+
+	period := time.Duration(k.Period) * time.Second
+
+	return period - time.Duration(t.UnixNano())%period
+}
+
+// code computes the HOTP value of the counter
+func (k *Key) code(counter uint64) string {
+
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+
+	mac := hmac.New(algorithms[k.Algorithm], k.Secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// dynamic truncation
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < k.Digits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", k.Digits, value%mod)
+}
+
+// decodeSecret decodes the base32 secret, the authenticator apps show it in groups without padding
+func decodeSecret(secret string) ([]byte, error) {
+
+	secret = strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(secret))
+	secret = strings.TrimRight(secret, "=")
+
+	raw, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil || len(raw) == 0 {
+		return nil, ErrInvalidSecret
+	}
+
+	return raw, nil
+}
@@ -0,0 +1,100 @@
+package otp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKey_Code(t *testing.T) {
+	// test vectors of RFC 6238, the secret is repeated to the size of the hash
+	secrets := map[string][]byte{
+		"SHA1":   []byte("12345678901234567890"),
+		"SHA256": []byte("12345678901234567890123456789012"),
+		"SHA512": []byte("1234567890123456789012345678901234567890123456789012345678901234"),
+	}
+
+	tests := []struct {
+		unix  int64
+		codes map[string]string
+	}{
+		{59, map[string]string{"SHA1": "94287082", "SHA256": "46119246", "SHA512": "90693936"}},
+		{1111111109, map[string]string{"SHA1": "07081804", "SHA256": "68084774", "SHA512": "25091201"}},
+		{2000000000, map[string]string{"SHA1": "69279037", "SHA256": "90698825", "SHA512": "38618901"}},
+	}
+
+	for _, tt := range tests {
+		for alg, code := range tt.codes {
+			key := Key{Type: TypeTOTP, Secret: secrets[alg], Algorithm: alg, Digits: 8, Period: 30}
+			require.NoError(t, key.Validate())
+			assert.Equal(t, code, key.Code(time.Unix(tt.unix, 0)), "%s at %d", alg, tt.unix)
+		}
+	}
+
+	// test vectors of RFC 4226
+	key := Key{Type: TypeHOTP, Secret: secrets["SHA1"], Algorithm: "SHA1", Digits: 6}
+	for counter, code := range []string{"755224", "287082", "359152", "969429", "338314"} {
+		key.Counter = uint64(counter)
+		assert.Equal(t, code, key.Code(time.Now()))
+	}
+}
+
+func TestKey_Remaining(t *testing.T) {
+	key := Key{Type: TypeTOTP, Period: 30}
+
+	assert.Equal(t, 30*time.Second, key.Remaining(time.Unix(60, 0)))
+	assert.Equal(t, time.Second, key.Remaining(time.Unix(89, 0)))
+}
+
+func TestParse(t *testing.T) {
+	key, err := Parse("otpauth://totp/Example:alice@google.com?secret=JBSW Y3DP EHPK 3PXP&issuer=Example")
+	require.NoError(t, err)
+	assert.Equal(t, &Key{
+		Type:      TypeTOTP,
+		Issuer:    "Example",
+		Account:   "alice@google.com",
+		Secret:    []byte("Hello!\xde\xad\xbe\xef"),
+		Algorithm: "SHA1",
+		Digits:    6,
+		Period:    30,
+	}, key)
+
+	key, err = Parse("otpauth://hotp/bob?secret=jbswy3dpehpk3pxp&algorithm=sha256&digits=8&counter=7")
+	require.NoError(t, err)
+	assert.Equal(t, TypeHOTP, key.Type)
+	assert.Equal(t, "bob", key.Account)
+	assert.Equal(t, "SHA256", key.Algorithm)
+	assert.Equal(t, 8, key.Digits)
+	assert.Equal(t, uint64(7), key.Counter)
+
+	// the URI of the key is read back to the same key
+	again, err := Parse(key.URI())
+	require.NoError(t, err)
+	assert.Equal(t, key, again)
+
+	for uri, expected := range map[string]error{
+		"https://totp/bob?secret=JBSWY3DPEHPK3PXP":               ErrInvalidURI,
+		"otpauth://totp/bob?secret=1":                            ErrInvalidSecret,
+		"otpauth://totp/bob":                                     ErrInvalidSecret,
+		"otpauth://motp/bob?secret=JBSWY3DPEHPK3PXP":             ErrUnknownType,
+		"otpauth://totp/bob?secret=JBSWY3DPEHPK3PXP&algorithm=M": ErrUnknownAlgorithm,
+		"otpauth://totp/bob?secret=JBSWY3DPEHPK3PXP&digits=4":    ErrInvalidDigits,
+		"otpauth://totp/bob?secret=JBSWY3DPEHPK3PXP&period=0":    ErrInvalidPeriod,
+		"otpauth://totp/bob?secret=JBSWY3DPEHPK3PXP&period=x":    ErrInvalidURI,
+	} {
+		_, err = Parse(uri)
+		assert.ErrorIs(t, err, expected, uri)
+	}
+}
+
+func TestNewKey(t *testing.T) {
+	key, err := NewKey(TypeTOTP, "jbsw y3dp ehpk 3pxp")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("Hello!\xde\xad\xbe\xef"), key.Secret)
+	assert.Equal(t, DefaultPeriod, key.Period)
+
+	_, err = NewKey("motp", "JBSWY3DPEHPK3PXP")
+	assert.ErrorIs(t, err, ErrUnknownType)
+}